@@ -0,0 +1,113 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"time"
+
+	"tchaik.com/player"
+	"tchaik.com/player/airplay"
+	"tchaik.com/player/cast"
+)
+
+const (
+	airplayDiscoverTimeout  = 5 * time.Second
+	airplayDiscoverInterval = time.Minute
+
+	// airplayMissingLimit is the number of consecutive discoveries a receiver can be
+	// missing from before its player is removed (mDNS responses are easily lost).
+	airplayMissingLimit = 3
+)
+
+// airplayQueue is an airplay.Queue which uses a cursor as the source of tracks (see
+// castQueue).
+type airplayQueue struct {
+	castQueue
+}
+
+func airplayTrack(t cast.Track, err error) (airplay.Track, error) {
+	if err != nil {
+		return airplay.Track{}, err
+	}
+	return airplay.Track{ID: t.ID, URL: t.URL}, nil
+}
+
+// Current implements airplay.Queue.
+func (q airplayQueue) Current() (airplay.Track, error) { return airplayTrack(q.castQueue.Current()) }
+
+// Next implements airplay.Queue.
+func (q airplayQueue) Next() (airplay.Track, error) { return airplayTrack(q.castQueue.Next()) }
+
+// Prev implements airplay.Queue.
+func (q airplayQueue) Prev() (airplay.Track, error) { return airplayTrack(q.castQueue.Prev()) }
+
+// discoverAirPlayPlayers periodically searches for AirPlay receivers on the local network,
+// adding a player for each new receiver found and removing the players of receivers which
+// have disappeared.  Players are identified by the receiver name.
+func discoverAirPlayPlayers(p *player.Players, l *sharedLibrary, m *Meta) {
+	q := airplayQueue{castQueue{
+		libs: l,
+		meta: m,
+		name: castCursor,
+		url:  airplayURL,
+	}}
+
+	players := make(map[string]*airplay.Player)
+	missing := make(map[string]int)
+	for {
+		devices, err := airplay.Discover(airplayDiscoverTimeout)
+		if err != nil {
+			log.Printf("error discovering airplay receivers: %v", err)
+			time.Sleep(airplayDiscoverInterval)
+			continue
+		}
+
+		found := make(map[string]bool, len(devices))
+		for _, d := range devices {
+			key := d.Name
+			found[key] = true
+			if _, ok := players[key]; ok || p.Get(key) != nil {
+				continue
+			}
+
+			ap := airplay.New(key, d.Addr, q, func(st player.Status) {
+				p.SetStatus(key, st)
+				m.prefetchNext(l.Get(), key, st)
+				if t, ok := l.Track(st.TrackID); ok && st.Playing {
+					m.scrobbler.Update(key, t, st.Time)
+				}
+			})
+			if err := ap.Connect(); err != nil {
+				log.Printf("error connecting to airplay receiver %#v: %v", key, err)
+				continue
+			}
+			if err := p.Add(ap); err != nil {
+				log.Printf("error adding airplay receiver %#v: %v", key, err)
+				ap.Close()
+				continue
+			}
+			players[key] = ap
+		}
+
+		for key, ap := range players {
+			if found[key] {
+				delete(missing, key)
+				continue
+			}
+			missing[key]++
+			if missing[key] < airplayMissingLimit {
+				continue
+			}
+			ap.Close()
+			if p.Get(key) == player.Player(ap) {
+				p.Remove(key)
+			}
+			delete(players, key)
+			delete(missing, key)
+		}
+		time.Sleep(airplayDiscoverInterval)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+)
+
+// collectionHandler is an http.Handler which responds to GET requests with the same
+// representation of a Group as the FETCH websocket action.  The Path of the Group is
+// given by the segments of the request path, i.e. /Root/<key>/...
+type collectionHandler struct {
+	libs *sharedLibrary
+	meta *Meta
+}
+
+// ServeHTTP implements http.Handler.
+func (h collectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var p index.Path
+	for _, s := range strings.Split(strings.Trim(r.URL.Path, "/"), "/") {
+		if s != "" {
+			p = append(p, index.Key(s))
+		}
+	}
+	if len(p) == 0 {
+		p = index.Path{index.Key(defaultCollection)}
+	}
+
+	user, err := requestUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	m, err := h.meta.ForUser(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lib := h.libs.Get()
+	c, err := fetchCollection(context.Background(), &lib, m, p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	_, err = w.Write(b)
+	if err != nil {
+		log.Printf("error writing response: %v", err)
+	}
+}
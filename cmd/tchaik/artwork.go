@@ -0,0 +1,122 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	_ "image/jpeg" // register image formats for artwork
+	_ "image/png"
+	"log"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+	"tchaik.com/store"
+	"tchaik.com/store/cafs"
+)
+
+// artworkThumbnailSize is the maximum width/height (in pixels) of thumbnails served from
+// the /thumbnail/ endpoint.
+const artworkThumbnailSize = 300
+
+// artworkInfo is information about the artwork of a track.
+type artworkInfo struct {
+	Width, Height int
+}
+
+// artworkCache reads (and caches) artwork information for tracks.
+type artworkCache struct {
+	fs store.FileSystem
+
+	sync.Mutex
+	m map[string]*artworkInfo
+}
+
+func newArtworkCache(fs store.FileSystem) *artworkCache {
+	return &artworkCache{
+		fs: fs,
+		m:  make(map[string]*artworkInfo),
+	}
+}
+
+// Get returns the artwork information for the track with the given ID, or nil if the track
+// has no artwork.
+func (a *artworkCache) Get(id string) *artworkInfo {
+	a.Lock()
+	info, ok := a.m[id]
+	a.Unlock()
+	if ok {
+		return info
+	}
+
+	info, err := a.read(id)
+	if err != nil {
+		info = nil
+	}
+
+	a.Lock()
+	a.m[id] = info
+	a.Unlock()
+	return info
+}
+
+func (a *artworkCache) read(id string) (*artworkInfo, error) {
+	f, err := a.fs.Open(context.Background(), "/"+id)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	return &artworkInfo{
+		Width:  cfg.Width,
+		Height: cfg.Height,
+	}, nil
+}
+
+// setArtwork sets the artwork fields of h using the artwork of the first track in g.  The
+// fields are left empty if the track has no artwork.
+func (h *group) setArtwork(g index.Group, artwork func(string) *artworkInfo) {
+	id, ok := index.FirstTrackAttr(attr.String("ID"), g).Field("ID").(string)
+	if !ok {
+		return
+	}
+	info := artwork(id)
+	if info == nil {
+		return
+	}
+	h.ArtworkURL = "/artwork/" + id
+	h.ThumbnailURL = "/thumbnail/" + id
+	h.ArtworkWidth = info.Width
+	h.ArtworkHeight = info.Height
+}
+
+// thumbnailFileSystem returns a FileSystem which serves resized artwork.  If path is non-empty
+// then resized images are cached in a content addressable store rooted there.
+func thumbnailFileSystem(artwork store.FileSystem, path string) store.FileSystem {
+	fs := store.ThumbnailFileSystem(artwork, artworkThumbnailSize)
+	if path == "" {
+		return fs
+	}
+
+	cfs, err := cafs.New(store.Dir(path))
+	if err != nil {
+		log.Printf("error creating thumbnail cache (thumbnails will not be cached): %v", err)
+		return fs
+	}
+
+	fs, errCh := cafs.NewCachedFileSystem(fs, cfs)
+	go func() {
+		for err := range errCh {
+			log.Printf("thumbnail cache: %v", err)
+		}
+	}()
+	return fs
+}
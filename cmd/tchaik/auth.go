@@ -0,0 +1,69 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requestToken returns the token of the request, given either as a bearer token in the
+// Authorization header or in the token query parameter (browsers can't set headers on
+// websocket connections).
+func requestToken(r *http.Request) string {
+	if a := r.Header.Get("Authorization"); strings.HasPrefix(a, "Bearer ") {
+		return strings.TrimSpace(a[len("Bearer "):])
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authChecker checks request credentials: either basic authentication (with a user and
+// password in creds) or a user token (in tokens).
+type authChecker struct {
+	creds  map[string]string
+	tokens map[string]string
+}
+
+// enabled returns true if any credentials are configured.
+func (a authChecker) enabled() bool {
+	return len(a.creds) > 0 || len(a.tokens) > 0
+}
+
+// Check returns true if the request has valid credentials.
+func (a authChecker) Check(r *http.Request) bool {
+	if user, password, ok := r.BasicAuth(); ok {
+		if p, ok := a.creds[user]; ok && subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1 {
+			return true
+		}
+	}
+	if t := requestToken(r); t != "" {
+		_, ok := a.tokens[t]
+		return ok
+	}
+	return false
+}
+
+// requireAuth returns an http.Handler which responds with 401 Unauthorized to requests
+// without valid credentials, and passes all other requests to h.  If no credentials are
+// configured then all requests are passed to h.
+func requireAuth(a authChecker, h http.Handler) http.Handler {
+	if !a.enabled() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Check(r) {
+			if len(a.creds) > 0 {
+				w.Header().Add("WWW-Authenticate", `Basic realm="tchaik"`)
+			}
+			if len(a.tokens) > 0 {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="tchaik"`)
+			}
+			http.Error(w, "unauthorized: missing or invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	a := authChecker{
+		creds:  map[string]string{"admin": "secret"},
+		tokens: map[string]string{"abc": "alice"},
+	}
+
+	tests := []struct {
+		a        authChecker
+		setup    func(r *http.Request)
+		expected int
+	}{
+		{authChecker{}, func(r *http.Request) {}, http.StatusOK},
+		{a, func(r *http.Request) {}, http.StatusUnauthorized},
+		{a, func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK},
+		{a, func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized},
+		{a, func(r *http.Request) { r.Header.Set("Authorization", "Bearer abc") }, http.StatusOK},
+		{a, func(r *http.Request) { r.Header.Set("Authorization", "Bearer xyz") }, http.StatusUnauthorized},
+		{a, func(r *http.Request) { r.URL.RawQuery = "token=abc" }, http.StatusOK},
+	}
+
+	for ii, tt := range tests {
+		r := httptest.NewRequest("GET", "/socket", nil)
+		tt.setup(r)
+		w := httptest.NewRecorder()
+		requireAuth(tt.a, ok).ServeHTTP(w, r)
+		if w.Code != tt.expected {
+			t.Errorf("[%d] status = %d, expected: %d", ii, w.Code, tt.expected)
+		}
+	}
+}
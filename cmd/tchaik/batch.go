@@ -0,0 +1,68 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+
+	"golang.org/x/net/context"
+)
+
+// getCommands returns the list of commands (each with an "action" and "data") in the field f.
+func (c Command) getCommands(f string) ([]Command, error) {
+	raw, err := c.get(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := raw.([]interface{}); !ok {
+		return nil, badField("expected '%s' to be of type '[]interface{}', got '%T'", f, raw)
+	}
+
+	// The commands are decoded in the same way as those received from the websocket.
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var commands []Command
+	if err := json.Unmarshal(b, &commands); err != nil {
+		return nil, badField("expected '%s' to contain commands: %v", f, err)
+	}
+	return commands, nil
+}
+
+// batch handles each of the commands in the "commands" field in order, and responds with the
+// list of their responses (null for commands which don't send one).  Errors are reported as
+// ERROR responses in the list, and don't stop the rest of the commands being handled.
+func (h *websocketHandler) batch(c Command, resp *Response) error {
+	commands, err := c.getCommands("commands")
+	if err != nil {
+		return err
+	}
+
+	responses := make([]*Response, len(commands))
+	for i, sub := range commands {
+		if sub.Action == ActionBatch {
+			responses[i] = newErrorResponse(sub, badField("cannot nest %v commands", ActionBatch))
+			continue
+		}
+
+		r := &Response{
+			Action: sub.Action,
+		}
+		err := h.mux.Handle(sub, r)
+		if err != nil {
+			if isTransportError(err) || err == context.Canceled {
+				return err
+			}
+			responses[i] = newErrorResponse(sub, err)
+			continue
+		}
+		if r.Data != nil {
+			responses[i] = r
+		}
+	}
+	resp.Data = responses
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/bookmark"
+)
+
+const (
+	// bookmarkInterval is the minimum time between updates to the bookmark of a playing
+	// track, so that the store isn't persisted on every status report.
+	bookmarkInterval = 10 * time.Second
+
+	// bookmarkMinDuration is the minimum duration of tracks which are bookmarked as they
+	// are played (i.e. audiobooks and long mixes).
+	bookmarkMinDuration = 10 * time.Minute
+
+	// bookmarkEndMargin is the time from the end of a track in which its bookmark is not
+	// updated: the track is considered finished.
+	bookmarkEndMargin = 30 * time.Second
+)
+
+// bookmarker is a bookmark.Store (keyed by ["T", <track id>] paths) which throttles
+// updates made during playback.
+type bookmarker struct {
+	bookmark.Store
+
+	mu   sync.Mutex
+	last map[string]time.Time // track ID -> time of last update
+}
+
+func newBookmarker(s bookmark.Store) *bookmarker {
+	return &bookmarker{
+		Store: s,
+		last:  make(map[string]time.Time),
+	}
+}
+
+// bookmarkPath returns the path used to identify the bookmark of a track.
+func bookmarkPath(id string) index.Path {
+	return index.Path{"T", index.Key(id)}
+}
+
+// Bookmark returns the bookmarked position (in seconds) of the track with the given ID, or
+// 0 if there isn't one.
+func (b *bookmarker) Bookmark(id string) float64 {
+	return b.Get(bookmarkPath(id))
+}
+
+// Update sets the bookmark of the playing track to the position (in seconds), unless it was
+// updated within the last bookmarkInterval.  Short tracks are not bookmarked, and positions
+// close to the end of the track are ignored.
+func (b *bookmarker) Update(t index.Track, pos float64) error {
+	d := time.Duration(t.GetInt("TotalTime")) * time.Millisecond
+	if d < bookmarkMinDuration || pos <= 0 || time.Duration(pos*float64(time.Second)) > d-bookmarkEndMargin {
+		return nil
+	}
+
+	id := t.GetString("ID")
+	b.mu.Lock()
+	if time.Since(b.last[id]) < bookmarkInterval {
+		b.mu.Unlock()
+		return nil
+	}
+	b.last[id] = time.Now()
+	b.mu.Unlock()
+
+	return b.Set(bookmarkPath(id), pos)
+}
+
+// Clear removes the bookmark of the track with the given ID.
+func (b *bookmarker) Clear(id string) error {
+	b.mu.Lock()
+	delete(b.last, id)
+	b.mu.Unlock()
+
+	return b.Set(bookmarkPath(id), 0)
+}
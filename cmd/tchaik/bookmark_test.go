@@ -0,0 +1,75 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/player"
+)
+
+type mapBookmarkStore map[string]float64
+
+func (m mapBookmarkStore) Set(p index.Path, v float64) error {
+	m[fmt.Sprintf("%v", p)] = v
+	return nil
+}
+
+func (m mapBookmarkStore) Get(p index.Path) float64 {
+	return m[fmt.Sprintf("%v", p)]
+}
+
+func TestBookmarkerUpdate(t *testing.T) {
+	b := newBookmarker(mapBookmarkStore{})
+	long := testTrack{ID: "1", TotalTime: int(time.Hour / time.Millisecond)}
+	short := testTrack{ID: "2", TotalTime: int(3 * time.Minute / time.Millisecond)}
+
+	b.Update(short, 60)
+	if got := b.Bookmark(short.ID); got != 0 {
+		t.Errorf("Bookmark(%#v) = %v, expected: %v (short track)", short.ID, got, 0)
+	}
+
+	b.Update(long, 60)
+	b.Update(long, 70) // throttled
+	if got := b.Bookmark(long.ID); got != 60 {
+		t.Errorf("Bookmark(%#v) = %v, expected: %v", long.ID, got, 60)
+	}
+
+	b.Clear(long.ID)
+	b.Update(long, 3590) // within bookmarkEndMargin of the end
+	if got := b.Bookmark(long.ID); got != 0 {
+		t.Errorf("Bookmark(%#v) = %v, expected: %v (near end)", long.ID, got, 0)
+	}
+
+	b.Update(long, 80)
+	if got := b.Bookmark(long.ID); got != 80 {
+		t.Errorf("Bookmark(%#v) = %v, expected: %v (after clear)", long.ID, got, 80)
+	}
+}
+
+func TestResumeErrors(t *testing.T) {
+	players := player.NewPlayers()
+	p := player.NewRep("key", func(interface{}) {})
+	players.Add(p)
+	h := &websocketHandler{
+		players: players,
+		meta:    &Meta{userMeta: &userMeta{bookmarks: newBookmarker(mapBookmarkStore{})}},
+	}
+
+	for _, st := range []player.Status{{}, {TrackID: "1"}} {
+		players.SetStatus("key", st)
+		err := h.resume("key", p, &Response{})
+		if err == nil {
+			t.Errorf("resume() with status %#v error = nil, expected error", st)
+			continue
+		}
+		if got := newErrorData(Command{}, err).Code; got != ErrorBadField {
+			t.Errorf("resume() with status %#v error code = %q, expected: %q", st, got, ErrorBadField)
+		}
+	}
+}
@@ -11,25 +11,66 @@ import (
 	"tchaik.com/index/attr"
 )
 
-// newBootstrapSearch creates a new index.Searcher which builds the search index
-// on the first call to Search.
-func newBootstrapSearcher(root index.Collection) index.Searcher {
+// bootstrapWordIndex is an index.WordIndex which is built on the first call to
+// Words or Search.
+type bootstrapWordIndex struct {
+	once   sync.Once
+	root   index.Collection
+	fields []string
+
+	index.WordIndex
+}
+
+func (b *bootstrapWordIndex) bootstrap() {
+	b.WordIndex = index.BuildCollectionWordIndex(b.root, b.fields)
+}
+
+// Words implements index.WordIndex.
+func (b *bootstrapWordIndex) Words() []string {
+	b.once.Do(b.bootstrap)
+	return b.WordIndex.Words()
+}
+
+// Search implements index.Searcher.
+func (b *bootstrapWordIndex) Search(input string) []index.Path {
+	b.once.Do(b.bootstrap)
+	return b.WordIndex.Search(input)
+}
+
+// newBootstrapSearcher creates a new index.Searcher which builds the search index
+// on the first call to Search, using build to construct the searcher from the
+// word index.  If fuzzy is true then words are also matched within a bounded edit
+// distance, and these matches are ranked below all others.
+func newBootstrapSearcher(wi index.WordIndex, build func(index.WordIndex) index.Searcher, fuzzy bool) index.Searcher {
 	return &bootstrapSearcher{
-		root: root,
+		wi:    wi,
+		build: build,
+		fuzzy: fuzzy,
 	}
 }
 
 type bootstrapSearcher struct {
-	once sync.Once
-	root index.Collection
+	once  sync.Once
+	wi    index.WordIndex
+	build func(index.WordIndex) index.Searcher
+	fuzzy bool
 
 	index.Searcher
 }
 
 func (b *bootstrapSearcher) bootstrap() {
-	wi := index.BuildCollectionWordIndex(b.root, []string{"Composer", "Artist", "Album", "Name"})
+	built := b.build(b.wi)
+	s := index.ExactFirst(
+		index.WordsIntersectSearcher(built),
+		index.WordsIntersectSearcher(b.wi),
+	)
+	if b.fuzzy {
+		s = index.RankedUnion(s, index.WordsIntersectSearcher(
+			index.RankedUnion(built, index.BuildFuzzyExpandSearcher(b.wi, b.wi)),
+		))
+	}
 	b.Searcher = index.FlatSearcher{
-		Searcher: index.WordsIntersectSearcher(index.BuildPrefixExpandSearcher(wi, wi, 10)),
+		Searcher: s,
 	}
 }
 
@@ -40,24 +81,30 @@ func (b *bootstrapSearcher) Search(input string) []index.Path {
 }
 
 // newBootstrapFilter creates a new index.Filter which initialises the filter on the
-// first call to Filter.
-func newBootstrapFilter(root index.Collection, field attr.Interface) index.Filter {
+// first call to Filter.  If bucket is non-nil then the values of the field are grouped
+// into buckets (see index.Bucket).
+func newBootstrapFilter(root index.Collection, field attr.Interface, bucket index.BucketFunc) index.Filter {
 	return &bootstrapFilter{
-		root:  root,
-		field: field,
+		root:   root,
+		field:  field,
+		bucket: bucket,
 	}
 }
 
 type bootstrapFilter struct {
-	once  sync.Once
-	root  index.Collection
-	field attr.Interface
+	once   sync.Once
+	root   index.Collection
+	field  attr.Interface
+	bucket index.BucketFunc
 
 	index.Filter
 }
 
 func (b *bootstrapFilter) bootstrap() {
 	b.Filter = index.FilterCollection(b.root, b.field)
+	if b.bucket != nil {
+		b.Filter = index.Bucket(b.Filter, b.bucket)
+	}
 }
 
 // Items implements index.Filter.
@@ -83,3 +130,94 @@ func (b *bootstrapRecent) List() []index.Path {
 	b.once.Do(b.bootstrap)
 	return b.list
 }
+
+// bootstrapRecentlyAdded is a Lister which lists the paths of all tracks in a collection,
+// ordered by when they were added (newest first).  The list is computed on the first call
+// to List.
+type bootstrapRecentlyAdded struct {
+	once sync.Once
+	root index.Collection
+
+	list []index.Path
+}
+
+func (b *bootstrapRecentlyAdded) bootstrap() {
+	b.list = index.RecentlyAdded(b.root, 0)
+}
+
+// List implements index.Lister.
+func (b *bootstrapRecentlyAdded) List() []index.Path {
+	b.once.Do(b.bootstrap)
+	return b.list
+}
+
+// newBootstrapDistribution creates a bootstrapDistribution which computes the distribution
+// of the attribute on the first call to List.
+func newBootstrapDistribution(t index.Tracker, a attr.Interface) *bootstrapDistribution {
+	return &bootstrapDistribution{
+		t:    t,
+		attr: a,
+	}
+}
+
+type bootstrapDistribution struct {
+	once sync.Once
+	t    index.Tracker
+	attr attr.Interface
+
+	list []index.ValueCount
+}
+
+func (b *bootstrapDistribution) bootstrap() {
+	b.list = index.Distribution(b.t, b.attr)
+}
+
+// List returns the (cached) distribution.
+func (b *bootstrapDistribution) List() []index.ValueCount {
+	b.once.Do(b.bootstrap)
+	return b.list
+}
+
+// bootstrapTrackPaths is a mapping of track IDs to their paths in a collection, which is
+// built on the first call to Get.
+type bootstrapTrackPaths struct {
+	once sync.Once
+	root index.Collection
+
+	m map[string]index.Path
+}
+
+func (b *bootstrapTrackPaths) bootstrap() {
+	b.m = make(map[string]index.Path)
+	index.Walk(&rootCollection{b.root}, index.Path{"Root"}, func(t index.Track, p index.Path) error {
+		b.m[t.GetString("ID")] = p
+		return nil
+	})
+}
+
+// Get returns the path of the track with the given ID.
+func (b *bootstrapTrackPaths) Get(id string) (index.Path, bool) {
+	b.once.Do(b.bootstrap)
+	p, ok := b.m[id]
+	return p, ok
+}
+
+// bootstrapStats is the libraryStats of a root collection, which are computed on the first
+// call to Stats.  Each Library has its own, so a rescan (which builds a new Library) discards
+// them.
+type bootstrapStats struct {
+	once sync.Once
+	root index.Collection
+
+	stats libraryStats
+}
+
+func (b *bootstrapStats) bootstrap() {
+	b.stats = computeLibraryStats(b.root)
+}
+
+// Stats returns the (cached) library stats.
+func (b *bootstrapStats) Stats() libraryStats {
+	b.once.Do(b.bootstrap)
+	return b.stats
+}
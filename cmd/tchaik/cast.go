@@ -0,0 +1,160 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/cursor"
+	"tchaik.com/player"
+	"tchaik.com/player/cast"
+)
+
+const (
+	// castCursor is the name of the cursor which Chromecast players play from (the same
+	// cursor used by the UI).
+	castCursor = "Default"
+
+	castDiscoverTimeout  = 5 * time.Second
+	castDiscoverInterval = time.Minute
+)
+
+// castQueue is a cast.Queue which uses a cursor as the source of tracks, served from url.
+type castQueue struct {
+	libs *sharedLibrary
+	meta *Meta
+	name string
+	url  string
+}
+
+// position returns the current position of the cursor, and whether there are next and
+// previous positions.
+func (q castQueue) position() (cur cursor.Position, next, prev bool, err error) {
+	c := q.meta.cursors.Get(q.name)
+	if c == nil {
+		return cursor.Position{}, false, false, fmt.Errorf("invalid cursor name: %v", q.name)
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	return c.Current, !c.Next.Empty(), !c.Previous.Empty(), nil
+}
+
+// Current implements cast.Queue.
+func (q castQueue) Current() (cast.Track, error) {
+	cur, _, _, err := q.position()
+	if err != nil {
+		return cast.Track{}, err
+	}
+	if cur.Empty() {
+		return cast.Track{}, fmt.Errorf("cursor has no current track")
+	}
+
+	lib := q.libs.Get()
+	t, err := lib.TrackFromPath(cur.Path)
+	if err != nil {
+		return cast.Track{}, err
+	}
+	return castTrack(t, q.url), nil
+}
+
+// Next implements cast.Queue.
+func (q castQueue) Next() (cast.Track, error) {
+	return q.move("NEXT")
+}
+
+// Prev implements cast.Queue.
+func (q castQueue) Prev() (cast.Track, error) {
+	return q.move("PREV")
+}
+
+// move applies the cursor action and returns the new current track.
+func (q castQueue) move(action string) (cast.Track, error) {
+	_, next, prev, err := q.position()
+	if err != nil {
+		return cast.Track{}, err
+	}
+	if (action == "NEXT" && !next) || (action == "PREV" && !prev) {
+		return cast.Track{}, fmt.Errorf("no track to move to")
+	}
+
+	ra := cursor.RepAction{
+		Name:   q.name,
+		Action: cursor.Action(action),
+	}
+	root := &rootCollection{q.libs.Get().collections["Root"]}
+	q.meta.playback.Lock()
+	err = ra.Apply(q.meta.cursors, q.meta.playlists, root)
+	q.meta.playback.Unlock()
+	if err != nil {
+		return cast.Track{}, err
+	}
+	return q.Current()
+}
+
+// castTrack returns the cast.Track for the index.Track, served from the base URL u.
+func castTrack(t index.Track, u string) cast.Track {
+	id := t.GetString("ID")
+	ct := mime.TypeByExtension(path.Ext(t.GetString("Location")))
+	if ct == "" {
+		ct = "audio/mpeg"
+	}
+	return cast.Track{
+		ID:          id,
+		URL:         strings.TrimSuffix(u, "/") + "/track/" + id,
+		ContentType: ct,
+		Title:       t.GetString("Name"),
+		Album:       t.GetString("Album"),
+		Artist:      strings.Join(t.GetStrings("Artist"), ", "),
+	}
+}
+
+// discoverCastPlayers periodically searches for Chromecast devices on the local network and
+// adds a player for each new device found.  Players are identified by the device name.
+func discoverCastPlayers(p *player.Players, l *sharedLibrary, m *Meta) {
+	q := castQueue{
+		libs: l,
+		meta: m,
+		name: castCursor,
+		url:  castURL,
+	}
+
+	for {
+		devices, err := cast.Discover(castDiscoverTimeout)
+		if err != nil {
+			log.Printf("error discovering chromecast devices: %v", err)
+		}
+
+		for _, d := range devices {
+			key := d.Name
+			if p.Get(key) != nil {
+				continue
+			}
+
+			cp := cast.New(key, d.Addr, q, func(st player.Status) {
+				p.SetStatus(key, st)
+				m.prefetchNext(l.Get(), key, st)
+				if t, ok := l.Track(st.TrackID); ok && st.Playing {
+					m.scrobbler.Update(key, t, st.Time)
+				}
+			})
+			if err := cp.Connect(); err != nil {
+				log.Printf("error connecting to chromecast %#v: %v", key, err)
+				continue
+			}
+			if err := p.Add(cp); err != nil {
+				log.Printf("error adding chromecast %#v: %v", key, err)
+				cp.Close()
+			}
+		}
+		time.Sleep(castDiscoverInterval)
+	}
+}
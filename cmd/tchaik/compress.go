@@ -0,0 +1,88 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/net/websocket"
+)
+
+// compressMinSize is the minimum size (in bytes) of an encoded message before it is
+// compressed: compressing smaller messages isn't worth the overhead.
+const compressMinSize = 1024
+
+// maxDecompressedSize is the maximum size (in bytes) of a received message once decompressed,
+// the same as the limit on (uncompressed) frames, as connections don't set MaxPayloadBytes.
+var maxDecompressedSize = websocket.DefaultMaxPayloadBytes
+
+// gzipMagic is the header which starts all gzip data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipped returns a websocket.Codec which gzips messages encoded by c that are at least
+// compressMinSize bytes, and sends them in binary frames.  Smaller messages are sent as
+// encoded by c.  Clients can identify compressed messages by the gzip header, as neither
+// JSON nor MessagePack encoded Responses start with it.  Received messages are
+// decompressed if they are gzipped, up to maxDecompressedSize bytes.
+//
+// NB: golang.org/x/net/websocket doesn't support the permessage-deflate extension, so
+// compression is applied to the message payloads instead.  Received messages which fail
+// to decompress (or are too large once decompressed) are reported as a decodeError.
+func gzipped(c websocket.Codec) websocket.Codec {
+	return websocket.Codec{
+		Marshal: func(v interface{}) ([]byte, byte, error) {
+			data, payloadType, err := c.Marshal(v)
+			if err != nil || len(data) < compressMinSize {
+				return data, payloadType, err
+			}
+
+			buf := &bytes.Buffer{}
+			w, err := gzip.NewWriterLevel(buf, gzip.BestSpeed)
+			if err != nil {
+				return nil, payloadType, err
+			}
+			if _, err := w.Write(data); err != nil {
+				return nil, payloadType, err
+			}
+			if err := w.Close(); err != nil {
+				return nil, payloadType, err
+			}
+			return buf.Bytes(), websocket.BinaryFrame, nil
+		},
+		Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+			if bytes.HasPrefix(data, gzipMagic) {
+				r, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					return decodeError{err}
+				}
+				data, err = ioutil.ReadAll(io.LimitReader(r, int64(maxDecompressedSize)+1))
+				if err != nil {
+					return decodeError{err}
+				}
+				if len(data) > maxDecompressedSize {
+					return decodeError{fmt.Errorf("decompressed message exceeds %d bytes", maxDecompressedSize)}
+				}
+			}
+			return c.Unmarshal(data, payloadType, v)
+		},
+	}
+}
+
+// newCodec returns the websocket.Codec for the format (see codecs), which compresses large
+// messages if compress is true.  Returns false if the format isn't supported.
+func newCodec(format string, compress bool) (websocket.Codec, bool) {
+	c, ok := codecs[format]
+	if !ok {
+		return websocket.Codec{}, false
+	}
+	if compress {
+		c = gzipped(c)
+	}
+	return c, true
+}
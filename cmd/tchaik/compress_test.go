@@ -0,0 +1,81 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestGzipped(t *testing.T) {
+	c, ok := newCodec("json", true)
+	if !ok {
+		t.Fatalf("newCodec(%#v, true) returned false", "json")
+	}
+
+	tests := []struct {
+		resp        Response
+		payloadType byte
+		compressed  bool
+	}{
+		{Response{Action: "SMALL", Data: "x"}, websocket.TextFrame, false},
+		{Response{Action: "LARGE", Data: strings.Repeat("x", compressMinSize)}, websocket.BinaryFrame, true},
+	}
+
+	for ii, tt := range tests {
+		data, payloadType, err := c.Marshal(tt.resp)
+		if err != nil {
+			t.Errorf("[%d] unexpected error from Marshal: %v", ii, err)
+			continue
+		}
+		if payloadType != tt.payloadType {
+			t.Errorf("[%d] payloadType = %d, expected: %d", ii, payloadType, tt.payloadType)
+		}
+		if got := bytes.HasPrefix(data, gzipMagic); got != tt.compressed {
+			t.Errorf("[%d] compressed = %v, expected: %v", ii, got, tt.compressed)
+		}
+
+		var got Response
+		if err := c.Unmarshal(data, payloadType, &got); err != nil {
+			t.Errorf("[%d] unexpected error from Unmarshal: %v", ii, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.resp) {
+			t.Errorf("[%d] Unmarshal(Marshal(%v)) = %v", ii, tt.resp, got)
+		}
+	}
+
+	if err := c.Unmarshal(append(gzipMagic, 0), websocket.BinaryFrame, &Response{}); err == nil {
+		t.Errorf("expected error from Unmarshal of invalid gzip data")
+	} else if _, ok := err.(decodeError); !ok {
+		t.Errorf("Unmarshal error = %T, expected: decodeError", err)
+	}
+}
+
+func TestGzippedLimit(t *testing.T) {
+	defer func(n int) { maxDecompressedSize = n }(maxDecompressedSize)
+	maxDecompressedSize = 2 * compressMinSize
+
+	c, _ := newCodec("json", true)
+	small, payloadType, _ := c.Marshal(Command{Action: "SMALL", Data: map[string]interface{}{"x": strings.Repeat("x", compressMinSize)}})
+	if err := c.Unmarshal(small, payloadType, &Command{}); err != nil {
+		t.Errorf("unexpected error from Unmarshal: %v", err)
+	}
+
+	// Compresses to much less than maxDecompressedSize.
+	large, payloadType, _ := c.Marshal(Command{Action: "LARGE", Data: map[string]interface{}{"x": strings.Repeat("x", 10*maxDecompressedSize)}})
+	if len(large) >= maxDecompressedSize {
+		t.Fatalf("compressed size = %d, expected less than %d", len(large), maxDecompressedSize)
+	}
+	if err := c.Unmarshal(large, payloadType, &Command{}); err == nil {
+		t.Errorf("expected error from Unmarshal of message larger than maxDecompressedSize")
+	} else if _, ok := err.(decodeError); !ok {
+		t.Errorf("Unmarshal error = %T, expected: decodeError", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"tchaik.com/index/playlist"
+)
+
+// exportTrack is a track in an exported playlist.
+type exportTrack struct {
+	URL      string
+	Title    string
+	Duration int // seconds
+}
+
+// playlistExportHandler is an http.Handler which responds to GET requests for
+// /<name>.m3u and /<name>.pls with the named playlist in the corresponding format.  Track
+// URLs point to the /track/ endpoint on the requested host.
+type playlistExportHandler struct {
+	libs *sharedLibrary
+	meta *Meta
+}
+
+// ServeHTTP implements http.Handler.
+func (h playlistExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ext := path.Ext(r.URL.Path)
+	name := strings.TrimSuffix(strings.Trim(r.URL.Path, "/"), ext)
+
+	var write func(*bytes.Buffer, []exportTrack, []string)
+	var contentType string
+	switch ext {
+	case ".m3u":
+		write, contentType = writeM3U, "audio/x-mpegurl"
+	case ".pls":
+		write, contentType = writePLS, "audio/x-scpls"
+	default:
+		http.Error(w, fmt.Sprintf("unsupported playlist format: %q", ext), http.StatusNotFound)
+		return
+	}
+
+	h.meta.playback.Lock()
+	p := h.meta.playlists.Get(name)
+	var items []*playlist.Item
+	if p != nil {
+		items = p.Items()
+	}
+	h.meta.playback.Unlock()
+	if p == nil {
+		http.Error(w, fmt.Sprintf("invalid playlist name: %q", name), http.StatusNotFound)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host + "/track/"
+
+	var tracks []exportTrack
+	var skipped []string
+	lib := h.libs.Get()
+	root := &rootCollection{lib.collections["Root"]}
+	for _, item := range items {
+		paths, err := playlist.Paths(item, root)
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		for _, p := range paths {
+			t, err := lib.TrackFromPath(p)
+			if err != nil {
+				skipped = append(skipped, p.String())
+				continue
+			}
+			title := t.GetString("Name")
+			if artist := strings.Join(t.GetStrings("Artist"), ", "); artist != "" {
+				title = artist + " - " + title
+			}
+			tracks = append(tracks, exportTrack{
+				URL:      base + url.QueryEscape(t.GetString("ID")),
+				Title:    title,
+				Duration: t.GetInt("TotalTime") / 1000,
+			})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	write(buf, tracks, skipped)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)+ext))
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("error writing playlist export: %v", err)
+	}
+}
+
+// writeM3U writes the tracks as an extended M3U playlist.  Paths which could not be resolved
+// are written as comments.
+func writeM3U(buf *bytes.Buffer, tracks []exportTrack, skipped []string) {
+	buf.WriteString("#EXTM3U\n")
+	for _, s := range skipped {
+		fmt.Fprintf(buf, "# skipped (could not resolve): %v\n", s)
+	}
+	for _, t := range tracks {
+		fmt.Fprintf(buf, "#EXTINF:%d,%v\n%v\n", t.Duration, t.Title, t.URL)
+	}
+}
+
+// writePLS writes the tracks as a PLS playlist.  Paths which could not be resolved are written
+// as comments.
+func writePLS(buf *bytes.Buffer, tracks []exportTrack, skipped []string) {
+	buf.WriteString("[playlist]\n")
+	for _, s := range skipped {
+		fmt.Fprintf(buf, "; skipped (could not resolve): %v\n", s)
+	}
+	for i, t := range tracks {
+		n := i + 1
+		fmt.Fprintf(buf, "File%d=%v\nTitle%d=%v\nLength%d=%d\n", n, t.URL, n, t.Title, n, t.Duration)
+	}
+	fmt.Fprintf(buf, "NumberOfEntries=%d\nVersion=2\n", len(tracks))
+}
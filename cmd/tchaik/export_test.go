@@ -0,0 +1,47 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePlaylistExports(t *testing.T) {
+	tracks := []exportTrack{
+		{URL: "http://host/track/1", Title: "Artist - One", Duration: 61},
+		{URL: "http://host/track/2", Title: "Two", Duration: 5},
+	}
+	skipped := []string{"Root:x:1"}
+
+	tests := []struct {
+		write    func(*bytes.Buffer, []exportTrack, []string)
+		expected string
+	}{
+		{
+			writeM3U,
+			"#EXTM3U\n" +
+				"# skipped (could not resolve): Root:x:1\n" +
+				"#EXTINF:61,Artist - One\nhttp://host/track/1\n" +
+				"#EXTINF:5,Two\nhttp://host/track/2\n",
+		},
+		{
+			writePLS,
+			"[playlist]\n" +
+				"; skipped (could not resolve): Root:x:1\n" +
+				"File1=http://host/track/1\nTitle1=Artist - One\nLength1=61\n" +
+				"File2=http://host/track/2\nTitle2=Two\nLength2=5\n" +
+				"NumberOfEntries=2\nVersion=2\n",
+		},
+	}
+
+	for i, tt := range tests {
+		buf := &bytes.Buffer{}
+		tt.write(buf, tracks, skipped)
+		if got := buf.String(); got != tt.expected {
+			t.Errorf("[%d] got:\n%v\nexpected:\n%v", i, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+	"tchaik.com/index/smart"
+)
+
+// filterSpec is a definition of a filter on a track field.
+type filterSpec struct {
+	// Name is the name used to identify the filter.
+	Name string `json:"name"`
+
+	// Field is the track field used to filter, i.e. "Year".
+	Field string `json:"field"`
+
+	// By groups field values into buckets: "" to use the value itself, "decade" (int fields
+	// only) or "letter" for the first letter of the value (string fields only).
+	By string `json:"by,omitempty"`
+}
+
+// listFields are the fields whose values are split into lists (see NewLibrary).
+var listFields = map[string]bool{
+	"Artist":   true,
+	"Composer": true,
+}
+
+// attr returns the attr.Interface for the filter and the function which groups its values into
+// buckets (nil if values aren't grouped), or an error if the field or grouping is invalid.
+func (s filterSpec) attr() (attr.Interface, index.BucketFunc, error) {
+	var f *smart.Field
+	for i, x := range smart.Fields {
+		if x.Attr == s.Field && !x.Meta {
+			f = &smart.Fields[i]
+			break
+		}
+	}
+	if f == nil {
+		return nil, nil, badField("invalid filter field: %#v", s.Field)
+	}
+
+	switch f.Type {
+	case smart.TypeString:
+		var a attr.Interface = attr.String(s.Field)
+		if listFields[s.Field] {
+			a = attr.Strings(s.Field)
+		}
+		switch s.By {
+		case "":
+			return a, nil, nil
+		case "letter":
+			return a, index.LetterBucket, nil
+		}
+		return nil, nil, badField("invalid grouping for string field %#v: %#v", s.Field, s.By)
+
+	case smart.TypeInt:
+		switch s.By {
+		case "":
+			return attr.Int(s.Field), nil, nil
+		case "decade":
+			return attr.Int(s.Field), index.DecadeBucket, nil
+		}
+		return nil, nil, badField("invalid grouping for int field %#v: %#v", s.Field, s.By)
+	}
+	return nil, nil, badField("cannot filter on %v field: %#v", f.Type, s.Field)
+}
+
+// defaultFilters are the filters available in every library.
+var defaultFilters = []filterSpec{
+	{Name: "Artist", Field: "Artist"},
+	{Name: "Composer", Field: "Composer"},
+	{Name: "Genre", Field: "Genre"},
+	{Name: "Year", Field: "Year"},
+}
+
+// filterSet is a collection of filters (identified by name) on a collection, which can be
+// extended at runtime.  It is safe for concurrent use.
+type filterSet struct {
+	root index.Collection
+
+	mu      sync.RWMutex
+	filters map[string]index.Filter
+	sub     map[string][]string // filter name -> names of filters for each sub-level
+	defined []filterSpec        // filters added using Define
+}
+
+// newFilterSet creates a filterSet on the collection containing the default filters.
+func newFilterSet(root index.Collection) *filterSet {
+	s := &filterSet{
+		root:    root,
+		filters: make(map[string]index.Filter, len(defaultFilters)),
+		sub: map[string][]string{
+			"Genre": {"Year"},
+		},
+	}
+	for _, spec := range defaultFilters {
+		a, bucket, err := spec.attr()
+		if err != nil {
+			panic(fmt.Sprintf("invalid default filter %#v: %v", spec.Name, err))
+		}
+		s.filters[spec.Name] = newBootstrapFilter(root, a, bucket)
+	}
+	return s
+}
+
+// Get returns the filter with the given name, and true if it exists (false otherwise).
+func (s *filterSet) Get(name string) (index.Filter, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.filters[name]
+	return f, ok
+}
+
+// Levels returns the filter with the given name followed by the filters for each of its
+// sub-levels.
+func (s *filterSet) Levels(name string) []index.Filter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filters := []index.Filter{s.filters[name]}
+	for _, n := range s.sub[name] {
+		filters = append(filters, s.filters[n])
+	}
+	return filters
+}
+
+// Names returns the names of the filters, in sorted order.
+func (s *filterSet) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.filters))
+	for n := range s.filters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Define adds (or replaces) the filter described by the spec.  Default filters cannot be
+// replaced.
+func (s *filterSet) Define(spec filterSpec) error {
+	if spec.Name == "" {
+		return badField("filter name required")
+	}
+	for _, d := range defaultFilters {
+		if d.Name == spec.Name {
+			return badField("cannot redefine filter: %#v", spec.Name)
+		}
+	}
+	a, bucket, err := spec.attr()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.filters[spec.Name] = newBootstrapFilter(s.root, a, bucket)
+	for i, d := range s.defined {
+		if d.Name == spec.Name {
+			s.defined[i] = spec
+			return nil
+		}
+	}
+	s.defined = append(s.defined, spec)
+	return nil
+}
+
+// Defined returns the specs of the filters added using Define.
+func (s *filterSet) Defined() []filterSpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]filterSpec(nil), s.defined...)
+}
@@ -0,0 +1,54 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterSetDefine(t *testing.T) {
+	s := newFilterSet(nil)
+
+	tests := []struct {
+		spec filterSpec
+		ok   bool
+	}{
+		{filterSpec{Name: "Decade", Field: "Year", By: "decade"}, true},
+		{filterSpec{Name: "Kind", Field: "Kind"}, true},
+		{filterSpec{Name: "Kind", Field: "Kind", By: "decade"}, false},
+		{filterSpec{Name: "Artist A-Z", Field: "Artist", By: "letter"}, true},
+		{filterSpec{Name: "Year A-Z", Field: "Year", By: "letter"}, false},
+		{filterSpec{Name: "Bad", Field: "NotAField"}, false},
+		{filterSpec{Name: "Rating", Field: "Rating"}, false},
+		{filterSpec{Name: "Added", Field: "DateAdded"}, false},
+		{filterSpec{Name: "Year", Field: "Year"}, false},
+		{filterSpec{Field: "Year"}, false},
+	}
+
+	for _, tt := range tests {
+		err := s.Define(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("Define(%#v) = %v, expected ok: %v", tt.spec, err, tt.ok)
+		}
+		if _, ok := s.Get(tt.spec.Name); !ok && tt.ok {
+			t.Errorf("Get(%#v) = _, false, expected true", tt.spec.Name)
+		}
+	}
+
+	expected := []string{"Artist", "Artist A-Z", "Composer", "Decade", "Genre", "Kind", "Year"}
+	if got := s.Names(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Names() = %v, expected: %v", got, expected)
+	}
+
+	expectedDefined := []filterSpec{
+		{Name: "Decade", Field: "Year", By: "decade"},
+		{Name: "Kind", Field: "Kind"},
+		{Name: "Artist A-Z", Field: "Artist", By: "letter"},
+	}
+	if got := s.Defined(); !reflect.DeepEqual(got, expectedDefined) {
+		t.Errorf("Defined() = %v, expected: %v", got, expectedDefined)
+	}
+}
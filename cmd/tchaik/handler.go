@@ -5,14 +5,18 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"path"
+	"strings"
 
 	"golang.org/x/net/context"
 	"golang.org/x/net/trace"
 
 	"github.com/dhowden/httpauth"
 
+	"tchaik.com/index"
+	"tchaik.com/index/remote"
 	"tchaik.com/player"
 	"tchaik.com/store"
 )
@@ -39,27 +43,63 @@ type fsServeMux struct {
 	httpauth.ServeMux
 }
 
+// HandleTrackFileSystem is a convenience method for adding a handler for streaming tracks to
+// an http.ServeMux, see trackFileHandler, durationHandler, transcodeHandler and
+// remoteTrackHandler.
+func (fsm *fsServeMux) HandleTrackFileSystem(pattern string, fs store.FileSystem, l index.Library, items remote.Store) {
+	tfs := &traceFS{fs, pattern}
+	var h http.Handler = trackFileHandler{fs, pattern}
+	if ffmpegPath != "" {
+		h = transcodeHandler{h, tfs, l}
+	}
+	h = remoteTrackHandler{h, items}
+	fsm.ServeMux.Handle(pattern, http.StripPrefix(pattern, durationHandler{h, l}))
+}
+
 // HandleFileSystem is a convenience method for adding an http.FileServer handler to an
 // http.ServeMux.
 func (fsm *fsServeMux) HandleFileSystem(pattern string, fs store.FileSystem) {
 	fsm.ServeMux.Handle(pattern, http.StripPrefix(pattern, http.FileServer(&traceFS{fs, pattern})))
 }
 
+// durationHandler is an http.Handler which adds an X-Content-Duration header (in seconds) to
+// responses for tracks, using the duration recorded in the index.  This lets players display
+// the full timeline (and seek) when the length of the stream cannot be determined from
+// the response itself.
+type durationHandler struct {
+	http.Handler
+	index.Library
+}
+
+// ServeHTTP implements http.Handler.
+func (d durationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t, ok := d.Library.Track(strings.Trim(r.URL.Path, "/")); ok {
+		if ms := t.GetInt("TotalTime"); ms > 0 {
+			w.Header().Set("X-Content-Duration", fmt.Sprintf("%.3f", float64(ms)/1000))
+		}
+	}
+	d.Handler.ServeHTTP(w, r)
+}
+
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("X-Clacks-Overhead", "GNU Terry Pratchett")
 	http.ServeFile(w, r, path.Join(uiDir, "index.html"))
 }
 
 // NewHandler creates the root http.Handler.
-func NewHandler(l Library, m *Meta, mediaFileSystem, artworkFileSystem store.FileSystem) http.Handler {
+func NewHandler(l *sharedLibrary, m *Meta, mediaFileSystem, artworkFileSystem store.FileSystem) http.Handler {
+	creds := make(map[string]string)
 	var c httpauth.Checker = httpauth.None{}
 	if authUser != "" {
-		c = httpauth.Creds(map[string]string{
-			authUser: authPassword,
-		})
+		creds[authUser] = authPassword
+		if authGuestUser != "" {
+			creds[authGuestUser] = authGuestPassword
+		}
+		c = httpauth.Creds(creds)
 	}
+	mux := http.NewServeMux()
 	h := fsServeMux{
-		httpauth.NewServeMux(c, http.NewServeMux()),
+		httpauth.NewServeMux(c, mux),
 	}
 
 	h.HandleFunc("/", rootHandler)
@@ -71,13 +111,28 @@ func NewHandler(l Library, m *Meta, mediaFileSystem, artworkFileSystem store.Fil
 
 	mediaFileSystem = l.FileSystem(mediaFileSystem)
 	artworkFileSystem = l.FileSystem(artworkFileSystem)
-	h.HandleFileSystem("/track/", mediaFileSystem)
+	h.HandleTrackFileSystem("/track/", mediaFileSystem, l, l.Get().remote)
 	h.HandleFileSystem("/artwork/", artworkFileSystem)
+	h.HandleFileSystem("/thumbnail/", thumbnailFileSystem(artworkFileSystem, thumbnailCachePath))
 	h.HandleFileSystem("/icon/", store.FaviconFileSystem(artworkFileSystem))
 
+	m.prefetch = newPrefetcher(mediaFileSystem)
 	p := player.NewPlayers()
-	h.Handle("/socket", NewWebsocketHandler(l, m, p))
+	if castURL != "" {
+		go discoverCastPlayers(p, l, m)
+	}
+	if airplayURL != "" {
+		go discoverAirPlayPlayers(p, l, m)
+	}
+	// The websocket is added directly so that it also accepts user tokens (see requireAuth).
+	ws := NewWebsocketHandler(l, m, p, mediaFileSystem, artworkFileSystem)
+	mux.Handle("/socket", requireAuth(authChecker{creds, userTokens}, ws))
 	h.Handle("/api/players/", http.StripPrefix("/api/players/", player.NewHTTPHandler(p)))
+	h.Handle("/api/collection/", http.StripPrefix("/api/collection/", collectionHandler{l, m}))
+	if ffmpegPath != "" {
+		h.Handle("/api/peaks/", http.StripPrefix("/api/peaks/", peaksHandler{l, newPeaksCache(mediaFileSystem, peaksCachePath)}))
+	}
+	h.Handle("/playlist/", http.StripPrefix("/playlist/", playlistExportHandler{l, m}))
 
 	return h
 }
@@ -0,0 +1,82 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// hub keeps track of connected websocket handlers so that Responses can be broadcast to
+// all of them.
+type hub struct {
+	sync.Mutex
+	clients map[*websocketHandler]struct{}
+}
+
+func newHub() *hub {
+	return &hub{
+		clients: make(map[*websocketHandler]struct{}),
+	}
+}
+
+// register adds the handler to the hub.
+func (b *hub) register(h *websocketHandler) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.clients[h] = struct{}{}
+}
+
+// unregister removes the handler from the hub.
+func (b *hub) unregister(h *websocketHandler) {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.clients, h)
+}
+
+// broadcast sends the Response to all registered handlers except the given one (which can
+// be nil).
+func (b *hub) broadcast(resp *Response, except *websocketHandler) {
+	b.broadcastWhere(resp, func(h *websocketHandler) bool { return h != except })
+}
+
+// broadcastWhere sends the Response to all registered handlers for which fn returns true.
+// Handlers can disconnect during a broadcast: failed sends are logged and otherwise ignored
+// (the handler will unregister itself).
+func (b *hub) broadcastWhere(resp *Response, fn func(*websocketHandler) bool) {
+	b.Lock()
+	clients := make([]*websocketHandler, 0, len(b.clients))
+	for h := range b.clients {
+		if fn(h) {
+			clients = append(clients, h)
+		}
+	}
+	b.Unlock()
+
+	for _, h := range clients {
+		if err := h.send(resp); err != nil && !isTransportError(err) {
+			log.Printf("error broadcasting %v: %v", resp.Action, err)
+		}
+	}
+}
+
+// broadcastChange sends a LIBRARY_CHANGED Response to all registered handlers except the
+// given one.  Changes to user metadata (favourites, checklists and ratings) are only sent to
+// the handlers of the same user.
+func (b *hub) broadcastChange(change libraryChange, except *websocketHandler) {
+	resp := &Response{
+		Action: ActionLibraryChanged,
+		Data:   change,
+	}
+	if except == nil || (change.Reason != changeFavourite && change.Reason != changeChecklist && change.Reason != changeRating) {
+		b.broadcast(resp, except)
+		return
+	}
+	b.broadcastWhere(resp, func(h *websocketHandler) bool {
+		return h != except && h.user == except.user
+	})
+}
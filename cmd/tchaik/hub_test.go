@@ -0,0 +1,71 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// testHubServer starts a websocket server which registers each connection with the hub,
+// and returns its URL.
+func testHubServer(b *hub, registered chan<- *websocketHandler) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		h := &websocketHandler{Conn: ws, codec: websocket.JSON}
+		b.register(h)
+		defer b.unregister(h)
+		registered <- h
+
+		var c Command
+		for websocket.JSON.Receive(ws, &c) == nil {
+		}
+	}))
+}
+
+func TestHubBroadcast(t *testing.T) {
+	b := newHub()
+	registered := make(chan *websocketHandler)
+	s := testHubServer(b, registered)
+	defer s.Close()
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+	var conns []*websocket.Conn
+	var handlers []*websocketHandler
+	for i := 0; i < 3; i++ {
+		ws, err := websocket.Dial(url, "", s.URL)
+		if err != nil {
+			t.Fatalf("unexpected error dialing: %v", err)
+		}
+		conns = append(conns, ws)
+		handlers = append(handlers, <-registered)
+	}
+
+	// Close one connection (without waiting for it to be unregistered), and exclude another.
+	conns[0].Close()
+	b.broadcastChange(libraryChange{Reason: changeRescan}, handlers[1])
+
+	conns[2].SetReadDeadline(time.Now().Add(time.Second))
+	var resp struct {
+		Action string
+		Data   libraryChange
+	}
+	if err := websocket.JSON.Receive(conns[2], &resp); err != nil {
+		t.Fatalf("unexpected error receiving broadcast: %v", err)
+	}
+	if resp.Action != ActionLibraryChanged || resp.Data.Reason != changeRescan {
+		t.Errorf("got = %v (%v), expected: %v (%v)", resp.Action, resp.Data.Reason, ActionLibraryChanged, changeRescan)
+	}
+
+	conns[1].SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if err := websocket.JSON.Receive(conns[1], &resp); err == nil {
+		t.Errorf("excluded handler received broadcast: %v", resp.Action)
+	}
+	conns[1].Close()
+	conns[2].Close()
+}
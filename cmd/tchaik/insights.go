@@ -0,0 +1,111 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"tchaik.com/index/history"
+)
+
+// listeningInsights is a collection of aggregate statistics computed from play history.
+type listeningInsights struct {
+	TotalPlays     int     `json:"totalPlays"`
+	CurrentStreak  int     `json:"currentStreak"` // days
+	LongestStreak  int     `json:"longestStreak"` // days
+	BusiestHour    int     `json:"busiestHour"`
+	PlaysByHour    [24]int `json:"playsByHour"`
+	PlaysByWeekday [7]int  `json:"playsByWeekday"` // Sunday first
+}
+
+// day returns the (local) date of t as a time at midnight UTC, so that consecutive days are
+// exactly 24 hours apart.
+func day(t time.Time) time.Time {
+	y, m, d := t.Local().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// computeListeningInsights computes listeningInsights from the play events, with streaks
+// computed relative to now.
+func computeListeningInsights(events []history.Event, now time.Time) listeningInsights {
+	var li listeningInsights
+	days := make(map[time.Time]bool)
+	for _, e := range events {
+		t := e.Time.Local()
+		li.TotalPlays++
+		li.PlaysByHour[t.Hour()]++
+		li.PlaysByWeekday[t.Weekday()]++
+		days[day(t)] = true
+	}
+
+	for h, n := range li.PlaysByHour {
+		if n > li.PlaysByHour[li.BusiestHour] {
+			li.BusiestHour = h
+		}
+	}
+
+	const oneDay = 24 * time.Hour
+	for d := range days {
+		if days[d.Add(-oneDay)] {
+			continue // not the start of a streak
+		}
+		n := 1
+		for days[d.Add(time.Duration(n)*oneDay)] {
+			n++
+		}
+		if n > li.LongestStreak {
+			li.LongestStreak = n
+		}
+	}
+
+	// The current streak can end today or yesterday (today's plays may be yet to come).
+	d := day(now)
+	if !days[d] {
+		d = d.Add(-oneDay)
+	}
+	for days[d] {
+		li.CurrentStreak++
+		d = d.Add(-oneDay)
+	}
+	return li
+}
+
+// insightsCache caches listeningInsights computed from a history.Store until
+// Invalidate is called, or the (local) date changes.
+type insightsCache struct {
+	store history.Store
+
+	sync.Mutex
+	valid    bool
+	day      time.Time // date the insights were computed, see day
+	insights listeningInsights
+}
+
+// Get returns the (cached) listening insights.
+func (c *insightsCache) Get() listeningInsights {
+	return c.get(time.Now())
+}
+
+// get returns the (cached) listening insights at now.  Streaks are relative to the date,
+// so insights computed on an earlier date are recomputed.
+func (c *insightsCache) get(now time.Time) listeningInsights {
+	c.Lock()
+	defer c.Unlock()
+
+	if d := day(now); !c.valid || !c.day.Equal(d) {
+		c.insights = computeListeningInsights(c.store.Recent(-1), now)
+		c.valid = true
+		c.day = d
+	}
+	return c.insights
+}
+
+// Invalidate clears the cache.
+func (c *insightsCache) Invalidate() {
+	c.Lock()
+	c.valid = false
+	c.Unlock()
+}
@@ -0,0 +1,109 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/history"
+)
+
+// testHistoryStore is a history.Store of events (most recent first), which counts calls to
+// Recent.
+type testHistoryStore struct {
+	events []history.Event
+	calls  int
+}
+
+func (s *testHistoryStore) Add(index.Path) error       { return nil }
+func (s *testHistoryStore) Get(index.Path) []time.Time { return nil }
+
+func (s *testHistoryStore) Recent(n int) []history.Event {
+	s.calls++
+	return s.events
+}
+
+// playsOn returns a play event at the hour on each of the days (relative to now).
+func playsOn(now time.Time, hour int, days ...int) []history.Event {
+	y, m, d := now.Date()
+	events := make([]history.Event, len(days))
+	for i, x := range days {
+		events[i] = history.Event{
+			Path: index.Path{"Root", "a", "0"},
+			Time: time.Date(y, m, d+x, hour, 0, 0, 0, time.Local),
+		}
+	}
+	return events
+}
+
+func TestComputeListeningInsights(t *testing.T) {
+	now := time.Date(2015, time.June, 10, 20, 0, 0, 0, time.Local) // a Wednesday
+
+	tests := []struct {
+		events            []history.Event
+		current, longest  int
+		totalPlays, hour  int
+		wednesdays, hours int // plays on Wednesdays, and in the busiest hour
+	}{
+		{nil, 0, 0, 0, 0, 0, 0},
+		// Plays today (twice), yesterday and the day before, and a longer earlier streak.
+		{playsOn(now, 9, 0, 0, -1, -2, -10, -11, -12, -13), 3, 4, 8, 9, 2, 8},
+		// No plays today yet: the streak ending yesterday is current.
+		{playsOn(now, 21, -1, -2), 2, 2, 2, 21, 0, 2},
+		// The last play was two days ago.
+		{playsOn(now, 8, -2, -3, -4), 0, 3, 3, 8, 0, 3},
+		// Streaks span months.
+		{playsOn(now, 7, -9, -10, -11), 0, 3, 3, 7, 0, 3},
+	}
+
+	for ii, tt := range tests {
+		got := computeListeningInsights(tt.events, now)
+		if got.CurrentStreak != tt.current || got.LongestStreak != tt.longest {
+			t.Errorf("[%d] streaks (current, longest) = (%d, %d), expected: (%d, %d)", ii, got.CurrentStreak, got.LongestStreak, tt.current, tt.longest)
+		}
+		if got.TotalPlays != tt.totalPlays {
+			t.Errorf("[%d] TotalPlays = %d, expected: %d", ii, got.TotalPlays, tt.totalPlays)
+		}
+		if got.BusiestHour != tt.hour || got.PlaysByHour[tt.hour] != tt.hours {
+			t.Errorf("[%d] busiest hour = %d (%d plays), expected: %d (%d plays)", ii, got.BusiestHour, got.PlaysByHour[got.BusiestHour], tt.hour, tt.hours)
+		}
+		if n := got.PlaysByWeekday[time.Wednesday]; n != tt.wednesdays {
+			t.Errorf("[%d] PlaysByWeekday[Wednesday] = %d, expected: %d", ii, n, tt.wednesdays)
+		}
+	}
+}
+
+func TestInsightsCache(t *testing.T) {
+	today := time.Date(2015, time.June, 10, 23, 0, 0, 0, time.Local)
+	s := &testHistoryStore{events: playsOn(today, 12, 0, -1)}
+	c := &insightsCache{store: s}
+
+	if got := c.get(today).CurrentStreak; got != 2 {
+		t.Errorf("CurrentStreak = %d, expected: %d", got, 2)
+	}
+	c.get(today.Add(30 * time.Minute))
+	if s.calls != 1 {
+		t.Errorf("Recent() called %d times on the same day, expected: %d", s.calls, 1)
+	}
+
+	// After midnight the streak still includes yesterday, but not the day before it.
+	if got := c.get(today.Add(2 * time.Hour)).CurrentStreak; got != 2 {
+		t.Errorf("CurrentStreak the next day = %d, expected: %d", got, 2)
+	}
+	if got := c.get(today.Add(26 * time.Hour)).CurrentStreak; got != 0 {
+		t.Errorf("CurrentStreak two days later = %d, expected: %d", got, 0)
+	}
+	if s.calls != 3 {
+		t.Errorf("Recent() called %d times over three days, expected: %d", s.calls, 3)
+	}
+
+	c.Invalidate()
+	c.get(today.Add(26 * time.Hour))
+	if s.calls != 4 {
+		t.Errorf("Recent() called %d times after Invalidate(), expected: %d", s.calls, 4)
+	}
+}
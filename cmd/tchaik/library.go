@@ -14,6 +14,7 @@ import (
 
 	"tchaik.com/index"
 	"tchaik.com/index/attr"
+	"tchaik.com/index/remote"
 	"tchaik.com/store"
 )
 
@@ -21,13 +22,28 @@ import (
 type Library struct {
 	index.Library
 
-	collections map[string]index.Collection
-	filters     map[string]index.Filter
-	recent      Lister
-	searcher    index.Searcher
+	collections   map[string]index.Collection
+	filters       *filterSet
+	distributions map[string]*bootstrapDistribution
+	recent        Lister
+	recentlyAdded Lister
+	stats         *bootstrapStats
+	totals        *totalsCache
+	trackPaths    *bootstrapTrackPaths
+	searchRanks   *searchRankCache
+	searcher      index.Searcher
+	searchers     map[string]index.Searcher
+	fuzzy         map[string]index.Searcher // fuzzy searchers for each mode
+	remote        remote.Store              // remote items, which are kept across rescans
 }
 
-func NewLibrary(l index.Library) Library {
+// searchFields are the fields included in the search index.  Each can also be searched
+// on its own by qualifying search terms with the (lower-case) field name, i.e. "artist:bach".
+var searchFields = []string{"Composer", "Artist", "Album", "Name"}
+
+// NewLibrary builds a Library from the index.Library.  The remote items in r (if non-nil) can
+// be fetched (and played) from the Root collection, see remoteCollection.
+func NewLibrary(l index.Library, r remote.Store) Library {
 	fmt.Printf("Building root collection...")
 	root := buildRootCollection(l)
 	fmt.Println("done.")
@@ -36,18 +52,76 @@ func NewLibrary(l index.Library) Library {
 	rootSplit := index.SubTransform(root, index.SplitList("Artist", "Composer"))
 	fmt.Println("done.")
 
+	wi := &bootstrapWordIndex{root: root, fields: searchFields}
+	fieldIndexes := make(map[string]index.WordIndex, len(searchFields))
+	for _, f := range searchFields {
+		fieldIndexes[f] = &bootstrapWordIndex{root: root, fields: []string{f}}
+	}
+
+	modes := map[string]func(index.WordIndex) index.Searcher{
+		"exact": func(wi index.WordIndex) index.Searcher {
+			return wi
+		},
+		"prefix": func(wi index.WordIndex) index.Searcher {
+			return index.BuildPrefixExpandSearcher(wi, wi, 10)
+		},
+		"substring": func(wi index.WordIndex) index.Searcher {
+			return index.BuildSubstringExpandSearcher(wi, wi)
+		},
+	}
+
+	newSearcher := func(build func(index.WordIndex) index.Searcher, fuzzy bool) index.Searcher {
+		fs := make(map[string]index.Searcher, len(fieldIndexes))
+		for f, fwi := range fieldIndexes {
+			fs[strings.ToLower(f)] = newBootstrapSearcher(fwi, build, fuzzy)
+		}
+		return index.FieldSearcher{
+			Searcher: newBootstrapSearcher(wi, build, fuzzy),
+			Fields:   fs,
+		}
+	}
+
+	searchers := make(map[string]index.Searcher, len(modes))
+	fuzzy := make(map[string]index.Searcher, len(modes))
+	for mode, build := range modes {
+		searchers[mode] = newSearcher(build, false)
+		fuzzy[mode] = newSearcher(build, true)
+	}
+
 	return Library{
 		Library: l,
 		collections: map[string]index.Collection{
-			"Root": root,
+			"Root": remoteCollection{root, r},
 		},
-		filters: map[string]index.Filter{
-			"Artist":   newBootstrapFilter(rootSplit, attr.Strings("Artist")),
-			"Composer": newBootstrapFilter(rootSplit, attr.Strings("Composer")),
+		filters: newFilterSet(rootSplit),
+		distributions: map[string]*bootstrapDistribution{
+			"Genre":  newBootstrapDistribution(l, attr.String("Genre")),
+			"Decade": newBootstrapDistribution(l, index.Decade("Year")),
 		},
-		recent:   &bootstrapRecent{root: root, n: 150},
-		searcher: newBootstrapSearcher(root),
+		recent:        &bootstrapRecent{root: root, n: 150},
+		recentlyAdded: &bootstrapRecentlyAdded{root: root},
+		stats:         &bootstrapStats{root: root},
+		totals:        newTotalsCache(),
+		trackPaths:    &bootstrapTrackPaths{root: root},
+		searchRanks:   newSearchRankCache(),
+		searcher:      searchers["prefix"],
+		searchers:     searchers,
+		fuzzy:         fuzzy,
+		remote:        r,
+	}
+}
+
+// Track implements index.Library, and also returns remote items.
+func (l Library) Track(identifier string) (index.Track, bool) {
+	if t, ok := l.Library.Track(identifier); ok {
+		return t, true
+	}
+	if l.remote != nil {
+		if i, ok := l.remote.Get(identifier); ok {
+			return i, true
+		}
 	}
+	return nil, false
 }
 
 type libraryFileSystem struct {
@@ -72,8 +146,11 @@ func (l *libraryFileSystem) Open(ctx context.Context, path string) (http.File, e
 }
 
 // Fetch fetches a Group and its corresponding Key given a path.  Returns an error if the path
-// is invalid.
-func (l *Library) Fetch(p index.Path) (index.Group, index.Key, error) {
+// is invalid, or ctx.Err() if the context has been cancelled.
+func (l *Library) Fetch(ctx context.Context, p index.Path) (index.Group, index.Key, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
 	if len(p) == 0 {
 		return nil, "", fmt.Errorf("invalid path: %v\n", p)
 	}
@@ -114,6 +191,97 @@ func (l *Library) FileSystem(fs store.FileSystem) store.FileSystem {
 	return store.Trace(&libraryFileSystem{fs, l.Library}, "libraryFileSystem")
 }
 
+// Walk calls fn for each track (and its path) in the Group identified by the Path.  The walk
+// is stopped (returning ctx.Err()) if the context is cancelled.
+func (l *Library) Walk(ctx context.Context, p index.Path, fn index.WalkFn) error {
+	g, _, err := l.Fetch(ctx, p)
+	if err != nil {
+		return err
+	}
+	return index.Walk(g, p, func(t index.Track, tp index.Path) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(t, tp)
+	})
+}
+
+// TrackFromPath returns the track identified by the Path.
+func (l *Library) TrackFromPath(p index.Path) (index.Track, error) {
+	if len(p) < 3 {
+		return nil, fmt.Errorf("invalid track path: %v", p)
+	}
+
+	var track index.Track
+	err := l.Walk(context.Background(), p[:len(p)-1], func(t index.Track, tp index.Path) error {
+		if tp.Equal(p) {
+			track = t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if track == nil {
+		return nil, fmt.Errorf("track not found: %v", p)
+	}
+	return track, nil
+}
+
+// RootPath returns the path in the Root collection for the Path, converting track ID paths
+// (["T", <track id>]) to the path of the track.
+func (l *Library) RootPath(p index.Path) (index.Path, bool) {
+	if len(p) == 2 && p[0] == "T" {
+		if rp, ok := l.trackPaths.Get(string(p[1])); ok {
+			return rp, true
+		}
+		if l.remote != nil {
+			if _, ok := l.remote.Get(string(p[1])); ok {
+				return remotePath(string(p[1])), true
+			}
+		}
+		return nil, false
+	}
+	return p, len(p) > 0 && p[0] == "Root"
+}
+
+// Exists returns true if the Path identifies a group or track in the library.
+func (l *Library) Exists(p index.Path) bool {
+	if _, _, err := l.Fetch(context.Background(), p); err == nil {
+		return true
+	}
+	_, err := l.TrackFromPath(p)
+	return err == nil
+}
+
+// fuzzySearchMode is the search mode which is the same as "prefix" with fuzzy matching, so
+// that fuzzy matching can be chosen as a mode (i.e. the connection default).
+const fuzzySearchMode = "fuzzy"
+
+// SearcherForMode returns the index.Searcher for the given search mode, which also matches
+// words within a bounded edit distance if fuzzy is true.  An empty mode returns the default
+// (prefix) searcher.
+func (l *Library) SearcherForMode(mode string, fuzzy bool) (index.Searcher, error) {
+	if mode == fuzzySearchMode {
+		mode, fuzzy = "prefix", true
+	}
+	if mode == "" && !fuzzy {
+		return l.searcher, nil
+	}
+	if mode == "" {
+		mode = "prefix"
+	}
+	searchers := l.searchers
+	if fuzzy {
+		searchers = l.fuzzy
+	}
+	s, ok := searchers[mode]
+	if !ok {
+		return nil, badField("unsupported search mode: %#v", mode)
+	}
+	return s, nil
+}
+
 // ExpandPaths constructs a collection (group) whose sub-groups are taken from the "Root"
 // collection.
 func (l *Library) ExpandPaths(paths []index.Path) index.Group {
@@ -0,0 +1,155 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/dhowden/tag"
+
+	"tchaik.com/index"
+	"tchaik.com/index/lyrics"
+	"tchaik.com/store"
+)
+
+// Sources of lyrics.
+const (
+	lyricsSourceEmbedded string = "embedded"
+	lyricsSourceProvider        = "provider"
+)
+
+// trackLyrics are the lyrics of a track, and where they came from.
+type trackLyrics struct {
+	lyrics.Lyrics
+	Source string `json:"source"`
+	Synced bool   `json:"synced"`
+}
+
+// lyricsEntry is a cached lookup of the lyrics of a track.
+type lyricsEntry struct {
+	id     string       // ID of the track at the path when the lyrics were read
+	lyrics *trackLyrics // nil if the track has no lyrics
+}
+
+// lyricsCache reads (and caches) the lyrics of tracks, keyed by path.  Lyrics are read from
+// the tags of the track, or (if there are none) fetched from the provider (if non-nil).
+type lyricsCache struct {
+	fs       store.FileSystem
+	provider lyrics.Provider
+
+	sync.Mutex
+	m map[string]lyricsEntry
+}
+
+func newLyricsCache(fs store.FileSystem, provider lyrics.Provider) *lyricsCache {
+	return &lyricsCache{
+		fs:       fs,
+		provider: provider,
+		m:        make(map[string]lyricsEntry),
+	}
+}
+
+// Get returns the lyrics of the track t with path p, or nil if it has none.  Entries are
+// dropped if the path no longer refers to the same track (i.e. after a rescan).  Errors from
+// the provider are not cached, so the lookup is retried by the next Get.
+func (c *lyricsCache) Get(p index.Path, t index.Track) (*trackLyrics, error) {
+	k := p.Encode()
+	id := t.GetString("ID")
+
+	c.Lock()
+	e, ok := c.m[k]
+	c.Unlock()
+	if ok && e.id == id {
+		return e.lyrics, nil
+	}
+
+	l, err := c.read(t)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	c.m[k] = lyricsEntry{id: id, lyrics: l}
+	c.Unlock()
+	return l, nil
+}
+
+func (c *lyricsCache) read(t index.Track) (*trackLyrics, error) {
+	if s := c.embedded(t.GetString("ID")); s != "" {
+		return newTrackLyrics(s, lyricsSourceEmbedded), nil
+	}
+	if c.provider == nil {
+		return nil, nil
+	}
+
+	s, err := c.provider.Lyrics(t.GetString("Artist"), t.GetString("Name"))
+	if err == lyrics.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTrackLyrics(s, lyricsSourceProvider), nil
+}
+
+// embedded returns the lyrics in the tags of the track with the given ID, or "" if there are
+// none (or the tags can't be read).
+func (c *lyricsCache) embedded(id string) string {
+	f, err := c.fs.Open(context.Background(), "/"+id)
+	if err != nil {
+		log.Printf("error opening track %v for lyrics: %v", id, err)
+		return ""
+	}
+	defer f.Close()
+
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		return ""
+	}
+	return m.Lyrics()
+}
+
+func newTrackLyrics(s, source string) *trackLyrics {
+	l := lyrics.Parse(s)
+	if l.Text == "" {
+		return nil
+	}
+	return &trackLyrics{
+		Lyrics: l,
+		Source: source,
+		Synced: l.Synced(),
+	}
+}
+
+// fetchLyrics responds with the lyrics of the track with the given path, which are null if
+// the track has none.  Synced lyrics include the time of each line.
+func (h *websocketHandler) fetchLyrics(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	t, err := h.lib.TrackFromPath(p)
+	if err != nil {
+		return invalidPath("path", err)
+	}
+
+	l, err := h.lyrics.Get(p, t)
+	if err != nil {
+		return fmt.Errorf("error fetching lyrics: %v", err)
+	}
+
+	resp.Data = struct {
+		Path   index.Path   `json:"path"`
+		Lyrics *trackLyrics `json:"lyrics"`
+	}{
+		Path:   p,
+		Lyrics: l,
+	}
+	return nil
+}
@@ -24,11 +24,17 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
 
 	"tchaik.com/index"
 	"tchaik.com/index/attr"
 
 	"tchaik.com/index/itl"
+	"tchaik.com/index/remote"
 	"tchaik.com/index/walk"
 	"tchaik.com/store"
 	"tchaik.com/store/cmdflag"
@@ -37,16 +43,50 @@ import (
 var debug bool
 var itlXML, tchLib, walkPath string
 
-var playHistoryPath, favouritesPath, checklistPath, playlistPath, cursorPath string
+var playHistoryPath, playCountPath, favouritesPath, checklistPath, ratingsPath, bookmarksPath, playlistPath, smartPlaylistPath, cursorPath, crossfadePath, rootOrderPath, remoteItemsPath string
 
 var listenAddr string
 var uiDir string
 var certFile, keyFile string
 
 var authUser, authPassword string
+var authGuestUser, authGuestPassword string
 
 var traceListenAddr string
 
+var nowPlayingInterval time.Duration
+
+var qualityMinBitRate int
+var qualityClipping bool
+
+var defaultCollection string
+
+var lastfmAPIKey, lastfmSecret, lastfmSessionKey string
+var lastfmThreshold float64
+
+var playThresholdFraction float64
+var playThresholdDuration time.Duration
+
+var castURL string
+
+var airplayURL string
+
+var userTokensPath string
+
+var ffmpegPath string
+
+var thumbnailCachePath string
+
+var peaksCachePath string
+
+var wsPingInterval, wsIdleTimeout time.Duration
+
+var playerIdleTTL time.Duration
+
+var lyricsURL string
+
+var writeTags bool
+
 func init() {
 	flag.BoolVar(&debug, "debug", false, "print debugging information")
 
@@ -59,17 +99,50 @@ func init() {
 	flag.StringVar(&walkPath, "path", "", "`directory` containing music files")
 
 	flag.StringVar(&playHistoryPath, "play-history", "history.json", "play history `file`")
+	flag.StringVar(&playCountPath, "play-counts", "playcounts.json", "play counts `file`")
 	flag.StringVar(&favouritesPath, "favourites", "favourites.json", "favourites `file`")
 	flag.StringVar(&checklistPath, "checklist", "checklist.json", "checklist `file`")
+	flag.StringVar(&ratingsPath, "ratings", "ratings.json", "ratings `file`")
+	flag.StringVar(&bookmarksPath, "bookmarks", "bookmarks.json", "playback bookmarks `file`")
 	flag.StringVar(&playlistPath, "playlists", "playlists.json", "playlists `file`")
+	flag.StringVar(&smartPlaylistPath, "smart-playlists", "smartplaylists.json", "smart playlists `file`")
 	flag.StringVar(&cursorPath, "cursors", "cursors.json", "cursors `file`")
+	flag.StringVar(&rootOrderPath, "root-order", "roots.json", "top-level collection order `file`")
+	flag.StringVar(&crossfadePath, "crossfade-overrides", "crossfade.json", "per-path crossfade overrides `file`")
+	flag.StringVar(&remoteItemsPath, "remote-items", "remote.json", "remote (radio and podcast) items `file`")
 
 	flag.StringVar(&uiDir, "ui-dir", "ui", "UI asset `directory`")
 
 	flag.StringVar(&authUser, "auth-user", "", "`user` to use for HTTP authentication (set to enable)")
 	flag.StringVar(&authPassword, "auth-password", "", "`password` to use for HTTP authentication")
+	flag.StringVar(&authGuestUser, "auth-guest-user", "", "`user` to use for read-only guest HTTP authentication")
+	flag.StringVar(&authGuestPassword, "auth-guest-password", "", "`password` to use for read-only guest HTTP authentication")
 
 	flag.StringVar(&traceListenAddr, "trace-listen", "", "bind `address` for trace HTTP server")
+
+	flag.StringVar(&defaultCollection, "default-collection", "Root", "`name` of the collection fetched by default")
+	flag.IntVar(&qualityMinBitRate, "quality-min-bitrate", 0, "flag tracks below this `bitrate` (kbps) in quality reports (set to enable)")
+	flag.BoolVar(&qualityClipping, "quality-clipping", false, "detect clipping in quality reports by decoding tracks with ffmpeg (see -peaks-cache)")
+	flag.IntVar(&recentlyAddedCount, "recently-added", 100, "`number` of tracks in the recently added list")
+	flag.StringVar(&lastfmAPIKey, "lastfm-api-key", "", "last.fm API `key` for scrobbling (set to enable)")
+	flag.StringVar(&lastfmSecret, "lastfm-secret", "", "last.fm API `secret` for scrobbling")
+	flag.StringVar(&lastfmSessionKey, "lastfm-session-key", "", "last.fm session `key` of the user to scrobble for")
+	flag.Float64Var(&lastfmThreshold, "lastfm-threshold", 0.5, "`fraction` of a track which must be played before it is scrobbled")
+	flag.Float64Var(&playThresholdFraction, "play-threshold", 0.5, "`fraction` of a track which must be played for the play to be recorded in play history and counts (0 to record all plays)")
+	flag.DurationVar(&playThresholdDuration, "play-threshold-duration", 4*time.Minute, "record plays of a track once this `duration` has been played, even if less than -play-threshold (0 to disable)")
+	flag.DurationVar(&nowPlayingInterval, "now-playing-interval", 5*time.Second, "default `interval` between rich now-playing updates")
+	flag.DurationVar(&wsPingInterval, "ws-ping-interval", 30*time.Second, "`interval` between websocket ping frames (0 to disable)")
+	flag.DurationVar(&wsIdleTimeout, "ws-idle-timeout", 90*time.Second, "close websocket connections which send nothing for this `duration` (0 to disable, must be longer than the UI keepalive interval of 20s)")
+	flag.DurationVar(&playerIdleTTL, "player-idle-ttl", 0, "remove browser players which have had no commands or status updates for this `duration` (set to enable)")
+	flag.StringVar(&thumbnailCachePath, "thumbnail-cache", "", "`path` to local artwork thumbnail cache (content addressable)")
+	flag.StringVar(&ffmpegPath, "ffmpeg", "ffmpeg", "path to ffmpeg `binary` used for transcoding (empty to disable)")
+	flag.StringVar(&peaksCachePath, "peaks-cache", "", "`directory` to cache waveform peaks of tracks, keyed by content hash (set to enable)")
+	flag.StringVar(&userTokensPath, "user-tokens", "", "JSON `file` mapping websocket tokens to user names, or to objects with a \"user\" and \"role\" (admin or guest) (set to enable per-user favourites, checklists, ratings and play history)")
+	flag.StringVar(&castURL, "cast-url", "", "base `URL` of this server as reachable by Chromecast devices, which must not require authentication (set to enable Chromecast players)")
+	flag.DurationVar(&prefetchLead, "prefetch-lead", 10*time.Second, "prefetch the next track of a player this `duration` before the current track ends (0 to disable)")
+	flag.BoolVar(&writeTags, "write-tags", false, "write ratings and favourites into the tags of track files (MP3 and FLAC), which modifies the files")
+	flag.StringVar(&lyricsURL, "lyrics-url", "", "`URL` template for fetching lyrics of tracks without embedded lyrics, where {artist} and {title} are replaced by those of the track (set to enable)")
+	flag.StringVar(&airplayURL, "airplay-url", "", "base `URL` of this server as reachable by AirPlay receivers, which must not require authentication (set to enable AirPlay players)")
 }
 
 type assignedCount int
@@ -82,56 +155,59 @@ func (e *assignedCount) check(list ...string) {
 	}
 }
 
-func readLibrary() (index.Library, error) {
+// readLibrary reads the library specified by the command line flags.  If the library was
+// built by walking a path then walked is the library before conversion, which can be used
+// for incremental rescans (see walk.Update).
+func readLibrary() (lib, walked index.Library, err error) {
 	e := assignedCount(0)
 	e.check(itlXML, tchLib, walkPath)
 
 	switch {
 	case e == 0:
-		return nil, fmt.Errorf("must specify one library file or a path to build one from (-itlXML, -lib or -path)")
+		return nil, nil, fmt.Errorf("must specify one library file or a path to build one from (-itlXML, -lib or -path)")
 	case e > 1:
-		return nil, fmt.Errorf("must only specify one library file or a path to build one from (-itlXML, -lib or -path)")
+		return nil, nil, fmt.Errorf("must only specify one library file or a path to build one from (-itlXML, -lib or -path)")
 	}
 
-	var lib index.Library
 	switch {
 	case tchLib != "":
 		f, err := os.Open(tchLib)
 		if err != nil {
-			return nil, fmt.Errorf("could not open Tchaik library file: %v", err)
+			return nil, nil, fmt.Errorf("could not open Tchaik library file: %v", err)
 		}
 		defer f.Close()
 
 		fmt.Printf("Parsing %v...", tchLib)
 		lib, err = index.ReadFrom(f)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing Tchaik library file: %v\n", err)
+			return nil, nil, fmt.Errorf("error parsing Tchaik library file: %v\n", err)
 		}
 		fmt.Println("done.")
-		return lib, nil
+		return lib, nil, nil
 
 	case itlXML != "":
 		f, err := os.Open(itlXML)
 		if err != nil {
-			return nil, fmt.Errorf("could open iTunes library file: %v", err)
+			return nil, nil, fmt.Errorf("could open iTunes library file: %v", err)
 		}
 		defer f.Close()
 
 		lib, err = itl.ReadFrom(f)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing iTunes library file: %v", err)
+			return nil, nil, fmt.Errorf("error parsing iTunes library file: %v", err)
 		}
 
 	case walkPath != "":
 		fmt.Printf("Walking %v...\n", walkPath)
 		lib = walk.NewLibrary(walkPath)
+		walked = lib
 		fmt.Println("Finished walking.")
 	}
 
 	fmt.Printf("Building Tchaik Library...")
 	lib = index.Convert(lib, "ID")
 	fmt.Println("done.")
-	return lib, nil
+	return lib, walked, nil
 }
 
 func buildRootCollection(l index.Library) index.Collection {
@@ -143,7 +219,7 @@ func buildRootCollection(l index.Library) index.Collection {
 func main() {
 	flag.Parse()
 
-	l, err := readLibrary()
+	l, walked, err := readLibrary()
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
 		os.Exit(1)
@@ -167,13 +243,41 @@ func main() {
 		}()
 	}
 
-	lib := NewLibrary(l)
+	items, err := remote.NewStore(remoteItemsPath)
+	if err != nil {
+		fmt.Printf("error loading remote items: %v\n", err)
+		os.Exit(1)
+	}
+
+	lib := NewLibrary(l, items)
+	if _, ok := lib.collections[defaultCollection]; !ok {
+		fmt.Printf("error: unknown default collection: %#v\n", defaultCollection)
+		os.Exit(1)
+	}
+
 	meta, err := loadLocalMeta()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	h := NewHandler(lib, meta, mediaFileSystem, artworkFileSystem)
+
+	if userTokensPath != "" {
+		userTokens, userTokenRoles, err = loadUserTokens(userTokensPath)
+		if err != nil {
+			fmt.Printf("error loading user tokens: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Removing missing favourites, checklist and playlist items...")
+	err = meta.Prune(lib)
+	if err != nil {
+		fmt.Printf("\nerror removing missing favourites, checklist and playlist items: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("done.")
+	h := NewHandler(newSharedLibrary(lib, walked), meta, mediaFileSystem, artworkFileSystem)
+	go flushOnSignal(meta)
 
 	if certFile != "" && keyFile != "" {
 		fmt.Printf("Web server is running on https://%v\n", listenAddr)
@@ -186,11 +290,37 @@ func main() {
 				MinVersion: tls.VersionTLS10,
 			},
 		}
-		log.Fatal(server.ListenAndServeTLS(certFile, keyFile))
+		// HTTP/2 multiplexes concurrent requests (i.e. streams and range requests when
+		// seeking) over a single connection.
+		if err := http2.ConfigureServer(server, nil); err != nil {
+			fmt.Printf("error configuring HTTP/2: %v\n", err)
+			os.Exit(1)
+		}
+		err := server.ListenAndServeTLS(certFile, keyFile)
+		flushMeta(meta)
+		log.Fatal(err)
 	}
 
 	fmt.Printf("Web server is running on http://%v\n", listenAddr)
 	fmt.Println("Quit the server with CTRL-C.")
 
-	log.Fatal(http.ListenAndServe(listenAddr, h))
+	err = http.ListenAndServe(listenAddr, h)
+	flushMeta(meta)
+	log.Fatal(err)
+}
+
+// flushOnSignal exits when the process is interrupted or terminated, after writing any pending
+// metadata changes (see Meta.Flush).
+func flushOnSignal(m *Meta) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	<-ch
+	flushMeta(m)
+	os.Exit(0)
+}
+
+func flushMeta(m *Meta) {
+	if err := m.Flush(); err != nil {
+		log.Printf("error writing metadata: %v", err)
+	}
 }
@@ -6,44 +6,51 @@ package main
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"tchaik.com/index"
-	"tchaik.com/index/checklist"
+	"tchaik.com/index/crossfade"
 	"tchaik.com/index/cursor"
-	"tchaik.com/index/favourite"
-	"tchaik.com/index/history"
+	"tchaik.com/index/playcount"
 	"tchaik.com/index/playlist"
+	"tchaik.com/index/rating"
+	"tchaik.com/index/rootorder"
+	"tchaik.com/index/smart"
 )
 
-// Meta is a container for extra metadata which wraps the central media library.
-// TODO: Refactor meta to be user-specific.
+// Meta is a container for extra metadata which wraps the central media library.  The
+// metadata in userMeta is specific to a user (see ForUser), everything else is shared.
 type Meta struct {
-	history    history.Store
-	favourites favourite.Store
-	checklist  checklist.Store
+	// playback serialises changes which span the playlist and cursor stores.
+	playback *sync.Mutex
+
+	*userMeta
+	users *userStores
+
+	playCounts playcount.Store
 	playlists  playlist.Store
+	smart      smart.Store
 	cursors    cursor.Store
+	crossfade  crossfade.Store
+	rootOrder  rootorder.Store
+
+	scrobbler *scrobbler
+	prefetch  *prefetcher // set once the media file system is created
 }
 
 func loadLocalMeta() (*Meta, error) {
-	fmt.Printf("Loading play history...")
-	playHistoryStore, err := history.NewStore(playHistoryPath)
-	if err != nil {
-		return nil, fmt.Errorf("error loading play history: %v", err)
-	}
-	fmt.Println("done.")
-
-	fmt.Printf("Loading favourites...")
-	favouriteStore, err := favourite.NewStore(favouritesPath)
+	fmt.Printf("Loading play history, favourites, checklist, ratings and bookmarks...")
+	u, err := loadUserMeta("")
 	if err != nil {
-		return nil, fmt.Errorf("\nerror loading favourites: %v", err)
+		return nil, fmt.Errorf("\n%v", err)
 	}
 	fmt.Println("done.")
 
-	fmt.Printf("Loading checklist...")
-	checklistStore, err := checklist.NewStore(checklistPath)
+	fmt.Printf("Loading play counts...")
+	playCountStore, err := playcount.NewStore(playCountPath)
 	if err != nil {
-		return nil, fmt.Errorf("\nerror loading checklist: %v", err)
+		return nil, fmt.Errorf("\nerror loading play counts: %v", err)
 	}
 	fmt.Println("done.")
 
@@ -58,6 +65,13 @@ func loadLocalMeta() (*Meta, error) {
 	}
 	fmt.Println("done")
 
+	fmt.Printf("Loading smart playlists...")
+	smartStore, err := smart.NewStore(smartPlaylistPath)
+	if err != nil {
+		return nil, fmt.Errorf("\nerror loading smart playlists: %v", err)
+	}
+	fmt.Println("done")
+
 	fmt.Printf("Loading cursors...")
 	cursorStore, err := cursor.NewStore(cursorPath)
 	if err != nil {
@@ -65,15 +79,69 @@ func loadLocalMeta() (*Meta, error) {
 	}
 	fmt.Println("done")
 
+	fmt.Printf("Loading crossfade overrides...")
+	crossfadeStore, err := crossfade.NewStore(crossfadePath)
+	if err != nil {
+		return nil, fmt.Errorf("\nerror loading crossfade overrides: %v", err)
+	}
+	fmt.Println("done")
+
+	fmt.Printf("Loading root order...")
+	rootOrderStore, err := rootorder.NewStore(rootOrderPath)
+	if err != nil {
+		return nil, fmt.Errorf("\nerror loading root order: %v", err)
+	}
+	fmt.Println("done")
+
+	var s *scrobbler
+	if lastfmAPIKey != "" {
+		s = newScrobbler(newLastfmClient(lastfmAPIKey, lastfmSecret, lastfmSessionKey), lastfmThreshold, time.Minute)
+	}
+
 	return &Meta{
-		history:    playHistoryStore,
-		favourites: favouriteStore,
-		checklist:  checklistStore,
+		playback:   &sync.Mutex{},
+		userMeta:   u,
+		users:      newUserStores(u),
+		playCounts: playCountStore,
 		playlists:  playlistStore,
+		smart:      smartStore,
 		cursors:    cursorStore,
+		crossfade:  crossfadeStore,
+		rootOrder:  rootOrderStore,
+		scrobbler:  s,
 	}, nil
 }
 
+// Prune removes favourites, checklist items and playlist items with paths which no longer
+// exist in the library.  Only the favourites and checklists of loaded users are pruned.
+func (m *Meta) Prune(l Library) error {
+	for _, u := range m.users.List() {
+		for _, p := range u.favourites.List() {
+			if !l.Exists(p) {
+				if err := u.favourites.Set(p, false); err != nil {
+					return err
+				}
+			}
+		}
+		for _, p := range u.checklist.List() {
+			if !l.Exists(p) {
+				if err := u.checklist.Set(p, false); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, name := range m.playlists.Names() {
+		p := m.playlists.Get(name)
+		if p.Prune(l.Exists) > 0 {
+			if err := m.playlists.Set(name, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 type metaFieldGrp struct {
 	index.Group
 
@@ -102,8 +170,8 @@ func (mfc metaFieldCol) Field(f string) interface{} {
 	return mfc.Collection.Field(f)
 }
 
-func newMetaField(g index.Group, field string, value bool) index.Group {
-	if !value {
+func newMetaField(g index.Group, field string, value interface{}) index.Group {
+	if value == nil || value == false {
 		return g
 	}
 	if c, ok := g.(index.Collection); ok {
@@ -122,8 +190,17 @@ func newMetaField(g index.Group, field string, value bool) index.Group {
 	}
 }
 
+// PlayCount returns the play count of the track with the given ID.
+func (m *Meta) PlayCount(id string) int {
+	return m.playCounts.Get(index.Path{"T", index.Key(id)})
+}
+
 // Annotate adds any meta information to the Group (identified by Path).
 func (m *Meta) Annotate(p index.Path, g index.Group) index.Group {
 	g = newMetaField(g, "Favourite", m.favourites.Get(p))
-	return newMetaField(g, "Checklist", m.checklist.Get(p))
+	g = newMetaField(g, "Checklist", m.checklist.Get(p))
+	if r := m.ratings.Get(p); r != rating.None {
+		g = newMetaField(g, "Rating", int(r))
+	}
+	return newMetaField(g, "NoCrossfade", m.crossfade.Get(p))
 }
@@ -0,0 +1,300 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"golang.org/x/net/websocket"
+)
+
+// MsgPack is a websocket.Codec which sends and receives MessagePack encoded values in
+// binary frames.  Values are first encoded using encoding/json so that the MessagePack
+// representation mirrors the JSON one (including any custom json.Marshaler implementations).
+var MsgPack = websocket.Codec{
+	Marshal:   msgpackMarshal,
+	Unmarshal: msgpackUnmarshal,
+}
+
+func msgpackMarshal(v interface{}) ([]byte, byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, websocket.BinaryFrame, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var x interface{}
+	err = dec.Decode(&x)
+	if err != nil {
+		return nil, websocket.BinaryFrame, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = encodeMsgPack(buf, x)
+	return buf.Bytes(), websocket.BinaryFrame, err
+}
+
+func msgpackUnmarshal(data []byte, payloadType byte, v interface{}) error {
+	x, err := decodeMsgPack(bytes.NewReader(data), maxMsgPackDepth)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func writeUint(w *bytes.Buffer, code byte, n uint64, size int) {
+	w.WriteByte(code)
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	w.Write(b[8-size:])
+}
+
+func encodeMsgPackLen(w *bytes.Buffer, n int, fix, fixMax byte, code8, code16, code32 byte) {
+	switch {
+	case n <= int(fixMax):
+		w.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		writeUint(w, code8, uint64(n), 1)
+	case n <= math.MaxUint16:
+		writeUint(w, code16, uint64(n), 2)
+	default:
+		writeUint(w, code32, uint64(n), 4)
+	}
+}
+
+// encodeMsgPack writes the MessagePack encoding of x, which must be a value produced by
+// decoding JSON (with json.Number for numbers).
+func encodeMsgPack(w *bytes.Buffer, x interface{}) error {
+	switch x := x.(type) {
+	case nil:
+		w.WriteByte(0xc0)
+
+	case bool:
+		if x {
+			w.WriteByte(0xc3)
+		} else {
+			w.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			switch {
+			case n >= 0 && n <= 0x7f:
+				w.WriteByte(byte(n))
+			case n < 0 && n >= -32:
+				w.WriteByte(byte(n))
+			default:
+				writeUint(w, 0xd3, uint64(n), 8)
+			}
+			return nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return err
+		}
+		writeUint(w, 0xcb, math.Float64bits(f), 8)
+
+	case string:
+		encodeMsgPackLen(w, len(x), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		w.WriteString(x)
+
+	case []interface{}:
+		encodeMsgPackLen(w, len(x), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, v := range x {
+			if err := encodeMsgPack(w, v); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		encodeMsgPackLen(w, len(x), 0x80, 15, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			encodeMsgPack(w, k)
+			if err := encodeMsgPack(w, x[k]); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("msgpack: unsupported type: %T", x)
+	}
+	return nil
+}
+
+func readN(r *bytes.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func readUint(r *bytes.Reader, size int) (uint64, error) {
+	b, err := readN(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, x := range b {
+		n = n<<8 | uint64(x)
+	}
+	return n, nil
+}
+
+// maxMsgPackDepth is the maximum nesting depth of arrays and maps in decoded values.
+const maxMsgPackDepth = 64
+
+// decodeMsgPack reads a MessagePack encoded value from r.  Numbers are returned as float64,
+// and maps as map[string]interface{}, to match the output of encoding/json.  Arrays and maps
+// can be nested at most depth levels.
+func decodeMsgPack(r *bytes.Reader, depth int) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return decodeMsgPackString(r, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return decodeMsgPackArray(r, int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return decodeMsgPackMap(r, int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xca:
+		n, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := readUint(r, 8)
+		return math.Float64frombits(n), err
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readUint(r, 1<<(c-0xcc))
+		return float64(n), err
+
+	case 0xd0:
+		n, err := readUint(r, 1)
+		return float64(int8(n)), err
+	case 0xd1:
+		n, err := readUint(r, 2)
+		return float64(int16(n)), err
+	case 0xd2:
+		n, err := readUint(r, 4)
+		return float64(int32(n)), err
+	case 0xd3:
+		n, err := readUint(r, 8)
+		return float64(int64(n)), err
+
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUint(r, 1<<(c-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackString(r, int(n))
+
+	case 0xc4, 0xc5, 0xc6: // bin, treated as string
+		n, err := readUint(r, 1<<(c-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackString(r, int(n))
+
+	case 0xdc, 0xdd:
+		n, err := readUint(r, 2<<(c-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackArray(r, int(n), depth)
+
+	case 0xde, 0xdf:
+		n, err := readUint(r, 2<<(c-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackMap(r, int(n), depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type code: %#x", c)
+}
+
+func decodeMsgPackString(r *bytes.Reader, n int) (interface{}, error) {
+	if n > r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b, err := readN(r, n)
+	return string(b), err
+}
+
+func decodeMsgPackArray(r *bytes.Reader, n, depth int) (interface{}, error) {
+	if depth <= 0 {
+		return nil, fmt.Errorf("msgpack: maximum nesting depth (%d) exceeded", maxMsgPackDepth)
+	}
+	if n > r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	result := make([]interface{}, n)
+	for i := range result {
+		v, err := decodeMsgPack(r, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+func decodeMsgPackMap(r *bytes.Reader, n, depth int) (interface{}, error) {
+	if depth <= 0 {
+		return nil, fmt.Errorf("msgpack: maximum nesting depth (%d) exceeded", maxMsgPackDepth)
+	}
+	if n > r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	result := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := decodeMsgPack(r, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: expected string map key, got %T", k)
+		}
+		v, err := decodeMsgPack(r, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		result[ks] = v
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	tests := []interface{}{
+		nil,
+		true,
+		false,
+		float64(0),
+		float64(127),
+		float64(-32),
+		float64(-33),
+		float64(1 << 40),
+		1.5,
+		"",
+		"hello",
+		strings.Repeat("x", 300),
+		[]interface{}{"a", float64(1), nil},
+		map[string]interface{}{
+			"action": "FETCH",
+			"data": map[string]interface{}{
+				"path": []interface{}{"Root", "Album"},
+			},
+		},
+	}
+
+	for ii, tt := range tests {
+		b, _, err := msgpackMarshal(tt)
+		if err != nil {
+			t.Errorf("[%d] unexpected error from msgpackMarshal(%#v): %v", ii, tt, err)
+			continue
+		}
+
+		var got interface{}
+		err = msgpackUnmarshal(b, 0, &got)
+		if err != nil {
+			t.Errorf("[%d] unexpected error from msgpackUnmarshal: %v", ii, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt) {
+			t.Errorf("[%d] round trip = %#v, expected: %#v", ii, got, tt)
+		}
+	}
+}
+
+func TestMsgPackCommand(t *testing.T) {
+	b, _, err := msgpackMarshal(map[string]interface{}{
+		"action": "SEARCH",
+		"data":   map[string]interface{}{"input": "ravel"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var c Command
+	err = msgpackUnmarshal(b, 0, &c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Action != "SEARCH" {
+		t.Errorf("c.Action = %#v, expected: %#v", c.Action, "SEARCH")
+	}
+	if input, _ := c.getString("input"); input != "ravel" {
+		t.Errorf("c.getString(\"input\") = %#v, expected: %#v", input, "ravel")
+	}
+}
+
+func TestMsgPackDepth(t *testing.T) {
+	nested := func(n int) []byte {
+		// n nested single element arrays containing nil.
+		return append(bytes.Repeat([]byte{0x91}, n), 0xc0)
+	}
+
+	tests := []struct {
+		depth int
+		ok    bool
+	}{
+		{1, true},
+		{maxMsgPackDepth, true},
+		{maxMsgPackDepth + 1, false},
+		{1000000, false},
+	}
+
+	for _, tt := range tests {
+		var got interface{}
+		err := msgpackUnmarshal(nested(tt.depth), 0, &got)
+		if (err == nil) != tt.ok {
+			t.Errorf("msgpackUnmarshal(<%d nested arrays>) error = %v, expected ok: %v", tt.depth, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+	"tchaik.com/player"
+	"tchaik.com/store"
+)
+
+// reportStatus sets the status of the player identified by key from the fields in
+// the Command.
+func (h *websocketHandler) reportStatus(key string, c Command) error {
+	if h.players.Get(key) == nil {
+		return unknownPlayer(key)
+	}
+
+	trackID, _ := c.getString("trackID")
+	playing, _ := c.getBool("playing")
+	t, _ := c.getFloat("time")
+
+	st := player.Status{
+		TrackID: trackID,
+		Playing: playing,
+		Time:    t,
+	}
+	h.players.SetStatus(key, st)
+	h.meta.prefetchNext(h.lib, key, st)
+
+	if _, ok := c.Data["volume"]; ok {
+		v, err := c.getFloat("volume")
+		if err != nil {
+			return err
+		}
+		h.players.SetVolumeState(key, v)
+	}
+
+	if playing {
+		if track, ok := h.lib.Track(trackID); ok {
+			h.meta.scrobbler.Update(key, track, t)
+			if err := h.meta.bookmarks.Update(track, t); err != nil {
+				log.Printf("error updating bookmark for track %#v: %v", trackID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// playerState is the state of a player as returned by the player LIST action.
+type playerState struct {
+	player.State
+	// Path is the path of the loaded track in the Root collection.
+	Path index.Path `json:"path,omitempty"`
+}
+
+// playerStates returns the state of each player, including the path of its loaded track.
+func (h *websocketHandler) playerStates() []playerState {
+	states := h.players.States()
+	result := make([]playerState, len(states))
+	for i, st := range states {
+		result[i].State = st
+		if st.TrackID != "" {
+			result[i].Path, _ = h.lib.RootPath(index.Path{"T", index.Key(st.TrackID)})
+		}
+	}
+	return result
+}
+
+// playerStatusInterval is the default interval between pushed player status updates (see
+// subscribePlayerStatus).
+const playerStatusInterval = 1 * time.Second
+
+// minPushInterval is the smallest interval between pushed updates which can be requested.
+const minPushInterval = 100 * time.Millisecond
+
+// getInterval returns the interval (in seconds) in the field f of the Command, or def if the
+// field is not set.  Intervals shorter than minPushInterval are rejected.
+func (c Command) getInterval(f string, def time.Duration) (time.Duration, error) {
+	if _, ok := c.Data[f]; !ok {
+		return def, nil
+	}
+	secs, err := c.getFloat(f)
+	if err != nil {
+		return 0, err
+	}
+	// Checked after conversion, so that tiny values can't become 0 (time.NewTicker panics).
+	interval := time.Duration(secs * float64(time.Second))
+	if interval < minPushInterval {
+		return 0, badField("invalid %s: %v (must be at least %v seconds)", f, secs, minPushInterval.Seconds())
+	}
+	return interval, nil
+}
+
+// playerStatus is the status of a player pushed to subscribed connections.
+type playerStatus struct {
+	playerState
+	// Duration is the duration (in seconds) of the loaded track.
+	Duration float64       `json:"duration,omitempty"`
+	Track    *trackSummary `json:"track,omitempty"`
+}
+
+// playerStatusSubscription returns the name of the status subscription for the player
+// identified by key.
+func playerStatusSubscription(key string) string {
+	return fmt.Sprintf("%v:%v", ActionPlayer, key)
+}
+
+// playerStatus returns the status of the player identified by key, and false if there is no
+// such player.
+func (h *websocketHandler) playerStatus(key string) (playerStatus, bool) {
+	st, ok := h.players.State(key)
+	if !ok {
+		return playerStatus{}, false
+	}
+
+	ps := playerStatus{
+		playerState: playerState{State: st},
+	}
+	if st.TrackID == "" {
+		return ps, true
+	}
+
+	l := h.libs.Get() // called from subscriptions, so can't use h.lib
+	if t, ok := l.Track(st.TrackID); ok {
+		ps.Duration = float64(t.GetInt("TotalTime")) / 1000
+		if p, ok := l.RootPath(index.Path{"T", index.Key(st.TrackID)}); ok {
+			ps.Path = p
+			ts := newTrackSummary(t, p)
+			ps.Track = &ts
+		}
+	}
+	return ps, true
+}
+
+// subscribePlayerStatus subscribes the connection to the status (position, state and loaded
+// track) of the player identified by key, which is sent every interval (in seconds, set in
+// the Command) and whenever the status is reported.  Responds with the current status.
+func (h *websocketHandler) subscribePlayerStatus(key string, c Command, resp *Response) error {
+	st, ok := h.playerStatus(key)
+	if !ok {
+		return unknownPlayer(key)
+	}
+
+	interval, err := c.getInterval("interval", playerStatusInterval)
+	if err != nil {
+		return err
+	}
+
+	h.subscribe(playerStatusSubscription(key), func(done <-chan struct{}) {
+		h.pushPlayerStatus(key, interval, done)
+	})
+	resp.Data = playerStatusResponse(st)
+	return nil
+}
+
+// playerStatusResponse returns the data of a player STATUS Response.
+func playerStatusResponse(st playerStatus) interface{} {
+	return struct {
+		Action string `json:"action"`
+		playerStatus
+	}{
+		Action:       "STATUS",
+		playerStatus: st,
+	}
+}
+
+// pushPlayerStatus sends the status of the player identified by key every interval, and
+// whenever its status is reported.  Returns when done is closed, the player is removed, or
+// if an error occurs sending.
+func (h *websocketHandler) pushPlayerStatus(key string, interval time.Duration, done <-chan struct{}) {
+	ch, stop := h.players.Watch(key)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ch:
+		case <-ticker.C:
+		}
+
+		st, ok := h.playerStatus(key)
+		if !ok {
+			return
+		}
+		err := h.send(&Response{
+			Action: ActionPlayer,
+			Data:   playerStatusResponse(st),
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// richNowPlaying is a composite representation of the now-playing state of a player,
+// intended for display clients.
+type richNowPlaying struct {
+	Key      string  `json:"key"`
+	Playing  bool    `json:"playing"`
+	Time     float64 `json:"time"`
+	Progress float64 `json:"progress"`
+
+	Track      *nowPlayingTrack `json:"track,omitempty"`
+	ArtworkURL string           `json:"artworkURL,omitempty"`
+	Palette    []string         `json:"palette,omitempty"`
+}
+
+type nowPlayingTrack struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name,omitempty"`
+	Album     string   `json:"album,omitempty"`
+	Artist    []string `json:"artist,omitempty"`
+	Composer  []string `json:"composer,omitempty"`
+	Year      int      `json:"year,omitempty"`
+	TotalTime int      `json:"totalTime,omitempty"`
+}
+
+func (h *websocketHandler) richNowPlaying(key string) richNowPlaying {
+	st := h.players.Status(key)
+	np := richNowPlaying{
+		Key:     key,
+		Playing: st.Playing,
+		Time:    st.Time,
+	}
+	if st.TrackID == "" {
+		return np
+	}
+
+	t, ok := h.libs.Track(st.TrackID) // called from subscriptions, so can't use h.lib
+	if !ok {
+		return np
+	}
+
+	np.Track = &nowPlayingTrack{
+		ID:        st.TrackID,
+		Name:      t.GetString("Name"),
+		Album:     t.GetString("Album"),
+		Artist:    t.GetStrings("Artist"),
+		Composer:  t.GetStrings("Composer"),
+		Year:      t.GetInt("Year"),
+		TotalTime: t.GetInt("TotalTime"),
+	}
+	if total := t.GetInt("TotalTime"); total > 0 {
+		np.Progress = 1000 * st.Time / float64(total)
+	}
+
+	if palette, ok := h.palettes.Get(st.TrackID); ok {
+		np.ArtworkURL = "/artwork/" + st.TrackID
+		np.Palette = palette
+	}
+	return np
+}
+
+func (h *websocketHandler) nowPlayingRich(c Command, resp *Response) error {
+	action, err := c.getString("action")
+	if err != nil {
+		return err
+	}
+
+	key, err := c.getString("key")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%v:%v", ActionNowPlayingRich, key)
+	switch action {
+	case "SUBSCRIBE":
+		if h.players.Get(key) == nil {
+			return unknownPlayer(key)
+		}
+		interval, err := c.getInterval("interval", nowPlayingInterval)
+		if err != nil {
+			return err
+		}
+		h.subscribe(name, func(done <-chan struct{}) {
+			h.pushNowPlayingRich(key, interval, done)
+		})
+
+	case "UNSUBSCRIBE":
+		h.unsubscribe(name)
+
+	default:
+		return badField("unknown action: %v", action)
+	}
+
+	resp.Data = h.richNowPlaying(key)
+	return nil
+}
+
+// pushNowPlayingRich sends the rich now-playing representation of the player identified by
+// key every interval, and whenever the track changes.  Returns when done is closed or if an
+// error occurs sending.
+func (h *websocketHandler) pushNowPlayingRich(key string, interval time.Duration, done <-chan struct{}) {
+	ch, stop := h.players.Watch(key)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := h.players.Status(key).TrackID
+	for {
+		select {
+		case <-done:
+			return
+
+		case st := <-ch:
+			if st.TrackID == last {
+				continue
+			}
+			last = st.TrackID
+
+		case <-ticker.C:
+		}
+
+		err := h.send(&Response{
+			Action: ActionNowPlayingRich,
+			Data:   h.richNowPlaying(key),
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// paletteSize is the maximum number of colours in a palette.
+const paletteSize = 5
+
+// paletteCache computes (and caches) colour palettes from track artwork.
+type paletteCache struct {
+	fs store.FileSystem
+
+	sync.Mutex
+	m map[string][]string
+}
+
+func newPaletteCache(fs store.FileSystem) *paletteCache {
+	return &paletteCache{
+		fs: fs,
+		m:  make(map[string][]string),
+	}
+}
+
+// Get returns the palette of the artwork for the track with the given ID, and true if
+// the track has artwork (false otherwise).
+func (p *paletteCache) Get(id string) ([]string, bool) {
+	p.Lock()
+	palette, ok := p.m[id]
+	p.Unlock()
+	if ok {
+		return palette, palette != nil
+	}
+
+	palette, err := p.palette(id)
+	if err != nil {
+		palette = nil
+	}
+
+	p.Lock()
+	p.m[id] = palette
+	p.Unlock()
+	return palette, palette != nil
+}
+
+func (p *paletteCache) palette(id string) ([]string, error) {
+	f, err := p.fs.Open(context.Background(), "/"+id)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return imagePalette(img, paletteSize), nil
+}
+
+type colourBucket struct {
+	n       int
+	r, g, b int
+}
+
+// colourBucketSlice is a convenience type for sorting colourBuckets by size (largest first).
+type colourBucketSlice []*colourBucket
+
+func (c colourBucketSlice) Len() int           { return len(c) }
+func (c colourBucketSlice) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c colourBucketSlice) Less(i, j int) bool { return c[i].n > c[j].n }
+
+// imagePalette computes the n most common colours in the image (quantised to 4 bits per
+// channel), returned as hex strings (i.e. "#ff0000").
+func imagePalette(img image.Image, n int) []string {
+	bounds := img.Bounds()
+	step := 1
+	if px := bounds.Dx() * bounds.Dy(); px > 10000 {
+		step = px / 10000
+	}
+
+	buckets := make(map[int]*colourBucket)
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i++
+			if i%step != 0 {
+				continue
+			}
+			r, g, b, _ := img.At(x, y).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+			k := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+			cb, ok := buckets[k]
+			if !ok {
+				cb = &colourBucket{}
+				buckets[k] = cb
+			}
+			cb.n++
+			cb.r += int(r)
+			cb.g += int(g)
+			cb.b += int(b)
+		}
+	}
+
+	list := make([]*colourBucket, 0, len(buckets))
+	for _, cb := range buckets {
+		list = append(list, cb)
+	}
+	sort.Stable(colourBucketSlice(list))
+	if len(list) > n {
+		list = list[:n]
+	}
+
+	palette := make([]string, len(list))
+	for i, cb := range list {
+		palette[i] = fmt.Sprintf("#%02x%02x%02x", cb.r/cb.n, cb.g/cb.n, cb.b/cb.n)
+	}
+	return palette
+}
@@ -0,0 +1,341 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+	"tchaik.com/store"
+)
+
+// Audio is decoded to mono PCM at peakSampleRate to compute peaks, each of which is the
+// maximum amplitude of peakBlockSize samples (i.e. 100 peaks per second).  These are the
+// most detailed peaks available, and are downsampled to the resolution requested.
+const (
+	peakSampleRate = 8000
+	peakBlockSize  = 80
+)
+
+// defaultPeakPoints is the number of peaks returned when the resolution isn't given.
+const defaultPeakPoints = 1000
+
+// readPeaks reads signed 16-bit little-endian mono PCM from r, and returns the maximum
+// (absolute) amplitude of each block of peakBlockSize samples.
+func readPeaks(r io.Reader) ([]uint16, error) {
+	br := bufio.NewReader(r)
+	var peaks []uint16
+	var peak uint16
+	n := 0
+	b := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(br, b); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		s := int(int16(binary.LittleEndian.Uint16(b)))
+		if s < 0 {
+			s = -s
+		}
+		if s > math.MaxInt16 {
+			s = math.MaxInt16
+		}
+		if uint16(s) > peak {
+			peak = uint16(s)
+		}
+		n++
+		if n == peakBlockSize {
+			peaks = append(peaks, peak)
+			peak, n = 0, 0
+		}
+	}
+	if n > 0 {
+		peaks = append(peaks, peak)
+	}
+	return peaks, nil
+}
+
+// downsamplePeaks returns n peaks, each of which is the maximum of a (contiguous) range of
+// p.  If n is larger than len(p) then p is returned.
+func downsamplePeaks(p []uint16, n int) []uint16 {
+	if n >= len(p) {
+		return p
+	}
+	result := make([]uint16, n)
+	for i := range result {
+		lo, hi := i*len(p)/n, (i+1)*len(p)/n
+		for _, x := range p[lo:hi] {
+			if x > result[i] {
+				result[i] = x
+			}
+		}
+	}
+	return result
+}
+
+// peaksCache computes the peaks of tracks, caching them (if dir is non-empty) in files
+// named by the content hash of the track.
+type peaksCache struct {
+	fs  store.FileSystem
+	dir string
+
+	sync.Mutex
+	hashes map[string]fileHash // track ID -> content hash, to avoid re-reading tracks
+}
+
+// fileHash is the content hash of a file with the given modification time and size.
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+func newPeaksCache(fs store.FileSystem, dir string) *peaksCache {
+	return &peaksCache{
+		fs:     fs,
+		dir:    dir,
+		hashes: make(map[string]fileHash),
+	}
+}
+
+// Get returns the peaks of the track, computing (and caching) them if necessary.  The content
+// hash of the track is re-computed if its file has been modified (i.e. its modification time
+// or size has changed).
+func (c *peaksCache) Get(ctx context.Context, t index.Track) ([]uint16, error) {
+	id := t.GetString("ID")
+	f, err := c.fs.Open(ctx, "/"+id)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	h, ok := c.hashes[id]
+	c.Unlock()
+	if ok && c.dir != "" && h.modTime.Equal(fi.ModTime()) && h.size == fi.Size() {
+		if p, err := c.load(h.hash); err == nil {
+			return p, nil
+		}
+	}
+
+	hash, err := trackHash(f, t)
+	if err != nil {
+		return nil, err
+	}
+	c.Lock()
+	c.hashes[id] = fileHash{modTime: fi.ModTime(), size: fi.Size(), hash: hash}
+	c.Unlock()
+
+	if c.dir != "" {
+		if p, err := c.load(hash); err == nil {
+			return p, nil
+		}
+	}
+
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	p, err := computePeaks(f, t)
+	if err != nil {
+		return nil, err
+	}
+	if c.dir != "" {
+		if err := c.save(hash, p); err != nil {
+			log.Printf("error caching peaks for %v: %v", id, err)
+		}
+	}
+	return p, nil
+}
+
+// trackHash returns the content hash of the track file r.  Tracks which are part of a file
+// (i.e. from a cue sheet) also include their start and end times.
+func trackHash(r io.Reader, t index.Track) (string, error) {
+	h := sha1.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	if start, end := t.GetInt("StartTime"), t.GetInt("EndTime"); start > 0 || end > 0 {
+		fmt.Fprintf(h, "%d-%d", start, end)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// computePeaks decodes the track file r using ffmpeg, and returns its peaks.
+func computePeaks(r io.Reader, t index.Track) ([]uint16, error) {
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+	args = append(args, seekArgs(t, 0)...)
+	args = append(args, "-vn", "-codec:a", "pcm_s16le", "-ar", strconv.Itoa(peakSampleRate),
+		"-ac", "1", "-f", "s16le", "pipe:1")
+
+	cmd := exec.Command(ffmpegPath, args...)
+	cmd.Stdin = r
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting ffmpeg: %v", err)
+	}
+	p, err := readPeaks(out)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("error decoding track: %v", err)
+	}
+	return p, nil
+}
+
+func (c *peaksCache) path(hash string) string {
+	return filepath.Join(c.dir, hash+".peaks")
+}
+
+// load reads the cached peaks with the given content hash.
+func (c *peaksCache) load(hash string) ([]uint16, error) {
+	b, err := ioutil.ReadFile(c.path(hash))
+	if err != nil {
+		return nil, err
+	}
+	p := make([]uint16, len(b)/2)
+	for i := range p {
+		p[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return p, nil
+}
+
+// save writes the peaks to the cache, replacing the file so that partially written peaks
+// are never loaded.
+func (c *peaksCache) save(hash string, p []uint16) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 2*len(p))
+	for i, x := range p {
+		binary.LittleEndian.PutUint16(b[2*i:], x)
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(hash))
+}
+
+// peaksHandler is an http.Handler which responds to GET requests with the amplitude peaks of
+// a track, for drawing waveforms.  The Path of the track is given by the segments of the
+// request path, i.e. /Root/<key>/.../<index> or /T/<track id>, and the number of peaks by
+// the "points" query parameter (defaultPeakPoints if not set).  Peaks are in the range 0-1.
+type peaksHandler struct {
+	libs  *sharedLibrary
+	cache *peaksCache
+}
+
+// ServeHTTP implements http.Handler.
+func (h peaksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var p index.Path
+	for _, s := range strings.Split(strings.Trim(r.URL.Path, "/"), "/") {
+		if s != "" {
+			p = append(p, index.Key(s))
+		}
+	}
+
+	points := defaultPeakPoints
+	if s := r.URL.Query().Get("points"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid points: %#v (must be a positive integer)", s), http.StatusBadRequest)
+			return
+		}
+		points = n
+	}
+
+	lib := h.libs.Get()
+	rp, ok := lib.RootPath(p)
+	if !ok {
+		http.Error(w, fmt.Sprintf("invalid track path: %v", p), http.StatusNotFound)
+		return
+	}
+	t, err := lib.TrackFromPath(rp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if lib.remote != nil {
+		if _, ok := lib.remote.Get(t.GetString("ID")); ok {
+			http.Error(w, "peaks are not available for remote items", http.StatusNotFound)
+			return
+		}
+	}
+
+	peaks, err := h.cache.Get(context.Background(), t)
+	if err != nil {
+		log.Printf("error computing peaks for %v: %v", rp, err)
+		http.Error(w, fmt.Sprintf("error computing peaks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	peaks = downsamplePeaks(peaks, points)
+
+	result := make([]float64, len(peaks))
+	for i, x := range peaks {
+		result[i] = math.Floor(float64(x)/math.MaxInt16*1000+0.5) / 1000
+	}
+	b, err := json.Marshal(struct {
+		Path  index.Path `json:"path"`
+		Peaks []float64  `json:"peaks"`
+	}{
+		Path:  rp,
+		Peaks: result,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	_, err = w.Write(b)
+	if err != nil {
+		log.Printf("error writing response: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestReadPeaks(t *testing.T) {
+	samples := make([]int16, 2*peakBlockSize+1)
+	samples[3] = 100
+	samples[10] = -200
+	samples[peakBlockSize+5] = -32768
+	samples[2*peakBlockSize] = 7
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, samples)
+
+	got, err := readPeaks(&buf)
+	if err != nil {
+		t.Fatalf("readPeaks() error = %v", err)
+	}
+	expected := []uint16{200, 32767, 7}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("readPeaks() = %v, expected: %v", got, expected)
+	}
+}
+
+func TestDownsamplePeaks(t *testing.T) {
+	p := []uint16{1, 5, 2, 8, 3, 4, 9}
+	tests := []struct {
+		n        int
+		expected []uint16
+	}{
+		{1, []uint16{9}},
+		{2, []uint16{5, 9}},
+		{3, []uint16{5, 8, 9}},
+		{7, p},
+		{100, p},
+	}
+
+	for _, tt := range tests {
+		got := downsamplePeaks(p, tt.n)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("downsamplePeaks(%v, %d) = %v, expected: %v", p, tt.n, got, tt.expected)
+		}
+	}
+}
+
+func TestPeaksCacheSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newPeaksCache(nil, dir)
+	p := []uint16{0, 1, 32767, 1000}
+	if err := c.save("abc", p); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	got, err := c.load("abc")
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("load() = %v, expected: %v", got, p)
+	}
+	if _, err := c.load("missing"); err == nil {
+		t.Errorf("load(%#v) error = nil, expected error", "missing")
+	}
+}
+
+// dirFileSystem is a store.FileSystem which serves the files in a directory.
+type dirFileSystem string
+
+func (d dirFileSystem) Open(ctx context.Context, path string) (http.File, error) {
+	return os.Open(filepath.Join(string(d), path))
+}
+
+func TestPeaksCacheModifiedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "1")
+	c := newPeaksCache(dirFileSystem(dir), filepath.Join(dir, "cache"))
+	track := testTrack{ID: "1"}
+
+	// Peaks are cached by content hash, so caching the peaks for each version of the file
+	// means that ffmpeg isn't needed.
+	write := func(data string, p []uint16, modTime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := trackHash(strings.NewReader(data), track)
+		if err != nil {
+			t.Fatalf("trackHash() error = %v", err)
+		}
+		if err := c.save(hash, p); err != nil {
+			t.Fatalf("save() error = %v", err)
+		}
+	}
+
+	modTime := time.Date(2015, time.June, 1, 0, 0, 0, 0, time.UTC)
+	write("one", []uint16{1}, modTime)
+	if got, err := c.Get(context.Background(), track); err != nil || !reflect.DeepEqual(got, []uint16{1}) {
+		t.Errorf("Get() = %v, %v, expected: %v, nil", got, err, []uint16{1})
+	}
+
+	// The same size, but modified later.
+	write("two", []uint16{2}, modTime.Add(time.Minute))
+	if got, err := c.Get(context.Background(), track); err != nil || !reflect.DeepEqual(got, []uint16{2}) {
+		t.Errorf("Get() after modifying the file = %v, %v, expected: %v, nil", got, err, []uint16{2})
+	}
+}
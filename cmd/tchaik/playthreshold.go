@@ -0,0 +1,71 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"time"
+
+	"tchaik.com/index"
+)
+
+// playThreshold is the amount of a track which must be played for the play to be recorded
+// (in the play history and play counts): either a fraction of the track duration, or a
+// duration (whichever is shorter).  The zero value records all plays.
+type playThreshold struct {
+	Fraction float64
+	Duration time.Duration
+}
+
+// Met returns true if playing for played (in seconds) of a track of the given duration (in
+// seconds, 0 if unknown) meets the threshold.
+func (pt playThreshold) Met(played, duration float64) bool {
+	if pt.Fraction <= 0 && pt.Duration <= 0 {
+		return true
+	}
+	if pt.Duration > 0 && played >= pt.Duration.Seconds() {
+		return true
+	}
+	return duration > 0 && pt.Fraction > 0 && played >= pt.Fraction*duration
+}
+
+// playedTime returns the time (in seconds) of the track t which was played, as sent in the
+// RECORD_PLAY command c (either "played" in seconds or "fraction" of the track) or otherwise
+// the reported position of the connection's player (if it has t loaded).  Returns false if
+// the played time isn't known.
+func (h *websocketHandler) playedTime(c Command, t index.Track) (float64, bool, error) {
+	duration := float64(t.GetInt("TotalTime")) / 1000
+
+	if _, ok := c.Data["played"]; ok {
+		played, err := c.getFloat("played")
+		if err != nil {
+			return 0, false, err
+		}
+		if played < 0 {
+			return 0, false, badField("invalid played: %v (must not be negative)", played)
+		}
+		return played, true, nil
+	}
+
+	if _, ok := c.Data["fraction"]; ok {
+		f, err := c.getFloat("fraction")
+		if err != nil {
+			return 0, false, err
+		}
+		if f < 0 || f > 1 {
+			return 0, false, badField("invalid fraction: %v (must be between 0 and 1)", f)
+		}
+		if duration <= 0 {
+			return 0, false, badField("fraction sent for track with unknown duration: %v", t.GetString("ID"))
+		}
+		return f * duration, true, nil
+	}
+
+	if h.playerKey != "" {
+		if st, ok := h.players.State(h.playerKey); ok && st.TrackID == t.GetString("ID") {
+			return st.Time, true, nil
+		}
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlayThresholdMet(t *testing.T) {
+	pt := playThreshold{Fraction: 0.5, Duration: 4 * time.Minute}
+	tests := []struct {
+		pt               playThreshold
+		played, duration float64
+		met              bool
+	}{
+		{pt, 0, 180, false},
+		{pt, 89, 180, false},
+		{pt, 90, 180, true},
+		{pt, 180, 180, true},
+		// Long tracks are recorded after the threshold duration.
+		{pt, 239, 600, false},
+		{pt, 240, 600, true},
+		// Unknown duration.
+		{pt, 100, 0, false},
+		{pt, 240, 0, true},
+		{playThreshold{Fraction: 0.5}, 1000, 0, false},
+		{playThreshold{Duration: time.Minute}, 59, 180, false},
+		{playThreshold{Duration: time.Minute}, 60, 180, true},
+		{playThreshold{}, 0, 180, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.pt.Met(tt.played, tt.duration); got != tt.met {
+			t.Errorf("%#v.Met(%v, %v) = %v, expected: %v", tt.pt, tt.played, tt.duration, got, tt.met)
+		}
+	}
+}
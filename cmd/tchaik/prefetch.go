@@ -0,0 +1,125 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"tchaik.com/player"
+	"tchaik.com/store"
+)
+
+// prefetchLead is the time before the end of the current track at which the next track
+// of a player is prefetched (0 to disable).
+var prefetchLead time.Duration
+
+// prefetchSize is the number of bytes read from the start of prefetched tracks.
+const prefetchSize = 1 << 20
+
+// prefetcher reads the start of the next track of each player shortly before the current
+// track ends, so that it has been fetched (and cached, for remote media file systems) by
+// the time it is requested.
+type prefetcher struct {
+	fs store.FileSystem
+
+	sync.Mutex
+	m map[string]*prefetch // player key -> latest prefetch
+}
+
+// prefetch is a prefetch of a track, which can be cancelled.
+type prefetch struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+func newPrefetcher(fs store.FileSystem) *prefetcher {
+	return &prefetcher{
+		fs: fs,
+		m:  make(map[string]*prefetch),
+	}
+}
+
+// Prefetch starts prefetching the track for the player (identified by key), cancelling any
+// on-going prefetch of a different track for the player.  Tracks which have already been
+// prefetched for the player are not fetched again.
+func (p *prefetcher) Prefetch(key, id string) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if x, ok := p.m[key]; ok {
+		if x.id == id {
+			return
+		}
+		x.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.m[key] = &prefetch{id: id, cancel: cancel}
+	go p.fetch(ctx, id)
+}
+
+// fetch reads the first prefetchSize bytes of the track, stopping early if ctx is done.
+func (p *prefetcher) fetch(ctx context.Context, id string) {
+	f, err := p.fs.Open(ctx, "/"+id)
+	if err != nil {
+		log.Printf("error prefetching track %#v: %v", id, err)
+		return
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32*1024)
+	for n := 0; n < prefetchSize; {
+		if ctx.Err() != nil {
+			return
+		}
+		m, err := f.Read(buf)
+		n += m
+		if err != nil {
+			return
+		}
+	}
+}
+
+// prefetchNext prefetches the track which follows the current track of the player if the
+// current track (given by its status) ends within prefetchLead.  Players play from the
+// same cursor as the UI (see castCursor).  The next track is re-evaluated on each call,
+// so changes to the playlist (or its shuffled order) after a prefetch has started are
+// picked up.
+func (m *Meta) prefetchNext(l Library, key string, st player.Status) {
+	if prefetchLead <= 0 || !st.Playing {
+		return
+	}
+	t, ok := l.Track(st.TrackID)
+	if !ok {
+		return
+	}
+	remaining := time.Duration(t.GetInt("TotalTime"))*time.Millisecond - time.Duration(st.Time*float64(time.Second))
+	if remaining > prefetchLead {
+		return
+	}
+
+	c := m.cursors.Get(castCursor)
+	if c == nil {
+		return
+	}
+	m.playback.Lock()
+	next, err := c.Upcoming()
+	m.playback.Unlock()
+	if err != nil || next.Empty() {
+		return
+	}
+
+	nt, err := l.TrackFromPath(next.Path)
+	if err != nil {
+		return
+	}
+	m.prefetch.Prefetch(key, nt.GetString("ID"))
+}
@@ -0,0 +1,62 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+type testFile struct {
+	*bytes.Reader
+}
+
+func (testFile) Close() error                       { return nil }
+func (testFile) Readdir(int) ([]os.FileInfo, error) { return nil, nil }
+func (testFile) Stat() (os.FileInfo, error)         { return nil, nil }
+
+// chanFileSystem is a store.FileSystem which sends the path of each opened file on a channel.
+type chanFileSystem chan string
+
+func (c chanFileSystem) Open(ctx context.Context, path string) (http.File, error) {
+	c <- path
+	return testFile{bytes.NewReader(make([]byte, 100))}, nil
+}
+
+func TestPrefetcherPrefetch(t *testing.T) {
+	fs := make(chanFileSystem, 10)
+	p := newPrefetcher(fs)
+
+	opened := func() string {
+		select {
+		case path := <-fs:
+			return path
+		case <-time.After(100 * time.Millisecond):
+			return ""
+		}
+	}
+
+	tests := []struct {
+		key, id  string
+		expected string
+	}{
+		{"a", "1", "/1"},
+		{"a", "1", ""}, // already prefetched
+		{"b", "1", "/1"},
+		{"a", "2", "/2"}, // next track changed
+		{"a", "1", "/1"},
+	}
+
+	for ii, tt := range tests {
+		p.Prefetch(tt.key, tt.id)
+		if got := opened(); got != tt.expected {
+			t.Errorf("[%d] Prefetch(%#v, %#v) opened %#v, expected: %#v", ii, tt.key, tt.id, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+)
+
+// Tracks are reported as clipping when at least clipMinBlocks of their peaks (each covering
+// peakBlockSize samples, i.e. a hundredth of a second) are within clipMargin of full scale.
+// Isolated full scale peaks are common in loud (but otherwise fine) masters, so only
+// sustained clipping is reported.
+const (
+	clipMargin    = 32
+	clipMinBlocks = 10
+)
+
+// clippedBlocks returns the number of peaks which are within clipMargin of full scale.
+func clippedBlocks(peaks []uint16) int {
+	n := 0
+	for _, p := range peaks {
+		if p >= math.MaxInt16-clipMargin {
+			n++
+		}
+	}
+	return n
+}
+
+// qualityIssue is a track with detected quality issues.
+type qualityIssue struct {
+	trackSummary
+	BitRate int      `json:"bitRate"`
+	Issues  []string `json:"issues"`
+}
+
+// peaksSource computes the peaks of tracks (i.e. peaksCache).
+type peaksSource interface {
+	Get(ctx context.Context, t index.Track) ([]uint16, error)
+}
+
+// trackWalker walks the tracks in the Group identified by a Path (i.e. Library).
+type trackWalker interface {
+	Walk(ctx context.Context, p index.Path, fn index.WalkFn) error
+}
+
+// qualityCache computes and caches quality reports by path.  Low bitrates are detected from
+// the index (if minBitRate is positive), and clipping from the peaks of tracks (if peaks is
+// non-nil).  Reports are dropped when the library is rebuilt (see Reset).
+type qualityCache struct {
+	minBitRate int
+	peaks      peaksSource
+
+	sync.Mutex
+	reports map[string][]qualityIssue
+}
+
+func newQualityCache(minBitRate int, peaks peaksSource) *qualityCache {
+	return &qualityCache{
+		minBitRate: minBitRate,
+		peaks:      peaks,
+		reports:    make(map[string][]qualityIssue),
+	}
+}
+
+// Enabled returns true if any quality issues are detected.
+func (c *qualityCache) Enabled() bool {
+	return c.minBitRate > 0 || c.peaks != nil
+}
+
+// Reset drops all cached reports.
+func (c *qualityCache) Reset() {
+	c.Lock()
+	c.reports = make(map[string][]qualityIssue)
+	c.Unlock()
+}
+
+// Report returns the tracks under the Path which have quality issues, computing (and
+// caching) the report if necessary.  Reports are not cached if the peaks of any track could
+// not be computed, so that clipping detection is retried.
+func (c *qualityCache) Report(ctx context.Context, w trackWalker, p index.Path) ([]qualityIssue, error) {
+	k := p.Encode()
+	c.Lock()
+	items, ok := c.reports[k]
+	c.Unlock()
+	if ok {
+		return items, nil
+	}
+
+	items = make([]qualityIssue, 0)
+	complete := true
+	err := w.Walk(ctx, p, func(t index.Track, tp index.Path) error {
+		var issues []string
+		br := t.GetInt("BitRate")
+		if c.minBitRate > 0 && br > 0 && br < c.minBitRate {
+			issues = append(issues, fmt.Sprintf("low bitrate (%d kbps)", br))
+		}
+		if c.peaks != nil {
+			peaks, err := c.peaks.Get(ctx, t)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("error computing peaks of %v for quality report: %v", tp, err)
+				complete = false
+			}
+			if n := clippedBlocks(peaks); n >= clipMinBlocks {
+				issues = append(issues, fmt.Sprintf("clipping (%.2fs at full scale)", float64(n*peakBlockSize)/peakSampleRate))
+			}
+		}
+		if len(issues) > 0 {
+			items = append(items, qualityIssue{
+				trackSummary: newTrackSummary(t, tp),
+				BitRate:      br,
+				Issues:       issues,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if complete {
+		c.Lock()
+		c.reports[k] = items
+		c.Unlock()
+	}
+	return items, nil
+}
+
+// localTracks is a trackWalker which skips the remote items of a Library: they aren't
+// files which can be analysed.
+type localTracks struct {
+	*Library
+}
+
+// Walk implements trackWalker.
+func (l localTracks) Walk(ctx context.Context, p index.Path, fn index.WalkFn) error {
+	return l.Library.Walk(ctx, p, func(t index.Track, tp index.Path) error {
+		if l.remote != nil {
+			if _, ok := l.remote.Get(t.GetString("ID")); ok {
+				return nil
+			}
+		}
+		return fn(t, tp)
+	})
+}
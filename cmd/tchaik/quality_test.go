@@ -0,0 +1,153 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+)
+
+// qualityTrack is a track with an ID and bitrate.
+type qualityTrack struct {
+	testTrack
+	bitRate int
+}
+
+func (t qualityTrack) GetInt(f string) int {
+	if f == "BitRate" {
+		return t.bitRate
+	}
+	return t.testTrack.GetInt(f)
+}
+
+// sliceWalker is a trackWalker which walks the same tracks for every path, and counts walks.
+type sliceWalker struct {
+	tracks []index.Track
+	walks  int
+}
+
+func (w *sliceWalker) Walk(ctx context.Context, p index.Path, fn index.WalkFn) error {
+	w.walks++
+	for i, t := range w.tracks {
+		if err := fn(t, append(p, index.Key(fmt.Sprintf("%d", i)))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapPeaks is a peaksSource which returns the peaks for track IDs, and an error for
+// unknown tracks.
+type mapPeaks map[string][]uint16
+
+func (m mapPeaks) Get(ctx context.Context, t index.Track) ([]uint16, error) {
+	p, ok := m[t.GetString("ID")]
+	if !ok {
+		return nil, fmt.Errorf("no peaks")
+	}
+	return p, nil
+}
+
+func TestClippedBlocks(t *testing.T) {
+	tests := []struct {
+		in       []uint16
+		expected int
+	}{
+		{nil, 0},
+		{[]uint16{0, 16000, 32000}, 0},
+		{[]uint16{math.MaxInt16, 100, math.MaxInt16 - clipMargin, math.MaxInt16 - clipMargin - 1}, 2},
+	}
+
+	for _, tt := range tests {
+		if got := clippedBlocks(tt.in); got != tt.expected {
+			t.Errorf("clippedBlocks(%v) = %d, expected: %d", tt.in, got, tt.expected)
+		}
+	}
+}
+
+func TestQualityCacheReport(t *testing.T) {
+	clipped := make([]uint16, 2*clipMinBlocks)
+	for i := 0; i < clipMinBlocks; i++ {
+		clipped[i] = math.MaxInt16
+	}
+	peaks := mapPeaks{
+		"fine":    {100, 200},
+		"clipped": clipped,
+		"low":     {100},
+		"blip":    clipped[clipMinBlocks-1:],
+	}
+
+	w := &sliceWalker{tracks: []index.Track{
+		qualityTrack{testTrack{ID: "fine"}, 320},
+		qualityTrack{testTrack{ID: "clipped"}, 320},
+		qualityTrack{testTrack{ID: "low"}, 96},
+		qualityTrack{testTrack{ID: "blip"}, 0},
+	}}
+	c := newQualityCache(128, peaks)
+	if !c.Enabled() {
+		t.Errorf("Enabled() = false, expected: true")
+	}
+
+	p := index.Path{"Root", "a"}
+	got, err := c.Report(context.Background(), w, p)
+	if err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+	expected := map[string][]string{
+		"clipped": {"clipping (0.10s at full scale)"},
+		"low":     {"low bitrate (96 kbps)"},
+	}
+	issues := make(map[string][]string, len(got))
+	for _, x := range got {
+		issues[x.ID] = x.Issues
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Report() issues = %v, expected: %v", issues, expected)
+	}
+
+	// Reports are cached until Reset.
+	c.Report(context.Background(), w, p)
+	if w.walks != 1 {
+		t.Errorf("Report() walked %d times, expected: %d", w.walks, 1)
+	}
+	c.Reset()
+	c.Report(context.Background(), w, p)
+	if w.walks != 2 {
+		t.Errorf("Report() after Reset() walked %d times, expected: %d", w.walks, 2)
+	}
+
+	// Incomplete reports (missing peaks) aren't cached.
+	w = &sliceWalker{tracks: []index.Track{qualityTrack{testTrack{ID: "missing"}, 320}}}
+	for i := 1; i <= 2; i++ {
+		if _, err := c.Report(context.Background(), w, index.Path{"Root", "b"}); err != nil {
+			t.Fatalf("Report() error = %v", err)
+		}
+		if w.walks != i {
+			t.Errorf("Report() with missing peaks walked %d times, expected: %d", w.walks, i)
+		}
+	}
+
+	if c := newQualityCache(0, nil); c.Enabled() {
+		t.Errorf("Enabled() = true, expected: false")
+	}
+}
+
+func TestQualityReportNotEnabled(t *testing.T) {
+	h := &websocketHandler{quality: newQualityCache(0, nil)}
+	c := Command{Data: map[string]interface{}{"path": []interface{}{"Root"}}}
+	err := h.qualityReport(c, &Response{})
+	if err == nil {
+		t.Fatalf("h.qualityReport() when disabled: expected error")
+	}
+	if got := newErrorData(c, err).Code; got != ErrorNotEnabled {
+		t.Errorf("h.qualityReport() when disabled: error code = %q, expected: %q", got, ErrorNotEnabled)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"tchaik.com/index"
+)
+
+// hasGenre returns true if any of the tracks in the group have the genre (ignoring case).
+func hasGenre(g index.Group, genre string) bool {
+	for _, t := range g.Tracks() {
+		if strings.EqualFold(t.GetString("Genre"), genre) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomAlbum returns the path of an album in the root collection chosen using r, and false
+// if there are none.  If genre is non-empty then only albums with a track in the genre are
+// chosen.  Each album is equally likely to be chosen, regardless of its number of tracks.
+func randomAlbum(root index.Collection, genre string, r *rand.Rand) (index.Path, bool) {
+	var keys []index.Key
+	for _, k := range root.Keys() {
+		if genre == "" || hasGenre(root.Get(k), genre) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, false
+	}
+	return index.Path{"Root", keys[r.Intn(len(keys))]}, true
+}
+
+// randomAlbum responds with the path of a randomly chosen album (see randomAlbum), and the
+// album expanded from the Root collection.
+func (h *websocketHandler) randomAlbum(c Command, resp *Response) error {
+	genre, _ := c.getString("genre")
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	p, ok := randomAlbum(h.lib.collections["Root"], genre, r)
+	if !ok {
+		if genre != "" {
+			return badField("no albums with genre: %#v", genre)
+		}
+		return fmt.Errorf("no albums in library")
+	}
+
+	resp.Data = struct {
+		Path index.Path  `json:"path"`
+		Data index.Group `json:"data"`
+	}{
+		Path: p,
+		Data: h.lib.ExpandPaths([]index.Path{p}),
+	}
+	return nil
+}
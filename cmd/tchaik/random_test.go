@@ -0,0 +1,55 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+)
+
+func TestRandomAlbum(t *testing.T) {
+	tracks := testTracker{
+		similarTestTrack{Name: "A1", Album: "A", Genre: "Jazz"},
+		similarTestTrack{Name: "B1", Album: "B", Genre: "Rock"},
+		similarTestTrack{Name: "B2", Album: "B", Genre: "Rock"},
+		similarTestTrack{Name: "B3", Album: "B", Genre: "Rock"},
+		similarTestTrack{Name: "B4", Album: "B", Genre: "Rock"},
+		similarTestTrack{Name: "C1", Album: "C", Genre: "jazz"},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+	r := rand.New(rand.NewSource(1))
+
+	counts := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		p, ok := randomAlbum(root, "", r)
+		if !ok {
+			t.Fatalf("randomAlbum(%#v) = _, false, expected: _, true", "")
+		}
+		counts[root.Get(p[1]).Name()]++
+	}
+	for _, name := range []string{"A", "B", "C"} {
+		// Each album should be chosen about 100 times, regardless of its number of tracks.
+		if n := counts[name]; n < 60 || n > 140 {
+			t.Errorf("randomAlbum(%#v) chose %#v %d times, expected about 100", "", name, n)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		p, ok := randomAlbum(root, "Jazz", r)
+		if !ok {
+			t.Fatalf("randomAlbum(%#v) = _, false, expected: _, true", "Jazz")
+		}
+		if name := root.Get(p[1]).Name(); name != "A" && name != "C" {
+			t.Errorf("randomAlbum(%#v) = %#v, expected album A or C", "Jazz", name)
+		}
+	}
+
+	if p, ok := randomAlbum(root, "Classical", r); ok {
+		t.Errorf("randomAlbum(%#v) = %v, true, expected: _, false", "Classical", p)
+	}
+}
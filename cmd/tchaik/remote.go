@@ -0,0 +1,394 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/remote"
+)
+
+// remoteGroup is the group of a remote item in the Root collection, which contains just the
+// item.  Its path is ["Root", <item id>], so remote items can be added to playlists (and
+// played using cursors) like any other group.
+type remoteGroup struct {
+	item remote.Item
+}
+
+// Name implements index.Group.
+func (g remoteGroup) Name() string { return g.item.Name }
+
+// Tracks implements index.Group.
+func (g remoteGroup) Tracks() []index.Track { return []index.Track{g.item} }
+
+// Field implements index.Group.
+func (g remoteGroup) Field(f string) interface{} {
+	switch f {
+	case "ID", "Kind", remote.SourceTypeField:
+		return g.item.GetString(f)
+	case "TotalTime":
+		if d := g.item.GetInt(f); d > 0 {
+			return d
+		}
+	}
+	return nil
+}
+
+// remoteCollection is a Collection which also contains the groups of remote items (see
+// remoteGroup).  The remote items are not included in Keys, so they aren't listed with the
+// groups of the collection (or included in its search index and filters).
+type remoteCollection struct {
+	index.Collection
+	items remote.Store
+}
+
+// Get implements index.Collection.  Remote items are checked first, as collections don't
+// necessarily return nil for missing keys (remote item IDs are prefixed to avoid clashes).
+func (c remoteCollection) Get(k index.Key) index.Group {
+	if c.items != nil {
+		if i, ok := c.items.Get(string(k)); ok {
+			return remoteGroup{i}
+		}
+	}
+	return c.Collection.Get(k)
+}
+
+// remotePath returns the path of the remote item with the given ID.
+func remotePath(id string) index.Path {
+	return index.Path{"Root", index.Key(id), "0"}
+}
+
+// remoteRetries is the number of times a dropped remote stream is reconnected (without any
+// data being read in between) before giving up.
+const remoteRetries = 5
+
+// remoteRetryDelay is the delay before reconnecting a dropped remote stream, which doubles
+// after each failed attempt.
+var remoteRetryDelay = 500 * time.Millisecond
+
+// remoteHeaderTimeout is the time to wait for the response headers of a remote item.  There
+// is no limit on reading the body: live streams never end.
+const remoteHeaderTimeout = 30 * time.Second
+
+// remoteClient is the http.Client used to request remote items.
+var remoteClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: remoteHeaderTimeout,
+	},
+}
+
+// remoteReader reads a remote item, reconnecting when the stream is dropped.  Live streams
+// (radio) are reconnected to the live position, and others are resumed from the current
+// offset using range requests.
+type remoteReader struct {
+	client *http.Client
+	url    string
+	live   bool
+
+	start  int64 // offset of the first byte of the response (non-zero for range requests)
+	length int64 // length of the response, -1 if unknown
+	offset int64 // number of bytes read
+
+	body io.ReadCloser
+	err  error // error from the last read of body
+}
+
+// openRemote requests the remote item, forwarding the Range header rng (if non-empty and the
+// item isn't live).  Returns the reader and the first response, whose body must not be used.
+func openRemote(client *http.Client, item remote.Item, rng string) (*remoteReader, *http.Response, error) {
+	r := &remoteReader{
+		client: client,
+		url:    item.URL,
+		live:   item.Type == remote.TypeRadio,
+		length: -1,
+	}
+
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rng != "" && !r.live {
+		req.Header.Set("Range", rng)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("unexpected response from %v: %v", r.url, resp.Status)
+	}
+
+	r.body = resp.Body
+	r.length = resp.ContentLength
+	if resp.StatusCode == http.StatusPartialContent {
+		r.start = contentRangeStart(resp.Header.Get("Content-Range"))
+	}
+	return r, resp, nil
+}
+
+// contentRangeStart returns the offset of the first byte in the Content-Range header value
+// (i.e. "bytes 100-199/1000"), or 0 if it can't be parsed.
+func contentRangeStart(s string) int64 {
+	s = strings.TrimPrefix(s, "bytes ")
+	if i := strings.Index(s, "-"); i > 0 {
+		if n, err := strconv.ParseInt(s[:i], 10, 64); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// complete returns true if the whole of the response (as far as can be told) has been read.
+// Live streams are never complete.
+func (r *remoteReader) complete() bool {
+	if r.live {
+		return false
+	}
+	return r.length < 0 || r.offset >= r.length
+}
+
+// Read implements io.Reader.
+func (r *remoteReader) Read(p []byte) (int, error) {
+	for failures := 0; ; {
+		err := r.err
+		if err == nil {
+			var n int
+			n, err = r.body.Read(p)
+			r.offset += int64(n)
+			if n > 0 {
+				r.err = err // returned by the next Read
+				return n, nil
+			}
+			if err == nil {
+				continue
+			}
+		}
+		r.err = nil
+		if err == io.EOF && r.complete() {
+			return 0, io.EOF
+		}
+
+		if failures == remoteRetries {
+			return 0, fmt.Errorf("remote stream %v dropped: %v", r.url, err)
+		}
+		r.body.Close()
+		time.Sleep(remoteRetryDelay << uint(failures))
+		failures++
+		if rerr := r.reconnect(); rerr != nil {
+			log.Printf("error reconnecting remote stream %v: %v", r.url, rerr)
+			r.body = ioutil.NopCloser(strings.NewReader(""))
+			r.err = rerr
+		}
+	}
+}
+
+// reconnect requests the remote item again, from the current offset if it isn't live.
+func (r *remoteReader) reconnect() error {
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return err
+	}
+	pos := r.start + r.offset
+	if !r.live {
+		rng := fmt.Sprintf("bytes=%d-", pos)
+		if r.length >= 0 {
+			rng += strconv.FormatInt(r.start+r.length-1, 10)
+		}
+		req.Header.Set("Range", rng)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && !r.live:
+		if start := contentRangeStart(resp.Header.Get("Content-Range")); start != pos {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected range in response: %v", resp.Header.Get("Content-Range"))
+		}
+
+	case resp.StatusCode == http.StatusOK:
+		if !r.live {
+			// The server doesn't support range requests, so skip the bytes already read.
+			if _, err := io.CopyN(ioutil.Discard, resp.Body, pos); err != nil {
+				resp.Body.Close()
+				return err
+			}
+		}
+
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("unexpected response: %v", resp.Status)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+// Close implements io.Closer.
+func (r *remoteReader) Close() error {
+	return r.body.Close()
+}
+
+// remoteHeaders are the headers of remote responses which are passed on to clients.
+var remoteHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges"}
+
+// remoteTrackHandler is an http.Handler which streams remote items (by ID) from their URLs,
+// reconnecting if the stream is dropped (see remoteReader).  Requests for other IDs are
+// passed to the wrapped handler.
+type remoteTrackHandler struct {
+	http.Handler
+	items remote.Store
+}
+
+// ServeHTTP implements http.Handler.
+func (h remoteTrackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var item remote.Item
+	ok := false
+	if h.items != nil {
+		item, ok = h.items.Get(strings.Trim(r.URL.Path, "/"))
+	}
+	if !ok {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	rr, resp, err := openRemote(remoteClient, item, r.Header.Get("Range"))
+	if err != nil {
+		log.Printf("error opening remote item %v: %v", item.ID, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	defer rr.Close()
+
+	for _, k := range remoteHeaders {
+		if v := resp.Header.Get(k); v != "" && (!rr.live || k == "Content-Type") {
+			w.Header().Set(k, v)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(resp.StatusCode)
+	if r.Method == "HEAD" {
+		return
+	}
+	io.Copy(w, rr)
+}
+
+// remoteItem is the representation of a remote item sent to clients.
+type remoteItem struct {
+	remote.Item
+	Path index.Path `json:"path"`
+}
+
+func newRemoteItem(i remote.Item) remoteItem {
+	return remoteItem{
+		Item: i,
+		Path: remotePath(i.ID),
+	}
+}
+
+// remote handles the REMOTE action, which lists (LIST), adds (ADD) and removes (REMOVE) remote
+// items.
+func (h *websocketHandler) remote(c Command, resp *Response) error {
+	action, err := c.getString("action")
+	if err != nil {
+		return err
+	}
+	items := h.lib.remote
+	if items == nil {
+		return &commandError{ErrorNotEnabled, "remote items are not enabled"}
+	}
+
+	switch action {
+	case "LIST":
+		list := items.List()
+		result := make([]remoteItem, len(list))
+		for i, x := range list {
+			result[i] = newRemoteItem(x)
+		}
+		resp.Data = struct {
+			Action string       `json:"action"`
+			Items  []remoteItem `json:"items"`
+		}{
+			Action: action,
+			Items:  result,
+		}
+		return nil
+
+	case "ADD":
+		typ, err := c.getString("type")
+		if err != nil {
+			return err
+		}
+		name, err := c.getString("name")
+		if err != nil {
+			return err
+		}
+		u, err := c.getString("url")
+		if err != nil {
+			return err
+		}
+		item, err := remote.NewItem(remote.Type(typ), name, u)
+		if err != nil {
+			return badField("%v", err)
+		}
+		item.Album, _ = c.getString("album")
+		item.Artist, _ = c.getString("artist")
+		if _, ok := c.Data["duration"]; ok {
+			item.Duration, err = c.getFloat("duration")
+			if err != nil {
+				return err
+			}
+			if item.Duration < 0 || item.Type == remote.TypeRadio {
+				return badField("invalid duration: %v (must be positive, and only set for podcasts)", item.Duration)
+			}
+		}
+		if err := items.Add(item); err != nil {
+			return err
+		}
+		h.hub.broadcastChange(libraryChange{Reason: changeRemote, Path: remotePath(item.ID)}, h)
+		resp.Data = struct {
+			Action string     `json:"action"`
+			Item   remoteItem `json:"item"`
+		}{
+			Action: action,
+			Item:   newRemoteItem(item),
+		}
+		return nil
+
+	case "REMOVE":
+		id, err := c.getString("id")
+		if err != nil {
+			return err
+		}
+		if err := items.Remove(id); err != nil {
+			return badField("%v", err)
+		}
+		h.hub.broadcastChange(libraryChange{Reason: changeRemote, Path: remotePath(id)}, h)
+		resp.Data = struct {
+			Action string `json:"action"`
+			ID     string `json:"id"`
+		}{
+			Action: action,
+			ID:     id,
+		}
+		return nil
+	}
+	return badField("invalid remote action: %#v", action)
+}
@@ -0,0 +1,148 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+	"tchaik.com/index/remote"
+)
+
+type testRemoteStore map[string]remote.Item
+
+func (s testRemoteStore) Add(i remote.Item) error { s[i.ID] = i; return nil }
+func (s testRemoteStore) Remove(id string) error  { delete(s, id); return nil }
+func (s testRemoteStore) Get(id string) (remote.Item, bool) {
+	i, ok := s[id]
+	return i, ok
+}
+func (s testRemoteStore) List() []remote.Item { return nil }
+
+func TestRemoteReaderReconnect(t *testing.T) {
+	defer func(d time.Duration) { remoteRetryDelay = d }(remoteRetryDelay)
+	remoteRetryDelay = 0
+
+	content := []byte(strings.Repeat("0123456789", 100))
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Drop the connection part way through the body.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:250])
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer s.Close()
+
+	item, err := remote.NewItem(remote.TypePodcast, "Episode", s.URL+"/ep.mp3")
+	if err != nil {
+		t.Fatalf("NewItem() error = %v", err)
+	}
+	r, _, err := openRemote(http.DefaultClient, item, "")
+	if err != nil {
+		t.Fatalf("openRemote() error = %v", err)
+	}
+	defer r.Close()
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Errorf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("ReadAll() = %d bytes, expected: %d bytes (equal to content)", len(got), len(content))
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, expected: %d", requests, 2)
+	}
+}
+
+func TestRemoteReaderLive(t *testing.T) {
+	defer func(d time.Duration) { remoteRetryDelay = d }(remoteRetryDelay)
+	remoteRetryDelay = 0
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			t.Errorf("unexpected Range header for live stream: %v", r.Header.Get("Range"))
+		}
+		w.Write([]byte("live"))
+	}))
+	defer s.Close()
+
+	item, err := remote.NewItem(remote.TypeRadio, "Radio", s.URL+"/stream")
+	if err != nil {
+		t.Fatalf("NewItem() error = %v", err)
+	}
+	r, _, err := openRemote(http.DefaultClient, item, "bytes=10-")
+	if err != nil {
+		t.Fatalf("openRemote() error = %v", err)
+	}
+	defer r.Close()
+
+	// Live streams are reconnected at the end of each response, rather than ending.
+	got := make([]byte, 12)
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Errorf("ReadFull() error = %v", err)
+	}
+	if expected := "livelivelive"; string(got) != expected {
+		t.Errorf("ReadFull() = %#v, expected: %#v", string(got), expected)
+	}
+}
+
+func TestRemoteCollection(t *testing.T) {
+	item, err := remote.NewItem(remote.TypeRadio, "Radio", "http://example.com/stream")
+	if err != nil {
+		t.Fatalf("NewItem() error = %v", err)
+	}
+	tracks := testTracker{
+		similarTestTrack{Name: "A1", Album: "A"},
+	}
+	c := remoteCollection{
+		Collection: index.Collect(tracks, index.By(attr.String("Album"))),
+		items:      testRemoteStore{item.ID: item},
+	}
+
+	g := c.Get(index.Key(item.ID))
+	if g == nil {
+		t.Fatalf("Get(%#v) = nil, expected group", item.ID)
+	}
+	if got := g.Field(remote.SourceTypeField); got != string(remote.TypeRadio) {
+		t.Errorf("Field(%#v) = %#v, expected: %#v", remote.SourceTypeField, got, remote.TypeRadio)
+	}
+	if tracks := g.Tracks(); len(tracks) != 1 || tracks[0].GetString("ID") != item.ID {
+		t.Errorf("Tracks() = %#v, expected: [%#v]", tracks, item)
+	}
+	if k := c.Keys()[0]; len(c.Get(k).Tracks()) != 1 {
+		t.Errorf("Get(%#v).Tracks() = %#v, expected: %#v", k, c.Get(k).Tracks(), tracks)
+	}
+	for _, k := range c.Keys() {
+		if k == index.Key(item.ID) {
+			t.Errorf("Keys() = %v, expected not to contain remote item %#v", c.Keys(), item.ID)
+		}
+	}
+}
+
+func TestRemoteNotEnabled(t *testing.T) {
+	h := &websocketHandler{}
+	c := Command{Data: map[string]interface{}{"action": "LIST"}}
+	err := h.remote(c, &Response{})
+	if err == nil {
+		t.Fatalf("h.remote() without remote items: expected error")
+	}
+	if got := newErrorData(c, err).Code; got != ErrorNotEnabled {
+		t.Errorf("h.remote() without remote items: error code = %q, expected: %q", got, ErrorNotEnabled)
+	}
+}
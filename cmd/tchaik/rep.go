@@ -9,6 +9,7 @@ import (
 
 	"tchaik.com/index"
 	"tchaik.com/index/attr"
+	"tchaik.com/index/remote"
 )
 
 // Group is a wrapper type for an index.Group which implements MarshalJSON
@@ -16,6 +17,38 @@ import (
 type Group struct {
 	index.Group
 	Key index.Key
+
+	// Thumb, if non-nil, is used to fetch thumbnail data URIs from track IDs which are
+	// then included for each group in a collection.
+	Thumb func(id string) string
+
+	// Artwork, if non-nil, is used to fetch artwork information from track IDs which is
+	// then included for the group (and each group in a collection).
+	Artwork func(id string) *artworkInfo
+
+	// PlayCount, if non-nil, is used to fetch play counts from track IDs which are then
+	// included for each track in the group.
+	PlayCount func(id string) int
+
+	// Bookmark, if non-nil, is used to fetch bookmarked positions from track IDs which are
+	// then included for each track in the group.
+	Bookmark func(id string) float64
+}
+
+// Types of items in Group representations, so that clients can tell which items can be
+// expanded without fetching them.
+const (
+	itemTypeCollection string = "collection" // a group of groups
+	itemTypeGroup             = "group"      // a group of tracks
+	itemTypeTrack             = "track"      // a track (leaf)
+)
+
+// groupType returns the item type of the Group, from its type in the index.
+func groupType(g index.Group) string {
+	if _, ok := g.(index.Collection); ok {
+		return itemTypeCollection
+	}
+	return itemTypeGroup
 }
 
 // MarshalJSON implements json.Marshaler.
@@ -23,6 +56,7 @@ func (g *Group) MarshalJSON() ([]byte, error) {
 	h := group{
 		Name:        g.Name(),
 		Key:         g.Key,
+		Type:        groupType(g.Group),
 		TotalTime:   g.Field("TotalTime"),
 		Artist:      g.Field("Artist"),
 		AlbumArtist: g.Field("AlbumArtist"),
@@ -35,17 +69,31 @@ func (g *Group) MarshalJSON() ([]byte, error) {
 		ID:          g.Field("ID"),
 		Favourite:   g.Field("Favourite"),
 		Checklist:   g.Field("Checklist"),
+		NoCrossfade: g.Field("NoCrossfade"),
+		Rating:      g.Field("Rating"),
+		SourceType:  g.Field(remote.SourceTypeField),
+	}
+
+	if g.Artwork != nil {
+		h.setArtwork(g.Group, g.Artwork)
 	}
 
 	if c, ok := g.Group.(index.Collection); ok {
-		return json.Marshal(buildCollection(h, c))
+		return json.Marshal(buildCollection(h, c, g.Thumb, g.Artwork))
 	}
 
 	for _, t := range g.Tracks() {
-		h.Tracks = append(h.Tracks, &Track{
+		tr := &Track{
 			Track: t,
 			group: g,
-		})
+		}
+		if g.PlayCount != nil {
+			tr.playCount = g.PlayCount(t.GetString("ID"))
+		}
+		if g.Bookmark != nil {
+			tr.bookmark = g.Bookmark(t.GetString("ID"))
+		}
+		h.Tracks = append(h.Tracks, tr)
 	}
 	return json.Marshal(h)
 }
@@ -86,9 +134,10 @@ func (g groupField) Field(field string) interface{} {
 	return g.Group.Field(field)
 }
 
-func buildCollection(h group, c index.Collection) group {
+func buildCollection(h group, c index.Collection, thumb func(string) string, artwork func(string) *artworkInfo) group {
 	for _, k := range c.Keys() {
 		g := c.Get(k)
+		typ := groupType(g)
 		g = index.FirstTrackAttr(attr.Strings("AlbumArtist"), g)
 		g = index.CommonGroupAttr([]attr.Interface{attr.Strings("Artist")}, g)
 
@@ -97,12 +146,22 @@ func buildCollection(h group, c index.Collection) group {
 			collection: c,
 		}
 
-		h.Groups = append(h.Groups, group{
+		sg := group{
 			Name:        g.Name(),
 			Key:         k,
+			Type:        typ,
 			AlbumArtist: g.Field("AlbumArtist"),
 			Artist:      g.Field("Artist"),
-		})
+		}
+		if thumb != nil {
+			if id, ok := index.FirstTrackAttr(attr.String("ID"), g).Field("ID").(string); ok {
+				sg.Thumb = thumb(id)
+			}
+		}
+		if artwork != nil {
+			sg.setArtwork(g, artwork)
+		}
+		h.Groups = append(h.Groups, sg)
 	}
 	return h
 }
@@ -111,7 +170,9 @@ func buildCollection(h group, c index.Collection) group {
 type Track struct {
 	index.Track
 
-	group index.Group
+	group     index.Group
+	playCount int
+	bookmark  float64
 }
 
 // GetString implements index.Track.
@@ -148,7 +209,9 @@ func (t *Track) GetInt(field string) int {
 }
 
 func (t *Track) MarshalJSON() ([]byte, error) {
+	sourceType, _ := t.group.Field(remote.SourceTypeField).(string)
 	return json.Marshal(struct {
+		Type        string   `json:"type"`
 		ID          string   `json:"id,omitempty"`
 		Name        string   `json:"name,omitempty"`
 		Album       string   `json:"album,omitempty"`
@@ -159,8 +222,17 @@ func (t *Track) MarshalJSON() ([]byte, error) {
 		Year        int      `json:"year,omitempty"`
 		DiscNumber  int      `json:"discNumber,omitempty"`
 		TotalTime   int      `json:"totalTime,omitempty"`
-		BitRate     int      `json:"bitRate,omitempty"`
+		Format      string   `json:"format,omitempty"`
+		BitRate     int      `json:"bitRate,omitempty"`    // kbps
+		SampleRate  int      `json:"sampleRate,omitempty"` // Hz
+		BitDepth    int      `json:"bitDepth,omitempty"`   // bits per sample
+		PlayCount   int      `json:"playCount,omitempty"`
+		Bookmark    float64  `json:"bookmark,omitempty"`   // seconds
+		TrackGain   int      `json:"trackGain,omitempty"`  // hundredths of a dB
+		AlbumGain   int      `json:"albumGain,omitempty"`  // hundredths of a dB
+		SourceType  string   `json:"sourceType,omitempty"` // remote items only, see remote.Type
 	}{
+		Type:        itemTypeTrack,
 		ID:          t.GetString("ID"),
 		Name:        t.GetString("Name"),
 		TotalTime:   t.GetInt("TotalTime"),
@@ -171,27 +243,44 @@ func (t *Track) MarshalJSON() ([]byte, error) {
 		Kind:        t.GetString("Kind"),
 		Year:        t.GetInt("Year"),
 		DiscNumber:  t.GetInt("DiscNumber"),
+		Format:      t.GetString("Format"),
 		BitRate:     t.GetInt("BitRate"),
+		SampleRate:  t.GetInt("SampleRate"),
+		BitDepth:    t.GetInt("BitDepth"),
+		PlayCount:   t.playCount,
+		Bookmark:    t.bookmark,
+		TrackGain:   t.GetInt("TrackGain"),
+		AlbumGain:   t.GetInt("AlbumGain"),
+		SourceType:  sourceType,
 	})
 }
 
 type group struct {
-	Name        string        `json:"name"`
-	Key         index.Key     `json:"key"`
-	TotalTime   interface{}   `json:"totalTime,omitempty"`
-	Artist      interface{}   `json:"artist,omitempty"`
-	AlbumArtist interface{}   `json:"albumArtist,omitempty"`
-	Composer    interface{}   `json:"composer,omitempty"`
-	BitRate     interface{}   `json:"bitRate,omitempty"`
-	DiscNumber  interface{}   `json:"discNumber,omitempty"`
-	ListStyle   interface{}   `json:"listStyle,omitempty"`
-	ID          interface{}   `json:"id,omitempty"`
-	Year        interface{}   `json:"year,omitempty"`
-	Kind        interface{}   `json:"kind,omitempty"`
-	Favourite   interface{}   `json:"favourite,omitempty"`
-	Checklist   interface{}   `json:"checklist,omitempty"`
-	Groups      []group       `json:"groups,omitempty"`
-	Tracks      []index.Track `json:"tracks,omitempty"`
+	Name          string        `json:"name"`
+	Key           index.Key     `json:"key"`
+	Type          string        `json:"type"` // see itemTypeCollection, itemTypeGroup
+	TotalTime     interface{}   `json:"totalTime,omitempty"`
+	Artist        interface{}   `json:"artist,omitempty"`
+	AlbumArtist   interface{}   `json:"albumArtist,omitempty"`
+	Composer      interface{}   `json:"composer,omitempty"`
+	BitRate       interface{}   `json:"bitRate,omitempty"`
+	DiscNumber    interface{}   `json:"discNumber,omitempty"`
+	ListStyle     interface{}   `json:"listStyle,omitempty"`
+	ID            interface{}   `json:"id,omitempty"`
+	Year          interface{}   `json:"year,omitempty"`
+	Kind          interface{}   `json:"kind,omitempty"`
+	Favourite     interface{}   `json:"favourite,omitempty"`
+	Checklist     interface{}   `json:"checklist,omitempty"`
+	NoCrossfade   interface{}   `json:"noCrossfade,omitempty"`
+	Rating        interface{}   `json:"rating,omitempty"`
+	SourceType    interface{}   `json:"sourceType,omitempty"`
+	Thumb         string        `json:"thumb,omitempty"`
+	ArtworkURL    string        `json:"artworkURL,omitempty"`
+	ThumbnailURL  string        `json:"thumbnailURL,omitempty"`
+	ArtworkWidth  int           `json:"artworkWidth,omitempty"`
+	ArtworkHeight int           `json:"artworkHeight,omitempty"`
+	Groups        []group       `json:"groups,omitempty"`
+	Tracks        []index.Track `json:"tracks,omitempty"`
 }
 
 type rootCollection struct {
@@ -203,11 +292,21 @@ func (r *rootCollection) Get(k index.Key) index.Group {
 	if g == nil {
 		return g
 	}
+	if _, ok := g.(remoteGroup); ok {
+		return g
+	}
 
 	index.Sort(g.Tracks(), index.MultiSort(index.SortByString("Kind"), index.SortByInt("DiscNumber"), index.SortByInt("TrackNumber")))
 	g = index.Transform(g, index.SplitList("Artist", "AlbumArtist", "Composer"))
 	g = index.Transform(g, index.TrimTrackNumPrefix)
-	c := index.Collect(g, index.ByPrefix("Name"))
+	// Albums with tracks on more than one disc are grouped by disc first, so that the prefix
+	// grouping (and track numbering) is within each disc.
+	var c index.Collection
+	if d := index.ByDisc("DiscNumber"); d.Discs(g) > 1 {
+		c = index.SubCollect(index.Collect(g, d), index.ByPrefix("Name"))
+	} else {
+		c = index.Collect(g, index.ByPrefix("Name"))
+	}
 	g = index.SubTransform(c, index.TrimEnumPrefix)
 	g = index.SumGroupIntAttr("TotalTime", g)
 	commonFields := []attr.Interface{
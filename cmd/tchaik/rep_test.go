@@ -0,0 +1,153 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+)
+
+type discTestTrack struct {
+	Name, Album             string
+	DiscNumber, TrackNumber int
+}
+
+func (t discTestTrack) GetString(k string) string {
+	switch k {
+	case "Name":
+		return t.Name
+	case "Album":
+		return t.Album
+	}
+	return ""
+}
+
+func (t discTestTrack) GetStrings(k string) []string { return index.DefaultGetStrings(t, k) }
+func (t discTestTrack) GetTime(k string) time.Time   { return time.Time{} }
+
+func (t discTestTrack) GetInt(k string) int {
+	switch k {
+	case "DiscNumber":
+		return t.DiscNumber
+	case "TrackNumber":
+		return t.TrackNumber
+	}
+	return 0
+}
+
+func TestRootCollectionDiscs(t *testing.T) {
+	tracks := testTracker{
+		discTestTrack{Name: "Intro", Album: "Box Set", DiscNumber: 2, TrackNumber: 1},
+		discTestTrack{Name: "Overture", Album: "Box Set", DiscNumber: 1, TrackNumber: 1},
+		discTestTrack{Name: "Finale", Album: "Box Set", DiscNumber: 2, TrackNumber: 2},
+		discTestTrack{Name: "Theme", Album: "Box Set", DiscNumber: 1, TrackNumber: 2},
+		discTestTrack{Name: "One", Album: "Single", DiscNumber: 1, TrackNumber: 1},
+		discTestTrack{Name: "Two", Album: "Single", DiscNumber: 1, TrackNumber: 2},
+	}
+	root := &rootCollection{index.Collect(tracks, index.By(attr.String("Album")))}
+
+	names := func(g index.Group) []string {
+		var names []string
+		for _, t := range g.Tracks() {
+			names = append(names, t.GetString("Name"))
+		}
+		return names
+	}
+
+	keys := root.Keys()
+	box, ok := root.Get(keys[0]).(index.Collection)
+	if !ok {
+		t.Fatalf("Get(%#v) is not a collection of discs", keys[0])
+	}
+	tests := []struct {
+		name   string
+		tracks []string
+	}{
+		{"Disc 1", []string{"Overture", "Theme"}},
+		{"Disc 2", []string{"Intro", "Finale"}},
+	}
+	if len(box.Keys()) != len(tests) {
+		t.Fatalf("Get(%#v).Keys() = %v, expected %d discs", keys[0], box.Keys(), len(tests))
+	}
+	for i, k := range box.Keys() {
+		g := box.Get(k)
+		if g.Name() != tests[i].name {
+			t.Errorf("disc %d name = %#v, expected: %#v", i, g.Name(), tests[i].name)
+		}
+		if got := names(g); !reflect.DeepEqual(got, tests[i].tracks) {
+			t.Errorf("disc %d tracks = %v, expected: %v", i, got, tests[i].tracks)
+		}
+	}
+
+	single := root.Get(keys[1])
+	if _, ok := single.(index.Collection); ok {
+		t.Errorf("Get(%#v) is a collection, expected single-disc album without discs", keys[1])
+	}
+	if got, expected := names(single), []string{"One", "Two"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Get(%#v) tracks = %v, expected: %v", keys[1], got, expected)
+	}
+}
+
+func TestGroupMarshalJSONType(t *testing.T) {
+	tracks := testTracker{
+		searchTestTrack{Name: "Come Together", Album: "Abbey Road", Artist: "The Beatles"},
+		searchTestTrack{Name: "Help!", Album: "Help!", Artist: "The Beatles"},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+
+	type item struct {
+		Type   string `json:"type"`
+		Groups []struct {
+			Type string `json:"type"`
+		} `json:"groups"`
+		Tracks []struct {
+			Type string `json:"type"`
+		} `json:"tracks"`
+	}
+
+	tests := []struct {
+		g      index.Group
+		typ    string
+		groups []string
+		tracks []string
+	}{
+		{root, itemTypeCollection, []string{itemTypeGroup, itemTypeGroup}, nil},
+		{root.Get(root.Keys()[0]), itemTypeGroup, nil, []string{itemTypeTrack}},
+	}
+
+	for ii, tt := range tests {
+		b, err := json.Marshal(&Group{Group: tt.g, Key: "Root"})
+		if err != nil {
+			t.Fatalf("[%d] unexpected error from json.Marshal: %v", ii, err)
+		}
+		var got item
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("[%d] unexpected error from json.Unmarshal: %v", ii, err)
+		}
+
+		if got.Type != tt.typ {
+			t.Errorf("[%d] type = %#v, expected: %#v", ii, got.Type, tt.typ)
+		}
+		if len(got.Groups) != len(tt.groups) || len(got.Tracks) != len(tt.tracks) {
+			t.Errorf("[%d] got %d groups and %d tracks, expected: %d and %d", ii, len(got.Groups), len(got.Tracks), len(tt.groups), len(tt.tracks))
+			continue
+		}
+		for i, g := range got.Groups {
+			if g.Type != tt.groups[i] {
+				t.Errorf("[%d] groups[%d].type = %#v, expected: %#v", ii, i, g.Type, tt.groups[i])
+			}
+		}
+		for i, x := range got.Tracks {
+			if x.Type != tt.tracks[i] {
+				t.Errorf("[%d] tracks[%d].type = %#v, expected: %#v", ii, i, x.Type, tt.tracks[i])
+			}
+		}
+	}
+}
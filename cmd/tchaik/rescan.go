@@ -0,0 +1,207 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/walk"
+	"tchaik.com/store"
+)
+
+// rescanStatus is a summary of the changes between the library and the underlying files.
+type rescanStatus struct {
+	Needed   bool `json:"needed"`
+	Added    int  `json:"added"`
+	Removed  int  `json:"removed"`
+	Modified int  `json:"modified"`
+
+	// AddedChecked is true if the library was built from a path, and so additions could be
+	// detected.
+	AddedChecked bool `json:"addedChecked"`
+}
+
+// computeRescanStatus compares the modification times recorded in the library with those of the
+// files on disk.  If root is non-empty then files under root which are not in the library are
+// counted as additions.
+func computeRescanStatus(l index.Library, root string) rescanStatus {
+	var s rescanStatus
+	known := make(map[string]bool)
+	for _, t := range l.Tracks() {
+		loc := t.GetString("Location")
+		known[loc] = true
+
+		fi, err := os.Stat(loc)
+		if err != nil {
+			s.Removed++
+			continue
+		}
+		if fi.ModTime().Truncate(time.Second).After(t.GetTime("DateModified").Truncate(time.Second)) {
+			s.Modified++
+		}
+	}
+
+	if root != "" {
+		s.AddedChecked = true
+		for _, p := range walk.Files(root) {
+			if !known[p] {
+				s.Added++
+			}
+		}
+	}
+
+	s.Needed = s.Added > 0 || s.Removed > 0 || s.Modified > 0
+	return s
+}
+
+// libraryChange describes a change to the library (or its metadata) which is broadcast to
+// clients in LIBRARY_CHANGED messages.
+type libraryChange struct {
+	Reason string     `json:"reason"`
+	Path   index.Path `json:"path,omitempty"` // favourite/checklist/remote item path
+	Name   string     `json:"name,omitempty"` // playlist name
+
+	Tracks    int `json:"tracks,omitempty"`
+	Processed int `json:"processed,omitempty"` // number of files (re-)read during the rescan
+}
+
+// Reasons for library changes.
+const (
+	changeRescan    string = "RESCAN"
+	changeFavourite        = "FAVOURITE"
+	changeChecklist        = "CHECKLIST"
+	changeRating           = "RATING"
+	changePlaylist         = "PLAYLIST"
+	changeRemote           = "REMOTE"
+)
+
+// errRescanInProgress is returned by sharedLibrary.Rescan when a rescan is already running.
+var errRescanInProgress = errors.New("rescan already in progress")
+
+// sharedLibrary is a Library which can be replaced (i.e. after a rescan) while it is in use.
+// It implements index.Library by delegating to the current Library.
+type sharedLibrary struct {
+	sync.RWMutex
+	l      Library
+	walked index.Library // library built by walking walkPath, used for incremental rescans
+
+	rescanMu   sync.Mutex // protects rescanning and watchers
+	rescanning bool
+	watchers   map[chan libraryChange]struct{}
+}
+
+func newSharedLibrary(l Library, walked index.Library) *sharedLibrary {
+	return &sharedLibrary{
+		l:        l,
+		walked:   walked,
+		watchers: make(map[chan libraryChange]struct{}),
+	}
+}
+
+// Get returns the current Library.
+func (s *sharedLibrary) Get() Library {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.l
+}
+
+// Set replaces the current Library.
+func (s *sharedLibrary) Set(l Library) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.l = l
+}
+
+// Tracks implements index.Library.
+func (s *sharedLibrary) Tracks() []index.Track {
+	l := s.Get()
+	return l.Tracks()
+}
+
+// Track implements index.Library.
+func (s *sharedLibrary) Track(identifier string) (index.Track, bool) {
+	l := s.Get()
+	return l.Track(identifier)
+}
+
+// FileSystem wraps the store.FileSystem in a lookup on the current library, see
+// Library.FileSystem.
+func (s *sharedLibrary) FileSystem(fs store.FileSystem) store.FileSystem {
+	return store.Trace(&libraryFileSystem{fs, s}, "libraryFileSystem")
+}
+
+// Watch returns a channel which receives a libraryChange each time the library is rebuilt,
+// and a function which must be called to stop watching.
+func (s *sharedLibrary) Watch() (<-chan libraryChange, func()) {
+	ch := make(chan libraryChange, 1)
+
+	s.rescanMu.Lock()
+	s.watchers[ch] = struct{}{}
+	s.rescanMu.Unlock()
+
+	return ch, func() {
+		s.rescanMu.Lock()
+		delete(s.watchers, ch)
+		s.rescanMu.Unlock()
+	}
+}
+
+// Rescan starts an incremental rescan of the files under walkPath: only files which have
+// been added or modified since the last scan are read.  The current library is replaced
+// and watchers notified when the rescan completes.  Returns an error if the library was
+// not built from a path, or if a rescan is already in progress.
+func (s *sharedLibrary) Rescan() error {
+	s.rescanMu.Lock()
+	defer s.rescanMu.Unlock()
+
+	if walkPath == "" || s.walked == nil {
+		return fmt.Errorf("rescan is only supported for libraries built from a path (-path)")
+	}
+	if s.rescanning {
+		return errRescanInProgress
+	}
+	s.rescanning = true
+
+	go s.rescan(s.walked)
+	return nil
+}
+
+func (s *sharedLibrary) rescan(prev index.Library) {
+	walked, n := walk.Update(prev, walkPath)
+	l := NewLibrary(index.Convert(walked, "ID"), s.Get().remote)
+	for _, spec := range s.Get().filters.Defined() {
+		if err := l.filters.Define(spec); err != nil {
+			log.Printf("error redefining filter %#v after rescan: %v", spec.Name, err)
+		}
+	}
+	s.Set(l)
+	log.Printf("rescan of %v complete: %d files processed", walkPath, n)
+
+	change := libraryChange{
+		Reason:    changeRescan,
+		Tracks:    len(l.Tracks()),
+		Processed: n,
+	}
+
+	s.rescanMu.Lock()
+	defer s.rescanMu.Unlock()
+
+	s.walked = walked
+	s.rescanning = false
+	for ch := range s.watchers {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// role is a type which represents the level of access granted to a connection.  Roles are
+// carried by the credentials of the connection: either the role of its user token, or (for
+// basic authentication) whether the user is the guest user, see requestRole.
+type role int
+
+const (
+	// roleGuest can browse and play, but not change anything.
+	roleGuest role = iota
+	// roleAdmin can do anything.
+	roleAdmin
+)
+
+// roleNames is a mapping of role names (i.e. as given in the user tokens file) to roles.
+var roleNames = map[string]role{
+	"guest": roleGuest,
+	"admin": roleAdmin,
+}
+
+// parseRole returns the role with the given name.
+func parseRole(name string) (role, error) {
+	r, ok := roleNames[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid role: %#v (must be \"admin\" or \"guest\")", name)
+	}
+	return r, nil
+}
+
+// String implements fmt.Stringer.
+func (r role) String() string {
+	for name, x := range roleNames {
+		if x == r {
+			return name
+		}
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// actionRoles is a mapping of websocket actions to the minimum role required to perform
+// them.  Actions which are not listed are available to all authenticated users.
+var actionRoles = map[string]role{
+	ActionSetFavourite:    roleAdmin,
+	ActionSetChecklist:    roleAdmin,
+	ActionSetChecklistAll: roleAdmin,
+	ActionSetCrossfade:    roleAdmin,
+	ActionSetRating:       roleAdmin,
+	ActionPlaylist:        roleAdmin,
+	ActionSetPlaylistMeta: roleAdmin,
+	ActionSmartPlaylist:   roleAdmin,
+	ActionQueue:           roleAdmin,
+	ActionRequeueRecent:   roleAdmin,
+	ActionResetPlayback:   roleAdmin,
+	ActionSetRootOrder:    roleAdmin,
+	ActionRescan:          roleAdmin,
+	ActionDefineFilter:    roleAdmin,
+	ActionRemote:          roleAdmin,
+}
+
+// readActions maps websocket actions to sub-actions (the "action" field of the Command)
+// which only read data, and so are available to all authenticated users.
+var readActions = map[string]string{
+	ActionPlaylist:      "FETCH",
+	ActionSmartPlaylist: "FETCH",
+	ActionRemote:        "LIST",
+}
+
+// writeActions maps websocket actions which are available to all authenticated users to
+// sub-actions (the "action" field of the Command) which change data, and so require
+// roleAdmin.
+var writeActions = map[string][]string{
+	// SET_AND_PLAY replaces the playlist of the cursor (as ActionResetPlayback does), and
+	// DELETE can remove shared cursors (i.e. the one cast and AirPlay players play from).
+	ActionCursor: {"SET_AND_PLAY", "DELETE"},
+}
+
+// requiredRole returns the minimum role required to perform the Command.
+func requiredRole(c Command) role {
+	if subs, ok := writeActions[c.Action]; ok {
+		sub, _ := c.getString("action")
+		for _, a := range subs {
+			if sub == a {
+				return roleAdmin
+			}
+		}
+	}
+	if a, ok := readActions[c.Action]; ok {
+		if sub, _ := c.getString("action"); sub == a {
+			return roleGuest
+		}
+	}
+	return actionRoles[c.Action]
+}
+
+// Allowed returns true iff the role can perform the Command.
+func (r role) Allowed(c Command) bool {
+	return r >= requiredRole(c)
+}
+
+// requestRole returns the role of the (authenticated) user making the request.  Requests with a
+// user token have the role of the token (see loadUserTokens), and tokens without a role are
+// guests if a guest user is configured.  Otherwise, if no guest user is configured then all
+// users are admins.
+func requestRole(r *http.Request) role {
+	if t := requestToken(r); t != "" {
+		if ro, ok := userTokenRoles[t]; ok {
+			return ro
+		}
+		if authGuestUser != "" {
+			return roleGuest
+		}
+		return roleAdmin
+	}
+	if authGuestUser == "" {
+		return roleAdmin
+	}
+	if user, _, ok := r.BasicAuth(); ok && user == authGuestUser {
+		return roleGuest
+	}
+	return roleAdmin
+}
@@ -0,0 +1,89 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoleAllowed(t *testing.T) {
+	tests := []struct {
+		r        role
+		c        Command
+		expected bool
+	}{
+		{roleGuest, Command{Action: ActionFetch}, true},
+		{roleGuest, Command{Action: ActionSearch}, true},
+		{roleGuest, Command{Action: ActionSetFavourite}, false},
+		{roleGuest, Command{Action: ActionPlaylist, Data: map[string]interface{}{"action": "FETCH"}}, true},
+		{roleGuest, Command{Action: ActionPlaylist, Data: map[string]interface{}{"action": "ADD_ITEM"}}, false},
+		{roleGuest, Command{Action: ActionCursor, Data: map[string]interface{}{"action": "NEXT"}}, true},
+		{roleGuest, Command{Action: ActionCursor, Data: map[string]interface{}{"action": "SET_AND_PLAY"}}, false},
+		{roleAdmin, Command{Action: ActionCursor, Data: map[string]interface{}{"action": "SET_AND_PLAY"}}, true},
+		{roleGuest, Command{Action: ActionCursor, Data: map[string]interface{}{"action": "DELETE", "name": "Default"}}, false},
+		{roleAdmin, Command{Action: ActionCursor, Data: map[string]interface{}{"action": "DELETE", "name": "Default"}}, true},
+		{roleAdmin, Command{Action: ActionSetFavourite}, true},
+		{roleAdmin, Command{Action: ActionPlaylist, Data: map[string]interface{}{"action": "ADD_ITEM"}}, true},
+	}
+
+	for ii, tt := range tests {
+		got := tt.r.Allowed(tt.c)
+		if got != tt.expected {
+			t.Errorf("[%d] role(%d).Allowed(%#v) = %v, expected: %v", ii, tt.r, tt.c, got, tt.expected)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, r := range []role{roleGuest, roleAdmin} {
+		got, err := parseRole(r.String())
+		if err != nil || got != r {
+			t.Errorf("parseRole(%#v) = %v, %v, expected: %v, nil", r.String(), got, err, r)
+		}
+	}
+	if _, err := parseRole("owner"); err == nil {
+		t.Errorf("parseRole(%#v) error = nil, expected error", "owner")
+	}
+}
+
+func TestRequestRole(t *testing.T) {
+	userTokens = map[string]string{"abc": "alice", "def": "bob", "ghi": "carol"}
+	userTokenRoles = map[string]role{"def": roleGuest, "ghi": roleAdmin}
+	defer func() { userTokens, userTokenRoles, authGuestUser = nil, nil, "" }()
+
+	basic := func(user string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, "secret") }
+	}
+	token := func(t string) func(r *http.Request) {
+		return func(r *http.Request) { r.URL.RawQuery = "token=" + t }
+	}
+
+	tests := []struct {
+		guest    string // guest user
+		setup    func(r *http.Request)
+		expected role
+	}{
+		{"", basic("admin"), roleAdmin},
+		{"", token("abc"), roleAdmin},
+		{"", token("def"), roleGuest},
+		{"guest", basic("admin"), roleAdmin},
+		{"guest", basic("guest"), roleGuest},
+		{"guest", token("abc"), roleGuest}, // no role given
+		{"guest", token("def"), roleGuest},
+		{"guest", token("ghi"), roleAdmin},
+		{"guest", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ghi") }, roleAdmin},
+	}
+
+	for ii, tt := range tests {
+		authGuestUser = tt.guest
+		r := httptest.NewRequest("GET", "/socket", nil)
+		tt.setup(r)
+		if got := requestRole(r); got != tt.expected {
+			t.Errorf("[%d] requestRole() = %d, expected: %d", ii, got, tt.expected)
+		}
+	}
+}
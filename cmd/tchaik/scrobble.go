@@ -0,0 +1,346 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tchaik.com/index"
+)
+
+// scrobble is a record of a track play to be submitted to a scrobbling service.
+type scrobble struct {
+	Artist    string
+	Track     string
+	Album     string
+	Duration  int // seconds
+	Timestamp time.Time
+}
+
+func newScrobble(t index.Track, start time.Time) scrobble {
+	return scrobble{
+		Artist:    strings.Join(t.GetStrings("Artist"), ", "),
+		Track:     t.GetString("Name"),
+		Album:     t.GetString("Album"),
+		Duration:  t.GetInt("TotalTime") / 1000,
+		Timestamp: start,
+	}
+}
+
+// scrobbleClient is an interface which defines methods for submitting plays to a
+// scrobbling service.
+type scrobbleClient interface {
+	// NowPlaying notifies the service that the track has started playing.
+	NowPlaying(s scrobble) error
+
+	// Scrobble submits the play.
+	Scrobble(s scrobble) error
+}
+
+// permanentError is implemented by errors from a scrobbleClient which won't succeed if
+// retried.
+type permanentError interface {
+	Permanent() bool
+}
+
+func isPermanent(err error) bool {
+	p, ok := err.(permanentError)
+	return ok && p.Permanent()
+}
+
+// minScrobbleDuration is the minimum duration of a track which can be scrobbled.
+const minScrobbleDuration = 30 * time.Second
+
+// maxPendingScrobbles is the maximum number of scrobbles held for retrying, once reached
+// the oldest are dropped.
+const maxPendingScrobbles = 1000
+
+// scrobblePlay is the state of the track loaded in a player.
+type scrobblePlay struct {
+	trackID   string
+	start     time.Time
+	scrobbled bool
+	ended     bool // the play has been recorded (see Played)
+}
+
+// scrobbler sends now-playing updates and scrobbles to a scrobbleClient.  A track is
+// scrobbled once the play position passes threshold (a fraction of the track duration),
+// or when the play is recorded.  Scrobbles which fail are queued and retried, unless the
+// failure is permanent.
+type scrobbler struct {
+	client    scrobbleClient
+	threshold float64
+	retry     time.Duration
+
+	sync.Mutex
+	plays   map[string]*scrobblePlay // player key -> current play
+	pending []scrobble
+	wake    chan struct{}
+}
+
+func newScrobbler(client scrobbleClient, threshold float64, retry time.Duration) *scrobbler {
+	s := &scrobbler{
+		client:    client,
+		threshold: threshold,
+		retry:     retry,
+		plays:     make(map[string]*scrobblePlay),
+		wake:      make(chan struct{}, 1),
+	}
+	go s.run()
+	return s
+}
+
+// Update records the play position (in seconds) of the track loaded in the player with
+// the given key.  A now-playing update is sent when a new track starts.
+func (s *scrobbler) Update(key string, t index.Track, pos float64) {
+	if s == nil {
+		return
+	}
+
+	id := t.GetString("ID")
+	d := float64(t.GetInt("TotalTime")) / 1000
+
+	s.Lock()
+	p, ok := s.plays[key]
+	if ok && p.trackID == id && p.ended {
+		if d <= 0 || pos >= s.threshold*d {
+			// Status from the end of a play which has already been recorded.
+			s.Unlock()
+			return
+		}
+		// The track is being played again.
+		ok = false
+	}
+	if !ok || p.trackID != id {
+		p = &scrobblePlay{
+			trackID: id,
+			start:   time.Now().Add(-time.Duration(pos * float64(time.Second))),
+		}
+		s.plays[key] = p
+		go s.nowPlaying(newScrobble(t, p.start))
+	}
+
+	if d > 0 && pos >= s.threshold*d {
+		s.scrobble(p, t)
+	}
+	s.Unlock()
+}
+
+// Played records that the track loaded in the player with the given key has finished
+// playing, and scrobbles it if it has not already been scrobbled.  The play is kept until
+// the player loads another track, so that later updates don't scrobble it again.
+func (s *scrobbler) Played(key string, t index.Track) {
+	if s == nil {
+		return
+	}
+
+	id := t.GetString("ID")
+	s.Lock()
+	defer s.Unlock()
+
+	p, ok := s.plays[key]
+	if !ok || p.trackID != id || p.ended {
+		d := time.Duration(t.GetInt("TotalTime")) * time.Millisecond
+		p = &scrobblePlay{
+			trackID: id,
+			start:   time.Now().Add(-d),
+		}
+		s.plays[key] = p
+	}
+	s.scrobble(p, t)
+	p.ended = true
+}
+
+// scrobble queues the play for submission.  Must be called with the lock held.
+func (s *scrobbler) scrobble(p *scrobblePlay, t index.Track) {
+	if p.scrobbled {
+		return
+	}
+	if time.Duration(t.GetInt("TotalTime"))*time.Millisecond < minScrobbleDuration {
+		return
+	}
+	p.scrobbled = true
+	if n := len(s.pending) - maxPendingScrobbles + 1; n > 0 {
+		log.Printf("dropping %d pending scrobbles", n)
+		s.pending = s.pending[n:]
+	}
+	s.pending = append(s.pending, newScrobble(t, p.start))
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scrobbler) nowPlaying(x scrobble) {
+	if err := s.client.NowPlaying(x); err != nil {
+		log.Printf("error sending now playing update: %v", err)
+	}
+}
+
+// run submits pending scrobbles, waiting for the retry interval after a failure.
+func (s *scrobbler) run() {
+	for {
+		select {
+		case <-s.wake:
+		case <-time.After(s.retry):
+		}
+		s.flush()
+	}
+}
+
+// flush submits pending scrobbles in order, stopping at the first failure which can be
+// retried.  Scrobbles which fail permanently are dropped.
+func (s *scrobbler) flush() {
+	for {
+		s.Lock()
+		if len(s.pending) == 0 {
+			s.Unlock()
+			return
+		}
+		x, n := s.pending[0], len(s.pending)
+		s.Unlock()
+
+		if err := s.client.Scrobble(x); err != nil {
+			if !isPermanent(err) {
+				log.Printf("error scrobbling (%d pending): %v", n, err)
+				return
+			}
+			log.Printf("error scrobbling, dropped %v: %v", x.Track, err)
+		}
+
+		s.Lock()
+		s.pending = s.pending[1:]
+		s.Unlock()
+	}
+}
+
+// lastfmURL is the root URL of the last.fm API.
+const lastfmURL = "https://ws.audioscrobbler.com/2.0/"
+
+// lastfmTimeout is the timeout for requests to the last.fm API.
+const lastfmTimeout = 30 * time.Second
+
+// lastfmClient is a scrobbleClient which submits to last.fm.
+type lastfmClient struct {
+	apiKey     string
+	secret     string
+	sessionKey string
+
+	url    string
+	client *http.Client
+}
+
+func newLastfmClient(apiKey, secret, sessionKey string) lastfmClient {
+	return lastfmClient{
+		apiKey:     apiKey,
+		secret:     secret,
+		sessionKey: sessionKey,
+		url:        lastfmURL,
+		client:     &http.Client{Timeout: lastfmTimeout},
+	}
+}
+
+// lastfmError is an error returned by the last.fm API.
+type lastfmError struct {
+	Code    int
+	Message string
+}
+
+func (e lastfmError) Error() string {
+	return fmt.Sprintf("last.fm error %d: %v", e.Code, e.Message)
+}
+
+// Permanent implements permanentError.  All errors other than service offline (11),
+// temporary error (16) and rate limit exceeded (29) are permanent.
+func (e lastfmError) Permanent() bool {
+	switch e.Code {
+	case 11, 16, 29:
+		return false
+	}
+	return true
+}
+
+// NowPlaying implements scrobbleClient.
+func (l lastfmClient) NowPlaying(s scrobble) error {
+	v := url.Values{}
+	v.Set("method", "track.updateNowPlaying")
+	l.setTrack(v, s)
+	return l.call(v)
+}
+
+// Scrobble implements scrobbleClient.
+func (l lastfmClient) Scrobble(s scrobble) error {
+	v := url.Values{}
+	v.Set("method", "track.scrobble")
+	v.Set("timestamp", strconv.FormatInt(s.Timestamp.Unix(), 10))
+	l.setTrack(v, s)
+	return l.call(v)
+}
+
+func (l lastfmClient) setTrack(v url.Values, s scrobble) {
+	v.Set("artist", s.Artist)
+	v.Set("track", s.Track)
+	if s.Album != "" {
+		v.Set("album", s.Album)
+	}
+	if s.Duration > 0 {
+		v.Set("duration", strconv.Itoa(s.Duration))
+	}
+}
+
+// sign adds the authentication parameters and request signature to v.
+func (l lastfmClient) sign(v url.Values) {
+	v.Set("api_key", l.apiKey)
+	v.Set("sk", l.sessionKey)
+
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := md5.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s%s", k, v.Get(k))
+	}
+	fmt.Fprint(h, l.secret)
+	v.Set("api_sig", hex.EncodeToString(h.Sum(nil)))
+}
+
+func (l lastfmClient) call(v url.Values) error {
+	l.sign(v)
+	resp, err := l.client.PostForm(l.url, v)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		Status string `xml:"status,attr"`
+		Error  struct {
+			Code    int    `xml:"code,attr"`
+			Message string `xml:",chardata"`
+		} `xml:"error"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("error decoding last.fm response (%v): %v", resp.Status, err)
+	}
+	if r.Status != "ok" {
+		return lastfmError{r.Error.Code, strings.TrimSpace(r.Error.Message)}
+	}
+	return nil
+}
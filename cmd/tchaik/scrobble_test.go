@@ -0,0 +1,221 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testTrack struct {
+	ID, Name  string
+	TotalTime int // milliseconds
+}
+
+func (t testTrack) GetString(k string) string {
+	switch k {
+	case "ID":
+		return t.ID
+	case "Name":
+		return t.Name
+	}
+	return ""
+}
+
+func (t testTrack) GetStrings(k string) []string { return nil }
+
+func (t testTrack) GetInt(k string) int {
+	if k == "TotalTime" {
+		return t.TotalTime
+	}
+	return 0
+}
+
+func (t testTrack) GetBool(k string) bool      { return false }
+func (t testTrack) GetTime(k string) time.Time { return time.Time{} }
+
+type testScrobbleClient struct {
+	sync.Mutex
+	fail       bool
+	permanent  bool
+	attempts   int
+	nowPlaying []string
+	scrobbles  []string
+}
+
+func (c *testScrobbleClient) NowPlaying(s scrobble) error {
+	c.Lock()
+	defer c.Unlock()
+	c.nowPlaying = append(c.nowPlaying, s.Track)
+	return nil
+}
+
+func (c *testScrobbleClient) Scrobble(s scrobble) error {
+	c.Lock()
+	defer c.Unlock()
+	c.attempts++
+	if c.fail {
+		return fmt.Errorf("network error")
+	}
+	if c.permanent {
+		return lastfmError{Code: 6, Message: "Invalid parameters"}
+	}
+	c.scrobbles = append(c.scrobbles, s.Track)
+	return nil
+}
+
+func (c *testScrobbleClient) counts() (int, int) {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.nowPlaying), len(c.scrobbles)
+}
+
+func TestScrobbler(t *testing.T) {
+	c := &testScrobbleClient{fail: true}
+	s := newScrobbler(c, 0.5, 10*time.Millisecond)
+
+	long := testTrack{ID: "1", Name: "long", TotalTime: 200000}
+	short := testTrack{ID: "2", Name: "short", TotalTime: 10000}
+
+	s.Update("key", long, 10)
+	s.Update("key", long, 99)
+	s.Update("key", long, 100)
+	s.Update("key", long, 150)
+	s.Played("key", long)
+	s.Played("key", short)
+
+	time.Sleep(50 * time.Millisecond)
+	if _, n := c.counts(); n != 0 {
+		t.Errorf("scrobbles submitted while client failing: %d", n)
+	}
+
+	c.Lock()
+	c.fail = false
+	c.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	np, n := c.counts()
+	if np != 1 {
+		t.Errorf("now playing updates = %d, expected: %d", np, 1)
+	}
+	if n != 1 {
+		t.Errorf("scrobbles = %d, expected: %d", n, 1)
+	}
+}
+
+func TestScrobblerPlayedOnce(t *testing.T) {
+	c := &testScrobbleClient{}
+	s := newScrobbler(c, 0.5, time.Hour)
+
+	long := testTrack{ID: "1", Name: "long", TotalTime: 200000}
+
+	s.Update("key", long, 150)
+	s.Played("key", long)
+	// Status updates from the end of the play.
+	s.Update("key", long, 199)
+	s.Update("key", long, 200)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, n := c.counts(); n != 1 {
+		t.Errorf("scrobbles = %d, expected: %d", n, 1)
+	}
+
+	// Playing the track again is scrobbled.
+	s.Update("key", long, 0)
+	s.Update("key", long, 150)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, n := c.counts(); n != 2 {
+		t.Errorf("scrobbles after replay = %d, expected: %d", n, 2)
+	}
+}
+
+func TestScrobblerPermanentError(t *testing.T) {
+	c := &testScrobbleClient{permanent: true}
+	s := newScrobbler(c, 0.5, 10*time.Millisecond)
+
+	s.Played("a", testTrack{ID: "1", Name: "one", TotalTime: 200000})
+	s.Played("b", testTrack{ID: "2", Name: "two", TotalTime: 200000})
+	time.Sleep(50 * time.Millisecond)
+
+	c.Lock()
+	attempts := c.attempts
+	c.Unlock()
+	if attempts != 2 {
+		t.Errorf("scrobble attempts = %d, expected: %d", attempts, 2)
+	}
+
+	s.Lock()
+	n := len(s.pending)
+	s.Unlock()
+	if n != 0 {
+		t.Errorf("pending scrobbles = %d, expected: %d", n, 0)
+	}
+}
+
+func TestScrobblerPendingLimit(t *testing.T) {
+	c := &testScrobbleClient{fail: true}
+	s := newScrobbler(c, 0.5, time.Hour)
+
+	for i := 0; i < maxPendingScrobbles+5; i++ {
+		s.Played("key", testTrack{ID: fmt.Sprint(i), Name: fmt.Sprint(i), TotalTime: 200000})
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if len(s.pending) != maxPendingScrobbles {
+		t.Fatalf("pending scrobbles = %d, expected: %d", len(s.pending), maxPendingScrobbles)
+	}
+	if s.pending[0].Track != "5" {
+		t.Errorf("oldest pending scrobble = %v, expected: %v", s.pending[0].Track, "5")
+	}
+}
+
+func TestLastfmClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("track") {
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+		case "temporary":
+			fmt.Fprint(w, `<lfm status="failed"><error code="16">Temporary error</error></lfm>`)
+		case "permanent":
+			fmt.Fprint(w, `<lfm status="failed"><error code="6">Invalid parameters</error></lfm>`)
+		default:
+			fmt.Fprint(w, `<lfm status="ok"></lfm>`)
+		}
+	}))
+	defer srv.Close()
+
+	l := newLastfmClient("key", "secret", "session")
+	if l.client.Timeout == 0 {
+		t.Errorf("newLastfmClient() has no request timeout")
+	}
+	l.url = srv.URL
+	l.client.Timeout = 20 * time.Millisecond
+
+	tests := []struct {
+		track     string
+		err       bool
+		permanent bool
+	}{
+		{"ok", false, false},
+		{"slow", true, false},
+		{"temporary", true, false},
+		{"permanent", true, true},
+	}
+	for _, tt := range tests {
+		err := l.Scrobble(scrobble{Artist: "artist", Track: tt.track})
+		if (err != nil) != tt.err {
+			t.Errorf("Scrobble(%#v) error = %v, expected error: %v", tt.track, err, tt.err)
+		}
+		if got := isPermanent(err); got != tt.permanent {
+			t.Errorf("isPermanent(Scrobble(%#v)) = %v, expected: %v", tt.track, got, tt.permanent)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+)
+
+// searchFieldWeights are the weights given to matches in each of the searchFields when
+// ranking search results (see index.MatchWords).
+var searchFieldWeights = map[string]float64{
+	"Album":    4,
+	"Artist":   4,
+	"Composer": 3,
+	"Name":     2,
+}
+
+// searchPlaysWeight is the weight given to the (log of the) number of plays of the tracks
+// in a search result when ranking search results.
+const searchPlaysWeight = 1
+
+// rankSearch orders the search results (paths) by relevance to the input, using the fields
+// which matched (see searchFieldWeights) and the popularity of the tracks.  Results with
+// the same score keep their original order.  Results which aren't in the library's
+// searchRankCache are left unscored if the context is cancelled.
+func rankSearch(ctx context.Context, l Library, m *Meta, input string, paths []index.Path) []index.Path {
+	ranked := scoredPathSlice{
+		paths:  make([]index.Path, len(paths)),
+		scores: make([]float64, len(paths)),
+	}
+	copy(ranked.paths, paths)
+	for i, p := range paths {
+		r, err := l.searchRanks.Get(ctx, &l, p)
+		if err != nil {
+			continue
+		}
+		plays := l.searchRanks.Plays(r, m)
+		ranked.scores[i] = r.words.Score(input, searchFieldWeights) + searchPlaysWeight*math.Log1p(float64(plays))
+	}
+	sort.Stable(ranked)
+	return ranked.paths
+}
+
+// searchRank is the data used to rank a search result: the words of its searchFieldWeights
+// fields and the IDs of its tracks, along with their total play count.
+type searchRank struct {
+	words index.MatchWords
+	ids   []string
+
+	plays    int
+	playsGen int // generation of the searchRankCache when plays was counted
+}
+
+// searchRankCache caches searchRanks by path, so that search results aren't fetched and
+// walked on every search.  The index does not change while tchaik is running, so entries
+// are kept, but their play counts are recounted after InvalidatePlays.
+type searchRankCache struct {
+	sync.Mutex
+	m   map[string]*searchRank
+	gen int
+}
+
+func newSearchRankCache() *searchRankCache {
+	return &searchRankCache{
+		m:   make(map[string]*searchRank),
+		gen: 1,
+	}
+}
+
+// Get returns the (cached) searchRank of the Group with Path p, fetching it from the
+// Library if necessary.
+func (c *searchRankCache) Get(ctx context.Context, l *Library, p index.Path) (*searchRank, error) {
+	k := p.Encode()
+
+	c.Lock()
+	r, ok := c.m[k]
+	c.Unlock()
+	if ok {
+		return r, nil
+	}
+
+	g, _, err := l.Fetch(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(searchFieldWeights))
+	for f := range searchFieldWeights {
+		fields = append(fields, f)
+	}
+	r = &searchRank{words: index.GroupMatchWords(g, fields)}
+	index.Walk(g, p, func(t index.Track, _ index.Path) error {
+		r.ids = append(r.ids, t.GetString("ID"))
+		return nil
+	})
+
+	c.Lock()
+	c.m[k] = r
+	c.Unlock()
+	return r, nil
+}
+
+// Plays returns the total play count of the tracks in the searchRank, which is recounted
+// from the Meta if plays have been recorded since it was last counted.
+func (c *searchRankCache) Plays(r *searchRank, m *Meta) int {
+	c.Lock()
+	defer c.Unlock()
+
+	if r.playsGen != c.gen {
+		r.plays = 0
+		for _, id := range r.ids {
+			r.plays += m.PlayCount(id)
+		}
+		r.playsGen = c.gen
+	}
+	return r.plays
+}
+
+// InvalidatePlays marks the play counts of all entries as out of date.
+func (c *searchRankCache) InvalidatePlays() {
+	c.Lock()
+	c.gen++
+	c.Unlock()
+}
+
+// scoredPathSlice is a convenience type for sorting paths by score (highest first).
+type scoredPathSlice struct {
+	paths  []index.Path
+	scores []float64
+}
+
+func (s scoredPathSlice) Len() int           { return len(s.paths) }
+func (s scoredPathSlice) Less(i, j int) bool { return s.scores[i] > s.scores[j] }
+func (s scoredPathSlice) Swap(i, j int) {
+	s.paths[i], s.paths[j] = s.paths[j], s.paths[i]
+	s.scores[i], s.scores[j] = s.scores[j], s.scores[i]
+}
+
+// groupedSearchResults are search results grouped by the kind of item which matched the
+// input.
+type groupedSearchResults struct {
+	Artists searchBucket `json:"artists"`
+	Albums  searchBucket `json:"albums"`
+	Tracks  searchBucket `json:"tracks"`
+}
+
+// searchBucket is a group of search results of one kind.
+type searchBucket struct {
+	// Count is the number of matches included in Results, Total is the number of matches
+	// before the limit was applied.
+	Count   int         `json:"count"`
+	Total   int         `json:"total"`
+	Results interface{} `json:"results"`
+}
+
+// searchArtist is an artist matched by a search, with the paths of the search results which
+// contain their tracks.
+type searchArtist struct {
+	Name  string       `json:"name"`
+	Paths []index.Path `json:"paths"`
+}
+
+// groupSearch buckets the (ranked) search results into the artists and tracks whose names
+// match the input, and the albums which match the input by name, or by a combination of
+// fields (hence not by an artist or track alone).  Each bucket keeps the order of the
+// results, and includes at most limit items if limit > 0.  Results are skipped if the context
+// is cancelled.
+func groupSearch(ctx context.Context, l Library, input string, paths []index.Path, limit int) groupedSearchResults {
+	var artists []searchArtist
+	artistIndex := make(map[string]int)
+	var albums []index.Path
+	var tracks []trackSummary
+
+	for _, p := range paths {
+		g, _, err := l.Fetch(ctx, p)
+		if err != nil {
+			continue
+		}
+		matched := false
+		index.Walk(g, p, func(t index.Track, tp index.Path) error {
+			for _, a := range t.GetStrings("Artist") {
+				if !index.MatchString(a, input) {
+					continue
+				}
+				matched = true
+				i, ok := artistIndex[a]
+				if !ok {
+					i = len(artists)
+					artistIndex[a] = i
+					artists = append(artists, searchArtist{Name: a})
+				}
+				if ap := artists[i].Paths; len(ap) == 0 || !ap[len(ap)-1].Equal(p) {
+					artists[i].Paths = append(ap, p)
+				}
+			}
+			if index.MatchString(t.GetString("Name"), input) {
+				matched = true
+				tracks = append(tracks, newTrackSummary(t, tp))
+			}
+			return nil
+		})
+
+		if !matched || index.MatchString(g.Name(), input) {
+			albums = append(albums, p)
+		}
+	}
+
+	r := groupedSearchResults{
+		Artists: searchBucket{Total: len(artists)},
+		Albums:  searchBucket{Total: len(albums)},
+		Tracks:  searchBucket{Total: len(tracks)},
+	}
+	if limit > 0 {
+		if len(artists) > limit {
+			artists = artists[:limit]
+		}
+		if len(albums) > limit {
+			albums = albums[:limit]
+		}
+		if len(tracks) > limit {
+			tracks = tracks[:limit]
+		}
+	}
+	r.Artists.Count, r.Artists.Results = len(artists), artists
+	r.Albums.Count, r.Albums.Results = len(albums), l.ExpandPaths(albums)
+	r.Tracks.Count, r.Tracks.Results = len(tracks), tracks
+	return r
+}
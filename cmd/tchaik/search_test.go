@@ -0,0 +1,185 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+)
+
+type searchTestTrack struct {
+	ID, Name, Album, Artist string
+}
+
+func (t searchTestTrack) GetString(k string) string {
+	switch k {
+	case "ID":
+		return t.ID
+	case "Name":
+		return t.Name
+	case "Album":
+		return t.Album
+	case "Artist":
+		return t.Artist
+	}
+	return ""
+}
+
+func (t searchTestTrack) GetStrings(k string) []string { return index.DefaultGetStrings(t, k) }
+func (t searchTestTrack) GetInt(k string) int          { return 0 }
+func (t searchTestTrack) GetTime(k string) time.Time   { return time.Time{} }
+
+// mapPlayCounts is a playcount.Store of play counts by path.
+type mapPlayCounts map[string]int
+
+func (m mapPlayCounts) Increment(p index.Path) error { m[p.Encode()]++; return nil }
+func (m mapPlayCounts) Get(p index.Path) int         { return m[p.Encode()] }
+func (m mapPlayCounts) Top(n int) []index.Path       { return nil }
+
+func TestRankSearch(t *testing.T) {
+	tracks := testTracker{
+		searchTestTrack{ID: "1", Name: "Come Together", Album: "Abbey Road", Artist: "The Beatles"},
+		searchTestTrack{ID: "2", Name: "Road Runner", Album: "Road Songs", Artist: "Bo Diddley"},
+		searchTestTrack{ID: "3", Name: "Roadhouse Blues", Album: "Morrison Hotel", Artist: "The Doors"},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+	l := Library{
+		collections: map[string]index.Collection{"Root": root},
+		searchRanks: newSearchRankCache(),
+	}
+	plays := mapPlayCounts{}
+	m := &Meta{playCounts: plays}
+
+	albumPaths := make(map[string]index.Path)
+	for _, k := range root.Keys() {
+		albumPaths[root.Get(k).Name()] = index.Path{"Root", k}
+	}
+	abbey, hotel, songs := albumPaths["Abbey Road"], albumPaths["Morrison Hotel"], albumPaths["Road Songs"]
+	paths := []index.Path{hotel, abbey, songs}
+
+	// Album matches outweigh prefix matches of track names, ties keep their order.
+	got := rankSearch(context.Background(), l, m, "road", paths)
+	if expected := []index.Path{abbey, songs, hotel}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("rankSearch() = %v, expected: %v", got, expected)
+	}
+
+	// Ranks are cached, so results are still ranked with a cancelled context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got = rankSearch(ctx, l, m, "road", paths)
+	if expected := []index.Path{abbey, songs, hotel}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("rankSearch() with cancelled context = %v, expected: %v", got, expected)
+	}
+
+	// Play counts are recounted once invalidated.
+	plays.Increment(index.Path{"T", "2"})
+	got = rankSearch(ctx, l, m, "road", paths)
+	if expected := []index.Path{abbey, songs, hotel}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("rankSearch() before InvalidatePlays() = %v, expected: %v", got, expected)
+	}
+	l.searchRanks.InvalidatePlays()
+	got = rankSearch(ctx, l, m, "road", paths)
+	if expected := []index.Path{songs, abbey, hotel}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("rankSearch() after InvalidatePlays() = %v, expected: %v", got, expected)
+	}
+}
+
+func TestGroupSearch(t *testing.T) {
+	tracks := testTracker{
+		searchTestTrack{Name: "Come Together", Album: "Abbey Road", Artist: "The Beatles"},
+		searchTestTrack{Name: "Something", Album: "Abbey Road", Artist: "The Beatles"},
+		searchTestTrack{Name: "Help!", Album: "Help!", Artist: "The Beatles"},
+		searchTestTrack{Name: "Road Runner", Album: "Road Songs", Artist: "Bo Diddley & The Beatles"},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+	l := Library{collections: map[string]index.Collection{"Root": root}}
+
+	var albumPaths []index.Path // Abbey Road, Help!, Road Songs
+	for _, k := range root.Keys() {
+		albumPaths = append(albumPaths, index.Path{"Root", k})
+	}
+
+	tests := []struct {
+		input   string
+		paths   []int // indexes of the albums matched by the search
+		limit   int
+		artists []string
+		albums  int
+		tracks  []string
+		total   [3]int // artists, albums, tracks
+	}{
+		{"beatles", []int{0, 1, 2}, 0, []string{"The Beatles"}, 0, nil, [3]int{1, 0, 0}},
+		{"road", []int{0, 2}, 0, nil, 2, []string{"Road Runner"}, [3]int{0, 2, 1}},
+		{"help", []int{1}, 0, nil, 1, []string{"Help!"}, [3]int{0, 1, 1}},
+		{"beatles something", []int{0}, 0, nil, 1, nil, [3]int{0, 1, 0}},
+		{"b", []int{0, 1, 2}, 1, []string{"The Beatles"}, 0, nil, [3]int{2, 0, 0}},
+		{"road", []int{0, 2}, 1, nil, 1, []string{"Road Runner"}, [3]int{0, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		var paths []index.Path
+		for _, i := range tt.paths {
+			paths = append(paths, albumPaths[i])
+		}
+		r := groupSearch(context.Background(), l, tt.input, paths, tt.limit)
+
+		var artists []string
+		for _, a := range r.Artists.Results.([]searchArtist) {
+			artists = append(artists, a.Name)
+		}
+		if !reflect.DeepEqual(artists, tt.artists) {
+			t.Errorf("groupSearch(%#v) artists = %v, expected: %v", tt.input, artists, tt.artists)
+		}
+		if r.Albums.Count != tt.albums {
+			t.Errorf("groupSearch(%#v) albums count = %d, expected: %d", tt.input, r.Albums.Count, tt.albums)
+		}
+		var names []string
+		for _, ts := range r.Tracks.Results.([]trackSummary) {
+			names = append(names, ts.Name)
+		}
+		if !reflect.DeepEqual(names, tt.tracks) {
+			t.Errorf("groupSearch(%#v) tracks = %v, expected: %v", tt.input, names, tt.tracks)
+		}
+		total := [3]int{r.Artists.Total, r.Albums.Total, r.Tracks.Total}
+		if total != tt.total {
+			t.Errorf("groupSearch(%#v) totals = %v, expected: %v", tt.input, total, tt.total)
+		}
+	}
+}
+
+func TestGroupSearchCancelled(t *testing.T) {
+	tracks := testTracker{
+		searchTestTrack{Name: "Come Together", Album: "Abbey Road", Artist: "The Beatles"},
+		searchTestTrack{Name: "Help!", Album: "Help!", Artist: "The Beatles"},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+	l := Library{collections: map[string]index.Collection{"Root": root}}
+
+	var albumPaths []index.Path
+	for _, k := range root.Keys() {
+		albumPaths = append(albumPaths, index.Path{"Root", k})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := l.Fetch(ctx, albumPaths[0]); err != context.Canceled {
+		t.Errorf("Fetch() with cancelled context = %v, expected: %v", err, context.Canceled)
+	}
+	if err := l.Walk(ctx, index.Path{"Root"}, func(index.Track, index.Path) error { return nil }); err != context.Canceled {
+		t.Errorf("Walk() with cancelled context = %v, expected: %v", err, context.Canceled)
+	}
+
+	r := groupSearch(ctx, l, "beatles", albumPaths, 0)
+	if r.Artists.Total != 0 || r.Albums.Total != 0 || r.Tracks.Total != 0 {
+		t.Errorf("groupSearch() with cancelled context totals = [%d %d %d], expected: [0 0 0]", r.Artists.Total, r.Albums.Total, r.Tracks.Total)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/history"
+)
+
+// similarCount is the default number of tracks returned by SIMILAR.
+const similarCount = 25
+
+// coplayWindow is the longest time between two plays for the tracks to be considered as
+// played together (i.e. in the same listening session).
+const coplayWindow = 30 * time.Minute
+
+// Weights of the components of the similarity score of a track.
+const (
+	similarCoplayWeight = 3.0 // for each time the tracks were played together
+	similarArtistWeight = 2.0
+	similarGenreWeight  = 1.0
+)
+
+// coplayCounts returns the number of times each track (by encoded path) was played within
+// coplayWindow of a play of the track with path p.  The events must be ordered by time.
+func coplayCounts(events []history.Event, p index.Path) map[string]int {
+	within := func(i, j int) bool {
+		d := events[i].Time.Sub(events[j].Time)
+		if d < 0 {
+			d = -d
+		}
+		return d <= coplayWindow
+	}
+
+	m := make(map[string]int)
+	for i, e := range events {
+		if !e.Path.Equal(p) {
+			continue
+		}
+		for j := i - 1; j >= 0 && within(i, j); j-- {
+			if !events[j].Path.Equal(p) {
+				m[events[j].Path.Encode()]++
+			}
+		}
+		for j := i + 1; j < len(events) && within(i, j); j++ {
+			if !events[j].Path.Equal(p) {
+				m[events[j].Path.Encode()]++
+			}
+		}
+	}
+	return m
+}
+
+// similarTrack is a candidate track for SIMILAR results.
+type similarTrack struct {
+	path       index.Path
+	score      float64
+	sameArtist bool
+}
+
+// similarTrackSlice is a convenience type for sorting similarTracks by score (highest first).
+type similarTrackSlice []similarTrack
+
+func (s similarTrackSlice) Len() int           { return len(s) }
+func (s similarTrackSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s similarTrackSlice) Less(i, j int) bool { return s[i].score > s[j].score }
+
+// sharesValue returns true if a and b have a (non-empty) value in common, ignoring case.
+func sharesValue(a, b []string) bool {
+	for _, x := range a {
+		if x == "" {
+			continue
+		}
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rankSimilar returns the paths of (at most limit) tracks in the root collection which are
+// similar to the track t with path p, most similar first.  Tracks are scored by the number
+// of times they were played together with t (see coplayCounts), and for sharing an artist or
+// genre.  At most half of the results are by the same artist, so that they don't crowd out
+// everything else.
+func rankSimilar(root index.Collection, t index.Track, p index.Path, coplays map[string]int, limit int) []index.Path {
+	artists := t.GetStrings("Artist")
+	genre := t.GetString("Genre")
+
+	var candidates []similarTrack
+	index.Walk(&rootCollection{root}, index.Path{"Root"}, func(x index.Track, xp index.Path) error {
+		if xp.Equal(p) {
+			return nil
+		}
+		st := similarTrack{
+			path:       xp,
+			score:      similarCoplayWeight * float64(coplays[xp.Encode()]),
+			sameArtist: sharesValue(artists, x.GetStrings("Artist")),
+		}
+		if st.sameArtist {
+			st.score += similarArtistWeight
+		}
+		if genre != "" && strings.EqualFold(genre, x.GetString("Genre")) {
+			st.score += similarGenreWeight
+		}
+		if st.score > 0 {
+			candidates = append(candidates, st)
+		}
+		return nil
+	})
+	sort.Stable(similarTrackSlice(candidates))
+
+	maxSameArtist := limit / 2
+	var paths []index.Path
+	for _, st := range candidates {
+		if len(paths) == limit {
+			break
+		}
+		if st.sameArtist {
+			if maxSameArtist == 0 {
+				continue
+			}
+			maxSameArtist--
+		}
+		paths = append(paths, st.path)
+	}
+	return paths
+}
+
+// similar responds with the tracks which are similar to the track at path (see rankSimilar),
+// using the play history of the user.  The response contains the albums of the tracks
+// (expanded from the Root collection), and the track paths in order of similarity.
+func (h *websocketHandler) similar(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	rp, ok := h.lib.RootPath(p)
+	if !ok {
+		return invalidPath("path", fmt.Errorf("not a track: %v", p))
+	}
+	p = rp
+	t, err := h.lib.TrackFromPath(p)
+	if err != nil {
+		return invalidPath("path", err)
+	}
+
+	limit := similarCount
+	if _, ok := c.Data["limit"]; ok {
+		limit, err = c.getInt("limit")
+		if err != nil {
+			return err
+		}
+		if limit <= 0 {
+			return badField("invalid limit: %d (must be positive)", limit)
+		}
+	}
+
+	var events []history.Event
+	for _, e := range h.meta.history.Recent(-1) {
+		if rp, ok := h.lib.RootPath(e.Path); ok {
+			events = append(events, history.Event{Path: rp, Time: e.Time})
+		}
+	}
+
+	paths := rankSimilar(h.lib.collections["Root"], t, p, coplayCounts(events, p), limit)
+	resp.Data = struct {
+		Path  index.Path   `json:"path"`
+		Data  index.Group  `json:"data"`
+		Paths []index.Path `json:"paths"`
+	}{
+		Path:  p,
+		Data:  h.lib.ExpandPaths(paths),
+		Paths: paths,
+	}
+	return nil
+}
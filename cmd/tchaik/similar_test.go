@@ -0,0 +1,101 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+	"tchaik.com/index/history"
+)
+
+type similarTestTrack struct {
+	Name, Album, Artist, Genre string
+}
+
+func (t similarTestTrack) GetString(k string) string {
+	switch k {
+	case "Name":
+		return t.Name
+	case "Album":
+		return t.Album
+	case "Artist":
+		return t.Artist
+	case "Genre":
+		return t.Genre
+	}
+	return ""
+}
+
+func (t similarTestTrack) GetStrings(k string) []string { return index.DefaultGetStrings(t, k) }
+func (t similarTestTrack) GetInt(k string) int          { return 0 }
+func (t similarTestTrack) GetTime(k string) time.Time   { return time.Time{} }
+
+func TestCoplayCounts(t *testing.T) {
+	a, b, c := index.Path{"Root", "a", "0"}, index.Path{"Root", "b", "0"}, index.Path{"Root", "c", "0"}
+	now := time.Now()
+	events := []history.Event{
+		{Path: b, Time: now},
+		{Path: a, Time: now.Add(-5 * time.Minute)},
+		{Path: c, Time: now.Add(-10 * time.Minute)},
+		{Path: b, Time: now.Add(-2 * time.Hour)},
+		{Path: a, Time: now.Add(-2*time.Hour - time.Minute)},
+		{Path: c, Time: now.Add(-5 * time.Hour)},
+	}
+
+	got := coplayCounts(events, a)
+	expected := map[string]int{b.Encode(): 2, c.Encode(): 1}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("coplayCounts() = %v, expected: %v", got, expected)
+	}
+}
+
+func TestRankSimilar(t *testing.T) {
+	tracks := testTracker{
+		similarTestTrack{Name: "A1", Album: "A", Artist: "Miles Davis", Genre: "Jazz"},
+		similarTestTrack{Name: "A2", Album: "A", Artist: "Miles Davis", Genre: "Jazz"},
+		similarTestTrack{Name: "A3", Album: "A", Artist: "Miles Davis", Genre: "Jazz"},
+		similarTestTrack{Name: "B1", Album: "B", Artist: "John Coltrane", Genre: "Jazz"},
+		similarTestTrack{Name: "C1", Album: "C", Artist: "Miles Davis & Gil Evans", Genre: "Orchestral"},
+		similarTestTrack{Name: "D1", Album: "D", Artist: "Radiohead", Genre: "Rock"},
+		similarTestTrack{Name: "E1", Album: "E", Artist: "Bach", Genre: "Classical"},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+
+	paths := make(map[string]index.Path)
+	index.Walk(&rootCollection{root}, index.Path{"Root"}, func(t index.Track, p index.Path) error {
+		paths[t.GetString("Name")] = p
+		return nil
+	})
+	coplays := map[string]int{paths["D1"].Encode(): 2}
+
+	tests := []struct {
+		limit    int
+		expected []string
+	}{
+		{1, []string{"D1"}},
+		{3, []string{"D1", "A2", "B1"}}, // at most half by the same artist
+		{4, []string{"D1", "A2", "A3", "B1"}},
+		{10, []string{"D1", "A2", "A3", "C1", "B1"}},
+	}
+
+	for _, tt := range tests {
+		got := rankSimilar(root, tracks[0], paths["A1"], coplays, tt.limit)
+		var names []string
+		for _, p := range got {
+			for n, np := range paths {
+				if np.Equal(p) {
+					names = append(names, n)
+				}
+			}
+		}
+		if !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("rankSimilar(limit: %d) = %v, expected: %v", tt.limit, names, tt.expected)
+		}
+	}
+}
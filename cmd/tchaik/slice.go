@@ -0,0 +1,55 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "tchaik.com/index"
+
+// sliceCollection is an index.Collection which only includes a range of the keys of the
+// underlying collection.
+type sliceCollection struct {
+	index.Collection
+	keys []index.Key
+}
+
+// Keys implements index.Collection.
+func (s sliceCollection) Keys() []index.Key { return s.keys }
+
+// sliceGroup is an index.Group which only includes a range of the tracks of the underlying
+// group.
+type sliceGroup struct {
+	index.Group
+	tracks []index.Track
+}
+
+// Tracks implements index.Group.
+func (s sliceGroup) Tracks() []index.Track { return s.tracks }
+
+// sliceBounds returns the bounds of the range [offset, offset+limit) clamped to [0, n).  A
+// negative limit includes everything after offset.
+func sliceBounds(n, offset, limit int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit >= 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// slice returns a Group (or Collection) which only includes the range of keys (or tracks
+// if g is not a Collection) given by offset and limit (see sliceBounds), and the total
+// number of keys (or tracks) in g.
+func slice(g index.Group, offset, limit int) (index.Group, int) {
+	if c, ok := g.(index.Collection); ok {
+		keys := c.Keys()
+		start, end := sliceBounds(len(keys), offset, limit)
+		return sliceCollection{c, keys[start:end]}, len(keys)
+	}
+
+	tracks := g.Tracks()
+	start, end := sliceBounds(len(tracks), offset, limit)
+	return sliceGroup{g, tracks[start:end]}, len(tracks)
+}
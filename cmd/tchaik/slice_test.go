@@ -0,0 +1,63 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+)
+
+type testTracker []index.Track
+
+func (t testTracker) Tracks() []index.Track { return t }
+
+func TestSlice(t *testing.T) {
+	var tracks testTracker
+	for i := 0; i < 5; i++ {
+		tracks = append(tracks, testTrack{ID: fmt.Sprint(i), Name: fmt.Sprint(i)})
+	}
+	c := index.Collect(tracks, index.By(attr.String("Name")))
+
+	tests := []struct {
+		offset, limit int
+		expected      []string // names of the groups
+	}{
+		{0, -1, []string{"0", "1", "2", "3", "4"}},
+		{0, 2, []string{"0", "1"}},
+		{3, 10, []string{"3", "4"}},
+		{2, -1, []string{"2", "3", "4"}},
+		{5, 2, []string{}},
+		{10, 2, []string{}},
+		{1, 0, []string{}},
+	}
+
+	for _, tt := range tests {
+		g, total := slice(c, tt.offset, tt.limit)
+		if total != 5 {
+			t.Errorf("slice(c, %d, %d) total = %d, expected: %d", tt.offset, tt.limit, total, 5)
+		}
+		sc, ok := g.(index.Collection)
+		if !ok {
+			t.Errorf("slice(c, %d, %d) returned %T, expected index.Collection", tt.offset, tt.limit, g)
+			continue
+		}
+		got := []string{}
+		for _, k := range sc.Keys() {
+			got = append(got, sc.Get(k).Name())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("slice(c, %d, %d) = %v, expected: %v", tt.offset, tt.limit, got, tt.expected)
+		}
+	}
+
+	g, total := slice(c.Get(c.Keys()[1]), 0, 10)
+	if total != 1 || len(g.Tracks()) != 1 {
+		t.Errorf("slice(g, 0, 10) = %d tracks (total %d), expected: %d (total %d)", len(g.Tracks()), total, 1, 1)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/rating"
+	"tchaik.com/index/smart"
+)
+
+// smartMeta implements smart.Meta using the meta data stores.
+type smartMeta struct {
+	*Meta
+}
+
+// Value implements smart.Meta.  Ratings, favourites and checklist items apply to the track
+// path and all the paths which contain it (i.e. a rated album rates its tracks), the most
+// specific value is used.  Play history is recorded against track paths and track IDs.
+func (m smartMeta) Value(attr string, t index.Track, p index.Path) interface{} {
+	switch attr {
+	case "Rating":
+		for i := len(p); i > 1; i-- {
+			if r := m.ratings.Get(p[:i]); r != rating.None {
+				return int(r)
+			}
+		}
+		return 0
+
+	case "Favourite", "Checklist":
+		get := m.favourites.Get
+		if attr == "Checklist" {
+			get = m.checklist.Get
+		}
+		for i := len(p); i > 1; i-- {
+			if get(p[:i]) {
+				return true
+			}
+		}
+		return false
+
+	case "PlayCount":
+		return m.PlayCount(t.GetString("ID"))
+
+	case "LastPlayed":
+		var last time.Time
+		for _, hp := range []index.Path{p, {"T", index.Key(t.GetString("ID"))}} {
+			for _, x := range m.history.Get(hp) {
+				if x.After(last) {
+					last = x
+				}
+			}
+		}
+		return last
+	}
+	return nil
+}
+
+// smartPlaylistResult is the representation of an evaluated smart playlist.
+type smartPlaylistResult struct {
+	Name string `json:"name"`
+	smart.Playlist
+	Paths index.Group `json:"paths"`
+}
+
+// getRules returns the list of smart playlist rules in field f of the Command.
+func (c Command) getRules(f string) ([]smart.Rule, error) {
+	raw, err := c.get(f)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, badField("expected '%s' to be of type '[]interface{}', got '%T'", f, raw)
+	}
+
+	rules := make([]smart.Rule, len(list))
+	for i, x := range list {
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, badField("expected '%s' to contain values of type 'map[string]interface{}', got '%T'", f, x)
+		}
+		field, _ := m["field"].(string)
+		op, _ := m["op"].(string)
+		rules[i] = smart.Rule{
+			Field: field,
+			Op:    smart.Operator(op),
+			Value: m["value"],
+		}
+		if err := rules[i].Validate(); err != nil {
+			return nil, badField("invalid rule %d in '%s': %v", i, f, err)
+		}
+	}
+	return rules, nil
+}
+
+// smartPlaylist handles the SMART_PLAYLIST action.  FETCH evaluates the named smart playlist
+// against the library, SET replaces its rules and DELETE removes it.
+func (h *websocketHandler) smartPlaylist(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+
+	action, err := c.getString("action")
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "FETCH":
+		// Evaluated below.
+
+	case "SET":
+		p := smart.Playlist{Match: smart.MatchAll}
+		if m, ok := c.Data["match"]; ok {
+			s, _ := m.(string)
+			p.Match = smart.Match(s)
+		}
+		p.Rules, err = c.getRules("rules")
+		if err != nil {
+			return err
+		}
+		if err := p.Validate(); err != nil {
+			return badField("%v", err)
+		}
+		if err := h.meta.smart.Set(name, p); err != nil {
+			return err
+		}
+
+	case "DELETE":
+		return h.meta.smart.Delete(name)
+
+	default:
+		return badField("unknown action: %v", action)
+	}
+
+	p, ok := h.meta.smart.Get(name)
+	if !ok {
+		return badField("invalid smart playlist name: '%v'", name)
+	}
+
+	root := index.Path{"Root"}
+	paths, err := smart.Evaluate(p, h.lib.collections["Root"], root, smartMeta{h.meta}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	resp.Data = smartPlaylistResult{
+		Name:     name,
+		Playlist: p,
+		Paths:    h.lib.ExpandPaths(paths),
+	}
+	return nil
+}
+
+// smartPlaylists responds with the names of the smart playlists.
+func (h *websocketHandler) smartPlaylists(c Command, resp *Response) error {
+	resp.Data = h.meta.smart.Names()
+	return nil
+}
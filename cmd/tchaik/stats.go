@@ -0,0 +1,145 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"tchaik.com/index"
+)
+
+// formatStats is a summary of the tracks in a library of a particular format (Kind).
+type formatStats struct {
+	Kind   string `json:"kind"`
+	Tracks int    `json:"tracks"`
+	Bytes  int64  `json:"bytes"`
+	Size   string `json:"size"`
+}
+
+// formatStatsSlice is a convenience type for sorting formatStats by size (largest first),
+// then by kind.
+type formatStatsSlice []formatStats
+
+func (f formatStatsSlice) Len() int      { return len(f) }
+func (f formatStatsSlice) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f formatStatsSlice) Less(i, j int) bool {
+	if f[i].Bytes != f[j].Bytes {
+		return f[i].Bytes > f[j].Bytes
+	}
+	return f[i].Kind < f[j].Kind
+}
+
+// libraryStats is a summary of the tracks in a library.
+type libraryStats struct {
+	Tracks   int           `json:"tracks"`
+	Albums   int           `json:"albums"`
+	Artists  int           `json:"artists"`
+	Duration float64       `json:"duration"` // seconds
+	Bytes    int64         `json:"bytes"`
+	Size     string        `json:"size"`
+	Formats  []formatStats `json:"formats"`
+}
+
+// computeLibraryStats computes libraryStats for the root collection, using the file sizes
+// and durations recorded in the index.  Artists are counted individually, so tracks with
+// several (listed) artists count towards each of them.
+func computeLibraryStats(root index.Collection) libraryStats {
+	m := make(map[string]*formatStats)
+	artists := make(map[string]bool)
+	s := libraryStats{
+		Albums: len(root.Keys()),
+	}
+	index.Walk(&rootCollection{root}, index.Path{"Root"}, func(x index.Track, _ index.Path) error {
+		for _, a := range x.GetStrings("Artist") {
+			if a != "" {
+				artists[a] = true
+			}
+		}
+		s.Duration += float64(x.GetInt("TotalTime")) / 1000
+
+		n := int64(x.GetInt("Size"))
+		s.Tracks++
+		s.Bytes += n
+
+		k := x.GetString("Kind")
+		f, ok := m[k]
+		if !ok {
+			f = &formatStats{Kind: k}
+			m[k] = f
+		}
+		f.Tracks++
+		f.Bytes += n
+		return nil
+	})
+	s.Artists = len(artists)
+	s.Size = humanBytes(s.Bytes)
+
+	s.Formats = make([]formatStats, 0, len(m))
+	for _, f := range m {
+		f.Size = humanBytes(f.Bytes)
+		s.Formats = append(s.Formats, *f)
+	}
+	sort.Sort(formatStatsSlice(s.Formats))
+	return s
+}
+
+// humanBytes returns a human-readable representation of the number of bytes (i.e. "1.5 GB").
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for x := n / unit; x >= unit; x /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// groupTotals is the number of tracks and their total duration (in seconds) in a group,
+// including any nested groups.
+type groupTotals struct {
+	Tracks   int
+	Duration float64
+}
+
+// totalsCache caches groupTotals by path.  The index does not change while tchaik is
+// running, so entries are never invalidated.
+type totalsCache struct {
+	sync.Mutex
+	m map[string]groupTotals
+}
+
+func newTotalsCache() *totalsCache {
+	return &totalsCache{
+		m: make(map[string]groupTotals),
+	}
+}
+
+// Get returns the (cached) totals for the Group g with Path p.
+func (c *totalsCache) Get(p index.Path, g index.Group) groupTotals {
+	k := p.Encode()
+
+	c.Lock()
+	t, ok := c.m[k]
+	c.Unlock()
+	if ok {
+		return t
+	}
+
+	index.Walk(g, p, func(x index.Track, _ index.Path) error {
+		t.Tracks++
+		t.Duration += float64(x.GetInt("TotalTime")) / 1000
+		return nil
+	})
+
+	c.Lock()
+	c.m[k] = t
+	c.Unlock()
+	return t
+}
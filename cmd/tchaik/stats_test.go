@@ -0,0 +1,70 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+)
+
+type statsTestTrack struct {
+	Album, Artist, Kind string
+	Size, TotalTime     int
+}
+
+func (t statsTestTrack) GetString(k string) string {
+	switch k {
+	case "Album":
+		return t.Album
+	case "Artist":
+		return t.Artist
+	case "Kind":
+		return t.Kind
+	}
+	return ""
+}
+
+func (t statsTestTrack) GetStrings(k string) []string { return index.DefaultGetStrings(t, k) }
+func (t statsTestTrack) GetTime(k string) time.Time   { return time.Time{} }
+
+func (t statsTestTrack) GetInt(k string) int {
+	switch k {
+	case "Size":
+		return t.Size
+	case "TotalTime":
+		return t.TotalTime
+	}
+	return 0
+}
+
+func TestComputeLibraryStats(t *testing.T) {
+	tracks := testTracker{
+		statsTestTrack{Album: "Abbey Road", Artist: "The Beatles", Kind: "FLAC", Size: 3000, TotalTime: 60000},
+		statsTestTrack{Album: "Abbey Road", Artist: "The Beatles", Kind: "MP3", Size: 1000, TotalTime: 30000},
+		statsTestTrack{Album: "Road Songs", Artist: "Bo Diddley & The Beatles", Kind: "MP3", Size: 1048576, TotalTime: 500},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+
+	got := computeLibraryStats(root)
+	expected := libraryStats{
+		Tracks:   3,
+		Albums:   2,
+		Artists:  2,
+		Duration: 90.5,
+		Bytes:    1052576,
+		Size:     "1.0 MB",
+		Formats: []formatStats{
+			{Kind: "MP3", Tracks: 2, Bytes: 1049576, Size: "1.0 MB"},
+			{Kind: "FLAC", Tracks: 1, Bytes: 3000, Size: "2.9 KB"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("computeLibraryStats() = %#v, expected: %#v", got, expected)
+	}
+}
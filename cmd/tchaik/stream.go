@@ -0,0 +1,77 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/trace"
+
+	"tchaik.com/store"
+)
+
+// trackMaxAge is the time for which clients can use cached track files before revalidating
+// them (using the ETag).
+const trackMaxAge = 24 * time.Hour
+
+// trackFileHandler is an http.Handler which streams track files from a store.FileSystem.  Each
+// request opens its own file and uses http.ServeContent, which serves range requests by
+// seeking the file and copying only the requested bytes (files are never read into memory).
+// This means that concurrent (and overlapping) range requests, i.e. from clients that are
+// seeking, are independent of each other, and an abandoned request only stops its own copy.
+// Responses include an ETag and Last-Modified, so clients can revalidate cached files and
+// resume partial downloads with If-Range.
+type trackFileHandler struct {
+	fs     store.FileSystem
+	family string // used for request traces
+}
+
+// ServeHTTP implements http.Handler.
+func (t trackFileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := path.Clean("/" + r.URL.Path)
+	tr := trace.New(t.family, p)
+	defer tr.Finish()
+
+	f, err := t.fs.Open(trace.NewContext(context.Background(), tr), p)
+	if err != nil {
+		tr.LazyPrintf("error opening file: %v", err)
+		tr.SetError()
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		tr.LazyPrintf("error in stat: %v", err)
+		tr.SetError()
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if fi.IsDir() {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", fileETag(fi))
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(trackMaxAge/time.Second)))
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+// fileETag returns a (strong) ETag for the file, computed from its modification time and size
+// so that the file doesn't need to be read.
+func fileETag(fi os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
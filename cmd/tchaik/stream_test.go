@@ -0,0 +1,98 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"tchaik.com/store"
+)
+
+func TestTrackFileHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "track.mp3"), data, 0644); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("unexpected error creating dir: %v", err)
+	}
+
+	h := trackFileHandler{store.NewFileSystem(http.Dir(dir), "test"), "test"}
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/"+path, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("track.mp3", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, expected: %d", w.Code, http.StatusOK)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Errorf("GET response has no ETag")
+	}
+	if cc := w.Header().Get("Cache-Control"); cc == "" {
+		t.Errorf("GET response has no Cache-Control")
+	}
+	if w.Body.Len() != len(data) {
+		t.Errorf("GET body length = %d, expected: %d", w.Body.Len(), len(data))
+	}
+
+	if w := get("track.mp3", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("GET with If-None-Match status = %d, expected: %d", w.Code, http.StatusNotModified)
+	}
+	if w := get("track.mp3", map[string]string{"Range": "bytes=0-9", "If-Range": `"stale"`}); w.Code != http.StatusOK {
+		t.Errorf("GET with stale If-Range status = %d, expected: %d", w.Code, http.StatusOK)
+	}
+
+	for _, path := range []string{"missing.mp3", "sub"} {
+		if w := get(path, nil); w.Code != http.StatusNotFound {
+			t.Errorf("GET %v status = %d, expected: %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+
+	// Overlapping range requests (i.e. from a seeking client) are served concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			end := start + 99
+			w := get("track.mp3", map[string]string{
+				"Range":    fmt.Sprintf("bytes=%d-%d", start, end),
+				"If-Range": etag,
+			})
+			if w.Code != http.StatusPartialContent {
+				t.Errorf("GET range %d-%d status = %d, expected: %d", start, end, w.Code, http.StatusPartialContent)
+				return
+			}
+			if got := w.Body.String(); got != string(data[start:end+1]) {
+				t.Errorf("GET range %d-%d returned the wrong bytes", start, end)
+			}
+		}(i * 40)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,68 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"tchaik.com/index"
+	"tchaik.com/index/tagwrite"
+)
+
+// writeTags calls fn with the location of each track identified by the path (a track, or a
+// group of tracks), to write a value into the tags of the track files.  Does nothing unless
+// tag writing is enabled (see -write-tags).  All the tracks are written even if some fail,
+// and the first error is returned.
+func (h *websocketHandler) writeTags(p index.Path, fn func(loc string) error) error {
+	if !writeTags {
+		return nil
+	}
+
+	var tracks []index.Track
+	if t, err := h.lib.TrackFromPath(p); err == nil {
+		tracks = append(tracks, t)
+	} else {
+		err := h.lib.Walk(h.ctx, p, func(t index.Track, _ index.Path) error {
+			tracks = append(tracks, t)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var failed int
+	var first error
+	for _, t := range tracks {
+		loc := t.GetString("Location")
+		if err := fn(loc); err != nil {
+			log.Printf("error writing tags to %v: %v", loc, err)
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	if first != nil {
+		return &commandError{ErrorTagWrite, fmt.Sprintf("value saved, but could not write tags of %d of %d track(s): %v", failed, len(tracks), first)}
+	}
+	return nil
+}
+
+// writeRatingTags writes the rating into the tags of the tracks identified by the path.
+func (h *websocketHandler) writeRatingTags(p index.Path, value int) error {
+	return h.writeTags(p, func(loc string) error {
+		return tagwrite.SetRating(loc, value)
+	})
+}
+
+// writeFavouriteTags writes the favourite flag into the tags of the tracks identified by the
+// path.
+func (h *websocketHandler) writeFavouriteTags(p index.Path, value bool) error {
+	return h.writeTags(p, func(loc string) error {
+		return tagwrite.SetFavourite(loc, value)
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/store"
+)
+
+// thumbnailSize is the maximum width/height (in pixels) of inlined thumbnails.
+const thumbnailSize = 48
+
+// thumbnailWorkers is the maximum number of thumbnails generated concurrently.
+const thumbnailWorkers = 4
+
+// thumbnailCache computes (and caches) small artwork thumbnails as data URIs.  Thumbnails are
+// generated in the background, so that fetching a collection doesn't wait for them.
+type thumbnailCache struct {
+	fs   store.FileSystem
+	sema chan struct{}
+
+	sync.Mutex
+	m       map[string]string
+	pending map[string]bool
+}
+
+func newThumbnailCache(fs store.FileSystem) *thumbnailCache {
+	return &thumbnailCache{
+		fs:      store.ThumbnailFileSystem(fs, thumbnailSize),
+		sema:    make(chan struct{}, thumbnailWorkers),
+		m:       make(map[string]string),
+		pending: make(map[string]bool),
+	}
+}
+
+// Get returns the data URI of the artwork thumbnail for the track with the given ID, or ""
+// if it hasn't been generated yet, in which case it is generated in the background (until ctx
+// is done).  Failures aren't cached, so are retried by later calls.
+func (t *thumbnailCache) Get(ctx context.Context, id string) string {
+	t.Lock()
+	defer t.Unlock()
+
+	if uri, ok := t.m[id]; ok {
+		return uri
+	}
+	if !t.pending[id] {
+		t.pending[id] = true
+		go t.generate(ctx, id)
+	}
+	return ""
+}
+
+func (t *thumbnailCache) generate(ctx context.Context, id string) {
+	var uri string
+	var err error
+	select {
+	case t.sema <- struct{}{}:
+		uri, err = t.dataURI(ctx, id)
+		<-t.sema
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.pending, id)
+	if err == nil {
+		t.m[id] = uri
+	}
+}
+
+func (t *thumbnailCache) dataURI(ctx context.Context, id string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f, err := t.fs.Open(ctx, "/"+id)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// countFileSystem is a store.FileSystem which serves the contents of files, and counts the
+// number of times each path is opened.
+type countFileSystem struct {
+	files map[string]string
+
+	sync.Mutex
+	opens map[string]int
+}
+
+func (fs *countFileSystem) Open(ctx context.Context, path string) (http.File, error) {
+	fs.Lock()
+	fs.opens[path]++
+	fs.Unlock()
+
+	s, ok := fs.files[path]
+	if !ok {
+		return nil, fmt.Errorf("no artwork: %v", path)
+	}
+	return testFile{bytes.NewReader([]byte(s))}, nil
+}
+
+func (fs *countFileSystem) count(path string) int {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.opens[path]
+}
+
+func TestThumbnailCache(t *testing.T) {
+	fs := &countFileSystem{
+		files: map[string]string{"/1": "jpeg"},
+		opens: make(map[string]int),
+	}
+	c := newThumbnailCache(fs)
+	c.fs = fs // skip resizing
+
+	// wait calls Get until the thumbnail is generated (or a timeout).
+	wait := func(ctx context.Context, id string) string {
+		for i := 0; i < 50; i++ {
+			if uri := c.Get(ctx, id); uri != "" {
+				return uri
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+		return ""
+	}
+
+	ctx := context.Background()
+	expected := "data:image/jpeg;base64,anBlZw=="
+	if got := wait(ctx, "1"); got != expected {
+		t.Errorf("Get(%#v) = %#v, expected: %#v", "1", got, expected)
+	}
+	if n := fs.count("/1"); n != 1 {
+		t.Errorf("artwork opened %d times, expected: %d", n, 1)
+	}
+
+	// Failures aren't cached.
+	wait(ctx, "2")
+	if n := fs.count("/2"); n < 2 {
+		t.Errorf("failing artwork opened %d times, expected retries", n)
+	}
+
+	// Thumbnails aren't generated once the context is done.
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	if got := wait(done, "3"); got != "" {
+		t.Errorf("Get(%#v) with cancelled context = %#v, expected: %#v", "3", got, "")
+	}
+	if n := fs.count("/3"); n != 0 {
+		t.Errorf("artwork opened %d times with cancelled context, expected: %d", n, 0)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"tchaik.com/index"
+)
+
+// transcodeFormat describes an ffmpeg output format.
+type transcodeFormat struct {
+	codec       string
+	format      string
+	contentType string
+	args        []string // extra encoder options
+}
+
+// transcodeFormats are the supported values of the transcode query parameter.  The encoders
+// must produce constant bitrate output (libopus defaults to VBR).
+var transcodeFormats = map[string]transcodeFormat{
+	"mp3":  {codec: "libmp3lame", format: "mp3", contentType: "audio/mpeg"},
+	"opus": {codec: "libopus", format: "ogg", contentType: "audio/ogg", args: []string{"-vbr", "off"}},
+}
+
+const (
+	defaultTranscodeBitrate = 128 // kbps
+	minTranscodeBitrate     = 32
+	maxTranscodeBitrate     = 320
+)
+
+// transcodeHandler is an http.Handler which transcodes tracks using ffmpeg when requested with
+// a transcode query parameter (and optional bitrate, in kbps), for example:
+//
+//	/track/1234?transcode=opus&bitrate=96
+//
+// Tracks requested with transcode=wav are streamed as uncompressed PCM (see serveWAV).
+// The output of ffmpeg is streamed as it is produced.  The output is constant bitrate, so its
+// length can be estimated from the track duration, and byte ranges are served by seeking
+// the source to the corresponding time.  Requests without a transcode parameter, or with an
+// unsupported format, are passed through to the underlying Handler (the latter with an
+// X-Transcode-Warning header), as are requests for which ffmpeg could not be started.  Tracks which are part of a file (i.e. split by a cue sheet,
+// see isSegment) are always transcoded, by default to WAV.
+type transcodeHandler struct {
+	http.Handler
+	fs  http.FileSystem
+	lib index.Library
+}
+
+// ServeHTTP implements http.Handler.
+func (t transcodeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var tr index.Track
+	if x, ok := t.lib.Track(strings.Trim(r.URL.Path, "/")); ok {
+		tr = x
+	}
+
+	q := r.URL.Query()
+	name := q.Get("transcode")
+	if name == "" {
+		if !isSegment(tr) {
+			t.Handler.ServeHTTP(w, r)
+			return
+		}
+		name = "wav"
+	}
+
+	tf, ok := transcodeFormats[name]
+	if !ok && name != "wav" {
+		w.Header().Set("X-Transcode-Warning", fmt.Sprintf("unsupported transcode format: %q", name))
+		if !isSegment(tr) {
+			t.Handler.ServeHTTP(w, r)
+			return
+		}
+		name = "wav"
+	}
+
+	if name == "wav" {
+		f, err := t.fs.Open(path.Clean("/" + r.URL.Path))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+
+		t.serveWAV(w, r, f, tr)
+		return
+	}
+
+	bitrate := defaultTranscodeBitrate
+	if b := q.Get("bitrate"); b != "" {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < minTranscodeBitrate || n > maxTranscodeBitrate {
+			http.Error(w, fmt.Sprintf("invalid bitrate: %q", b), http.StatusBadRequest)
+			return
+		}
+		bitrate = n
+	}
+
+	f, err := t.fs.Open(path.Clean("/" + r.URL.Path))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	// Estimated length of the output in bytes, or 0 if the duration of the track is unknown.
+	var size int64
+	if tr != nil {
+		size = int64(tr.GetInt("TotalTime")) * int64(bitrate) / 8
+	}
+
+	var start int64
+	var ranged bool
+	if size > 0 {
+		if rng := r.Header.Get("Range"); rng != "" {
+			ranged = true
+			start, err = parseRangeStart(rng, size)
+			if err != nil {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+		}
+	}
+
+	var cmd *exec.Cmd
+	var out io.ReadCloser
+	if r.Method != "HEAD" {
+		args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+		args = append(args, seekArgs(tr, float64(start)*8/float64(bitrate*1000))...)
+		args = append(args, "-vn", "-codec:a", tf.codec, "-b:a", fmt.Sprintf("%dk", bitrate))
+		args = append(args, tf.args...)
+		args = append(args, "-f", tf.format, "pipe:1")
+
+		cmd = exec.Command(ffmpegPath, args...)
+		cmd.Stdin = f
+		out, err = cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			log.Printf("error starting ffmpeg for %v: %v", r.URL.Path, err)
+			if isSegment(tr) {
+				http.Error(w, "error transcoding track", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("X-Transcode-Warning", "transcoding unavailable")
+			t.Handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", tf.contentType)
+	if size > 0 {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	if ranged {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	if r.Method == "HEAD" {
+		return
+	}
+
+	var src io.Reader = out
+	if size > 0 {
+		src = io.LimitReader(out, size-start)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		// The client has most likely gone away (i.e. seeked or stopped).
+		cmd.Process.Kill()
+	}
+	out.Close()
+	cmd.Wait()
+}
+
+// isSegment returns true if the track (which can be nil) is part of a file, rather than the
+// whole file.
+func isSegment(tr index.Track) bool {
+	return tr != nil && (tr.GetInt("StartTime") > 0 || tr.GetInt("EndTime") > 0)
+}
+
+// seekArgs returns the ffmpeg output options which start the output offset seconds into the
+// track (which can be nil) and, for tracks which are part of a file, end it at the end of
+// the track.
+func seekArgs(tr index.Track, offset float64) []string {
+	start := offset
+	var length float64 // seconds, 0 for the rest of the file
+	if tr != nil {
+		start += float64(tr.GetInt("StartTime")) / 1000
+		if end := tr.GetInt("EndTime"); end > 0 {
+			length = float64(end)/1000 - start
+		}
+	}
+
+	var args []string
+	if start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(start, 'f', 3, 64))
+	}
+	if length > 0 {
+		args = append(args, "-t", strconv.FormatFloat(length, 'f', 3, 64))
+	}
+	return args
+}
+
+// parseRangeStart returns the start offset of the first byte range in the Range header value,
+// for a resource of the given size.
+func parseRangeStart(rng string, size int64) (int64, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(rng, prefix) {
+		return 0, fmt.Errorf("invalid range: %q", rng)
+	}
+	spec := strings.TrimSpace(strings.SplitN(rng[len(prefix):], ",", 2)[0])
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid range: %q", rng)
+	}
+
+	if i == 0 {
+		// Suffix range: the last n bytes.
+		n, err := strconv.ParseInt(spec[1:], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid range: %q", rng)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, nil
+	}
+
+	start, err := strconv.ParseInt(spec[:i], 10, 64)
+	if err != nil || start < 0 {
+		return 0, fmt.Errorf("invalid range: %q", rng)
+	}
+	if start >= size {
+		return 0, fmt.Errorf("range start %d past end of content (%d bytes)", start, size)
+	}
+	return start, nil
+}
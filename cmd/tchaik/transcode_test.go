@@ -0,0 +1,96 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tchaik.com/index"
+)
+
+func TestParseRangeStart(t *testing.T) {
+	tests := []struct {
+		in    string
+		start int64
+		ok    bool
+	}{
+		{"bytes=0-", 0, true},
+		{"bytes=100-", 100, true},
+		{"bytes=100-199", 100, true},
+		{"bytes=100-199, 300-399", 100, true},
+		{"bytes=-100", 900, true},
+		{"bytes=-2000", 0, true},
+		{"bytes=1000-", 0, false},
+		{"bytes=abc-", 0, false},
+		{"bytes=100", 0, false},
+		{"items=0-", 0, false},
+	}
+
+	for _, tt := range tests {
+		start, err := parseRangeStart(tt.in, 1000)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseRangeStart(%q) error = %v, expected ok: %v", tt.in, err, tt.ok)
+			continue
+		}
+		if start != tt.start {
+			t.Errorf("parseRangeStart(%q) = %d, expected: %d", tt.in, start, tt.start)
+		}
+	}
+}
+
+type testLibrary map[string]index.Track
+
+func (l testLibrary) Tracks() []index.Track {
+	tracks := make([]index.Track, 0, len(l))
+	for _, t := range l {
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+func (l testLibrary) Track(id string) (index.Track, bool) {
+	t, ok := l[id]
+	return t, ok
+}
+
+func TestTranscodeHandlerFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "1"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(p string) { ffmpegPath = p }(ffmpegPath)
+	ffmpegPath = filepath.Join(dir, "missing-ffmpeg")
+
+	h := transcodeHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "original")
+		}),
+		fs:  http.Dir(dir),
+		lib: testLibrary{"1": testTrack{ID: "1", TotalTime: 1000}},
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/1?transcode=opus", nil))
+	if got := w.Body.String(); got != "original" {
+		t.Errorf("body = %q, expected: %q", got, "original")
+	}
+	if w.Header().Get("X-Transcode-Warning") == "" {
+		t.Errorf("X-Transcode-Warning header not set")
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "" {
+		t.Errorf("Accept-Ranges = %q, expected: %q", got, "")
+	}
+}
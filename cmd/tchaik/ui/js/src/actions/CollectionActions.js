@@ -18,6 +18,19 @@ var CollectionActions = {
     WebsocketAPI.send(CollectionConstants.FETCH, {path: path});
   },
 
+  fetchBatch: function(paths) {
+    var missing = paths.filter(function(path) {
+      if (CollectionStore.getCollection(path)) {
+        CollectionStore.emitChange(path);
+        return false;
+      }
+      return true;
+    });
+    if (missing.length > 0) {
+      WebsocketAPI.send(CollectionConstants.FETCH_BATCH, {paths: missing});
+    }
+  },
+
   setCurrentTrack: function(track) {
     AppDispatcher.handleViewAction({
       actionType: NowPlayingConstants.SET_CURRENT_TRACK,
@@ -43,6 +56,15 @@ var CollectionActions = {
     WebsocketAPI.send(CollectionConstants.FETCH, {path: path});
   },
 
+  setChecklistAll: function(path, value) {
+    WebsocketAPI.send(CollectionConstants.SET_CHECKLIST_ALL, {
+      path: path,
+      value: value,
+    });
+
+    WebsocketAPI.send(CollectionConstants.FETCH, {path: path});
+  },
+
 };
 
 export default CollectionActions;
@@ -1,6 +1,7 @@
 import AppDispatcher from "../dispatcher/AppDispatcher";
 
 import CursorConstants from "../constants/CursorConstants.js";
+import PlaylistActions from "./PlaylistActions.js";
 import WebsocketAPI from "../utils/WebsocketAPI.js";
 
 var cursorName = "Default";
@@ -30,6 +31,30 @@ var CursorActions = {
     });
   },
 
+  // setAndPlay replaces the playlist with paths and moves the cursor to the item at index
+  // (and path within it, if given) in a single command.
+  setAndPlay: function(paths, index, path) {
+    let data = {
+      action: CursorConstants.SET_AND_PLAY,
+      name: cursorName,
+      paths: paths,
+      index: index,
+    };
+    if (path !== undefined) {
+      data.path = path;
+    }
+    WebsocketAPI.send(CursorConstants.CURSOR, data);
+    PlaylistActions.fetch();
+  },
+
+  goto: function(index) {
+    WebsocketAPI.send(CursorConstants.CURSOR, {
+      action: CursorConstants.GOTO,
+      name: cursorName,
+      index: index,
+    });
+  },
+
   next: function() {
     WebsocketAPI.send(CursorConstants.CURSOR, {
       action: CursorConstants.NEXT,
@@ -41,6 +66,31 @@ var CursorActions = {
     });
   },
 
+  stopAfterCurrent: function() {
+    WebsocketAPI.send(CursorConstants.CURSOR, {
+      action: CursorConstants.STOP_AFTER_CURRENT,
+      name: cursorName,
+    });
+  },
+
+  shuffle: function(seed) {
+    let data = {
+      action: CursorConstants.SHUFFLE,
+      name: cursorName,
+    };
+    if (seed !== undefined) {
+      data.seed = seed;
+    }
+    WebsocketAPI.send(CursorConstants.CURSOR, data);
+  },
+
+  unshuffle: function() {
+    WebsocketAPI.send(CursorConstants.CURSOR, {
+      action: CursorConstants.UNSHUFFLE,
+      name: cursorName,
+    });
+  },
+
   prev: function() {
     WebsocketAPI.send(CursorConstants.CURSOR, {
       action: CursorConstants.PREV,
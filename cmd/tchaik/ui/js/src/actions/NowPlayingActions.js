@@ -3,6 +3,7 @@ import AppDispatcher from "../dispatcher/AppDispatcher";
 import WebsocketAPI from "../utils/WebsocketAPI.js";
 
 import NowPlayingStore from "../stores/NowPlayingStore.js";
+import CursorStore from "../stores/CursorStore.js";
 import NowPlayingConstants from "../constants/NowPlayingConstants.js";
 import CursorConstants from "../constants/CursorConstants.js";
 
@@ -53,9 +54,11 @@ var NowPlayingActions = {
   ended: function(source, repeat) {
     WebsocketAPI.send(NowPlayingConstants.RECORD_PLAY, {path: ["T", NowPlayingStore.getTrack().id]});
 
+    // Read before dispatching ENDED, which clears the flag.
+    const stop = source === "cursor" && CursorStore.getStopAfterCurrent();
     if (source === "cursor") {
       WebsocketAPI.send(CursorConstants.CURSOR, {
-        action: CursorConstants.NEXT,
+        action: CursorConstants.ENDED,
         name: "Default",
       });
     }
@@ -64,6 +67,7 @@ var NowPlayingActions = {
       actionType: NowPlayingConstants.ENDED,
       source: source,
       repeat: repeat,
+      stop: stop,
     });
   },
 
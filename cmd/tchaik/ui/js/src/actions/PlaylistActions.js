@@ -15,6 +15,14 @@ var PlaylistActions = {
     });
   },
 
+  // refresh fetches the playlist if it has the given name (i.e. after it was changed by
+  // another client).
+  refresh: function(name) {
+    if (name === playlistName) {
+      PlaylistActions.fetch();
+    }
+  },
+
   addItem: function(path) {
     WebsocketAPI.send(PlaylistConstants.PLAYLIST, {
       action: PlaylistConstants.ADD_ITEM,
@@ -40,6 +48,16 @@ var PlaylistActions = {
     });
   },
 
+  // move moves the item at index from to index to (the cursor stays on the same track).
+  move: function(from, to) {
+    WebsocketAPI.send(PlaylistConstants.PLAYLIST, {
+      name: playlistName,
+      action: PlaylistConstants.MOVE,
+      index: from,
+      to: to,
+    });
+  },
+
   clear: function() {
     AppDispatcher.handleViewAction({
       actionType: PlaylistConstants.CLEAR_PLAYLIST,
@@ -5,11 +5,19 @@ import AppDispatcher from "../dispatcher/AppDispatcher.js";
 import SearchConstants from "../constants/SearchConstants.js";
 
 
+// searchLimit is the maximum number of (ranked) matches requested for each search.
+const searchLimit = 50;
+
 var SearchActions = {
 
-  search: function(input) {
+  // search requests matches for input, restricted to the subtree at scope (if given).
+  search: function(input, scope) {
     input = "" + input;
-    WebsocketAPI.send(SearchConstants.SEARCH, {input: input});
+    let data = {input: input, limit: searchLimit};
+    if (scope !== undefined) {
+      data.scope = scope;
+    }
+    WebsocketAPI.send(SearchConstants.SEARCH, data);
 
     AppDispatcher.handleViewAction({
       actionType: SearchConstants.SEARCH,
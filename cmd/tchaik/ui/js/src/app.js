@@ -26,6 +26,22 @@ if (process.env.WS_URL) {
   websocketUrl = process.env.WS_URL;
 }
 
+// The user token (if any) is given in the page URL (?token=...) and remembered, so that
+// favourites, checklists, ratings and play history are specific to the user.
+const tokenMatch = /[?&]token=([^&]*)/.exec(window.location.search);
+if (tokenMatch) {
+  localStorage.setItem("userToken", decodeURIComponent(tokenMatch[1]));
+}
+const userToken = localStorage.getItem("userToken");
+if (userToken) {
+  websocketUrl += (websocketUrl.indexOf("?") === -1 ? "?" : "&") + "token=" + encodeURIComponent(userToken);
+}
+
+// Large responses are gzipped if the browser can decompress them (see WebsocketAPI).
+if (typeof DecompressionStream !== "undefined") {
+  websocketUrl += (websocketUrl.indexOf("?") === -1 ? "?" : "&") + "compress=gzip";
+}
+
 WebsocketAPI.init(websocketUrl);
 
 ReactDOM.render(
@@ -7,12 +7,30 @@ import NowPlayingActions from "../actions/NowPlayingActions.js";
 import NowPlayingStore from "../stores/NowPlayingStore.js";
 
 import PlayingStatusStore from "../stores/PlayingStatusStore.js";
+import CursorStore from "../stores/CursorStore.js";
 
 import VolumeStore from "../stores/VolumeStore.js";
 
 
 const audioEvents = ["error", "progress", "play", "pause", "ended", "timeupdate", "loadedmetadata", "loadstart"];
 
+// preloadSeconds is the time before the end of a track at which the next track is loaded
+// when using the gapless and crossfade transitions.
+const preloadSeconds = 10;
+
+// gainFactor returns the volume multiplier for the ReplayGain mode and track.  Gains are
+// given in hundredths of a dB, tracks without ReplayGain values are not adjusted.
+function gainFactor(mode, track) {
+  if (!track || mode === "off") {
+    return 1;
+  }
+  const gain = (mode === "album") ? (track.albumGain || track.trackGain) : track.trackGain;
+  if (!gain) {
+    return 1;
+  }
+  return Math.pow(10, gain / 2000);
+}
+
 class AudioPlayer extends React.Component {
   constructor(props) {
     super(props);
@@ -29,6 +47,7 @@ class AudioPlayer extends React.Component {
     }
     NowPlayingStore.addControlListener(this._onNowPlayingControl);
 
+    this.setOutputDevice(this.props.outputDevice);
     if (this.props.source) {
       this.setSrc(this.props.source);
       this.load();
@@ -63,9 +82,13 @@ class AudioPlayer extends React.Component {
       this.play();
     }
 
-    if (prevProps.volume !== this.props.volume) {
+    if (prevProps.volume !== this.props.volume || prevProps.gain !== this.props.gain) {
       this.setVolume(this.props.volume);
     }
+
+    if (prevProps.outputDevice !== this.props.outputDevice) {
+      this.setOutputDevice(this.props.outputDevice);
+    }
   }
 
   buffered() {
@@ -96,8 +119,63 @@ class AudioPlayer extends React.Component {
     return this._audio.currentTime;
   }
 
+  // setOutputDevice plays the audio through the device with the given id (empty for the
+  // default device), where the browser supports choosing the device.
+  setOutputDevice(id) {
+    if (typeof this._audio.setSinkId !== "function") {
+      if (id) {
+        console.log("Output device selection not supported by this browser");
+      }
+      return;
+    }
+    this._audio.setSinkId(id).catch(function(err) {
+      console.log("Error setting output device:", id, err);
+    });
+  }
+
+  // setVolume sets the volume of the audio, adjusted by the ReplayGain factor for the track.
   setVolume(v) {
-    this._audio.volume = v;
+    this._audio.volume = Math.min(1, v * this.props.gain);
+  }
+
+  // preloadNext starts loading the next track so that it is cached before the current
+  // track ends.
+  preloadNext() {
+    const next = CursorStore.getNextTrack();
+    if (!next || this._preloaded === next.id) {
+      return;
+    }
+    this._preloaded = next.id;
+    this._preload = new Audio();
+    this._preload.preload = "auto";
+    this._preload.src = `/track/${next.id}`;
+  }
+
+  // applyTransition fades the volume in at the start and out at the end of the track
+  // for crossfade transitions, and preloads the next track for gapless and crossfade
+  // transitions.  Transitions are disabled for tracks with a crossfade override.
+  applyTransition() {
+    const t = this.props.transition;
+    if (!t || t.mode === "none") {
+      return;
+    }
+    if (CursorStore.getNoCrossfade()) {
+      // Restore the volume in case the override was set part way through a fade.
+      this.setVolume(this.props.volume);
+      return;
+    }
+
+    const current = this.currentTime();
+    const remaining = this.duration() - current;
+    if (remaining < preloadSeconds) {
+      this.preloadNext();
+    }
+
+    if (t.mode !== "crossfade" || !(t.seconds > 0)) {
+      return;
+    }
+    const fade = Math.min(1, current / t.seconds, remaining / t.seconds);
+    this.setVolume(this.props.volume * Math.max(0, fade));
   }
 
   volume() {
@@ -145,6 +223,7 @@ class AudioPlayer extends React.Component {
 
       case "timeupdate":
         NowPlayingActions.currentTime(this.currentTime());
+        this.applyTransition();
         break;
 
       case "loadedmetadata":
@@ -185,6 +264,9 @@ function getPlayerState() {
     source: src,
     playing: NowPlayingStore.getPlaying(),
     volume: VolumeStore.getVolume(),
+    gain: gainFactor(NowPlayingStore.getReplayGain(), track),
+    transition: NowPlayingStore.getTransition(),
+    outputDevice: NowPlayingStore.getOutputDevice(),
   };
 }
 
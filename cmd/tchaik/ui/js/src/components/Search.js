@@ -20,7 +20,11 @@ export default Search;
 
 
 function getResultsState() {
-  return {results: SearchStore.getResults()};
+  return {
+    results: SearchStore.getResults(),
+    count: SearchStore.getCount(),
+    total: SearchStore.getTotal(),
+  };
 }
 
 class Results extends React.Component {
@@ -44,7 +48,16 @@ class Results extends React.Component {
     if (list.length === 0) {
       return <div className="no-results"><Icon icon="audiotrack" />No results found</div>;
     }
-    return <GroupList path={["Root"]} list={list} depth={0} />;
+    let total = null;
+    if (this.state.count < this.state.total) {
+      total = <div className="search-total">Showing {this.state.count} of {this.state.total} matches</div>;
+    }
+    return (
+      <div>
+        {total}
+        <GroupList path={["Root"]} list={list} depth={0} />
+      </div>
+    );
   }
 
   _onChange() {
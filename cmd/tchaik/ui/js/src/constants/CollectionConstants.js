@@ -2,6 +2,9 @@ var keyMirror = require("keymirror");
 
 module.exports = keyMirror({
   FETCH: null,
+  FETCH_BATCH: null,
+  LIBRARY_CHANGED: null,
   SET_FAVOURITE: null,
   SET_CHECKLIST: null,
+  SET_CHECKLIST_ALL: null,
 });
@@ -4,6 +4,7 @@ module.exports = keyMirror({
   CTRL: null,
   PLAY: null,
   PAUSE: null,
+  STOP: null,
   NEXT: null,
   PREV: null,
   TIME: null,
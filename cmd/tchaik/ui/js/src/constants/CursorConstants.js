@@ -8,4 +8,12 @@ module.exports = keyMirror({
   NEXT: null,
   PREV: null,
   SET: null,
+  GOTO: null,
+  SET_AND_PLAY: null,
+
+  ENDED: null,
+  STOP_AFTER_CURRENT: null,
+
+  SHUFFLE: null,
+  UNSHUFFLE: null,
 });
@@ -5,6 +5,7 @@ module.exports = keyMirror({
 
   FETCH: null,
   REMOVE: null,
+  MOVE: null,
   NEXT: null,
   PREV: null,
   ADD_ITEM: null,
@@ -2,4 +2,6 @@ var keyMirror = require("keymirror");
 
 module.exports = keyMirror({
   RECONNECT: null,
+  ERROR: null,
+  PING: null,
 });
@@ -4,6 +4,8 @@ import {ChangeEmitter, CHANGE_EVENT} from "../utils/ChangeEmitter.js";
 
 import AppDispatcher from "../dispatcher/AppDispatcher";
 
+import WebsocketAPI from "../utils/WebsocketAPI.js";
+
 import CollectionConstants from "../constants/CollectionConstants.js";
 
 
@@ -36,6 +38,21 @@ function addItem(path, item) {
   _collections[pathToKey(path)] = item;
 }
 
+// clearItems removes collections which could be affected by a change to path (or all
+// collections if path is not set), and returns their paths.
+function clearItems(path) {
+  const changed = pathToKey(path);
+  const paths = [];
+  for (const key in _collections) {
+    if (changed && changed.indexOf(key) !== 0 && key.indexOf(changed) !== 0) {
+      continue;
+    }
+    paths.push(key.split(pathSeparator));
+    delete _collections[key];
+  }
+  return paths;
+}
+
 class CollectionStore extends ChangeEmitter {
   pathToKey(path) {
     return pathToKey(path);
@@ -63,6 +80,29 @@ _store.dispatchToken = AppDispatcher.register(function(payload) {
         addItem(action.data.path, action.data.item);
         _store.emitChange(action.data.path);
         break;
+
+      case CollectionConstants.FETCH_BATCH:
+        action.data.results.forEach(function(result) {
+          if (result.error) {
+            console.error("error fetching " + result.path + ": " + result.error);
+            return;
+          }
+          addItem(result.path, result.item);
+          _store.emitChange(result.path);
+        });
+        break;
+
+      case CollectionConstants.LIBRARY_CHANGED: {
+        if (action.data.reason === "PLAYLIST") {
+          break;
+        }
+        // Refetch everything affected, updates are handled like any other FETCH_BATCH.
+        const paths = clearItems(action.data.path);
+        if (paths.length > 0) {
+          WebsocketAPI.send(CollectionConstants.FETCH_BATCH, {paths: paths});
+        }
+        break;
+      }
     }
   }
   return true;
@@ -52,10 +52,19 @@ class Position {
 }
 
 class Cursor {
-  constructor(current = new Position(0, null), previous= new Position(0, null), next = new Position(0, null)) {
+  constructor(current = new Position(0, null), previous= new Position(0, null), next = new Position(0, null), stopAfterCurrent = false) {
     this._current = current;
     this._previous = previous;
     this._next = next;
+    this._stopAfterCurrent = stopAfterCurrent;
+  }
+
+  stopAfterCurrent() {
+    return this._stopAfterCurrent;
+  }
+
+  clearStopAfterCurrent() {
+    this._stopAfterCurrent = false;
   }
 
   current() {
@@ -69,6 +78,13 @@ class Cursor {
     return trackForPath(this._current.path());
   }
 
+  nextTrack() {
+    if (this._next.isEmpty()) {
+      return null;
+    }
+    return trackForPath(this._next.path());
+  }
+
   forward() {
     if (this._next.isEmpty()) {
       return;
@@ -105,6 +121,10 @@ class Cursor {
 
 let _cursor = new Cursor();
 
+// _noCrossfade is true if crossfade (and gapless) transitions are disabled for the current or
+// next track of the cursor.
+let _noCrossfade = false;
+
 class CursorStore extends ChangeEmitter {
 
   getCurrentPosition() {
@@ -119,6 +139,10 @@ class CursorStore extends ChangeEmitter {
     return _cursor.currentTrack();
   }
 
+  getNextTrack() {
+    return _cursor.nextTrack();
+  }
+
   canPrev() {
     return _cursor.canBackward();
   }
@@ -127,6 +151,14 @@ class CursorStore extends ChangeEmitter {
     return _cursor.canForward();
   }
 
+  getNoCrossfade() {
+    return _noCrossfade;
+  }
+
+  getStopAfterCurrent() {
+    return _cursor.stopAfterCurrent();
+  }
+
 }
 
 function positionFromData(position) {
@@ -157,7 +189,8 @@ _store.dispatchToken = AppDispatcher.register(function(payload) {
       const previous = positionFromData(action.data.previous);
       const next = positionFromData(action.data.next);
 
-      _cursor = new Cursor(current, previous, next);
+      _cursor = new Cursor(current, previous, next, action.data.stopAfterCurrent === true);
+      _noCrossfade = action.data.noCrossfade === true;
       _store.emitChange();
     }
   }
@@ -172,6 +205,12 @@ _store.dispatchToken = AppDispatcher.register(function(payload) {
         if (action.source !== "cursor") {
           break;
         }
+        if (action.stop === true) {
+          // The server clears the flag (without moving the cursor) when it receives ENDED.
+          _cursor.clearStopAfterCurrent();
+          _store.emitChange();
+          break;
+        }
         /* falls through */
       case CursorConstants.NEXT:
         _cursor.forward();
@@ -17,6 +17,9 @@ let CONTROL_EVENT = "control";
 
 let currentPlaying = null;
 let currentRepeat = null;
+let currentTransition = null;
+let currentReplayGain = null;
+let currentOutputDevice = null;
 let _currentTrack = null;
 
 function setCurrentTrackSource(source) {
@@ -41,6 +44,11 @@ function setCurrentTrack(track) {
   return change;
 }
 
+function clearCurrentTrack() {
+  localStorage.removeItem("currentTrack");
+  _currentTrack = null;
+}
+
 function _playing() {
   const v = localStorage.getItem("playing");
   if (v === null) {
@@ -81,6 +89,48 @@ function setRepeat(v) {
   localStorage.setItem("repeat", JSON.stringify(v));
 }
 
+const defaultTransition = {mode: "none", seconds: 0};
+
+function transition() {
+  if (currentTransition === null) {
+    const v = localStorage.getItem("transition");
+    currentTransition = (v === null) ? defaultTransition : JSON.parse(v);
+  }
+  return currentTransition;
+}
+
+function setTransition(v) {
+  currentTransition = v;
+  localStorage.setItem("transition", JSON.stringify(v));
+}
+
+function replayGain() {
+  if (currentReplayGain === null) {
+    const v = localStorage.getItem("replayGain");
+    currentReplayGain = (v === null) ? "off" : v;
+  }
+  return currentReplayGain;
+}
+
+function setReplayGain(v) {
+  currentReplayGain = v;
+  localStorage.setItem("replayGain", v);
+}
+
+// outputDevice returns the id of the audio output device, empty for the default device.
+function outputDevice() {
+  if (currentOutputDevice === null) {
+    const v = localStorage.getItem("outputDevice");
+    currentOutputDevice = (v === null) ? "" : v;
+  }
+  return currentOutputDevice;
+}
+
+function setOutputDevice(v) {
+  currentOutputDevice = v;
+  localStorage.setItem("outputDevice", v);
+}
+
 function currentTrack() {
   if (_currentTrack === null) {
     const c = localStorage.getItem("currentTrack");
@@ -106,6 +156,18 @@ class NowPlayingStore extends ChangeEmitter {
     return currentTrack();
   }
 
+  getTransition() {
+    return transition();
+  }
+
+  getReplayGain() {
+    return replayGain();
+  }
+
+  getOutputDevice() {
+    return outputDevice();
+  }
+
   getSource() {
     return currentTrackSource();
   }
@@ -149,6 +211,12 @@ _nowPlayingStore.dispatchToken = AppDispatcher.register(function(payload) {
           _nowPlayingStore.emitChange();
           break;
 
+        case CtrlConstants.STOP:
+          setPlaying(false);
+          clearCurrentTrack();
+          _nowPlayingStore.emitChange();
+          break;
+
         case CtrlConstants.NEXT:
           /* fallsthrough */
         case CtrlConstants.PREV:
@@ -175,6 +243,21 @@ _nowPlayingStore.dispatchToken = AppDispatcher.register(function(payload) {
           _nowPlayingStore.emitChange();
           break;
 
+        case "transition":
+          setTransition(action.data.Value);
+          _nowPlayingStore.emitChange();
+          break;
+
+        case "replayGain":
+          setReplayGain(action.data.Value);
+          _nowPlayingStore.emitChange();
+          break;
+
+        case "output":
+          setOutputDevice(action.data.Value.device);
+          _nowPlayingStore.emitChange();
+          break;
+
         case "time":
           _nowPlayingStore.emitControl(NowPlayingConstants.SET_CURRENT_TIME, action.data.Value);
           break;
@@ -211,6 +294,13 @@ _nowPlayingStore.dispatchToken = AppDispatcher.register(function(payload) {
         if (action.source !== "cursor") {
           break;
         }
+
+        if (action.stop === true) {
+          _nowPlayingStore.emitControl(NowPlayingConstants.SET_CURRENT_TIME, 0);
+          setPlaying(false);
+          _nowPlayingStore.emitChange();
+          break;
+        }
         /* falls through */
       case CursorConstants.PREV:
         /* falls through */
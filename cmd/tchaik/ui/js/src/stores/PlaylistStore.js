@@ -5,6 +5,9 @@ import {ChangeEmitter} from "../utils/ChangeEmitter.js";
 
 import CollectionStore from "./CollectionStore.js";
 
+import PlaylistActions from "../actions/PlaylistActions.js";
+
+import CollectionConstants from "../constants/CollectionConstants.js";
 import PlaylistConstants from "../constants/PlaylistConstants.js";
 
 
@@ -120,6 +123,10 @@ _store.dispatchToken = AppDispatcher.register(function(payload) {
       }
       _store.emitChange();
     }
+
+    if (action.actionType === CollectionConstants.LIBRARY_CHANGED && action.data.reason === "PLAYLIST") {
+      PlaylistActions.refresh(action.data.name);
+    }
   }
 
   if (source === "VIEW_ACTION") {
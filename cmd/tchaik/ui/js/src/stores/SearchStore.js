@@ -11,10 +11,16 @@ import ContainerConstants from "../constants/ContainerConstants.js";
 
 
 let _results = [];
-
-function setResults(results) {
-  if (results !== null && results.groups) {
-    _results = results.groups;
+let _count = 0;
+let _total = 0;
+
+// setResults sets the results of a search: the (ranked) groups containing at most the
+// requested limit of matches, along with the number included and the total.
+function setResults(data) {
+  _count = (data && data.count) || 0;
+  _total = (data && data.total) || 0;
+  if (data && data.results !== null && data.results.groups) {
+    _results = data.results.groups;
     return;
   }
   _results = [];
@@ -38,6 +44,14 @@ class SearchResultStore extends ChangeEmitter {
     return _results;
   }
 
+  getCount() {
+    return _count;
+  }
+
+  getTotal() {
+    return _total;
+  }
+
   getInput() {
     return input();
   }
@@ -7,10 +7,15 @@ import AppDispatcher from "../dispatcher/AppDispatcher";
 import CtrlConstants from "../constants/ControlConstants.js";
 import VolumeConstants from "../constants/VolumeConstants.js";
 
+import NowPlayingActions from "../actions/NowPlayingActions.js";
+
 
 const defaultVolume = 0.75;
 const defaultVolumeMute = false;
 
+const fadeStep = 50; // ms
+let fadeTimer = null;
+
 function _setVolume(v) {
   localStorage.setItem("volume", v);
 }
@@ -45,6 +50,40 @@ function setVolume(v) {
 }
 
 
+function cancelFade() {
+  if (fadeTimer !== null) {
+    clearInterval(fadeTimer);
+    fadeTimer = null;
+  }
+}
+
+// fadeVolume ramps the volume to v over ms milliseconds, cancelling any fade in progress.
+// If pause is set then playback is paused at the end of the fade, and the volume from before
+// the fade is restored.
+function fadeVolume(v, ms, pause) {
+  cancelFade();
+  const from = _volumeStore.getVolume();
+  const steps = Math.max(1, Math.round(ms / fadeStep));
+  let i = 0;
+  fadeTimer = setInterval(function() {
+    i++;
+    if (i < steps) {
+      setVolume(from + (v - from) * i / steps);
+      _volumeStore.emitChange();
+      return;
+    }
+
+    cancelFade();
+    if (pause) {
+      NowPlayingActions.playing(false);
+      setVolume(from);
+    } else {
+      setVolume(v);
+    }
+    _volumeStore.emitChange();
+  }, ms / steps);
+}
+
 class VolumeStore extends ChangeEmitter {
   getVolume() {
     return volumeMute() ? 0.0 : volume();
@@ -71,6 +110,11 @@ _volumeStore.dispatchToken = AppDispatcher.register(function(payload) {
           break;
 
         case "volume":
+          if (action.data.fadeMs > 0) {
+            fadeVolume(action.data.Value, action.data.fadeMs, action.data.pause);
+            break;
+          }
+          cancelFade();
           setVolume(action.data.Value);
           _volumeStore.emitChange();
           break;
@@ -90,6 +134,7 @@ _volumeStore.dispatchToken = AppDispatcher.register(function(payload) {
     switch (action.actionType) {
 
       case VolumeConstants.SET_VOLUME:
+        cancelFade();
         setVolume(action.volume);
         _volumeStore.emitChange();
         break;
@@ -7,6 +7,7 @@ import AppDispatcher from "../dispatcher/AppDispatcher.js";
 import WebsocketActions from "../actions/WebsocketActions.js";
 import WebsocketConstants from "../constants/WebsocketConstants.js";
 
+const keepaliveInterval = 20000; // ms
 
 class WebsocketAPI extends ChangeEmitter {
   constructor() {
@@ -16,6 +17,9 @@ class WebsocketAPI extends ChangeEmitter {
     this.open = false;
     this.queue = [];
     this.sock = null;
+    this.keepalive = null;
+    // Messages are handled in order, including those which need to be decompressed.
+    this.received = Promise.resolve();
 
     this.dispatchToken = AppDispatcher.register(this._handleViewAction.bind(this));
   }
@@ -33,6 +37,7 @@ class WebsocketAPI extends ChangeEmitter {
       return;
     }
 
+    this.sock.binaryType = "arraybuffer";
     this.sock.onmessage = this._onMessage.bind(this);
     this.sock.onerror = this._onError.bind(this);
     this.sock.onopen = this._onOpen.bind(this);
@@ -70,8 +75,23 @@ class WebsocketAPI extends ChangeEmitter {
   }
 
   _onMessage(obj) {
-    var msg = JSON.parse(obj.data);
-    WebsocketActions.dispatch(msg);
+    var data = obj.data;
+    this.received = this.received.then(function() {
+      if (typeof data === "string") {
+        return data;
+      }
+      // Binary messages are gzipped JSON.
+      var stream = new Blob([data]).stream().pipeThrough(new DecompressionStream("gzip"));
+      return new Response(stream).text();
+    }).then(function(text) {
+      var msg = JSON.parse(text);
+      if (msg.action === WebsocketConstants.ERROR) {
+        console.error("error handling " + msg.data.action + " (" + msg.data.code + "): " + msg.data.message);
+      }
+      WebsocketActions.dispatch(msg);
+    }).catch(function(err) {
+      console.error("error handling message: " + err);
+    });
   }
 
   _onError(err) {
@@ -80,6 +100,11 @@ class WebsocketAPI extends ChangeEmitter {
 
   _onOpen() {
     this.open = true;
+    // Browsers can't send ping frames, so send a command to stop the server timing out
+    // the connection when idle.
+    this.keepalive = setInterval(function() {
+      this.send(WebsocketConstants.PING, {});
+    }.bind(this), keepaliveInterval);
     this.emitChange();
     this.queue.map(function(payload) {
       this.send(payload.action, payload.data);
@@ -89,6 +114,7 @@ class WebsocketAPI extends ChangeEmitter {
 
   _onClose() {
     this.open = false;
+    clearInterval(this.keepalive);
     this.emitChange();
   }
 }
@@ -0,0 +1,135 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"tchaik.com/index"
+	"tchaik.com/index/rating"
+)
+
+// undoLimit is the maximum number of changes recorded for UNDO in each connection.
+const undoLimit = 20
+
+// undoEntry is a change to the metadata of a path which can be undone.
+type undoEntry struct {
+	action string // SET_FAVOURITE, SET_CHECKLIST or SET_RATING
+	path   index.Path
+	prev   interface{} // value before the change
+	value  interface{} // value set by the change
+}
+
+// undoStack is a bounded stack of changes, the oldest changes are dropped when the stack
+// is full.  It is not safe for concurrent use.
+type undoStack struct {
+	limit   int
+	entries []undoEntry
+}
+
+// push adds the change to the top of the stack.
+func (s *undoStack) push(e undoEntry) {
+	if len(s.entries) == s.limit {
+		copy(s.entries, s.entries[1:])
+		s.entries = s.entries[:len(s.entries)-1]
+	}
+	s.entries = append(s.entries, e)
+}
+
+// pop removes and returns the change at the top of the stack, returns false if the stack
+// is empty.
+func (s *undoStack) pop() (undoEntry, bool) {
+	if len(s.entries) == 0 {
+		return undoEntry{}, false
+	}
+	e := s.entries[len(s.entries)-1]
+	s.entries = s.entries[:len(s.entries)-1]
+	return e, true
+}
+
+// clear removes all the changes from the stack.
+func (s *undoStack) clear() {
+	s.entries = nil
+}
+
+// record adds the change (if it changed the value) to the undo stack of the connection.
+func (h *websocketHandler) record(action string, p index.Path, prev, value interface{}) {
+	if prev == value {
+		return
+	}
+	h.undo.push(undoEntry{
+		action: action,
+		path:   p,
+		prev:   prev,
+		value:  value,
+	})
+}
+
+// metaValue returns the current value of the metadata changed by the action for the path.
+func (h *websocketHandler) metaValue(action string, p index.Path) interface{} {
+	switch action {
+	case ActionSetFavourite:
+		return h.meta.favourites.Get(p)
+	case ActionSetChecklist:
+		return h.meta.checklist.Get(p)
+	case ActionSetRating:
+		return int(h.meta.ratings.Get(p))
+	}
+	panic(fmt.Sprintf("unknown undo action: %v", action))
+}
+
+// undoChange reverts the most recent change made by the connection.  If the value has been
+// changed since (i.e. by another connection), the change is dropped and reported as a
+// conflict, leaving the value as it is.  The response contains the path and its (new)
+// value.
+func (h *websocketHandler) undoChange(c Command, resp *Response) error {
+	e, ok := h.undo.pop()
+	if !ok {
+		return &commandError{ErrorNothingToUndo, "nothing to undo"}
+	}
+
+	current := h.metaValue(e.action, e.path)
+	conflict := current != e.value
+	if !conflict {
+		var err error
+		switch e.action {
+		case ActionSetFavourite:
+			err = h.meta.favourites.Set(e.path, e.prev.(bool))
+			if err == nil {
+				h.hub.broadcastChange(libraryChange{Reason: changeFavourite, Path: e.path}, h)
+				// Tag write errors are logged (see writeTags), the undo has still happened.
+				h.writeFavouriteTags(e.path, e.prev.(bool))
+			}
+		case ActionSetChecklist:
+			err = h.meta.checklist.Set(e.path, e.prev.(bool))
+			if err == nil {
+				h.hub.broadcastChange(libraryChange{Reason: changeChecklist, Path: e.path}, h)
+			}
+		case ActionSetRating:
+			err = h.meta.ratings.Set(e.path, rating.Value(e.prev.(int)))
+			if err == nil {
+				h.hub.broadcastChange(libraryChange{Reason: changeRating, Path: e.path}, h)
+				h.writeRatingTags(e.path, e.prev.(int))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		current = e.prev
+	}
+
+	resp.Data = struct {
+		Action   string      `json:"action"`
+		Path     index.Path  `json:"path"`
+		Value    interface{} `json:"value"`
+		Conflict bool        `json:"conflict"`
+	}{
+		Action:   e.action,
+		Path:     e.path,
+		Value:    current,
+		Conflict: conflict,
+	}
+	return nil
+}
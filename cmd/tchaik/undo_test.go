@@ -0,0 +1,103 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"tchaik.com/index"
+	"tchaik.com/index/rating"
+)
+
+func TestUndoStack(t *testing.T) {
+	s := &undoStack{limit: 3}
+	for i := 1; i <= 5; i++ {
+		s.push(undoEntry{value: i})
+	}
+
+	for _, expected := range []int{5, 4, 3} {
+		e, ok := s.pop()
+		if !ok || e.value != expected {
+			t.Errorf("s.pop() = %v, %v, expected: %v, true", e.value, ok, expected)
+		}
+	}
+	if e, ok := s.pop(); ok {
+		t.Errorf("s.pop() = %v, true, expected: false", e.value)
+	}
+
+	s.push(undoEntry{value: 1})
+	s.clear()
+	if _, ok := s.pop(); ok {
+		t.Errorf("s.pop() after s.clear() = true, expected: false")
+	}
+}
+
+type testRatingStore map[string]rating.Value
+
+func (s testRatingStore) Set(p index.Path, v rating.Value) error {
+	s[p.Encode()] = v
+	return nil
+}
+
+func (s testRatingStore) Get(p index.Path) rating.Value { return s[p.Encode()] }
+
+func TestUndoChange(t *testing.T) {
+	ratings := testRatingStore{}
+	h := &websocketHandler{
+		meta: &Meta{userMeta: &userMeta{ratings: ratings}},
+		undo: &undoStack{limit: undoLimit},
+		hub:  newHub(),
+	}
+	p := index.Path{"Root", "a"}
+
+	setRating := func(v int) {
+		err := h.setRating(Command{Data: map[string]interface{}{
+			"path":  []interface{}{"Root", "a"},
+			"value": float64(v),
+		}}, &Response{})
+		if err != nil {
+			t.Fatalf("h.setRating(%d) error: %v", v, err)
+		}
+	}
+	undo := func() (interface{}, bool) {
+		resp := &Response{}
+		if err := h.undoChange(Command{}, resp); err != nil {
+			t.Fatalf("h.undoChange() error: %v", err)
+		}
+		v := resp.Data.(struct {
+			Action   string      `json:"action"`
+			Path     index.Path  `json:"path"`
+			Value    interface{} `json:"value"`
+			Conflict bool        `json:"conflict"`
+		})
+		return v.Value, v.Conflict
+	}
+
+	setRating(3)
+	setRating(3) // unchanged, so not recorded
+	setRating(5)
+
+	if v, conflict := undo(); v != 3 || conflict {
+		t.Errorf("undo() = %v, %v, expected: 3, false", v, conflict)
+	}
+	if got := ratings.Get(p); got != 3 {
+		t.Errorf("rating after undo = %v, expected: 3", got)
+	}
+
+	// Changed by another connection.
+	ratings.Set(p, 1)
+	if v, conflict := undo(); v != 1 || !conflict {
+		t.Errorf("undo() = %v, %v, expected: 1, true", v, conflict)
+	}
+	if got := ratings.Get(p); got != 1 {
+		t.Errorf("rating after conflicting undo = %v, expected: 1", got)
+	}
+
+	if err := h.undoChange(Command{}, &Response{}); err == nil {
+		t.Errorf("h.undoChange() with empty stack: expected error")
+	} else if got := newErrorData(Command{}, err).Code; got != ErrorNothingToUndo {
+		t.Errorf("h.undoChange() with empty stack: error code = %q, expected: %q", got, ErrorNothingToUndo)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"tchaik.com/index/bookmark"
+	"tchaik.com/index/checklist"
+	"tchaik.com/index/favourite"
+	"tchaik.com/index/history"
+	"tchaik.com/index/rating"
+)
+
+// userMeta contains the metadata which is specific to a user.
+type userMeta struct {
+	// user is the name of the user, empty for the default user (which is shared by all
+	// anonymous connections).
+	user string
+
+	history    history.Store
+	favourites favourite.Store
+	checklist  checklist.Store
+	ratings    rating.Store
+	bookmarks  *bookmarker
+	insights   *insightsCache
+}
+
+// userPath returns the path of the file for the user, derived from the path p of the file for
+// the default user (i.e. favourites.json -> favourites.<user>.json).
+func userPath(p, user string) string {
+	if user == "" {
+		return p
+	}
+	ext := filepath.Ext(p)
+	return strings.TrimSuffix(p, ext) + "." + url.QueryEscape(user) + ext
+}
+
+// loadUserMeta loads the metadata for the user.
+func loadUserMeta(user string) (*userMeta, error) {
+	historyStore, err := history.NewStore(userPath(playHistoryPath, user))
+	if err != nil {
+		return nil, fmt.Errorf("error loading play history: %v", err)
+	}
+
+	favouriteStore, err := favourite.NewStore(userPath(favouritesPath, user))
+	if err != nil {
+		return nil, fmt.Errorf("error loading favourites: %v", err)
+	}
+
+	checklistStore, err := checklist.NewStore(userPath(checklistPath, user))
+	if err != nil {
+		return nil, fmt.Errorf("error loading checklist: %v", err)
+	}
+
+	ratingStore, err := rating.NewStore(userPath(ratingsPath, user))
+	if err != nil {
+		return nil, fmt.Errorf("error loading ratings: %v", err)
+	}
+
+	bookmarkStore, err := bookmark.NewStore(userPath(bookmarksPath, user))
+	if err != nil {
+		return nil, fmt.Errorf("error loading bookmarks: %v", err)
+	}
+
+	return &userMeta{
+		user:       user,
+		history:    historyStore,
+		favourites: favouriteStore,
+		checklist:  checklistStore,
+		ratings:    ratingStore,
+		bookmarks:  newBookmarker(bookmarkStore),
+		insights:   &insightsCache{store: historyStore},
+	}, nil
+}
+
+// userStores is a collection of userMeta (identified by user name) which are loaded when
+// first requested.
+type userStores struct {
+	sync.Mutex
+	m map[string]*userMeta
+}
+
+// newUserStores creates a userStores containing the default user.
+func newUserStores(def *userMeta) *userStores {
+	return &userStores{
+		m: map[string]*userMeta{
+			def.user: def,
+		},
+	}
+}
+
+// Get returns the userMeta for the user, loading it if necessary.
+func (s *userStores) Get(user string) (*userMeta, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if u, ok := s.m[user]; ok {
+		return u, nil
+	}
+	u, err := loadUserMeta(user)
+	if err != nil {
+		return nil, fmt.Errorf("error loading metadata for user %#v: %v", user, err)
+	}
+	s.m[user] = u
+	return u, nil
+}
+
+// List returns the loaded userMeta, ordered by user name.
+func (s *userStores) List() []*userMeta {
+	s.Lock()
+	defer s.Unlock()
+
+	users := make([]string, 0, len(s.m))
+	for k := range s.m {
+		users = append(users, k)
+	}
+	sort.Strings(users)
+
+	result := make([]*userMeta, len(users))
+	for i, k := range users {
+		result[i] = s.m[k]
+	}
+	return result
+}
+
+// Flush writes any pending changes to the favourites and checklists of all loaded users
+// (which are written shortly after they are made), returning the first error.
+func (m *Meta) Flush() error {
+	var err error
+	for _, u := range m.users.List() {
+		for _, s := range []interface {
+			Flush() error
+		}{u.favourites, u.checklist} {
+			if ferr := s.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+	}
+	return err
+}
+
+// ForUser returns a Meta which uses the metadata of the user, and shares everything else
+// with m.
+func (m *Meta) ForUser(user string) (*Meta, error) {
+	u, err := m.users.Get(user)
+	if err != nil {
+		return nil, err
+	}
+	if u == m.userMeta {
+		return m, nil
+	}
+	um := *m
+	um.userMeta = u
+	return &um, nil
+}
+
+// userTokens is a mapping of tokens to user names, used to identify the users of websocket
+// connections (see requestUser).
+var userTokens map[string]string
+
+// userTokenRoles is a mapping of tokens to the roles given to them in the user tokens file
+// (see requestRole).
+var userTokenRoles map[string]role
+
+// userToken is an entry of the user tokens file given as an object, which can also set the
+// role of the token.
+type userToken struct {
+	User string `json:"user"`
+	Role string `json:"role"`
+}
+
+// loadUserTokens reads the user tokens from the JSON file at path.  Tokens map either to a
+// user name, or to a userToken object with a user name and (optional) role name (see
+// roleNames).  Returns the user names and roles of the tokens.
+func loadUserTokens(path string) (map[string]string, map[string]role, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var m map[string]json.RawMessage
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("error decoding user tokens: %v", err)
+	}
+
+	users := make(map[string]string, len(m))
+	roles := make(map[string]role)
+	for token, raw := range m {
+		var user string
+		if err := json.Unmarshal(raw, &user); err == nil {
+			users[token] = user
+			continue
+		}
+		var ut userToken
+		if err := json.Unmarshal(raw, &ut); err != nil {
+			return nil, nil, fmt.Errorf("error decoding user token for %#v: expected user name or object", token)
+		}
+		users[token] = ut.User
+		if ut.Role != "" {
+			r, err := parseRole(ut.Role)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error decoding user token for %#v: %v", ut.User, err)
+			}
+			roles[token] = r
+		}
+	}
+	return users, roles, nil
+}
+
+// requestUser returns the user identified by the token of the request (see requestToken).
+// Requests without a token are from the default user.
+func requestUser(r *http.Request) (string, error) {
+	token := requestToken(r)
+	if token == "" {
+		return "", nil
+	}
+	user, ok := userTokens[token]
+	if !ok {
+		return "", fmt.Errorf("invalid user token")
+	}
+	return user, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUserPath(t *testing.T) {
+	tests := []struct {
+		path, user, expected string
+	}{
+		{"favourites.json", "", "favourites.json"},
+		{"favourites.json", "alice", "favourites.alice.json"},
+		{"data/history", "bob", "data/history.bob"},
+		{"ratings.json", "../x", "ratings...%2Fx.json"},
+	}
+
+	for ii, tt := range tests {
+		if got := userPath(tt.path, tt.user); got != tt.expected {
+			t.Errorf("[%d] userPath(%#v, %#v) = %#v, expected: %#v", ii, tt.path, tt.user, got, tt.expected)
+		}
+	}
+}
+
+func TestRequestUser(t *testing.T) {
+	userTokens = map[string]string{"abc": "alice"}
+	defer func() { userTokens = nil }()
+
+	tests := []struct {
+		url, user string
+		err       bool
+	}{
+		{"/socket", "", false},
+		{"/socket?token=abc", "alice", false},
+		{"/socket?format=msgpack&token=abc", "alice", false},
+		{"/socket?token=xyz", "", true},
+	}
+
+	for ii, tt := range tests {
+		got, err := requestUser(httptest.NewRequest("GET", tt.url, nil))
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] requestUser(%#v) error = %v, expected error: %v", ii, tt.url, err, tt.err)
+		}
+		if got != tt.user {
+			t.Errorf("[%d] requestUser(%#v) = %#v, expected: %#v", ii, tt.url, got, tt.user)
+		}
+	}
+}
+
+func TestLoadUserTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		in    string
+		users map[string]string
+		roles map[string]role
+		err   bool
+	}{
+		{`{"abc": "alice"}`, map[string]string{"abc": "alice"}, map[string]role{}, false},
+		{
+			`{"abc": "alice", "def": {"user": "bob", "role": "guest"}, "ghi": {"user": "carol", "role": "admin"}, "jkl": {"user": "dave"}}`,
+			map[string]string{"abc": "alice", "def": "bob", "ghi": "carol", "jkl": "dave"},
+			map[string]role{"def": roleGuest, "ghi": roleAdmin},
+			false,
+		},
+		{`{"abc": {"user": "alice", "role": "owner"}}`, nil, nil, true},
+		{`{"abc": 1}`, nil, nil, true},
+	}
+
+	path := filepath.Join(dir, "tokens.json")
+	for ii, tt := range tests {
+		if err := ioutil.WriteFile(path, []byte(tt.in), 0600); err != nil {
+			t.Fatal(err)
+		}
+		users, roles, err := loadUserTokens(path)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] loadUserTokens() error = %v, expected error: %v", ii, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(users, tt.users) || !reflect.DeepEqual(roles, tt.roles) {
+			t.Errorf("[%d] loadUserTokens() = %v, %v, expected: %v, %v", ii, users, roles, tt.users, tt.roles)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+
+	"tchaik.com/index"
+)
+
+// wavHeaderSize is the size of the RIFF/WAVE header written before the PCM data.
+const wavHeaderSize = 44
+
+// wavFormat describes the PCM data of a WAV stream.
+type wavFormat struct {
+	sampleRate int // Hz
+	channels   int
+	bitDepth   int // bits per sample
+}
+
+// defaultWAVFormat is used for tracks with an unknown (or unsupported) sample rate.
+var defaultWAVFormat = wavFormat{sampleRate: 44100, channels: 2, bitDepth: 16}
+
+// trackWAVFormat returns the wavFormat used to stream the track: 16-bit stereo at the sample
+// rate of the track (which can be nil).
+func trackWAVFormat(t index.Track) wavFormat {
+	f := defaultWAVFormat
+	if t == nil {
+		return f
+	}
+	if r := t.GetInt("SampleRate"); r >= 8000 && r <= 192000 {
+		f.sampleRate = r
+	}
+	return f
+}
+
+// blockAlign returns the size (in bytes) of a sample frame, i.e. one sample for each channel.
+func (f wavFormat) blockAlign() int64 { return int64(f.channels * f.bitDepth / 8) }
+
+// byteRate returns the number of bytes per second of PCM data.
+func (f wavFormat) byteRate() int64 { return int64(f.sampleRate) * f.blockAlign() }
+
+// dataSize returns the size of the PCM data for a track of the given duration (in
+// milliseconds), which is a whole number of sample frames.
+func (f wavFormat) dataSize(ms int) int64 {
+	return int64(ms) * int64(f.sampleRate) / 1000 * f.blockAlign()
+}
+
+// header returns the RIFF/WAVE header for dataSize bytes of PCM data.
+func (f wavFormat) header(dataSize int64) []byte {
+	b := make([]byte, wavHeaderSize)
+	copy(b[0:], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], uint32(wavHeaderSize-8+dataSize))
+	copy(b[8:], "WAVE")
+	copy(b[12:], "fmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(b[22:], uint16(f.channels))
+	binary.LittleEndian.PutUint32(b[24:], uint32(f.sampleRate))
+	binary.LittleEndian.PutUint32(b[28:], uint32(f.byteRate()))
+	binary.LittleEndian.PutUint16(b[32:], uint16(f.blockAlign()))
+	binary.LittleEndian.PutUint16(b[34:], uint16(f.bitDepth))
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], uint32(dataSize))
+	return b
+}
+
+// maxWAVDataSize is the largest data chunk which can be described by a WAV header.
+const maxWAVDataSize = 1<<32 - 1 - (wavHeaderSize - 8)
+
+// copyPCM writes exactly n bytes of PCM data from r to w, after discarding the first skip
+// bytes of r.  The duration of the track (and so the size given in the header) is only
+// approximate, so the output of ffmpeg is truncated, or padded with silence, to match.
+func copyPCM(w io.Writer, r io.Reader, skip, n int64) error {
+	if _, err := io.CopyN(ioutil.Discard, r, skip); err != nil && err != io.EOF {
+		return err
+	}
+	m, err := io.Copy(w, io.LimitReader(r, n))
+	if err != nil {
+		return err
+	}
+	if m < n {
+		_, err = io.CopyN(w, zeroReader{}, n-m)
+	}
+	return err
+}
+
+// zeroReader is an io.Reader which reads zero bytes (silence, for signed PCM).
+type zeroReader struct{}
+
+// Read implements io.Reader.
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// serveWAV transcodes the track in f to a WAV stream (uncompressed PCM, which can be decoded
+// directly by WebAudio clients).  The size of the stream is computed from the duration and
+// sample rate of the track, so byte ranges are served by seeking the source to the time of
+// the first sample frame in the range.  Tracks without a known duration (including those
+// which aren't in the library, when tr is nil) are streamed without range support, with
+// the maximum size in the header.
+func (t transcodeHandler) serveWAV(w http.ResponseWriter, r *http.Request, f io.Reader, tr index.Track) {
+	wf := trackWAVFormat(tr)
+
+	maxSize := maxWAVDataSize - maxWAVDataSize%wf.blockAlign()
+	var dataSize int64
+	if tr != nil {
+		dataSize = wf.dataSize(tr.GetInt("TotalTime"))
+	}
+	sized := dataSize > 0
+	if !sized || dataSize > maxSize {
+		dataSize = maxSize
+	}
+	size := wavHeaderSize + dataSize
+
+	var start int64
+	var ranged bool
+	if sized {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if rng := r.Header.Get("Range"); rng != "" {
+			var err error
+			ranged = true
+			start, err = parseRangeStart(rng, size)
+			if err != nil {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size-start, 10))
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	if ranged {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	if r.Method == "HEAD" {
+		return
+	}
+
+	if start < wavHeaderSize {
+		if _, err := w.Write(wf.header(dataSize)[start:]); err != nil {
+			return
+		}
+	}
+
+	// Offset into the PCM data, seeking to the start of the containing sample frame and then
+	// discarding the remainder.
+	var offset, skip int64
+	if start > wavHeaderSize {
+		offset = start - wavHeaderSize
+		skip = offset % wf.blockAlign()
+		offset -= skip
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+	args = append(args, seekArgs(tr, float64(offset/wf.blockAlign())/float64(wf.sampleRate))...)
+	args = append(args, "-vn", "-codec:a", "pcm_s16le", "-ar", strconv.Itoa(wf.sampleRate),
+		"-ac", strconv.Itoa(wf.channels), "-f", "s16le", "pipe:1")
+
+	cmd := exec.Command(ffmpegPath, args...)
+	cmd.Stdin = f
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("error transcoding %v: %v", r.URL.Path, err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("error starting ffmpeg for %v: %v", r.URL.Path, err)
+		return
+	}
+
+	if sized {
+		err = copyPCM(w, out, skip, dataSize-offset-skip)
+	} else {
+		_, err = io.Copy(w, out)
+	}
+	if err != nil {
+		// The client has most likely gone away (i.e. seeked or stopped).
+		cmd.Process.Kill()
+	}
+	out.Close()
+	cmd.Wait()
+}
@@ -0,0 +1,98 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestWAVFormatDataSize(t *testing.T) {
+	tests := []struct {
+		f    wavFormat
+		ms   int
+		size int64
+	}{
+		{defaultWAVFormat, 0, 0},
+		{defaultWAVFormat, 1000, 176400},
+		{defaultWAVFormat, 1, 176},
+		{wavFormat{sampleRate: 48000, channels: 2, bitDepth: 16}, 2500, 480000},
+		{wavFormat{sampleRate: 22050, channels: 1, bitDepth: 16}, 1001, 44144},
+	}
+
+	for _, tt := range tests {
+		size := tt.f.dataSize(tt.ms)
+		if size != tt.size {
+			t.Errorf("%v.dataSize(%d) = %d, expected: %d", tt.f, tt.ms, size, tt.size)
+		}
+		if size%tt.f.blockAlign() != 0 {
+			t.Errorf("%v.dataSize(%d) = %d, expected a multiple of %d", tt.f, tt.ms, size, tt.f.blockAlign())
+		}
+	}
+}
+
+func TestWAVFormatHeader(t *testing.T) {
+	b := defaultWAVFormat.header(1000)
+	if len(b) != wavHeaderSize {
+		t.Fatalf("len(header) = %d, expected: %d", len(b), wavHeaderSize)
+	}
+
+	strs := []struct {
+		offset int
+		s      string
+	}{
+		{0, "RIFF"},
+		{8, "WAVE"},
+		{12, "fmt "},
+		{36, "data"},
+	}
+	for _, tt := range strs {
+		if got := string(b[tt.offset : tt.offset+4]); got != tt.s {
+			t.Errorf("header[%d:%d] = %q, expected: %q", tt.offset, tt.offset+4, got, tt.s)
+		}
+	}
+
+	ints := []struct {
+		offset int
+		n      uint32
+	}{
+		{4, 1036},
+		{24, 44100},
+		{28, 176400},
+		{40, 1000},
+	}
+	for _, tt := range ints {
+		if got := binary.LittleEndian.Uint32(b[tt.offset:]); got != tt.n {
+			t.Errorf("header[%d:%d] = %d, expected: %d", tt.offset, tt.offset+4, got, tt.n)
+		}
+	}
+}
+
+func TestCopyPCM(t *testing.T) {
+	tests := []struct {
+		in      string
+		skip, n int64
+		out     string
+	}{
+		{"abcdef", 0, 6, "abcdef"},
+		{"abcdef", 0, 4, "abcd"},
+		{"abcdef", 2, 4, "cdef"},
+		{"abcdef", 2, 6, "cdef\x00\x00"},
+		{"ab", 4, 2, "\x00\x00"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := copyPCM(&buf, strings.NewReader(tt.in), tt.skip, tt.n); err != nil {
+			t.Errorf("copyPCM(%q, %d, %d) error: %v", tt.in, tt.skip, tt.n, err)
+			continue
+		}
+		if buf.String() != tt.out {
+			t.Errorf("copyPCM(%q, %d, %d) = %q, expected: %q", tt.in, tt.skip, tt.n, buf.String(), tt.out)
+		}
+	}
+}
@@ -9,15 +9,90 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
+	"golang.org/x/net/context"
 	"golang.org/x/net/websocket"
 
 	"tchaik.com/index"
+	"tchaik.com/index/chapter"
 	"tchaik.com/index/cursor"
+	"tchaik.com/index/lyrics"
 	"tchaik.com/index/playlist"
+	"tchaik.com/index/rating"
+	"tchaik.com/index/rootorder"
+	"tchaik.com/index/smart"
 	"tchaik.com/player"
+	"tchaik.com/store"
 )
 
+// ErrorCode is a machine-readable code which identifies the cause of an ERROR response.
+type ErrorCode string
+
+// Error codes sent in ERROR responses.
+const (
+	ErrorBadField      ErrorCode = "BAD_FIELD"
+	ErrorInvalidPath             = "INVALID_PATH"
+	ErrorUnknownPlayer           = "UNKNOWN_PLAYER"
+	ErrorUnknownAction           = "UNKNOWN_ACTION"
+	ErrorBadMessage              = "BAD_MESSAGE"
+	ErrorInternal                = "INTERNAL"
+	ErrorTagWrite                = "TAG_WRITE"
+	ErrorNothingToUndo           = "NOTHING_TO_UNDO"
+	ErrorNotEnabled              = "NOT_ENABLED"
+)
+
+// commandError is an error handling a Command which is reported to the client.
+type commandError struct {
+	Code    ErrorCode
+	Message string
+}
+
+// Error implements error.
+func (e *commandError) Error() string {
+	return e.Message
+}
+
+func badField(format string, args ...interface{}) error {
+	return &commandError{ErrorBadField, fmt.Sprintf(format, args...)}
+}
+
+func invalidPath(f string, err error) error {
+	return &commandError{ErrorInvalidPath, fmt.Sprintf("invalid path in '%s': %v", f, err)}
+}
+
+func unknownPlayer(key string) error {
+	return &commandError{ErrorUnknownPlayer, fmt.Sprintf("invalid player key: %v", key)}
+}
+
+// errorData is the data sent in an ERROR response.
+type errorData struct {
+	Action  string    `json:"action"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// newErrorData creates the errorData for an error returned when handling c.  Errors which
+// are not commandErrors are reported with code INTERNAL, or BAD_MESSAGE when the Command
+// could not be decoded.
+func newErrorData(c Command, err error) errorData {
+	code := ErrorCode(ErrorInternal)
+	switch err := err.(type) {
+	case *commandError:
+		code = err.Code
+	case decodeError:
+		code = ErrorBadMessage
+	}
+	return errorData{
+		Action:  c.Action,
+		Code:    code,
+		Message: err.Error(),
+	}
+}
+
 // Command is a type which is a container for data received from the websocket.
 type Command struct {
 	Action string
@@ -27,7 +102,7 @@ type Command struct {
 func (c Command) get(f string) (interface{}, error) {
 	raw, ok := c.Data[f]
 	if !ok {
-		return nil, fmt.Errorf("expected '%s' in data map", f)
+		return nil, badField("expected '%s' in data map", f)
 	}
 	return raw, nil
 }
@@ -40,7 +115,7 @@ func (c Command) getString(f string) (string, error) {
 
 	value, ok := raw.(string)
 	if !ok {
-		return "", fmt.Errorf("expected '%s' to be of type 'string', got '%T'", f, raw)
+		return "", badField("expected '%s' to be of type 'string', got '%T'", f, raw)
 	}
 	return value, nil
 }
@@ -53,7 +128,7 @@ func (c Command) getFloat(f string) (float64, error) {
 
 	value, ok := raw.(float64)
 	if !ok {
-		return 0.0, fmt.Errorf("expected '%s' to be of type 'float64', got '%T'", f, raw)
+		return 0.0, badField("expected '%s' to be of type 'float64', got '%T'", f, raw)
 	}
 	return value, nil
 }
@@ -74,18 +149,66 @@ func (c Command) getBool(f string) (bool, error) {
 
 	value, ok := raw.(bool)
 	if !ok {
-		return false, fmt.Errorf("expected '%s' to be of type 'bool', got '%T'", f, raw)
+		return false, badField("expected '%s' to be of type 'bool', got '%T'", f, raw)
+	}
+	return value, nil
+}
+
+func (c Command) getStrings(f string) ([]string, error) {
+	raw, err := c.get(f)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, badField("expected '%s' to be of type '[]interface{}', got '%T'", f, raw)
+	}
+
+	value := make([]string, len(list))
+	for i, x := range list {
+		s, ok := x.(string)
+		if !ok {
+			return nil, badField("expected '%s' to contain values of type 'string', got '%T'", f, x)
+		}
+		value[i] = s
 	}
 	return value, nil
 }
 
+func (c Command) getPaths(f string) ([]index.Path, error) {
+	raw, err := c.get(f)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, badField("expected '%s' to be of type '[]interface{}', got '%T'", f, raw)
+	}
+
+	paths := make([]index.Path, len(list))
+	for i, x := range list {
+		p, err := index.PathFromJSONInterface(x)
+		if err != nil {
+			return nil, invalidPath(f, err)
+		}
+		paths[i] = p
+	}
+	return paths, nil
+}
+
 func (c Command) getPath(f string) (index.Path, error) {
 	raw, err := c.get(f)
 	if err != nil {
 		return nil, err
 	}
 
-	return index.PathFromJSONInterface(raw)
+	p, err := index.PathFromJSONInterface(raw)
+	if err != nil {
+		return nil, invalidPath(f, err)
+	}
+	return p, nil
 }
 
 // sameSearcher is a light wrapper around a index.Searher which caches the path
@@ -93,56 +216,134 @@ func (c Command) getPath(f string) (index.Path, error) {
 // searches return the same result (and hence does not need to be re-transmitted).
 type sameSearcher struct {
 	index.Searcher
-	paths []index.Path
+
+	// rank, if non-nil, orders search results by relevance to the input.
+	rank func(input string, paths []index.Path) []index.Path
+	// limit is the maximum number of (ranked) results returned, 0 for no limit.
+	limit int
+	// grouped is true if the results are grouped by kind (see groupSearch), in which case
+	// limit applies to each group (and not to the results returned by Search).
+	grouped bool
+
+	paths []index.Path // results of the last search
+	total int          // number of matches in the last search (before the limit was applied)
 	same  bool
 }
 
 // Search implements index.Searcher.
 func (r *sameSearcher) Search(input string) []index.Path {
 	paths := r.Searcher.Search(input)
+	total := len(paths)
+	if r.rank != nil {
+		paths = r.rank(input, paths)
+	}
+	if r.limit > 0 && !r.grouped && len(paths) > r.limit {
+		paths = paths[:r.limit]
+	}
+
 	r.same = false
-	if len(r.paths) == len(paths) {
+	if len(r.paths) == len(paths) && r.total == total {
 		r.same = true
 		for i, path := range r.paths {
-			if path[1] != paths[i][1] {
+			if !path.Equal(paths[i]) {
 				r.same = false
 				break
 			}
 		}
 	}
 	r.paths = paths
+	r.total = total
 	return paths
 }
 
 const (
+	// Connection Actions
+	ActionSetFormat         = "SET_FORMAT"
+	ActionListSubscriptions = "LIST_SUBSCRIPTIONS"
+	ActionUnsubscribe       = "UNSUBSCRIBE"
+	ActionPing              = "PING"
+	ActionBatch             = "BATCH"
+
 	// Player Actions
 	ActionKey    string = "KEY"
 	ActionPlayer        = "PLAYER"
 
 	// Path Actions
-	ActionRecordPlay   = "RECORD_PLAY"
-	ActionSetFavourite = "SET_FAVOURITE"
-	ActionSetChecklist = "SET_CHECKLIST"
+	ActionRecordPlay      = "RECORD_PLAY"
+	ActionSetFavourite    = "SET_FAVOURITE"
+	ActionSetChecklist    = "SET_CHECKLIST"
+	ActionSetChecklistAll = "SET_CHECKLIST_ALL"
+	ActionSetCrossfade    = "SET_NO_CROSSFADE"
+	ActionSetRating       = "SET_RATING"
+	ActionSetBookmark     = "SET_BOOKMARK"
+	ActionUndo            = "UNDO"
 
 	// Playlist Actions
-	ActionPlaylist = "PLAYLIST"
+	ActionPlaylist          = "PLAYLIST"
+	ActionFetchPlaylistMeta = "FETCH_PLAYLIST_META"
+	ActionSetPlaylistMeta   = "SET_PLAYLIST_META"
+	ActionQueue             = "QUEUE"
+	ActionRequeueRecent     = "REQUEUE_RECENT"
+	ActionResetPlayback     = "RESET_PLAYBACK"
+
+	// Smart Playlist Actions
+	ActionSmartPlaylistFields = "SMART_PLAYLIST_FIELDS"
+	ActionSmartPlaylist       = "SMART_PLAYLIST"
+	ActionSmartPlaylists      = "SMART_PLAYLISTS"
 
 	// Cursor Actions
 	ActionCursor = "CURSOR"
 
 	// Library Actions
-	ActionCtrl          = "CTRL"
-	ActionFetch         = "FETCH"
-	ActionSearch        = "SEARCH"
-	ActionFilterList    = "FILTER_LIST"
-	ActionFilterPaths   = "FILTER_PATHS"
-	ActionFetchPathList = "FETCH_PATHLIST"
+	ActionCtrl            = "CTRL"
+	ActionFetch           = "FETCH"
+	ActionFetchBatch      = "FETCH_BATCH"
+	ActionFetchDefault    = "FETCH_DEFAULT"
+	ActionFetchRoots      = "FETCH_ROOTS"
+	ActionSetRootOrder    = "SET_ROOT_ORDER"
+	ActionSearch          = "SEARCH"
+	ActionSetSearchMode   = "SET_SEARCH_MODE"
+	ActionFilterList      = "FILTER_LIST"
+	ActionFilterPaths     = "FILTER_PATHS"
+	ActionDefineFilter    = "DEFINE_FILTER"
+	ActionFetchPathList   = "FETCH_PATHLIST"
+	ActionTrackNeighbours = "TRACK_NEIGHBOURS"
+	ActionAlbumTracks     = "ALBUM_TRACKS"
+	ActionFetchChapters   = "FETCH_CHAPTERS"
+	ActionFetchLyrics     = "FETCH_LYRICS"
+	ActionRandomAlbum     = "RANDOM_ALBUM"
+	ActionFetchPathsMeta  = "FETCH_PATHS_META"
+
+	// Auth Actions
+	ActionNotAuthorized = "NOT_AUTHORIZED"
+	ActionError         = "ERROR"
+
+	// Now Playing Actions
+	ActionNowPlayingRich = "NOW_PLAYING_RICH"
+
+	// Library Insight Actions
+	ActionGenreDistribution  = "GENRE_DISTRIBUTION"
+	ActionDecadeDistribution = "DECADE_DISTRIBUTION"
+	ActionLibraryStats       = "LIBRARY_STATS"
+	ActionStats              = "STATS"
+	ActionSimilar            = "SIMILAR"
+	ActionQualityReport      = "QUALITY_REPORT"
+	ActionListeningInsights  = "LISTENING_INSIGHTS"
+
+	// Rescan Actions
+	ActionRescanStatus   = "RESCAN_STATUS"
+	ActionRescan         = "RESCAN"
+	ActionLibraryChanged = "LIBRARY_CHANGED"
+
+	// Remote Item Actions
+	ActionRemote = "REMOTE"
 )
 
 type websocketHandlerFunc func(c Command, r *Response) error
 
 type websocketMux struct {
-	m map[string]websocketHandlerFunc
+	m    map[string]websocketHandlerFunc
+	role role
 }
 
 func (w *websocketMux) HandleFunc(a string, fn websocketHandlerFunc) {
@@ -152,43 +353,169 @@ func (w *websocketMux) HandleFunc(a string, fn websocketHandlerFunc) {
 func (w *websocketMux) Handle(c Command, r *Response) error {
 	fn, ok := w.m[c.Action]
 	if !ok {
-		return fmt.Errorf("unknown action: %v", c.Action)
+		return &commandError{ErrorUnknownAction, fmt.Sprintf("unknown action: %v", c.Action)}
+	}
+	if !w.role.Allowed(c) {
+		r.Action = ActionNotAuthorized
+		r.Data = struct {
+			Action string `json:"action"`
+			Role   string `json:"role"`
+		}{
+			Action: c.Action,
+			Role:   w.role.String(),
+		}
+		return nil
 	}
 	return fn(c, r)
 }
 
 // NewWebsocketHandler creates a websocket handler for the library, players and history.
-func NewWebsocketHandler(l Library, m *Meta, p *player.Players) http.Handler {
+func NewWebsocketHandler(libs *sharedLibrary, m *Meta, p *player.Players, media, artwork store.FileSystem) http.Handler {
+	palettes := newPaletteCache(artwork)
+	thumbs := newThumbnailCache(artwork)
+	artworkInfo := newArtworkCache(artwork)
+
+	var provider lyrics.Provider
+	if lyricsURL != "" {
+		provider = lyrics.HTTPProvider(lyricsURL)
+	}
+	lyricsInfo := newLyricsCache(media, provider)
+
+	var peaks peaksSource
+	if qualityClipping && ffmpegPath != "" {
+		peaks = newPeaksCache(media, peaksCachePath)
+	}
+	quality := newQualityCache(qualityMinBitRate, peaks)
+
+	b := newHub()
+	changes, _ := libs.Watch()
+	go func() {
+		for change := range changes {
+			quality.Reset()
+			b.broadcastChange(change, nil)
+		}
+	}()
+
+	p.SetIdleTTL(playerIdleTTL, func(key string) {
+		b.broadcast(&Response{
+			Action: ActionPlayer,
+			Data: struct {
+				Action string `json:"action"`
+				Key    string `json:"key"`
+			}{
+				Action: "EXPIRED",
+				Key:    key,
+			},
+		}, nil)
+	})
+
 	return websocket.Handler(func(ws *websocket.Conn) {
 		defer ws.Close()
 		mux := &websocketMux{
-			m: make(map[string]websocketHandlerFunc),
+			m:    make(map[string]websocketHandlerFunc),
+			role: requestRole(ws.Request()),
+		}
+
+		user, err := requestUser(ws.Request())
+		if err != nil {
+			log.Printf("rejected websocket connection: %v", err)
+			return
+		}
+		um, err := m.ForUser(user)
+		if err != nil {
+			log.Printf("error in websocket connection: %v", err)
+			return
 		}
 
+		l := libs.Get()
 		h := &websocketHandler{
-			Conn:    ws,
-			mux:     mux,
-			lib:     l,
-			meta:    m,
-			players: p,
+			Conn:     ws,
+			mux:      mux,
+			hub:      b,
+			libs:     libs,
+			lib:      l,
+			user:     user,
+			meta:     um,
+			players:  p,
+			media:    media,
+			palettes: palettes,
+			thumbs:   thumbs,
+			artwork:  artworkInfo,
+			lyrics:   lyricsInfo,
+			quality:  quality,
 			searcher: &sameSearcher{
 				Searcher: l.searcher,
 			},
+			codec:         codecs["json"],
+			subscriptions: make(map[string]func()),
+			undo:          &undoStack{limit: undoLimit},
+		}
+		q := ws.Request().URL.Query()
+		h.compress = q.Get("compress") == "gzip"
+		format := q.Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if codec, ok := newCodec(format, h.compress); ok {
+			h.codec = codec
 		}
 
+		mux.HandleFunc(ActionSetFormat, h.setFormat)
+		mux.HandleFunc(ActionListSubscriptions, h.listSubscriptions)
+		mux.HandleFunc(ActionUnsubscribe, h.unsubscribeAction)
+		mux.HandleFunc(ActionPing, func(Command, *Response) error { return nil })
+		mux.HandleFunc(ActionBatch, h.batch)
 		mux.HandleFunc(ActionKey, h.key)
 		mux.HandleFunc(ActionPlayer, h.player)
 		mux.HandleFunc(ActionRecordPlay, h.recordPlay)
 		mux.HandleFunc(ActionSetFavourite, h.setFavourite)
 		mux.HandleFunc(ActionSetChecklist, h.setChecklist)
+		mux.HandleFunc(ActionSetChecklistAll, h.setChecklistAll)
+		mux.HandleFunc(ActionSetCrossfade, h.setCrossfade)
+		mux.HandleFunc(ActionSetRating, h.setRating)
+		mux.HandleFunc(ActionSetBookmark, h.setBookmark)
+		mux.HandleFunc(ActionUndo, h.undoChange)
 		mux.HandleFunc(ActionPlaylist, h.playlist)
+		mux.HandleFunc(ActionFetchPlaylistMeta, h.fetchPlaylistMeta)
+		mux.HandleFunc(ActionSetPlaylistMeta, h.setPlaylistMeta)
+		mux.HandleFunc(ActionQueue, h.queue)
+		mux.HandleFunc(ActionRequeueRecent, h.requeueRecent)
+		mux.HandleFunc(ActionResetPlayback, h.resetPlayback)
+		mux.HandleFunc(ActionSmartPlaylistFields, h.smartPlaylistFields)
+		mux.HandleFunc(ActionSmartPlaylist, h.smartPlaylist)
+		mux.HandleFunc(ActionSmartPlaylists, h.smartPlaylists)
 		mux.HandleFunc(ActionCursor, h.cursor)
 		mux.HandleFunc(ActionFetch, h.collectionList)
+		mux.HandleFunc(ActionFetchBatch, h.fetchBatch)
+		mux.HandleFunc(ActionFetchDefault, h.defaultCollectionList)
+		mux.HandleFunc(ActionFetchRoots, h.fetchRoots)
+		mux.HandleFunc(ActionSetRootOrder, h.setRootOrder)
+		mux.HandleFunc(ActionTrackNeighbours, h.trackNeighbours)
+		mux.HandleFunc(ActionAlbumTracks, h.albumTracks)
+		mux.HandleFunc(ActionFetchChapters, h.fetchChapters)
+		mux.HandleFunc(ActionFetchLyrics, h.fetchLyrics)
+		mux.HandleFunc(ActionFetchPathsMeta, h.fetchPathsMeta)
 		mux.HandleFunc(ActionSearch, h.search)
+		mux.HandleFunc(ActionSetSearchMode, h.setSearchMode)
 		mux.HandleFunc(ActionFilterList, h.filterList)
 		mux.HandleFunc(ActionFilterPaths, h.filterPaths)
+		mux.HandleFunc(ActionDefineFilter, h.defineFilter)
 		mux.HandleFunc(ActionFetchPathList, h.fetchPathList)
-
+		mux.HandleFunc(ActionNowPlayingRich, h.nowPlayingRich)
+		mux.HandleFunc(ActionGenreDistribution, h.distribution("Genre"))
+		mux.HandleFunc(ActionDecadeDistribution, h.distribution("Decade"))
+		mux.HandleFunc(ActionLibraryStats, h.libraryStats)
+		mux.HandleFunc(ActionStats, h.libraryStats)
+		mux.HandleFunc(ActionSimilar, h.similar)
+		mux.HandleFunc(ActionRandomAlbum, h.randomAlbum)
+		mux.HandleFunc(ActionQualityReport, h.qualityReport)
+		mux.HandleFunc(ActionListeningInsights, h.listeningInsights)
+		mux.HandleFunc(ActionRescanStatus, h.rescanStatus)
+		mux.HandleFunc(ActionRescan, h.rescan)
+		mux.HandleFunc(ActionRemote, h.remote)
+
+		b.register(h)
+		defer b.unregister(h)
 		h.handle()
 	})
 }
@@ -197,21 +524,210 @@ type websocketHandler struct {
 	*websocket.Conn
 	mux      *websocketMux
 	players  *player.Players
-	lib      Library
+	hub      *hub
+	libs     *sharedLibrary
+	lib      Library         // current library, updated before each command is handled
+	ctx      context.Context // context of the current command, see handle
 	searcher *sameSearcher
-	meta     *Meta
+	user     string // user of the connection (see requestUser)
+	meta     *Meta  // metadata of the user
+	media    store.FileSystem
+	palettes *paletteCache
+	thumbs   *thumbnailCache
+	artwork  *artworkCache
+	lyrics   *lyricsCache
+	quality  *qualityCache
+
+	searchMode string // default search mode for the connection
+
+	searchMu     sync.Mutex         // protects searchGen and searchTimer
+	searchGen    int                // incremented for each SEARCH, so superseded searches can be dropped
+	searchTimer  *time.Timer        // pending (debounced) search
+	searchCancel context.CancelFunc // cancels the context of the pending (or in-flight) search
+	searchRunMu  sync.Mutex         // serialises searches, protects searcher
+
+	sendMu   sync.Mutex      // protects writes to Conn, codec and compress
+	codec    websocket.Codec // used to encode Responses and decode Commands
+	compress bool            // large Responses are gzipped (see gzipped)
+
+	// subscriptions maps subscription names to functions which end them.
+	subscriptions map[string]func()
+
+	// undo records the metadata changes made by the connection (see undoChange).
+	undo *undoStack
 
 	playerKey string
+
+	connCtx    context.Context    // cancelled when the connection is closed
+	connCancel context.CancelFunc // cancels connCtx
+}
+
+// send writes the Response to the websocket.  It is safe to call from multiple
+// goroutines.
+func (h *websocketHandler) send(resp *Response) error {
+	h.sendMu.Lock()
+	defer h.sendMu.Unlock()
+
+	if err := h.codec.Send(h.Conn, resp); err != nil {
+		return transportError{err}
+	}
+	return nil
+}
+
+// codecs is a mapping of format names to the websocket.Codec used to encode/decode
+// Responses and Commands in that format.
+var codecs = map[string]websocket.Codec{
+	"json":    decodeErrors(websocket.JSON),
+	"msgpack": decodeErrors(MsgPack),
+}
+
+// setFormat sets the format used for subsequent Responses and Commands.
+func (h *websocketHandler) setFormat(c Command, resp *Response) error {
+	format, err := c.getString("format")
+	if err != nil {
+		return err
+	}
+
+	h.sendMu.Lock()
+	defer h.sendMu.Unlock()
+
+	if _, ok := c.Data["compress"]; ok {
+		h.compress, err = c.getBool("compress")
+		if err != nil {
+			return err
+		}
+	}
+	codec, ok := newCodec(format, h.compress)
+	if !ok {
+		return badField("unsupported format: %#v", format)
+	}
+	h.codec = codec
+	return nil
+}
+
+// subscribe starts a subscription identified by name, replacing any existing subscription
+// with the same name.  The function fn is run in a new goroutine, and should return when
+// the done channel is closed.
+func (h *websocketHandler) subscribe(name string, fn func(done <-chan struct{})) {
+	h.unsubscribe(name)
+
+	done := make(chan struct{})
+	h.subscriptions[name] = func() { close(done) }
+	go fn(done)
+}
+
+// unsubscribe ends the subscription identified by name (if it exists).
+func (h *websocketHandler) unsubscribe(name string) {
+	if stop, ok := h.subscriptions[name]; ok {
+		stop()
+		delete(h.subscriptions, name)
+	}
+}
+
+// subscriptionNames returns the sorted list of active subscription names.
+func (h *websocketHandler) subscriptionNames() []string {
+	names := make([]string, 0, len(h.subscriptions))
+	for name := range h.subscriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (h *websocketHandler) listSubscriptions(c Command, resp *Response) error {
+	resp.Data = h.subscriptionNames()
+	return nil
+}
+
+// unsubscribeAction ends the subscription with the given name, and responds with the
+// remaining active subscriptions.
+func (h *websocketHandler) unsubscribeAction(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+	if _, ok := h.subscriptions[name]; !ok {
+		return badField("unknown subscription: %#v", name)
+	}
+	h.unsubscribe(name)
+	resp.Data = h.subscriptionNames()
+	return nil
+}
+
+// ping sends a websocket ping frame.  Clients (i.e. browsers) respond automatically, which
+// keeps the connection open through proxies which drop idle connections.
+func (h *websocketHandler) ping() error {
+	h.sendMu.Lock()
+	defer h.sendMu.Unlock()
+
+	h.SetWriteDeadline(time.Now().Add(wsPingInterval))
+	defer h.SetWriteDeadline(time.Time{})
+
+	payloadType := h.PayloadType
+	h.PayloadType = websocket.PingFrame
+	_, err := h.Write(nil)
+	h.PayloadType = payloadType
+	return err
+}
+
+// keepalive sends ping frames every wsPingInterval until done is closed.  If a ping cannot
+// be sent then the connection is closed.
+func (h *websocketHandler) keepalive(done <-chan struct{}) {
+	t := time.NewTicker(wsPingInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		if err := h.ping(); err != nil {
+			log.Printf("error sending ping: %v", err)
+			h.connCancel()
+			h.Close()
+			return
+		}
+	}
 }
 
+// handle receives and handles Commands until the connection is closed.  Each Command is
+// handled with its own context (see websocketHandler.ctx), which is cancelled when the
+// Command has been handled, or when the connection is closed (so that in-flight work is
+// abandoned).
 func (h *websocketHandler) handle() {
+	h.connCtx, h.connCancel = context.WithCancel(context.Background())
+	defer h.connCancel()
+
 	defer h.players.Remove(h.playerKey)
+	defer h.cancelSearch()
+	defer h.undo.clear()
+
+	if wsPingInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go h.keepalive(done)
+	}
+	defer func() {
+		for name := range h.subscriptions {
+			h.unsubscribe(name)
+		}
+	}()
 
 	var err error
 	for {
 		var c Command
-		err = websocket.JSON.Receive(h.Conn, &c)
+		if wsIdleTimeout > 0 {
+			h.SetReadDeadline(time.Now().Add(wsIdleTimeout))
+		}
+		err = h.codec.Receive(h.Conn, &c)
 		if err != nil {
+			if _, ok := err.(decodeError); ok {
+				err = h.sendError(c, err)
+				if err == nil {
+					continue
+				}
+			}
 			if err != io.EOF {
 				err = fmt.Errorf("receive: %v", err)
 			}
@@ -221,28 +737,94 @@ func (h *websocketHandler) handle() {
 		resp := &Response{
 			Action: c.Action,
 		}
+		h.lib = h.libs.Get()
+		var cancel context.CancelFunc
+		h.ctx, cancel = context.WithCancel(h.connCtx)
 		err = h.mux.Handle(c, resp)
+		cancel()
 		if err != nil {
-			break
+			if isTransportError(err) {
+				break
+			}
+			if err == context.Canceled {
+				// The connection is being closed, so there is no one to respond to.
+				continue
+			}
+			err = h.sendError(c, err)
+			if err != nil {
+				break
+			}
+			continue
 		}
 		if resp.Data == nil {
 			continue
 		}
 
-		err = websocket.JSON.Send(h.Conn, resp)
+		err = h.send(resp)
 		if err != nil {
-			if err != io.EOF {
-				err = fmt.Errorf("send: %v", err)
-			}
 			break
 		}
 	}
 
+	if te, ok := err.(transportError); ok {
+		err = te.error
+		if err != io.EOF {
+			err = fmt.Errorf("send: %v", err)
+		}
+	}
 	if err != nil && err != io.EOF {
 		log.Printf("socket error: %v", err)
 	}
 }
 
+// decodeError is an error returned when a received message could not be decoded.  The
+// message has been consumed, so the connection can still be used.
+type decodeError struct {
+	error
+}
+
+// decodeErrors wraps the websocket.Codec so that errors decoding messages are returned as
+// decodeErrors.
+func decodeErrors(c websocket.Codec) websocket.Codec {
+	return websocket.Codec{
+		Marshal: c.Marshal,
+		Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+			err := c.Unmarshal(data, payloadType, v)
+			if err != nil {
+				return decodeError{err}
+			}
+			return nil
+		},
+	}
+}
+
+// transportError is an error writing to the websocket connection, after which the connection
+// should be closed.
+type transportError struct {
+	error
+}
+
+// isTransportError returns true if the error was caused by a failure of the underlying
+// connection (rather than a problem with a Command, including network errors from requests
+// made while handling it), and so the connection should be closed.
+func isTransportError(err error) bool {
+	_, ok := err.(transportError)
+	return ok
+}
+
+// sendError reports an error handling the Command to the client.
+func (h *websocketHandler) sendError(c Command, err error) error {
+	return h.send(newErrorResponse(c, err))
+}
+
+// newErrorResponse creates the ERROR response for an error returned when handling c.
+func newErrorResponse(c Command, err error) *Response {
+	return &Response{
+		Action: ActionError,
+		Data:   newErrorData(c, err),
+	}
+}
+
 // Response is a type which represnets a response to a Websocket Command.
 type Response struct {
 	Action string      `json:"action"`
@@ -256,7 +838,7 @@ func (h *websocketHandler) player(c Command, resp *Response) error {
 	}
 
 	if action == "LIST" {
-		resp.Data = h.players.List()
+		resp.Data = h.playerStates()
 		return nil
 	}
 
@@ -265,113 +847,591 @@ func (h *websocketHandler) player(c Command, resp *Response) error {
 		return err
 	}
 
+	if action == "REPORT_STATUS" {
+		return h.reportStatus(key, c)
+	}
+
+	switch action {
+	case "GROUP":
+		keys, err := c.getStrings("keys")
+		if err != nil {
+			return err
+		}
+		if _, err := h.players.Group(key, keys); err != nil {
+			return err
+		}
+		return h.room(key, resp)
+
+	case "UNGROUP":
+		if err := h.players.Ungroup(key); err != nil {
+			return err
+		}
+		return h.room(key, resp)
+
+	case "SLEEP_TIMER":
+		return h.sleepTimer(key, c, resp)
+
+	case "SUBSCRIBE":
+		return h.subscribePlayerStatus(key, c, resp)
+
+	case "UNSUBSCRIBE":
+		h.unsubscribe(playerStatusSubscription(key))
+		return nil
+	}
+
 	p := h.players.Get(key)
 	if p == nil {
-		return fmt.Errorf("invalid player key: %v", key)
+		return unknownPlayer(key)
+	}
+	h.players.Touch(key)
+
+	if action == "RESUME" {
+		return h.resume(key, p, resp)
+	}
+
+	if action == player.RepActions[player.ActionToggleMute] || player.Action(action) == player.ActionToggleMute {
+		return h.toggleMute(key, resp)
 	}
 
 	r := player.RepAction{
 		Action: action,
 		Value:  c.Data["value"],
 	}
-	return r.Apply(p)
-}
-
-func (h *websocketHandler) key(c Command, resp *Response) error {
-	key, err := c.getString("key")
+	a, ok := player.RepActionToAction(action)
+	if player.Action(action) == player.ActionSeek || ok && a == player.ActionSeek {
+		mode, _ := c.getString("mode")
+		r.Mode = player.SeekMode(mode)
+		r.Position = h.position(key)
+	}
+	setVolume := player.Action(action) == player.ActionSetVolume || ok && a == player.ActionSetVolume
+	if setVolume {
+		if _, ok := c.Data["fadeMs"]; ok {
+			r.FadeMs, err = c.getInt("fadeMs")
+			if err != nil {
+				return err
+			}
+		}
+		r.Pause, _ = c.getBool("pause")
+	}
+	err = r.Apply(p)
 	if err != nil {
 		return err
 	}
 
-	h.players.Remove(h.playerKey)
-	if key != "" {
-		h.players.Add(player.Validated(WebsocketPlayer(key, h.Conn)))
+	if v, ok := r.Value.(float64); setVolume && ok && !r.Pause {
+		// Fades which pause restore the volume afterwards, so only the volume of other
+		// changes is remembered for unmuting.
+		h.players.SetVolumeState(key, v)
 	}
-	h.playerKey = key
-	return nil
-}
 
-func (h *websocketHandler) recordPlay(c Command, resp *Response) error {
-	p, err := c.getPath("path")
-	if err != nil {
-		return err
+	if player.Action(action) == player.ActionStop || ok && a == player.ActionStop {
+		// Stopping unloads the track, so the now-playing state is reset (including that of the
+		// members of a room).  Setting the status notifies watchers (i.e. status subscriptions),
+		// and other connections are sent the new status.
+		st := player.Status{}
+		for _, k := range append(h.players.Members(key), key) {
+			h.players.SetStatus(k, st)
+		}
+		if ps, ok := h.playerStatus(key); ok {
+			h.hub.broadcast(&Response{
+				Action: ActionPlayer,
+				Data:   playerStatusResponse(ps),
+			}, h)
+		}
+		resp.Data = struct {
+			Key    string        `json:"key"`
+			Status player.Status `json:"status"`
+		}{
+			Key:    key,
+			Status: st,
+		}
 	}
-	return h.meta.history.Add(p)
+	return nil
 }
 
-func (h *websocketHandler) setFavourite(c Command, resp *Response) error {
-	p, err := c.getPath("path")
+// sleepTimer schedules the player with the given key to pause after the number of seconds
+// in the value field (0 cancels the timer).  All connected handlers are notified when the
+// timer fires.
+func (h *websocketHandler) sleepTimer(key string, c Command, resp *Response) error {
+	secs, err := c.getFloat("value")
 	if err != nil {
 		return err
 	}
-	value, err := c.getBool("value")
-	if err != nil {
-		return err
+	if secs < 0 {
+		return badField("invalid value in 'value': sleep timer must be non-negative")
+	}
+	if h.players.Get(key) == nil {
+		return unknownPlayer(key)
 	}
-	return h.meta.favourites.Set(p, value)
-}
 
-func (h *websocketHandler) setChecklist(c Command, resp *Response) error {
-	p, err := c.getPath("path")
+	hub := h.hub
+	err = h.players.SetSleepTimer(key, time.Duration(secs*float64(time.Second)), func(err error) {
+		if err != nil {
+			log.Printf("error pausing player %#v for sleep timer: %v", key, err)
+			return
+		}
+		hub.broadcast(&Response{
+			Action: ActionPlayer,
+			Data: struct {
+				Action string `json:"action"`
+				Key    string `json:"key"`
+			}{
+				Action: "SLEEP_TIMER_TRIGGERED",
+				Key:    key,
+			},
+		}, nil)
+	})
 	if err != nil {
 		return err
 	}
-	value, err := c.getBool("value")
-	if err != nil {
-		return err
+
+	resp.Data = struct {
+		Key     string  `json:"key"`
+		Seconds float64 `json:"seconds"`
+	}{
+		Key:     key,
+		Seconds: secs,
 	}
-	return h.meta.checklist.Set(p, value)
+	return nil
 }
 
-func (h *websocketHandler) cursor(c Command, resp *Response) error {
-	name, err := c.getString("name")
-	if err != nil {
-		return err
+// resume seeks the player to the bookmarked position of its loaded track.
+func (h *websocketHandler) resume(key string, p player.Player, resp *Response) error {
+	id := h.players.Status(key).TrackID
+	if id == "" {
+		return badField("player %v has no track loaded", key)
 	}
-
-	action, err := c.getString("action")
-	if err != nil {
+	pos := h.meta.bookmarks.Bookmark(id)
+	if pos == 0 {
+		return badField("no bookmark for track: %v", id)
+	}
+	if err := p.SetTime(pos); err != nil {
 		return err
 	}
 
-	if action != "FETCH" {
-		path, _ := c.getPath("path")
-		index, _ := c.getInt("index")
-
-		ra := cursor.RepAction{
-			Name:   name,
-			Action: cursor.Action(action),
-			Path:   path,
-			Index:  index,
-		}
-
-		root := &rootCollection{h.lib.collections["Root"]}
-		err = ra.Apply(h.meta.cursors, h.meta.playlists, root)
-		if err != nil {
-			return err
-		}
+	resp.Data = struct {
+		Key  string  `json:"key"`
+		Time float64 `json:"time"`
+	}{
+		Key:  key,
+		Time: pos,
 	}
-
-	resp.Data = h.meta.cursors.Get(name)
 	return nil
 }
 
-func (h *websocketHandler) playlist(c Command, resp *Response) error {
-	name, err := c.getString("name")
+// toggleMute mutes (or unmutes) the player with the given key, restoring its previous volume
+// when unmuting (see player.Players.ToggleMute).
+func (h *websocketHandler) toggleMute(key string, resp *Response) error {
+	muted, err := h.players.ToggleMute(key)
 	if err != nil {
 		return err
 	}
 
-	action, err := c.getString("action")
-	if err != nil {
+	resp.Data = struct {
+		Key   string `json:"key"`
+		Muted bool   `json:"muted"`
+	}{
+		Key:   key,
+		Muted: muted,
+	}
+	return nil
+}
+
+// room responds with the members of the room with the given key (empty if the room has
+// been removed).
+func (h *websocketHandler) room(key string, resp *Response) error {
+	members := h.players.Members(key)
+	if members == nil {
+		members = []string{}
+	}
+	resp.Data = struct {
+		Key     string   `json:"key"`
+		Members []string `json:"members"`
+	}{
+		Key:     key,
+		Members: members,
+	}
+	return nil
+}
+
+// position returns the play position of the player with the given key, using the last
+// reported status (accounting for the time elapsed since, see Players.State) and the
+// duration of the loaded track from the library.
+func (h *websocketHandler) position(key string) *player.Position {
+	state, _ := h.players.State(key)
+	st := state.Status
+	pos := &player.Position{
+		Time: st.Time,
+	}
+	if t, ok := h.lib.Track(st.TrackID); ok {
+		pos.Duration = float64(t.GetInt("TotalTime")) / 1000
+	}
+	return pos
+}
+
+func (h *websocketHandler) key(c Command, resp *Response) error {
+	key, err := c.getString("key")
+	if err != nil {
+		return err
+	}
+
+	h.players.Remove(h.playerKey)
+	h.playerKey = ""
+	if key != "" {
+		if err := h.players.AddExpiring(player.Validated(WebsocketPlayer(key, h.send))); err != nil {
+			return badField("invalid key: %v", err)
+		}
+	}
+	h.playerKey = key
+	return nil
+}
+
+// recordPlay records a play of the track identified by the path in the play history and play
+// counts.  Plays of tracks which were skipped before the play threshold (see playThreshold
+// and playedTime) are not recorded.  The response includes whether the play was recorded.
+func (h *websocketHandler) recordPlay(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+
+	t, ok := h.trackForPlay(p)
+	if ok {
+		played, known, err := h.playedTime(c, t)
+		if err != nil {
+			return err
+		}
+		pt := playThreshold{Fraction: playThresholdFraction, Duration: playThresholdDuration}
+		if known && !pt.Met(played, float64(t.GetInt("TotalTime"))/1000) {
+			setRecordPlayResponse(resp, p, false)
+			return nil
+		}
+	}
+
+	err = h.meta.history.Add(p)
+	if err != nil {
+		return err
+	}
+	h.meta.insights.Invalidate()
+
+	if ok {
+		h.meta.scrobbler.Played(h.playerKey, t)
+		// The track has finished, so playback shouldn't resume from its bookmark.
+		if err := h.meta.bookmarks.Clear(t.GetString("ID")); err != nil {
+			return err
+		}
+		if err := h.meta.playCounts.Increment(index.Path{"T", index.Key(t.GetString("ID"))}); err != nil {
+			return err
+		}
+		h.lib.searchRanks.InvalidatePlays()
+	}
+	setRecordPlayResponse(resp, p, true)
+	return nil
+}
+
+func setRecordPlayResponse(resp *Response, p index.Path, recorded bool) {
+	resp.Data = struct {
+		Path     index.Path `json:"path"`
+		Recorded bool       `json:"recorded"`
+	}{
+		Path:     p,
+		Recorded: recorded,
+	}
+}
+
+// setBookmark sets the bookmarked position (in seconds) of the track identified by the
+// path, a position of 0 removes the bookmark.
+func (h *websocketHandler) setBookmark(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	pos, err := c.getFloat("position")
+	if err != nil {
+		return err
+	}
+	if pos < 0 {
+		return badField("invalid position: %v (must not be negative)", pos)
+	}
+	t, ok := h.trackForPlay(p)
+	if !ok {
+		return invalidPath("path", fmt.Errorf("not a track: %v", p))
+	}
+	id := t.GetString("ID")
+	if pos == 0 {
+		return h.meta.bookmarks.Clear(id)
+	}
+	return h.meta.bookmarks.Set(bookmarkPath(id), pos)
+}
+
+// trackForPlay returns the track identified by a path sent in RECORD_PLAY, either a
+// ["T", <track id>] path or a path into the Root collection.
+func (h *websocketHandler) trackForPlay(p index.Path) (index.Track, bool) {
+	if len(p) == 2 && p[0] == "T" {
+		return h.lib.Track(string(p[1]))
+	}
+	t, err := h.lib.TrackFromPath(p)
+	return t, err == nil
+}
+
+func (h *websocketHandler) setFavourite(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	value, err := c.getBool("value")
+	if err != nil {
+		return err
+	}
+	prev := h.meta.favourites.Get(p)
+	err = h.meta.favourites.Set(p, value)
+	if err != nil {
+		return err
+	}
+	h.record(ActionSetFavourite, p, prev, value)
+	h.hub.broadcastChange(libraryChange{Reason: changeFavourite, Path: p}, h)
+	return h.writeFavouriteTags(p, value)
+}
+
+func (h *websocketHandler) setChecklist(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	value, err := c.getBool("value")
+	if err != nil {
+		return err
+	}
+	prev := h.meta.checklist.Get(p)
+	err = h.meta.checklist.Set(p, value)
+	if err != nil {
+		return err
+	}
+	h.record(ActionSetChecklist, p, prev, value)
+	h.hub.broadcastChange(libraryChange{Reason: changeChecklist, Path: p}, h)
+	return nil
+}
+
+// setChecklistAll sets the checklist state of every track in the group identified by the
+// path.  A single change is broadcast for the whole group.
+func (h *websocketHandler) setChecklistAll(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	value, err := c.getBool("value")
+	if err != nil {
+		return err
+	}
+
+	g, _, err := h.lib.Fetch(h.ctx, p)
+	if err != nil {
+		return invalidPath("path", err)
+	}
+
+	paths := leafPaths(g, p)
+	if err := h.meta.checklist.SetAll(paths, value); err != nil {
+		return err
+	}
+	h.hub.broadcastChange(libraryChange{Reason: changeChecklist, Path: p}, h)
+
+	resp.Data = struct {
+		Path  index.Path `json:"path"`
+		Count int        `json:"count"`
+	}{
+		Path:  p,
+		Count: len(paths),
+	}
+	return nil
+}
+
+// leafPaths returns the paths of all the tracks in the Group (with path p).
+func leafPaths(g index.Group, p index.Path) []index.Path {
+	c, ok := g.(index.Collection)
+	if !ok {
+		paths := make([]index.Path, len(g.Tracks()))
+		for i := range paths {
+			paths[i] = make(index.Path, len(p)+1)
+			copy(paths[i], p)
+			paths[i][len(p)] = index.Key(strconv.Itoa(i))
+		}
+		return paths
+	}
+
+	var paths []index.Path
+	for _, cp := range index.CollectionPaths(c, p) {
+		paths = append(paths, leafPaths(c.Get(cp[len(cp)-1]), cp)...)
+	}
+	return paths
+}
+
+func (h *websocketHandler) setCrossfade(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	value, err := c.getBool("value")
+	if err != nil {
+		return err
+	}
+	return h.meta.crossfade.Set(p, value)
+}
+
+// setRating sets the rating (between 1 and 5) of the path, a value of 0 removes the rating.
+func (h *websocketHandler) setRating(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	value, err := c.getInt("value")
+	if err != nil {
+		return err
+	}
+	if value < 0 || !rating.Value(value).IsValid() {
+		return badField("invalid rating value: %d (must be between 0 and 5)", value)
+	}
+	prev := int(h.meta.ratings.Get(p))
+	if err := h.meta.ratings.Set(p, rating.Value(value)); err != nil {
+		return err
+	}
+	h.record(ActionSetRating, p, prev, value)
+	h.hub.broadcastChange(libraryChange{Reason: changeRating, Path: p}, h)
+	return h.writeRatingTags(p, value)
+}
+
+func (h *websocketHandler) cursor(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+
+	action, err := c.getString("action")
+	if err != nil {
 		return err
 	}
 
+	if action == "DELETE" {
+		return h.deleteCursor(name, resp)
+	}
+
 	if action != "FETCH" {
-		path, err := c.getPath("path")
+		path, _ := c.getPath("path")
+		index, _ := c.getInt("index")
+
+		ra := cursor.RepAction{
+			Name:   name,
+			Action: cursor.Action(action),
+			Path:   path,
+			Index:  index,
+		}
+		if action == "SHUFFLE" {
+			ra.Seed = shuffleSeed(c)
+		}
+		if action == "SET_AND_PLAY" {
+			ra.Paths, err = c.getPaths("paths")
+			if err != nil {
+				return err
+			}
+		}
+
+		root := &rootCollection{h.lib.collections["Root"]}
+		h.meta.playback.Lock()
+		err = ra.Apply(h.meta.cursors, h.meta.playlists, root)
+		h.meta.playback.Unlock()
 		if err != nil {
 			return err
 		}
+		if action == "SET_AND_PLAY" {
+			h.hub.broadcastChange(libraryChange{Reason: changePlaylist, Name: name}, h)
+		}
+	}
+
+	resp.Data = h.cursorResponse(name)
+	return nil
+}
+
+// cursorResponse is the representation of a Cursor sent to clients.
+type cursorResponse struct {
+	*cursor.Cursor
+
+	// NoCrossfade is true if crossfade (and gapless) transitions are disabled for the current
+	// or next track (see crossfade.Store), so the transition between them should be played
+	// without fading or preloading.
+	NoCrossfade bool `json:"noCrossfade,omitempty"`
+}
+
+// cursorResponse returns the representation of the cursor with the given name, or nil if
+// there is no such cursor.
+func (h *websocketHandler) cursorResponse(name string) *cursorResponse {
+	c := h.meta.cursors.Get(name)
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	current, next := c.Current, c.Next
+	c.Unlock()
+
+	r := &cursorResponse{Cursor: c}
+	for _, p := range []cursor.Position{current, next} {
+		if !p.Empty() && h.meta.crossfade.Get(p.Path) {
+			r.NoCrossfade = true
+		}
+	}
+	return r
+}
+
+// deleteCursor removes the cursor with the given name (i.e. when a client closes its view of
+// the playlist), the playlist is kept.  The response confirms the deletion, and reports
+// whether the cursor existed.
+func (h *websocketHandler) deleteCursor(name string, resp *Response) error {
+	ra := cursor.RepAction{
+		Name:   name,
+		Action: "DELETE",
+	}
+
+	h.meta.playback.Lock()
+	existed := h.meta.cursors.Get(name) != nil
+	err := ra.Apply(h.meta.cursors, h.meta.playlists, &rootCollection{h.lib.collections["Root"]})
+	h.meta.playback.Unlock()
+	if err != nil {
+		return err
+	}
+
+	resp.Data = struct {
+		Name    string `json:"name"`
+		Deleted bool   `json:"deleted"`
+	}{
+		Name:    name,
+		Deleted: existed,
+	}
+	return nil
+}
+
+// shuffleSeed returns the seed given in the Command, or a new seed if none is given.  New
+// seeds fit within the integer range of a float64 so that clients can send them back.
+func shuffleSeed(c Command) int64 {
+	if f, err := c.getFloat("seed"); err == nil {
+		return int64(f)
+	}
+	return time.Now().UnixNano() & (1<<53 - 1)
+}
+
+func (h *websocketHandler) playlist(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+
+	action, err := c.getString("action")
+	if err != nil {
+		return err
+	}
+
+	if action != "FETCH" {
+		path, err := c.getPath("path")
+		if err != nil && action != "DELETE" && action != "MOVE" && action != "RENAME" {
+			return err
+		}
 		index, _ := c.getInt("index")
 
 		ra := playlist.RepAction{
@@ -380,64 +1440,588 @@ func (h *websocketHandler) playlist(c Command, resp *Response) error {
 			Path:   path,
 			Index:  index,
 		}
+		switch action {
+		case "MOVE":
+			ra.To, err = c.getInt("to")
+			if err != nil {
+				return err
+			}
+		case "RENAME":
+			ra.NewName, err = c.getString("newName")
+			if err != nil {
+				return err
+			}
+		}
 
+		h.meta.playback.Lock()
 		err = ra.Apply(h.meta.playlists)
+		if err == nil {
+			err = h.playlistCursorChanged(action, ra)
+		}
+		h.meta.playback.Unlock()
 		if err != nil {
 			return err
 		}
+		h.hub.broadcastChange(libraryChange{Reason: changePlaylist, Name: name}, h)
+		switch action {
+		case "DELETE":
+			return nil
+		case "RENAME":
+			h.hub.broadcastChange(libraryChange{Reason: changePlaylist, Name: ra.NewName}, h)
+			name = ra.NewName
+		}
 	}
 
 	resp.Data = h.meta.playlists.Get(name)
 	return nil
 }
 
+// playlistCursorChanged updates the cursor of the playlist after the RepAction (with the
+// given action) has been applied.  Moving items keeps the cursor on the same track (rather than index), and the
+// cursor follows the playlist when it is renamed or is removed along with it.  Must be
+// called with the playback lock held.
+func (h *websocketHandler) playlistCursorChanged(action string, ra playlist.RepAction) error {
+	cur := h.meta.cursors.Get(ra.Name)
+	if cur == nil {
+		return nil
+	}
+
+	switch action {
+	case "MOVE":
+		cur.ItemMoved(ra.Index, ra.To)
+		return h.meta.cursors.Set(ra.Name, cur)
+
+	case "DELETE":
+		return h.meta.cursors.Delete(ra.Name)
+
+	case "RENAME":
+		if err := h.meta.cursors.Set(ra.NewName, cur); err != nil {
+			return err
+		}
+		return h.meta.cursors.Delete(ra.Name)
+	}
+	return nil
+}
+
+// queue inserts a path into the queue of a player, the playlist named by the player key.
+// If the index is omitted, or is past the end of the queue, then the path is appended.  The
+// cursor of the queue is updated so that it stays on the same track.
+func (h *websocketHandler) queue(c Command, resp *Response) error {
+	key, err := c.getString("key")
+	if err != nil {
+		return err
+	}
+
+	if h.players.Get(key) == nil {
+		return unknownPlayer(key)
+	}
+
+	path, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+
+	h.meta.playback.Lock()
+	defer h.meta.playback.Unlock()
+
+	p := h.meta.playlists.Get(key)
+	if p == nil {
+		p = &playlist.Playlist{}
+	}
+
+	n := len(p.Items())
+	if _, ok := c.Data["index"]; ok {
+		n, err = c.getInt("index")
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			n = 0
+		}
+	}
+	p.Insert(n, path)
+
+	err = h.meta.playlists.Set(key, p)
+	if err != nil {
+		return err
+	}
+
+	// Inserting is the same as appending the item and then moving it into place.
+	if last := len(p.Items()) - 1; n < last {
+		if cur := h.meta.cursors.Get(key); cur != nil {
+			cur.ItemMoved(last, n)
+			if err := h.meta.cursors.Set(key, cur); err != nil {
+				return err
+			}
+		}
+	}
+
+	resp.Data = struct {
+		Key      string             `json:"key"`
+		Playlist *playlist.Playlist `json:"playlist"`
+	}{
+		Key:      key,
+		Playlist: p,
+	}
+	return nil
+}
+
+type playlistMeta struct {
+	Name string `json:"name"`
+	playlist.Meta
+}
+
+// fetchPlaylistMeta responds with the description and cover of the named playlist.
+func (h *websocketHandler) fetchPlaylistMeta(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+
+	p := h.meta.playlists.Get(name)
+	if p == nil {
+		return badField("invalid playlist name: '%v'", name)
+	}
+
+	resp.Data = playlistMeta{
+		Name: name,
+		Meta: p.Meta(),
+	}
+	return nil
+}
+
+// setPlaylistMeta sets the description and cover of the named playlist.  Fields which are
+// omitted from the command are cleared.
+func (h *websocketHandler) setPlaylistMeta(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+	description, _ := c.getString("description")
+	cover, _ := c.getString("cover")
+
+	h.meta.playback.Lock()
+	defer h.meta.playback.Unlock()
+
+	p := h.meta.playlists.Get(name)
+	if p == nil {
+		return badField("invalid playlist name: '%v'", name)
+	}
+
+	m := playlist.Meta{
+		Description: description,
+		Cover:       cover,
+	}
+	p.SetMeta(m)
+	err = h.meta.playlists.Set(name, p)
+	if err != nil {
+		return err
+	}
+	h.hub.broadcastChange(libraryChange{Reason: changePlaylist, Name: name}, h)
+
+	resp.Data = playlistMeta{
+		Name: name,
+		Meta: m,
+	}
+	return nil
+}
+
+// resetPlayback replaces the contents of a playlist with a single path and moves its cursor to
+// the first track of the path in one step.  If a player key is given then the player is sent
+// the play action.
+func (h *websocketHandler) resetPlayback(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+
+	path, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+
+	var first index.Path
+	err = h.lib.Walk(h.ctx, path, func(t index.Track, p index.Path) error {
+		if first == nil {
+			first = p
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if first == nil {
+		return invalidPath("path", fmt.Errorf("no tracks in path: %v", path))
+	}
+
+	p := &playlist.Playlist{}
+	p.Add(path)
+	cur := cursor.NewCursor(p, &rootCollection{h.lib.collections["Root"]})
+	cur.Set(0, first)
+
+	h.meta.playback.Lock()
+	err = h.meta.playlists.Set(name, p)
+	if err == nil {
+		err = h.meta.cursors.Set(name, cur)
+	}
+	h.meta.playback.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if key, _ := c.getString("key"); key != "" {
+		pl := h.players.Get(key)
+		if pl == nil {
+			return unknownPlayer(key)
+		}
+		err = pl.Do(player.ActionPlay)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp.Data = struct {
+		Name     string             `json:"name"`
+		Playlist *playlist.Playlist `json:"playlist"`
+		Cursor   *cursor.Cursor     `json:"cursor"`
+	}{
+		Name:     name,
+		Playlist: p,
+		Cursor:   cur,
+	}
+	return nil
+}
+
+// requeueRecent adds the most recently played tracks (in the order they were played) to the
+// end of a playlist.  If the playlist has no existing cursor then one is created pointing at
+// the first requeued track.
+func (h *websocketHandler) requeueRecent(c Command, resp *Response) error {
+	name, err := c.getString("name")
+	if err != nil {
+		return err
+	}
+
+	n, err := c.getInt("count")
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return badField("invalid count: %d", n)
+	}
+	dedup, _ := c.getBool("dedup")
+
+	var paths []index.Path
+	var last index.Path
+	for _, e := range h.meta.history.Recent(-1) {
+		if len(paths) == n {
+			break
+		}
+		// Plays are recorded using track ID paths, which playlists cannot resolve.
+		p, ok := h.lib.RootPath(e.Path)
+		if !ok {
+			continue
+		}
+		if dedup && p.Equal(last) {
+			continue
+		}
+		paths = append(paths, p)
+		last = p
+	}
+
+	h.meta.playback.Lock()
+	defer h.meta.playback.Unlock()
+
+	p := h.meta.playlists.Get(name)
+	if p == nil {
+		p = &playlist.Playlist{}
+	}
+	start := len(p.Items())
+	for i := len(paths) - 1; i >= 0; i-- {
+		p.Add(paths[i])
+	}
+	err = h.meta.playlists.Set(name, p)
+	if err != nil {
+		return err
+	}
+
+	if len(paths) > 0 {
+		if cur := h.meta.cursors.Get(name); cur == nil || cur.Current.Empty() {
+			root := &rootCollection{h.lib.collections["Root"]}
+			cur = cursor.NewCursor(p, root)
+			cur.Set(start, paths[len(paths)-1])
+			err = h.meta.cursors.Set(name, cur)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	resp.Data = struct {
+		Name     string             `json:"name"`
+		Playlist *playlist.Playlist `json:"playlist"`
+		Cursor   *cursorResponse    `json:"cursor"`
+	}{
+		Name:     name,
+		Playlist: p,
+		Cursor:   h.cursorResponse(name),
+	}
+	return nil
+}
+
+// smartPlaylistFields responds with the fields (and operators for each field type) which can be
+// used in smart playlist rules.
+func (h *websocketHandler) smartPlaylistFields(c Command, resp *Response) error {
+	resp.Data = struct {
+		Fields    []smart.Field                   `json:"fields"`
+		Operators map[smart.Type][]smart.Operator `json:"operators"`
+	}{
+		Fields:    smart.Fields,
+		Operators: smart.Operators,
+	}
+	return nil
+}
+
 func (h *websocketHandler) collectionList(c Command, resp *Response) error {
 	p, err := c.getPath("path")
 	if err != nil {
 		return err
 	}
+	return h.fetch(p, c, resp)
+}
+
+// defaultCollectionList responds with the default collection, so that clients do not need to
+// know its key.
+func (h *websocketHandler) defaultCollectionList(c Command, resp *Response) error {
+	return h.fetch(index.Path{index.Key(defaultCollection)}, c, resp)
+}
+
+// fetchRoots responds with the names of the top-level collections, in the preferred order.
+func (h *websocketHandler) fetchRoots(c Command, resp *Response) error {
+	names := make([]string, 0, len(h.lib.collections))
+	for k := range h.lib.collections {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	resp.Data = struct {
+		Default string   `json:"default"`
+		Roots   []string `json:"roots"`
+	}{
+		Default: defaultCollection,
+		Roots:   rootorder.Apply(names, h.meta.rootOrder.Get()),
+	}
+	return nil
+}
+
+func (h *websocketHandler) setRootOrder(c Command, resp *Response) error {
+	order, err := c.getStrings("order")
+	if err != nil {
+		return err
+	}
+	if err := h.meta.rootOrder.Set(order); err != nil {
+		return err
+	}
+	return h.fetchRoots(c, resp)
+}
+
+// collection is the representation of a fetched Group.
+type collection struct {
+	Path          index.Path `json:"path"`
+	Item          *Group     `json:"item"`
+	TotalTracks   int        `json:"totalTracks"`
+	TotalDuration float64    `json:"totalDuration"`
+
+	// Offset and Total are set for range fetches: Item only includes the groups (or tracks)
+	// from Offset, and Total is the number in the full collection.
+	Offset int `json:"offset,omitempty"`
+	Total  int `json:"total,omitempty"`
+}
+
+// fetchCollection fetches the Group identified by the Path from the library, annotated
+// with meta information.
+func fetchCollection(ctx context.Context, l *Library, m *Meta, p index.Path) (*collection, error) {
+	return fetchCollectionRange(ctx, l, m, p, 0, -1)
+}
+
+// fetchCollectionRange is like fetchCollection, but only includes the range of groups (or
+// tracks) given by offset and limit.  A negative limit fetches the full collection.
+func fetchCollectionRange(ctx context.Context, l *Library, m *Meta, p index.Path, offset, limit int) (*collection, error) {
+	g, k, err := l.Fetch(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	totals := l.totals.Get(p, g)
+
+	col := &collection{
+		Path:          p,
+		TotalTracks:   totals.Tracks,
+		TotalDuration: totals.Duration,
+	}
+	if limit >= 0 || offset > 0 {
+		g, col.Total = slice(g, offset, limit)
+		col.Offset = offset
+	}
+	col.Item = &Group{
+		Group:     m.Annotate(p, g),
+		Key:       k,
+		PlayCount: m.PlayCount,
+		Bookmark:  m.bookmarks.Bookmark,
+	}
+	return col, nil
+}
+
+// fetchRange returns the (optional) offset and limit fields of the Command.  The limit is
+// -1 if it is not set.
+func fetchRange(c Command) (offset, limit int, err error) {
+	limit = -1
+	if _, ok := c.Data["offset"]; ok {
+		offset, err = c.getInt("offset")
+		if err != nil {
+			return
+		}
+		if offset < 0 {
+			err = badField("invalid offset: %d (must not be negative)", offset)
+			return
+		}
+	}
+	if _, ok := c.Data["limit"]; ok {
+		limit, err = c.getInt("limit")
+		if err != nil {
+			return
+		}
+		if limit < 0 {
+			err = badField("invalid limit: %d (must not be negative)", limit)
+			return
+		}
+	}
+	return
+}
+
+func (h *websocketHandler) fetch(p index.Path, c Command, resp *Response) error {
+	offset, limit, err := fetchRange(c)
+	if err != nil {
+		return err
+	}
+	col, err := fetchCollectionRange(h.ctx, &h.lib, h.meta, p, offset, limit)
+	if err != nil {
+		return err
+	}
+	h.withImages(col, c)
+	resp.Data = col
+	return nil
+}
+
+// withImages sets the image fields requested by the Command ("thumb" for inline thumbnails
+// and "artwork" for artwork URLs) to be included in the collection.
+func (h *websocketHandler) withImages(col *collection, c Command) {
+	if thumb, _ := c.getBool("thumb"); thumb {
+		// The collection is encoded after the command context is cancelled, so tie thumbnail
+		// generation to the connection.
+		ctx := h.connCtx
+		col.Item.Thumb = func(id string) string { return h.thumbs.Get(ctx, id) }
+	}
+	if artwork, _ := c.getBool("artwork"); artwork {
+		col.Item.Artwork = h.artwork.Get
+	}
+}
+
+// batchResult is the result of fetching a path in a batch.  If the fetch failed then the
+// collection fields are omitted and the error is set.
+type batchResult struct {
+	Path index.Path `json:"path"`
+	*collection
+	Code  ErrorCode `json:"code,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// fetchBatch fetches each of the given paths, responding with a result for each (in the
+// same order).  Errors fetching individual paths are reported in their results.
+func (h *websocketHandler) fetchBatch(c Command, resp *Response) error {
+	paths, err := c.getPaths("paths")
+	if err != nil {
+		return err
+	}
+	results := make([]batchResult, len(paths))
+	for i, p := range paths {
+		results[i].Path = p
+		col, err := fetchCollection(h.ctx, &h.lib, h.meta, p)
+		if err == context.Canceled {
+			return err
+		}
+		if err != nil {
+			results[i].Code = ErrorInvalidPath
+			results[i].Error = err.Error()
+			continue
+		}
+		h.withImages(col, c)
+		results[i].collection = col
+	}
+
+	resp.Data = struct {
+		Results []batchResult `json:"results"`
+	}{
+		Results: results,
+	}
+	return nil
+}
 
-	g, k, err := h.lib.Fetch(p)
+func (h *websocketHandler) filterList(c Command, resp *Response) error {
+	filterName, err := c.getString("name")
 	if err != nil {
 		return err
 	}
-	g = h.meta.Annotate(p, g)
+
+	filter, ok := h.lib.filters.Get(filterName)
+	if !ok {
+		return badField("invalid filter name: %#v", filterName)
+	}
+
+	filterNames := make([]string, len(filter.Items()))
+	for i, x := range filter.Items() {
+		filterNames[i] = x.Name()
+	}
 
 	resp.Data = struct {
-		Path index.Path  `json:"path"`
-		Item index.Group `json:"item"`
+		Name  string   `json:"name"`
+		Items []string `json:"items"`
 	}{
-		p,
-		&Group{
-			Group: g,
-			Key:   k,
-		},
+		Name:  filterName,
+		Items: filterNames,
 	}
 	return nil
 }
 
-func (h *websocketHandler) filterList(c Command, resp *Response) error {
-	filterName, err := c.getString("name")
+// defineFilter adds a filter to the library, which is then available to FILTER_LIST and
+// FILTER_PATHS.  The filter is grouped by the value of the field, or by the optional "by"
+// grouping (i.e. "decade", or "letter" for an A-Z index).
+func (h *websocketHandler) defineFilter(c Command, resp *Response) error {
+	name, err := c.getString("name")
 	if err != nil {
 		return err
 	}
-
-	filter, ok := h.lib.filters[filterName]
-	if !ok {
-		return fmt.Errorf("invalid filter name: %#v", filterName)
+	field, err := c.getString("field")
+	if err != nil {
+		return err
+	}
+	var by string
+	if _, ok := c.Data["by"]; ok {
+		by, err = c.getString("by")
+		if err != nil {
+			return err
+		}
 	}
 
-	filterNames := make([]string, len(filter.Items()))
-	for i, x := range filter.Items() {
-		filterNames[i] = x.Name()
+	spec := filterSpec{Name: name, Field: field, By: by}
+	if err := h.lib.filters.Define(spec); err != nil {
+		return badField("invalid filter: %v", err)
 	}
 
 	resp.Data = struct {
-		Name  string   `json:"name"`
-		Items []string `json:"items"`
+		Filter  filterSpec `json:"filter"`
+		Filters []string   `json:"filters"`
 	}{
-		Name:  filterName,
-		Items: filterNames,
+		Filter:  spec,
+		Filters: h.lib.filters.Names(),
 	}
 	return nil
 }
@@ -453,13 +2037,16 @@ func (h *websocketHandler) filterPaths(c Command, resp *Response) error {
 		return err
 	}
 
-	filter, ok := h.lib.filters[filterName]
+	filter, ok := h.lib.filters.Get(filterName)
 	if !ok {
-		return fmt.Errorf("invalid filter name: %#v", filterName)
+		return badField("invalid filter name: %#v", filterName)
 	}
 
-	if len(path) != 1 {
-		return fmt.Errorf("invalid path: %#v", path)
+	if len(path) == 0 {
+		return invalidPath("path", fmt.Errorf("empty path"))
+	}
+	if len(path) > 1 {
+		return h.filterSubPaths(filterName, path, resp)
 	}
 	name := string(path[0])
 
@@ -471,7 +2058,7 @@ func (h *websocketHandler) filterPaths(c Command, resp *Response) error {
 		}
 	}
 	if item == nil {
-		return fmt.Errorf("invalid filter item: %#v", name)
+		return badField("invalid filter item: %#v", name)
 	}
 
 	resp.Data = struct {
@@ -484,6 +2071,30 @@ func (h *websocketHandler) filterPaths(c Command, resp *Response) error {
 	return nil
 }
 
+// filterSubPaths responds with the paths matching each level of a multi-level filter, i.e.
+// the path ["Jazz", "1959"] for the Genre filter, whose sub-level is the Year filter.
+func (h *websocketHandler) filterSubPaths(filterName string, path index.Path, resp *Response) error {
+	filters := h.lib.filters.Levels(filterName)
+
+	names := make([]string, len(path))
+	for i, k := range path {
+		names[i] = string(k)
+	}
+	paths, err := index.FilterPaths(filters, names)
+	if err != nil {
+		return err
+	}
+
+	resp.Data = struct {
+		Path  index.Path  `json:"path"`
+		Paths index.Group `json:"paths"`
+	}{
+		Path:  index.PathFromStringSlice(append([]string{filterName}, names...)),
+		Paths: h.lib.ExpandPaths(paths),
+	}
+	return nil
+}
+
 // Lister is an interface which defines the List method.
 type Lister interface {
 	// List returns a list of index.Paths.
@@ -508,15 +2119,52 @@ func filterByRootLister(l Lister, paths []index.Path) []index.Path {
 	return result
 }
 
+// mostPlayedCount is the number of tracks included in the "mostplayed" path list.
+const mostPlayedCount = 100
+
+// recentlyAddedCount is the number of tracks included in the "recentlyadded" path list.
+var recentlyAddedCount int
+
+// historyPageSize is the number of plays included in the "history" path list when no limit
+// is given.
+const historyPageSize = 100
+
+// playHistory returns the track paths and times of the plays in the history from offset (at
+// most limit, or historyPageSize if limit is negative), most recent first, and the total
+// number of plays.  Plays of tracks which are no longer in the library are skipped.
+func (h *websocketHandler) playHistory(offset, limit int) ([]index.Path, []time.Time, int) {
+	if limit < 0 {
+		limit = historyPageSize
+	}
+
+	var paths []index.Path
+	var times []time.Time
+	for _, e := range h.meta.history.Recent(-1) {
+		p, ok := h.lib.RootPath(e.Path)
+		if !ok {
+			continue
+		}
+		paths = append(paths, p)
+		times = append(times, e.Time)
+	}
+
+	start, end := sliceBounds(len(paths), offset, limit)
+	return paths[start:end], times[start:end], len(paths)
+}
+
 func (h *websocketHandler) fetchPathList(c Command, resp *Response) error {
 	name, err := c.getString("name")
 	if err != nil {
 		return err
 	}
 
-	var paths []index.Path
+	var paths, tracks []index.Path
+	var times []time.Time
+	var total int
 	switch name {
-	case "recent":
+	case "recent", "recentalbums":
+		// NB: index.Recent already rolls up tracks into root-level (album) groups, ordered
+		// by the most recently added track in each.
 		paths = h.lib.recent.List()
 
 	case "favourite":
@@ -526,41 +2174,548 @@ func (h *websocketHandler) fetchPathList(c Command, resp *Response) error {
 	case "checklist":
 		paths = index.CollectionPaths(h.lib.collections["Root"], []index.Key{"Root"})
 		paths = filterByRootLister(h.meta.checklist, paths)
+
+	case "mostplayed":
+		for _, p := range h.meta.playCounts.Top(mostPlayedCount) {
+			if rp, ok := h.lib.RootPath(p); ok {
+				paths = append(paths, rp)
+			}
+		}
+
+	case "recentlyadded":
+		paths = h.lib.recentlyAdded.List()
+		if len(paths) > recentlyAddedCount {
+			paths = paths[:recentlyAddedCount]
+		}
+		tracks = paths
+
+	case "history":
+		offset, limit, err := fetchRange(c)
+		if err != nil {
+			return err
+		}
+		tracks, times, total = h.playHistory(offset, limit)
+		paths = tracks
 	}
 
 	resp.Data = struct {
 		Name string      `json:"name"`
 		Data index.Group `json:"data"`
+		// Paths are the paths of the listed tracks, in order (only set for lists of tracks).
+		Paths []index.Path `json:"paths,omitempty"`
+		// Times are the times each of the tracks in Paths was played, and Total is the
+		// number of plays in the full history (only set for history).
+		Times []time.Time `json:"times,omitempty"`
+		Total int         `json:"total,omitempty"`
 	}{
-		Name: name,
-		Data: h.lib.ExpandPaths(paths),
+		Name:  name,
+		Data:  h.lib.ExpandPaths(paths),
+		Paths: tracks,
+		Times: times,
+		Total: total,
 	}
 	return nil
 }
 
+// distribution returns a websocketHandlerFunc which responds with the named distribution
+// of track counts.
+func (h *websocketHandler) distribution(name string) websocketHandlerFunc {
+	return func(c Command, resp *Response) error {
+		d, ok := h.lib.distributions[name]
+		if !ok {
+			return fmt.Errorf("invalid distribution name: %#v", name)
+		}
+
+		resp.Data = struct {
+			Name  string             `json:"name"`
+			Items []index.ValueCount `json:"items"`
+		}{
+			Name:  name,
+			Items: d.List(),
+		}
+		return nil
+	}
+}
+
 func (h *websocketHandler) search(c Command, resp *Response) error {
 	input, err := c.getString("input")
 	if err != nil {
 		return err
 	}
 
+	mode, _ := c.getString("mode")
+	if mode == "" {
+		mode = h.searchMode
+	}
+	// Fuzzy matching is opt-in as it is much slower.
+	fuzzy, _ := c.getBool("fuzzy")
+	s, err := h.lib.SearcherForMode(mode, fuzzy)
+	if err != nil {
+		return err
+	}
+
+	// Results can be restricted to a subtree (i.e. an album), an empty scope searches
+	// everything.
+	if raw, ok := c.Data["scope"]; ok && raw != nil {
+		scope, err := c.getPath("scope")
+		if err != nil {
+			return err
+		}
+		if len(scope) > 0 {
+			if !h.lib.Exists(scope) {
+				return invalidPath("scope", fmt.Errorf("not found: %v", scope))
+			}
+			s = index.ScopedSearcher{Searcher: s, Scope: scope}
+		}
+	}
+
+	var limit int
+	if _, ok := c.Data["limit"]; ok {
+		limit, err = c.getInt("limit")
+		if err != nil {
+			return err
+		}
+		if limit < 0 {
+			return badField("invalid limit: %d (must not be negative)", limit)
+		}
+	}
+	grouped, _ := c.getBool("grouped")
+
+	h.searchMu.Lock()
+	defer h.searchMu.Unlock()
+
+	h.searchGen++
+	gen := h.searchGen
+	if h.searchTimer != nil {
+		h.searchTimer.Stop()
+	}
+	if h.searchCancel != nil {
+		h.searchCancel()
+	}
+	// Searches run after the command has been handled, so are only cancelled when they are
+	// superseded or the connection is closed.
+	ctx, cancel := context.WithCancel(h.connCtx)
+	h.searchCancel = cancel
+	h.searchTimer = time.AfterFunc(searchDebounce, func() {
+		h.runSearch(ctx, gen, s, input, limit, grouped)
+	})
+	return nil
+}
+
+// searchDebounce is the time to wait for further SEARCH commands before running a search,
+// so that bursts (i.e. from search-as-you-type) are coalesced into a single search.
+const searchDebounce = 150 * time.Millisecond
+
+// searchCurrent returns true if gen is the most recent search.
+func (h *websocketHandler) searchCurrent(gen int) bool {
+	h.searchMu.Lock()
+	defer h.searchMu.Unlock()
+
+	return gen == h.searchGen
+}
+
+// cancelSearch stops any pending search, and cancels (and drops the result of) any in-flight
+// search.
+func (h *websocketHandler) cancelSearch() {
+	h.searchMu.Lock()
+	defer h.searchMu.Unlock()
+
+	h.searchGen++
+	if h.searchTimer != nil {
+		h.searchTimer.Stop()
+	}
+	if h.searchCancel != nil {
+		h.searchCancel()
+	}
+}
+
+// runSearch runs the search and sends the (ranked) results, at most limit if limit > 0
+// (in each group of results if grouped, see groupSearch), unless they are unchanged from
+// those last sent or the search has been superseded by a later SEARCH (which cancels ctx).
+func (h *websocketHandler) runSearch(ctx context.Context, gen int, s index.Searcher, input string, limit int, grouped bool) {
+	h.searchRunMu.Lock()
+	defer h.searchRunMu.Unlock()
+
+	if !h.searchCurrent(gen) {
+		return
+	}
+
+	lib := h.libs.Get()
+	sent, sentTotal := h.searcher.paths, h.searcher.total
+	sentLimit, sentGrouped := h.searcher.limit, h.searcher.grouped
+	h.searcher.Searcher = s
+	h.searcher.limit = limit
+	h.searcher.grouped = grouped
+	h.searcher.rank = func(input string, paths []index.Path) []index.Path {
+		return rankSearch(ctx, lib, h.meta, input, paths)
+	}
 	paths := h.searcher.Search(input)
-	if h.searcher.same {
+	if !h.searchCurrent(gen) {
+		// A later search will compare its results against those last sent.
+		h.searcher.paths, h.searcher.total = sent, sentTotal
+		h.searcher.limit, h.searcher.grouped = sentLimit, sentGrouped
+		return
+	}
+	if h.searcher.same && limit == sentLimit && grouped == sentGrouped {
+		return
+	}
+
+	if grouped {
+		r := groupSearch(ctx, lib, input, paths, limit)
+		if ctx.Err() != nil {
+			return
+		}
+		err := h.send(&Response{
+			Action: ActionSearch,
+			Data:   r,
+		})
+		if err != nil {
+			log.Printf("error sending search results: %v", err)
+		}
+		return
+	}
+
+	err := h.send(&Response{
+		Action: ActionSearch,
+		Data: struct {
+			// Count is the number of matches included in Results, Total is the number
+			// of matches before the limit was applied.
+			Count   int         `json:"count"`
+			Total   int         `json:"total"`
+			Results index.Group `json:"results"`
+		}{
+			Count:   len(paths),
+			Total:   h.searcher.total,
+			Results: lib.ExpandPaths(paths),
+		},
+	})
+	if err != nil {
+		log.Printf("error sending search results: %v", err)
+	}
+}
+
+// trackSummary is a brief representation of a track (and its path) used in responses
+// which list tracks.
+type trackSummary struct {
+	Path        index.Path `json:"path"`
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Album       string     `json:"album,omitempty"`
+	DiscNumber  int        `json:"discNumber,omitempty"`
+	TrackNumber int        `json:"trackNumber,omitempty"`
+}
+
+func newTrackSummary(t index.Track, p index.Path) trackSummary {
+	return trackSummary{
+		Path:        p,
+		ID:          t.GetString("ID"),
+		Name:        t.GetString("Name"),
+		Album:       t.GetString("Album"),
+		DiscNumber:  t.GetInt("DiscNumber"),
+		TrackNumber: t.GetInt("TrackNumber"),
+	}
+}
+
+// trackNeighbours responds with the tracks in the album containing the track path (ordered by
+// disc and track number), along with the tracks immediately before and after it.
+func (h *websocketHandler) trackNeighbours(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	if len(p) < 3 {
+		return invalidPath("path", fmt.Errorf("invalid track path: %v", p))
+	}
+
+	album := p[:2]
+	var albumTracks []albumTrack
+	err = h.lib.Walk(h.ctx, album, func(t index.Track, tp index.Path) error {
+		albumTracks = append(albumTracks, albumTrack{t, tp})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Stable(albumTrackSlice(albumTracks))
+
+	tracks := make([]trackSummary, len(albumTracks))
+	for i, t := range albumTracks {
+		tracks[i] = newTrackSummary(t.Track, t.path)
+	}
+
+	i := -1
+	for j, t := range tracks {
+		if t.Path.Equal(p) {
+			i = j
+			break
+		}
+	}
+	if i == -1 {
+		return invalidPath("path", fmt.Errorf("track path not found in album: %v", p))
+	}
+
+	var prev, next *trackSummary
+	if i > 0 {
+		prev = &tracks[i-1]
+	}
+	if i < len(tracks)-1 {
+		next = &tracks[i+1]
+	}
+
+	resp.Data = struct {
+		Path     index.Path     `json:"path"`
+		Album    index.Path     `json:"album"`
+		Index    int            `json:"index"`
+		Previous *trackSummary  `json:"previous"`
+		Next     *trackSummary  `json:"next"`
+		Tracks   []trackSummary `json:"tracks"`
+	}{
+		Path:     p,
+		Album:    album,
+		Index:    i,
+		Previous: prev,
+		Next:     next,
+		Tracks:   tracks,
+	}
+	return nil
+}
+
+// albumTrackSlice is a convenience type for sorting album tracks by disc and track number.
+type albumTrackSlice []albumTrack
+
+type albumTrack struct {
+	index.Track
+	path index.Path
+}
+
+var albumTrackLess = index.MultiSort(index.SortByInt("DiscNumber"), index.SortByInt("TrackNumber"))
+
+func (a albumTrackSlice) Len() int           { return len(a) }
+func (a albumTrackSlice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a albumTrackSlice) Less(i, j int) bool { return albumTrackLess(a[i], a[j]) }
+
+// albumArtist returns the album artist of the track, falling back to the artist if no album
+// artist is set.
+func albumArtist(t index.Track) string {
+	if aa := t.GetString("AlbumArtist"); aa != "" {
+		return aa
+	}
+	return t.GetString("Artist")
+}
+
+// albumTracks responds with all the tracks in the library which have the same album and album
+// artist as the track with the given path, regardless of where they are in the collection,
+// ordered by disc and track number.
+func (h *websocketHandler) albumTracks(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	t, err := h.lib.TrackFromPath(p)
+	if err != nil {
+		return invalidPath("path", err)
+	}
+
+	album, artist := t.GetString("Album"), albumArtist(t)
+	if album == "" {
+		return invalidPath("path", fmt.Errorf("track has no album: %v", p))
+	}
+
+	var tracks []albumTrack
+	err = h.lib.Walk(h.ctx, index.Path{"Root"}, func(t index.Track, tp index.Path) error {
+		if t.GetString("Album") == album && albumArtist(t) == artist {
+			tracks = append(tracks, albumTrack{t, tp})
+		}
 		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Stable(albumTrackSlice(tracks))
+
+	summaries := make([]trackSummary, len(tracks))
+	for i, t := range tracks {
+		summaries[i] = newTrackSummary(t.Track, t.path)
+	}
+
+	resp.Data = struct {
+		Album       string         `json:"album"`
+		AlbumArtist string         `json:"albumArtist"`
+		Tracks      []trackSummary `json:"tracks"`
+	}{
+		Album:       album,
+		AlbumArtist: artist,
+		Tracks:      summaries,
+	}
+	return nil
+}
+
+// pathMeta is the metadata for a path in a fetchPathsMeta response.  Exactly one of Item
+// (for group paths) and Track (for track paths) is set.
+type pathMeta struct {
+	Path      index.Path    `json:"path"`
+	Item      index.Group   `json:"item,omitempty"`
+	Track     *trackSummary `json:"track,omitempty"`
+	Favourite bool          `json:"favourite,omitempty"`
+	Checklist bool          `json:"checklist,omitempty"`
+	Rating    rating.Value  `json:"rating,omitempty"`
+}
+
+// fetchPathsMeta responds with metadata for each of the given paths.  Paths which could not
+// be found are listed separately in the response.
+func (h *websocketHandler) fetchPathsMeta(c Command, resp *Response) error {
+	paths, err := c.getPaths("paths")
+	if err != nil {
+		return err
+	}
+
+	items := make([]pathMeta, 0, len(paths))
+	missing := make([]index.Path, 0)
+	for _, p := range paths {
+		pm := pathMeta{
+			Path:      p,
+			Favourite: h.meta.favourites.Get(p),
+			Checklist: h.meta.checklist.Get(p),
+			Rating:    h.meta.ratings.Get(p),
+		}
+
+		if g, k, err := h.lib.Fetch(h.ctx, p); err == nil {
+			pm.Item = &Group{
+				Group: h.meta.Annotate(p, g),
+				Key:   k,
+			}
+		} else if t, err := h.lib.TrackFromPath(p); err == nil {
+			ts := newTrackSummary(t, p)
+			pm.Track = &ts
+		} else {
+			missing = append(missing, p)
+			continue
+		}
+		items = append(items, pm)
 	}
 
-	resp.Data = h.lib.ExpandPaths(paths)
+	resp.Data = struct {
+		Items   []pathMeta   `json:"items"`
+		Missing []index.Path `json:"missing"`
+	}{
+		Items:   items,
+		Missing: missing,
+	}
+	return nil
+}
+
+// fetchChapters responds with the chapter markers embedded in the track with the given path.
+func (h *websocketHandler) fetchChapters(c Command, resp *Response) error {
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+	t, err := h.lib.TrackFromPath(p)
+	if err != nil {
+		return err
+	}
+
+	f, err := h.media.Open(h.ctx, "/"+t.GetString("ID"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chapters, err := chapter.Read(f)
+	if err != nil {
+		return fmt.Errorf("error reading chapters: %v", err)
+	}
+
+	resp.Data = struct {
+		Path     index.Path        `json:"path"`
+		Chapters []chapter.Chapter `json:"chapters"`
+	}{
+		Path:     p,
+		Chapters: chapters,
+	}
+	return nil
+}
+
+func (h *websocketHandler) setSearchMode(c Command, resp *Response) error {
+	mode, err := c.getString("mode")
+	if err != nil {
+		return err
+	}
+	if _, err := h.lib.SearcherForMode(mode, false); err != nil {
+		return err
+	}
+	h.searchMode = mode
 	return nil
 }
 
-// WebsocketPlayer creates a player.Player which sends commands down the websocket.Conn when
+// WebsocketPlayer creates a player.Player which calls send with commands when
 // player.Player methods are called.
-func WebsocketPlayer(key string, ws *websocket.Conn) player.Player {
+func WebsocketPlayer(key string, send func(*Response) error) player.Player {
 	repFn := func(data interface{}) {
-		websocket.JSON.Send(ws, &Response{
+		send(&Response{
 			Action: ActionCtrl,
 			Data:   data,
 		})
 	}
 	return player.NewRep(key, repFn)
 }
+
+func (h *websocketHandler) rescanStatus(c Command, resp *Response) error {
+	resp.Data = computeRescanStatus(h.lib.Library, walkPath)
+	return nil
+}
+
+// rescan starts an incremental rescan of the library.  Clients are sent a LIBRARY_CHANGED
+// message when it completes.
+func (h *websocketHandler) rescan(c Command, resp *Response) error {
+	if err := h.libs.Rescan(); err != nil {
+		return err
+	}
+	resp.Data = struct {
+		Started bool `json:"started"`
+	}{true}
+	return nil
+}
+
+func (h *websocketHandler) listeningInsights(c Command, resp *Response) error {
+	resp.Data = h.meta.insights.Get()
+	return nil
+}
+
+// libraryStats responds with the (cached) libraryStats of the library, for both STATS and
+// LIBRARY_STATS (kept for existing clients).
+func (h *websocketHandler) libraryStats(c Command, resp *Response) error {
+	resp.Data = h.lib.stats.Stats()
+	return nil
+}
+
+// qualityReport responds with the local tracks under the path which have quality issues: low
+// bitrates (as recorded in the index) and, if enabled, clipping (see qualityCache).
+func (h *websocketHandler) qualityReport(c Command, resp *Response) error {
+	if !h.quality.Enabled() {
+		return &commandError{ErrorNotEnabled, "quality reports are not enabled"}
+	}
+
+	p, err := c.getPath("path")
+	if err != nil {
+		return err
+	}
+
+	items, err := h.quality.Report(h.ctx, localTracks{&h.lib}, p)
+	if err != nil {
+		return err
+	}
+
+	resp.Data = struct {
+		Path       index.Path     `json:"path"`
+		MinBitRate int            `json:"minBitRate"`
+		Clipping   bool           `json:"clipping"`
+		Items      []qualityIssue `json:"items"`
+	}{
+		Path:       p,
+		MinBitRate: h.quality.minBitRate,
+		Clipping:   h.quality.peaks != nil,
+		Items:      items,
+	}
+	return nil
+}
@@ -0,0 +1,681 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"tchaik.com/index"
+	"tchaik.com/index/attr"
+	"tchaik.com/index/crossfade"
+	"tchaik.com/index/cursor"
+	"tchaik.com/index/playlist"
+	"tchaik.com/player"
+)
+
+func TestCommandErrorCodes(t *testing.T) {
+	c := Command{
+		Action: "TEST",
+		Data: map[string]interface{}{
+			"string": "value",
+			"path":   []interface{}{true},
+		},
+	}
+
+	errorCode := func(err error) ErrorCode {
+		if err == nil {
+			return ""
+		}
+		return newErrorData(c, err).Code
+	}
+
+	tests := []struct {
+		err  error
+		code ErrorCode
+	}{
+		{nil, ""},
+		{func() error { _, err := c.getString("missing"); return err }(), ErrorBadField},
+		{func() error { _, err := c.getBool("string"); return err }(), ErrorBadField},
+		{func() error { _, err := c.getPath("path"); return err }(), ErrorInvalidPath},
+		{unknownPlayer("key"), ErrorUnknownPlayer},
+		{decodeError{fmt.Errorf("bad json")}, ErrorBadMessage},
+		{fmt.Errorf("other"), ErrorInternal},
+		{func() error { _, err := (&Library{}).SearcherForMode("unknown", false); return err }(), ErrorBadField},
+		{func() error {
+			h := &websocketHandler{}
+			return h.unsubscribeAction(Command{Data: map[string]interface{}{"name": "unknown"}}, &Response{})
+		}(), ErrorBadField},
+	}
+
+	for i, tt := range tests {
+		if got := errorCode(tt.err); got != tt.code {
+			t.Errorf("[%d] error code = %q, expected: %q", i, got, tt.code)
+		}
+	}
+}
+
+func TestIsTransportError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{transportError{io.EOF}, true},
+		{transportError{&net.OpError{Op: "write", Err: fmt.Errorf("broken pipe")}}, true},
+		// Network errors from requests made while handling a Command (i.e. fetching lyrics)
+		// are reported to the client.
+		{&url.Error{Op: "Get", URL: "http://lyrics.example.com", Err: &net.DNSError{IsTimeout: true}}, false},
+		{io.EOF, false},
+		{badField("bad"), false},
+	}
+
+	for i, tt := range tests {
+		if got := isTransportError(tt.err); got != tt.expected {
+			t.Errorf("[%d] isTransportError(%v) = %v, expected: %v", i, tt.err, got, tt.expected)
+		}
+	}
+}
+
+type mapSearcher map[string][]index.Path
+
+func (m mapSearcher) Search(s string) []index.Path {
+	return m[s]
+}
+
+func TestSameSearcher(t *testing.T) {
+	s := &sameSearcher{
+		Searcher: index.FlatSearcher{
+			Searcher: mapSearcher{
+				"bjork":      {{"Root", "a"}, {"Root", "b", "0"}},
+				"bjork live": {{"Root", "a"}, {"Root", "b", "1"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		in   string
+		same bool
+	}{
+		{"bjork", false},
+		{"Björk", true},
+		{"BJÖRK", true},
+		{"bjork live", false},
+		{"", false},
+	}
+
+	for ii, tt := range tests {
+		s.Search(tt.in)
+		if s.same != tt.same {
+			t.Errorf("[%d] Search(%#v): same = %v, expected: %v", ii, tt.in, s.same, tt.same)
+		}
+	}
+}
+
+func TestSameSearcherLimit(t *testing.T) {
+	a, b, c := index.Path{"Root", "a"}, index.Path{"Root", "b"}, index.Path{"Root", "c"}
+	s := &sameSearcher{
+		Searcher: mapSearcher{
+			"one":   {a, b},
+			"two":   {a, b, c},
+			"three": {c, b, a},
+		},
+		rank: func(input string, paths []index.Path) []index.Path {
+			// Rank in reverse order.
+			ranked := make([]index.Path, len(paths))
+			for i, p := range paths {
+				ranked[len(paths)-1-i] = p
+			}
+			return ranked
+		},
+		limit: 2,
+	}
+
+	tests := []struct {
+		in       string
+		expected []index.Path
+		total    int
+		same     bool
+	}{
+		{"one", []index.Path{b, a}, 2, false},
+		{"two", []index.Path{c, b}, 3, false}, // total changed
+		{"three", []index.Path{a, b}, 3, false},
+		{"two", []index.Path{c, b}, 3, false},
+		{"two", []index.Path{c, b}, 3, true},
+	}
+
+	for ii, tt := range tests {
+		got := s.Search(tt.in)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("[%d] Search(%#v) = %v, expected: %v", ii, tt.in, got, tt.expected)
+		}
+		if s.total != tt.total {
+			t.Errorf("[%d] Search(%#v): total = %v, expected: %v", ii, tt.in, s.total, tt.total)
+		}
+		if s.same != tt.same {
+			t.Errorf("[%d] Search(%#v): same = %v, expected: %v", ii, tt.in, s.same, tt.same)
+		}
+	}
+}
+
+func TestCommandGetCommands(t *testing.T) {
+	c := Command{
+		Action: ActionBatch,
+		Data: map[string]interface{}{
+			"commands": []interface{}{
+				map[string]interface{}{"action": ActionFetchRoots, "data": map[string]interface{}{}},
+				map[string]interface{}{"action": ActionPlayer, "data": map[string]interface{}{"action": "LIST"}},
+				map[string]interface{}{"action": ActionPing},
+			},
+			"notCommands": []interface{}{"PING"},
+			"notList":     "PING",
+		},
+	}
+
+	got, err := c.getCommands("commands")
+	if err != nil {
+		t.Fatalf("getCommands(%#v) error = %v, expected: nil", "commands", err)
+	}
+	expected := []Command{
+		{Action: ActionFetchRoots, Data: map[string]interface{}{}},
+		{Action: ActionPlayer, Data: map[string]interface{}{"action": "LIST"}},
+		{Action: ActionPing},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("getCommands(%#v) = %#v, expected: %#v", "commands", got, expected)
+	}
+
+	for _, f := range []string{"notCommands", "notList", "missing"} {
+		if _, err := c.getCommands(f); err == nil {
+			t.Errorf("getCommands(%#v) error = nil, expected error", f)
+		}
+	}
+}
+
+type testCursorStore map[string]*cursor.Cursor
+
+func (s testCursorStore) Get(name string) *cursor.Cursor          { return s[name] }
+func (s testCursorStore) Set(name string, c *cursor.Cursor) error { s[name] = c; return nil }
+func (s testCursorStore) Delete(name string) error                { delete(s, name); return nil }
+
+func TestCursorResponseNoCrossfade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crossfade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs, err := crossfade.NewStore(filepath.Join(dir, "crossfade.json"))
+	if err != nil {
+		t.Fatalf("crossfade.NewStore() error = %v", err)
+	}
+	if err := cs.Set(index.Path{"Root", "Live"}, true); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	h := &websocketHandler{
+		meta: &Meta{
+			crossfade: cs,
+			cursors: testCursorStore{
+				"studio": &cursor.Cursor{
+					Current: cursor.Position{Path: index.Path{"Root", "Studio", "0"}},
+					Next:    cursor.Position{Path: index.Path{"Root", "Studio", "1"}},
+				},
+				"into-live": &cursor.Cursor{
+					Current: cursor.Position{Path: index.Path{"Root", "Studio", "1"}},
+					Next:    cursor.Position{Path: index.Path{"Root", "Live", "0"}},
+				},
+				"live": &cursor.Cursor{
+					Current: cursor.Position{Path: index.Path{"Root", "Live", "0"}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"studio", false},
+		{"into-live", true},
+		{"live", true},
+	}
+	for _, tt := range tests {
+		if got := h.cursorResponse(tt.name).NoCrossfade; got != tt.expected {
+			t.Errorf("cursorResponse(%#v).NoCrossfade = %v, expected: %v", tt.name, got, tt.expected)
+		}
+	}
+	if got := h.cursorResponse("missing"); got != nil {
+		t.Errorf("cursorResponse(%#v) = %#v, expected: nil", "missing", got)
+	}
+}
+
+func TestQueueInsert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := playlist.NewStore(filepath.Join(dir, "playlists.json"))
+	if err != nil {
+		t.Fatalf("playlist.NewStore() error = %v", err)
+	}
+	q := &playlist.Playlist{}
+	q.Add(index.Path{"Root", "a"})
+	q.Add(index.Path{"Root", "b"})
+	if err := ps.Set("key", q); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	players := player.NewPlayers()
+	players.Add(player.NewRep("key", func(interface{}) {}))
+
+	cursors := testCursorStore{
+		"key": &cursor.Cursor{
+			Current: cursor.Position{Path: index.Path{"Root", "a", "0"}, Index: 0},
+			Next:    cursor.Position{Path: index.Path{"Root", "b", "0"}, Index: 1},
+		},
+	}
+	h := &websocketHandler{
+		players: players,
+		meta: &Meta{
+			playback:  &sync.Mutex{},
+			playlists: ps,
+			cursors:   cursors,
+		},
+	}
+
+	queue := func(data map[string]interface{}) error {
+		data["key"] = "key"
+		data["path"] = []interface{}{"Root", "c"}
+		return h.queue(Command{Data: data}, &Response{})
+	}
+
+	if err := queue(map[string]interface{}{"index": 1.0}); err != nil {
+		t.Fatalf("queue() error = %v", err)
+	}
+	if err := queue(map[string]interface{}{}); err != nil {
+		t.Fatalf("queue() error = %v", err)
+	}
+	err = queue(map[string]interface{}{"index": "1"})
+	if got := newErrorData(Command{}, err).Code; got != ErrorBadField {
+		t.Errorf("queue() with string index: error code = %q, expected: %q", got, ErrorBadField)
+	}
+
+	expected := &playlist.Playlist{}
+	for _, p := range []index.Path{{"Root", "a"}, {"Root", "c"}, {"Root", "b"}, {"Root", "c"}} {
+		expected.Add(p)
+	}
+	got, _ := json.Marshal(ps.Get("key"))
+	want, _ := json.Marshal(expected)
+	if string(got) != string(want) {
+		t.Errorf("queue playlist = %s, expected: %s", got, want)
+	}
+
+	cur := cursors["key"]
+	if cur.Current.Index != 0 || cur.Next.Index != 2 {
+		t.Errorf("cursor indexes (current, next) = (%d, %d), expected: (%d, %d)", cur.Current.Index, cur.Next.Index, 0, 2)
+	}
+}
+
+func TestPlayerStopNotifiesWatchers(t *testing.T) {
+	players := player.NewPlayers()
+	for _, k := range []string{"one", "two"} {
+		players.Add(player.NewRep(k, func(interface{}) {}))
+		players.SetStatus(k, player.Status{TrackID: "1", Playing: true, Time: 10})
+	}
+	if _, err := players.Group("room", []string{"one", "two"}); err != nil {
+		t.Fatalf("Group() error = %v", err)
+	}
+
+	ch, stop := players.Watch("two")
+	defer stop()
+
+	h := &websocketHandler{players: players, hub: newHub()}
+	c := Command{Action: ActionPlayer, Data: map[string]interface{}{"key": "room", "action": "STOP"}}
+	if err := h.player(c, &Response{}); err != nil {
+		t.Fatalf("player(STOP) error = %v", err)
+	}
+
+	select {
+	case st := <-ch:
+		if st != (player.Status{}) {
+			t.Errorf("watched status = %#v, expected: %#v", st, player.Status{})
+		}
+	default:
+		t.Errorf("room member watcher not notified of STOP")
+	}
+	for _, k := range []string{"room", "one", "two"} {
+		if st := players.Status(k); st.Playing || st.TrackID != "" {
+			t.Errorf("Status(%#v) after STOP = %#v, expected: %#v", k, st, player.Status{})
+		}
+	}
+}
+
+func TestPlayerSeekRelative(t *testing.T) {
+	var sent []player.RepAction
+	players := player.NewPlayers()
+	players.Add(player.NewRep("key", func(v interface{}) { sent = append(sent, v.(player.RepAction)) }))
+	players.SetStatus("key", player.Status{TrackID: "1", Playing: true, Time: 10})
+
+	h := &websocketHandler{
+		players: players,
+		lib:     Library{Library: testLibrary{"1": testTrack{ID: "1", TotalTime: 200000}}},
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	c := Command{Action: ActionPlayer, Data: map[string]interface{}{
+		"key":    "key",
+		"action": "SEEK",
+		"mode":   string(player.SeekRelative),
+		"value":  5.0,
+	}}
+	if err := h.player(c, &Response{}); err != nil {
+		t.Fatalf("player(SEEK) error = %v", err)
+	}
+
+	if len(sent) != 1 {
+		t.Fatalf("sent %d actions, expected: %d", len(sent), 1)
+	}
+	// The seek is relative to the current position, not the last reported time.
+	if v, ok := sent[0].Value.(float64); !ok || v < 15.05 || v > 20 {
+		t.Errorf("seek time = %v, expected: between %v and %v", sent[0].Value, 15.05, 20)
+	}
+}
+
+func TestSetSearchMode(t *testing.T) {
+	l := &Library{
+		searcher:  mapSearcher{"prefix": nil},
+		searchers: map[string]index.Searcher{"exact": mapSearcher{"exact": nil}, "prefix": mapSearcher{"prefix": nil}},
+		fuzzy:     map[string]index.Searcher{"exact": mapSearcher{"fuzzy exact": nil}, "prefix": mapSearcher{"fuzzy prefix": nil}},
+	}
+	h := &websocketHandler{lib: *l}
+
+	tests := []struct {
+		mode     string
+		expected index.Searcher
+		code     ErrorCode
+	}{
+		{"exact", l.searchers["exact"], ""},
+		{"fuzzy", l.fuzzy["prefix"], ""},
+		{"", l.searcher, ""},
+		{"unknown", nil, ErrorBadField},
+	}
+	for _, tt := range tests {
+		h.searchMode = "exact"
+		err := h.setSearchMode(Command{Data: map[string]interface{}{"mode": tt.mode}}, &Response{})
+		if tt.code != "" {
+			if got := newErrorData(Command{}, err).Code; err == nil || got != tt.code {
+				t.Errorf("setSearchMode(%#v) error = %v (%q), expected code: %q", tt.mode, err, got, tt.code)
+			}
+			if h.searchMode != "exact" {
+				t.Errorf("setSearchMode(%#v): searchMode = %#v, expected unchanged", tt.mode, h.searchMode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("setSearchMode(%#v) error = %v", tt.mode, err)
+			continue
+		}
+		s, err := h.lib.SearcherForMode(h.searchMode, false)
+		if err != nil || !reflect.DeepEqual(s, tt.expected) {
+			t.Errorf("SearcherForMode(%#v) = %v, %v, expected: %v", h.searchMode, s, err, tt.expected)
+		}
+	}
+}
+
+type albumTestTrack struct {
+	ID, Album, Kind   string
+	Disc, TrackNumber int
+}
+
+func (t albumTestTrack) GetString(k string) string {
+	switch k {
+	case "ID":
+		return t.ID
+	case "Album":
+		return t.Album
+	case "Kind":
+		return t.Kind
+	}
+	return ""
+}
+
+func (t albumTestTrack) GetStrings(k string) []string { return index.DefaultGetStrings(t, k) }
+
+func (t albumTestTrack) GetInt(k string) int {
+	switch k {
+	case "DiscNumber":
+		return t.Disc
+	case "TrackNumber":
+		return t.TrackNumber
+	}
+	return 0
+}
+
+func (t albumTestTrack) GetTime(k string) time.Time { return time.Time{} }
+
+func TestTrackNeighbours(t *testing.T) {
+	// The album is split across discs, and the tracks of each disc have different kinds (which
+	// order the tracks in the collection before disc and track numbers).
+	tracks := testTracker{
+		albumTestTrack{ID: "2-1", Album: "Album", Kind: "MPEG", Disc: 2, TrackNumber: 1},
+		albumTestTrack{ID: "1-2", Album: "Album", Kind: "AAC", Disc: 1, TrackNumber: 2},
+		albumTestTrack{ID: "1-1", Album: "Album", Kind: "MPEG", Disc: 1, TrackNumber: 1},
+		albumTestTrack{ID: "2-2", Album: "Album", Kind: "AAC", Disc: 2, TrackNumber: 2},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Album")))
+	h := &websocketHandler{
+		lib: Library{collections: map[string]index.Collection{"Root": root}},
+		ctx: context.Background(),
+	}
+	album := index.Path{"Root", root.Keys()[0]}
+
+	paths := make(map[string]index.Path)
+	var walked []string
+	err := h.lib.Walk(h.ctx, album, func(t index.Track, p index.Path) error {
+		paths[t.GetString("ID")] = p
+		walked = append(walked, t.GetString("ID"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	expected := []string{"1-1", "1-2", "2-1", "2-2"}
+	if reflect.DeepEqual(walked, expected) {
+		t.Fatalf("walk order = %v, expected it to differ from disc and track order", walked)
+	}
+
+	type neighbours struct {
+		Index    int            `json:"index"`
+		Previous *trackSummary  `json:"previous"`
+		Next     *trackSummary  `json:"next"`
+		Tracks   []trackSummary `json:"tracks"`
+	}
+	id := func(t *trackSummary) string {
+		if t == nil {
+			return ""
+		}
+		return t.ID
+	}
+
+	for i, x := range expected {
+		var prev, next string
+		if i > 0 {
+			prev = expected[i-1]
+		}
+		if i < len(expected)-1 {
+			next = expected[i+1]
+		}
+
+		resp := &Response{}
+		err := h.trackNeighbours(Command{Data: map[string]interface{}{"path": pathData(paths[x])}}, resp)
+		if err != nil {
+			t.Errorf("trackNeighbours(%v) error = %v", paths[x], err)
+			continue
+		}
+		// Round trip through JSON so that the anonymous response type isn't repeated.
+		var got neighbours
+		b, _ := json.Marshal(resp.Data)
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if got.Index != i || id(got.Previous) != prev || id(got.Next) != next {
+			t.Errorf("trackNeighbours(%v) = (%d, %#v, %#v), expected: (%d, %#v, %#v)", x, got.Index, id(got.Previous), id(got.Next), i, prev, next)
+		}
+		var ids []string
+		for _, y := range got.Tracks {
+			ids = append(ids, y.ID)
+		}
+		if !reflect.DeepEqual(ids, expected) {
+			t.Errorf("trackNeighbours(%v) tracks = %v, expected: %v", x, ids, expected)
+		}
+	}
+
+	p := append(append(index.Path{}, album...), "9", "9")
+	err = h.trackNeighbours(Command{Data: map[string]interface{}{"path": pathData(p)}}, &Response{})
+	if got := newErrorData(Command{}, err).Code; err == nil || got != ErrorInvalidPath {
+		t.Errorf("trackNeighbours(%v) error = %v (%q), expected code: %q", p, err, got, ErrorInvalidPath)
+	}
+}
+
+// pathData returns the Path as it is decoded from a Command.
+func pathData(p index.Path) []interface{} {
+	data := make([]interface{}, len(p))
+	for i, k := range p {
+		data[i] = string(k)
+	}
+	return data
+}
+
+func TestAlbumTracks(t *testing.T) {
+	// The discs of the album are in different groups.
+	tracks := testTracker{
+		albumTestTrack{ID: "2-2", Album: "Album", Kind: "Disc 2", Disc: 2, TrackNumber: 2},
+		albumTestTrack{ID: "1-2", Album: "Album", Kind: "Disc 1", Disc: 1, TrackNumber: 2},
+		albumTestTrack{ID: "other", Album: "Other", Kind: "Disc 1", Disc: 1, TrackNumber: 3},
+		albumTestTrack{ID: "2-1", Album: "Album", Kind: "Disc 2", Disc: 2, TrackNumber: 1},
+		albumTestTrack{ID: "1-1", Album: "Album", Kind: "Disc 1", Disc: 1, TrackNumber: 1},
+	}
+	root := index.Collect(tracks, index.By(attr.String("Kind")))
+	h := &websocketHandler{
+		lib: Library{collections: map[string]index.Collection{"Root": root}},
+		ctx: context.Background(),
+	}
+
+	var p index.Path
+	h.lib.Walk(h.ctx, index.Path{"Root"}, func(t index.Track, tp index.Path) error {
+		if t.GetString("ID") == "2-1" {
+			p = tp
+		}
+		return nil
+	})
+	c := Command{Data: map[string]interface{}{"path": pathData(p)}}
+
+	resp := &Response{}
+	if err := h.albumTracks(c, resp); err != nil {
+		t.Fatalf("albumTracks(%v) error = %v", p, err)
+	}
+	var got struct {
+		Tracks []trackSummary `json:"tracks"`
+	}
+	b, _ := json.Marshal(resp.Data)
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	var ids []string
+	for _, x := range got.Tracks {
+		ids = append(ids, x.ID)
+	}
+	if expected := []string{"1-1", "1-2", "2-1", "2-2"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("albumTracks(%v) tracks = %v, expected: %v", p, ids, expected)
+	}
+
+	// Errors walking the library are returned.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.ctx = ctx
+	if err := h.albumTracks(c, &Response{}); err != context.Canceled {
+		t.Errorf("albumTracks(%v) with cancelled context error = %v, expected: %v", p, err, context.Canceled)
+	}
+	h.ctx = context.Background()
+
+	missing := Command{Data: map[string]interface{}{"path": []interface{}{"Root", "missing", "0"}}}
+	err := h.albumTracks(missing, &Response{})
+	if got := newErrorData(Command{}, err).Code; err == nil || got != ErrorInvalidPath {
+		t.Errorf("albumTracks(missing) error = %v (%q), expected code: %q", err, got, ErrorInvalidPath)
+	}
+}
+
+func TestSubscribePlayerStatusInterval(t *testing.T) {
+	players := player.NewPlayers()
+	players.Add(player.NewRep("key", func(interface{}) {}))
+	h := &websocketHandler{players: players, subscriptions: make(map[string]func())}
+	defer h.unsubscribe(playerStatusSubscription("key"))
+
+	tests := []struct {
+		interval interface{}
+		code     ErrorCode
+	}{
+		{1e-10, ErrorBadField},
+		{0.0, ErrorBadField},
+		{-1.0, ErrorBadField},
+		{"1", ErrorBadField},
+		{0.5, ""},
+	}
+	for _, tt := range tests {
+		c := Command{Data: map[string]interface{}{"interval": tt.interval}}
+		var code ErrorCode
+		if err := h.subscribePlayerStatus("key", c, &Response{}); err != nil {
+			code = newErrorData(c, err).Code
+		}
+		if code != tt.code {
+			t.Errorf("subscribePlayerStatus(interval: %#v) error code = %q, expected: %q", tt.interval, code, tt.code)
+		}
+	}
+}
+
+func TestNowPlayingRichSubscribe(t *testing.T) {
+	players := player.NewPlayers()
+	players.Add(player.NewRep("key", func(interface{}) {}))
+	h := &websocketHandler{
+		players:       players,
+		subscriptions: make(map[string]func()),
+	}
+	defer h.unsubscribe(fmt.Sprintf("%v:%v", ActionNowPlayingRich, "key"))
+
+	tests := []struct {
+		key      string
+		interval interface{}
+		code     ErrorCode
+	}{
+		{"key", 1e-10, ErrorBadField},
+		{"key", "1", ErrorBadField},
+		{"missing", 1.0, ErrorUnknownPlayer},
+		{"key", 0.5, ""},
+	}
+	for _, tt := range tests {
+		c := Command{Data: map[string]interface{}{"action": "SUBSCRIBE", "key": tt.key, "interval": tt.interval}}
+		var code ErrorCode
+		if err := h.nowPlayingRich(c, &Response{}); err != nil {
+			code = newErrorData(c, err).Code
+		}
+		if code != tt.code {
+			t.Errorf("nowPlayingRich(key: %#v, interval: %#v) error code = %q, expected: %q", tt.key, tt.interval, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bookmark defines types and methods for setting/getting playback positions
+// (bookmarks) for paths and persisting this data.
+package bookmark
+
+import (
+	"fmt"
+	"sync"
+
+	"tchaik.com/index"
+)
+
+// Store is an interface which defines methods necessary for setting and getting bookmarks
+// for index paths.
+type Store interface {
+	// Set the bookmark (position in seconds) for the path.  A position of 0 removes the
+	// bookmark.
+	Set(index.Path, float64) error
+	// Get the bookmark for the path, returns 0 if the path is not bookmarked.
+	Get(index.Path) float64
+}
+
+// NewStore creates a basic implementation of a bookmark store, using the given path as the
+// source of data. Note: we do not enforce any locking on the underlying file, which is read
+// once to initialise the store, and then overwritten after each call to Set.
+func NewStore(path string) (Store, error) {
+	m := make(map[string]float64)
+	s, err := index.NewPersistStore(path, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store{
+		m:     m,
+		store: s,
+	}, nil
+}
+
+type store struct {
+	sync.RWMutex
+
+	m     map[string]float64
+	store index.PersistStore
+}
+
+// Set implements Store.
+func (s *store) Set(p index.Path, v float64) error {
+	if v < 0 {
+		return fmt.Errorf("invalid bookmark position: %v (must not be negative)", v)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	k := fmt.Sprintf("%v", p)
+	if v == 0 {
+		if _, ok := s.m[k]; !ok {
+			return nil
+		}
+		delete(s.m, k)
+	} else {
+		s.m[k] = v
+	}
+	return s.store.Persist(&s.m)
+}
+
+// Get implements Store.
+func (s *store) Get(p index.Path) float64 {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.m[fmt.Sprintf("%v", p)]
+}
@@ -0,0 +1,51 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bookmark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tchaik.com/index"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bookmark")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bookmarks.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %v", err)
+	}
+
+	p := index.Path{"T", "1"}
+	if err := s.Set(p, 65.5); err != nil {
+		t.Errorf("unexpected error from Set: %v", err)
+	}
+	if err := s.Set(p, -1); err == nil {
+		t.Errorf("Set(%v, -1) = nil, expected error", p)
+	}
+
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading store: %v", err)
+	}
+	if got := s.Get(p); got != 65.5 {
+		t.Errorf("Get(%v) = %v, expected: %v", p, got, 65.5)
+	}
+
+	if err := s.Set(p, 0); err != nil {
+		t.Errorf("unexpected error from Set: %v", err)
+	}
+	if got := s.Get(p); got != 0 {
+		t.Errorf("Get(%v) = %v, expected: %v", p, got, 0)
+	}
+}
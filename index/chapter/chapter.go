@@ -0,0 +1,228 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chapter implements reading of chapter markers embedded in audio files.  ID3v2 CHAP
+// frames (as used in chaptered MP3 podcasts and audiobooks) and MP4 chapters (as used in M4B
+// audiobooks, see readMP4) are supported.
+package chapter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Chapter is a chapter marker.
+type Chapter struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	Start int    `json:"start"` // milliseconds
+	End   int    `json:"end"`   // milliseconds
+}
+
+// Read reads chapters from the ID3v2 tag at the start of r, or from r if it is an MP4 file.
+// Returns an empty list if there is no ID3v2 tag, or the tag or file contains no chapters.
+// ID3v2.2 tags, which predate CHAP frames, never contain chapters.
+func Read(r io.Reader) ([]Chapter, error) {
+	header := make([]byte, 10)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return []Chapter{}, nil
+		}
+		return nil, err
+	}
+	if string(header[4:8]) == "ftyp" {
+		return readMP4(r, header)
+	}
+	if string(header[:3]) != "ID3" {
+		return []Chapter{}, nil
+	}
+
+	version := header[3]
+	if version == 2 {
+		return []Chapter{}, nil
+	}
+	if version != 3 && version != 4 {
+		return nil, fmt.Errorf("unsupported ID3v2 version: %d", version)
+	}
+	flags := header[5]
+	size := syncsafe(header[6:10])
+
+	tag := make([]byte, size)
+	_, err = io.ReadFull(r, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	// In v2.3 the whole tag is unsynchronised, in v2.4 each frame is (see readFrames).
+	unsync := flags&0x80 != 0
+	if unsync && version == 3 {
+		tag = resync(tag)
+	}
+
+	if flags&0x40 != 0 { // extended header
+		if len(tag) < 4 {
+			return nil, errors.New("invalid extended header")
+		}
+		n := int(binary.BigEndian.Uint32(tag[:4]))
+		if version == 3 {
+			n += 4 // size excludes itself in v2.3
+		} else {
+			n = syncsafe(tag[:4])
+		}
+		if n > len(tag) {
+			return nil, errors.New("invalid extended header size")
+		}
+		tag = tag[n:]
+	}
+
+	chapters := make([]Chapter, 0)
+	err = readFrames(tag, version, unsync && version == 4, func(id string, data []byte) error {
+		if id != "CHAP" {
+			return nil
+		}
+		c, err := readChap(data, version)
+		if err != nil {
+			return err
+		}
+		chapters = append(chapters, c)
+		return nil
+	})
+	return chapters, err
+}
+
+// syncsafe decodes a 4-byte syncsafe integer.
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+// resync reverses unsynchronisation, removing the zero byte inserted after each 0xff.
+func resync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// readFrames calls fn for each frame in b.  In v2.4, frames are unsynchronised if unsync is
+// true or their format flags say so.
+func readFrames(b []byte, version byte, unsync bool, fn func(id string, data []byte) error) error {
+	for len(b) >= 10 {
+		if b[0] == 0 {
+			return nil // padding
+		}
+
+		id := string(b[:4])
+		var size int
+		if version == 4 {
+			size = syncsafe(b[4:8])
+		} else {
+			size = int(binary.BigEndian.Uint32(b[4:8]))
+		}
+		format := b[9]
+		b = b[10:]
+		if size > len(b) {
+			return fmt.Errorf("invalid frame size for %v: %d", id, size)
+		}
+
+		data := b[:size]
+		if version == 4 {
+			if format&0x40 != 0 && len(data) > 0 { // group identifier
+				data = data[1:]
+			}
+			if format&0x01 != 0 && len(data) >= 4 { // data length indicator
+				data = data[4:]
+			}
+			if unsync || format&0x02 != 0 {
+				data = resync(data)
+			}
+		}
+
+		err := fn(id, data)
+		if err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// readChap decodes the content of a CHAP frame.
+func readChap(b []byte, version byte) (Chapter, error) {
+	var c Chapter
+	i := 0
+	for i < len(b) && b[i] != 0 {
+		i++
+	}
+	if i+1+16 > len(b) {
+		return c, errors.New("invalid CHAP frame")
+	}
+
+	c.ID = string(b[:i])
+	b = b[i+1:]
+	c.Start = int(binary.BigEndian.Uint32(b[0:4]))
+	c.End = int(binary.BigEndian.Uint32(b[4:8]))
+
+	err := readFrames(b[16:], version, false, func(id string, data []byte) error {
+		if id == "TIT2" {
+			c.Title = readText(data)
+		}
+		return nil
+	})
+	return c, err
+}
+
+// readText decodes the content of a text frame.
+func readText(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	enc, b := b[0], b[1:]
+	switch enc {
+	case 0: // ISO-8859-1
+		r := make([]rune, 0, len(b))
+		for _, x := range b {
+			if x == 0 {
+				break
+			}
+			r = append(r, rune(x))
+		}
+		return string(r)
+
+	case 1, 2: // UTF-16 (with BOM), UTF-16BE
+		bigEndian := enc == 2
+		if enc == 1 && len(b) >= 2 {
+			bigEndian = b[0] == 0xfe && b[1] == 0xff
+			b = b[2:]
+		}
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			x := uint16(b[i+1])<<8 | uint16(b[i])
+			if bigEndian {
+				x = uint16(b[i])<<8 | uint16(b[i+1])
+			}
+			if x == 0 {
+				break
+			}
+			u = append(u, x)
+		}
+		return string(utf16.Decode(u))
+	}
+
+	// UTF-8
+	for i, x := range b {
+		if x == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,133 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chapter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func frame(id string, data []byte) []byte {
+	b := make([]byte, 10, 10+len(data))
+	copy(b, id)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(data)))
+	return append(b, data...)
+}
+
+func chap(id string, start, end uint32, title string) []byte {
+	b := append([]byte(id), 0)
+	times := make([]byte, 16)
+	binary.BigEndian.PutUint32(times[0:4], start)
+	binary.BigEndian.PutUint32(times[4:8], end)
+	b = append(b, times...)
+	b = append(b, frame("TIT2", append([]byte{3}, title...))...)
+	return frame("CHAP", b)
+}
+
+func tag(frames ...[]byte) []byte {
+	return tagVersion(3, 0, frames...)
+}
+
+func tagVersion(version, flags byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	if flags&0x80 != 0 && version == 3 {
+		body = bytes.Replace(body, []byte{0xff}, []byte{0xff, 0}, -1)
+	}
+	body = append(body, make([]byte, 8)...) // padding
+	n := len(body)
+	header := []byte{'I', 'D', '3', version, 0, flags, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(header, body...)
+}
+
+// unsyncFrame marks the frame f as unsynchronised (in v2.4) and unsynchronises its content.
+func unsyncFrame(f []byte) []byte {
+	data := bytes.Replace(f[10:], []byte{0xff}, []byte{0xff, 0}, -1)
+	b := append([]byte(nil), f[:10]...)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(data)))
+	b[9] |= 0x02
+	return append(b, data...)
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		in  []byte
+		out []Chapter
+	}{
+		{
+			[]byte{},
+			[]Chapter{},
+		},
+		{
+			[]byte("not a tag at all"),
+			[]Chapter{},
+		},
+		{
+			tag(frame("TIT2", append([]byte{0}, "Title"...))),
+			[]Chapter{},
+		},
+		{
+			tag(
+				frame("TIT2", append([]byte{0}, "Title"...)),
+				chap("ch0", 0, 60000, "Introduction"),
+				chap("ch1", 60000, 125000, "Chapter One"),
+			),
+			[]Chapter{
+				{ID: "ch0", Title: "Introduction", Start: 0, End: 60000},
+				{ID: "ch1", Title: "Chapter One", Start: 60000, End: 125000},
+			},
+		},
+		{
+			// ID3v2.2 tags can't contain chapters.
+			tagVersion(2, 0, []byte("TT2\x00\x00\x06\x00Title")),
+			[]Chapter{},
+		},
+		{
+			// Unsynchronised v2.3 tag.
+			tagVersion(3, 0x80, chap("ch0", 0, 0xff00ff, "\xff\xfe")),
+			[]Chapter{
+				{ID: "ch0", Title: "\xff\xfe", Start: 0, End: 0xff00ff},
+			},
+		},
+		{
+			// Unsynchronised v2.4 frame.
+			tagVersion(4, 0, unsyncFrame(chap("ch0", 0xff00, 0xff00ff, "\xff"))),
+			[]Chapter{
+				{ID: "ch0", Title: "\xff", Start: 0xff00, End: 0xff00ff},
+			},
+		},
+	}
+
+	for ii, tt := range tests {
+		got, err := Read(bytes.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", ii, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("[%d] Read() = %#v, expected: %#v", ii, got, tt.out)
+		}
+	}
+}
+
+func TestReadText(t *testing.T) {
+	tests := []struct {
+		in  []byte
+		out string
+	}{
+		{[]byte{0, 'a', 'b', 0}, "ab"},
+		{[]byte{1, 0xff, 0xfe, 'a', 0, 'b', 0}, "ab"},
+		{[]byte{2, 0, 'a', 0, 'b'}, "ab"},
+		{[]byte{3, 'a', 'b'}, "ab"},
+	}
+
+	for ii, tt := range tests {
+		got := readText(tt.in)
+		if got != tt.out {
+			t.Errorf("[%d] readText(%#v) = %#v, expected: %#v", ii, tt.in, got, tt.out)
+		}
+	}
+}
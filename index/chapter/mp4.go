@@ -0,0 +1,517 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chapter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"unicode/utf16"
+)
+
+// maxMoovSize is the maximum size of the moov atom (which holds the metadata of an MP4 file)
+// read by readMP4.
+const maxMoovSize = 64 << 20
+
+// maxTitleSize is the maximum size of a chapter title sample read from a chapter track.
+const maxTitleSize = 1024
+
+// readMP4 reads chapters from the MP4 file r, where header is the data which has already been
+// read from the start of r.  Nero chapters (a moov.udta.chpl atom) are used if present, otherwise
+// chapters are read from the QuickTime chapter track (a text track referenced by the tref.chap
+// atom of another track).  The titles of a chapter track are stored with the media data, and so
+// are only read if r is an io.Seeker.
+func readMP4(r io.Reader, header []byte) ([]Chapter, error) {
+	rs, seekable := r.(io.ReadSeeker)
+	var src io.Reader
+	if seekable {
+		if _, err := rs.Seek(-int64(len(header)), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		src = rs
+	} else {
+		src = io.MultiReader(bytes.NewReader(header), r)
+	}
+
+	for {
+		typ, n, err := readAtomHeader(src)
+		if err == io.EOF {
+			return []Chapter{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if typ == "moov" {
+			if n < 0 || n > maxMoovSize {
+				return nil, fmt.Errorf("invalid moov atom size: %d", n)
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(src, b); err != nil {
+				return nil, err
+			}
+			m, err := readMoov(b)
+			if err != nil {
+				return nil, err
+			}
+			if !seekable {
+				rs = nil
+			}
+			return m.chapters(rs)
+		}
+
+		if n < 0 {
+			return []Chapter{}, nil // atom extends to the end of the file
+		}
+		if seekable {
+			_, err = rs.Seek(n, io.SeekCurrent)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, src, n)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readAtomHeader reads an atom header from r, returning the type of the atom and the size of its
+// body, or -1 if the atom extends to the end of the file.
+func readAtomHeader(r io.Reader) (string, int64, error) {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return "", 0, io.EOF
+		}
+		return "", 0, err
+	}
+	typ := string(b[4:8])
+
+	switch size := int64(binary.BigEndian.Uint32(b[:4])); size {
+	case 0:
+		return typ, -1, nil
+	case 1:
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(b))
+		if size < 16 {
+			return "", 0, fmt.Errorf("invalid size for %v atom: %d", typ, size)
+		}
+		return typ, size - 16, nil
+	default:
+		if size < 8 {
+			return "", 0, fmt.Errorf("invalid size for %v atom: %d", typ, size)
+		}
+		return typ, size - 8, nil
+	}
+}
+
+// readAtoms calls fn for each atom in b.
+func readAtoms(b []byte, fn func(typ string, body []byte) error) error {
+	for len(b) >= 8 {
+		size := int64(binary.BigEndian.Uint32(b[:4]))
+		typ := string(b[4:8])
+		n := int64(8)
+		switch size {
+		case 0:
+			size = int64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return fmt.Errorf("invalid size for %v atom", typ)
+			}
+			size = int64(binary.BigEndian.Uint64(b[8:16]))
+			n = 16
+		}
+		if size < n || size > int64(len(b)) {
+			return fmt.Errorf("invalid size for %v atom: %d", typ, size)
+		}
+
+		if err := fn(typ, b[n:size]); err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// mp4Track is the chapter related metadata of a track in an MP4 file.
+type mp4Track struct {
+	id        uint32
+	chapters  []uint32 // ids of the chapter tracks of this track
+	timescale uint32
+
+	durations []uint32 // sample durations, in timescale units
+	sizes     []uint32
+	offsets   []int64     // chunk offsets
+	chunks    [][2]uint32 // first chunk (from 1) and samples per chunk of each run of chunks
+}
+
+// mp4Moov is the chapter related metadata of an MP4 file.
+type mp4Moov struct {
+	duration int // milliseconds
+	nero     []Chapter
+	tracks   []*mp4Track
+}
+
+// fullAtom returns the version and content of a full atom (one which starts with a
+// version byte and flags).
+func fullAtom(b []byte, typ string) (byte, []byte, error) {
+	if len(b) < 4 {
+		return 0, nil, fmt.Errorf("invalid %v atom", typ)
+	}
+	return b[0], b[4:], nil
+}
+
+// readTimes reads the timescale and duration fields which are common to the mvhd and mdhd
+// atoms.
+func readTimes(b []byte, typ string) (timescale uint32, duration uint64, err error) {
+	version, b, err := fullAtom(b, typ)
+	if err != nil {
+		return 0, 0, err
+	}
+	if version == 1 {
+		if len(b) < 28 {
+			return 0, 0, fmt.Errorf("invalid %v atom", typ)
+		}
+		return binary.BigEndian.Uint32(b[16:20]), binary.BigEndian.Uint64(b[20:28]), nil
+	}
+	if len(b) < 16 {
+		return 0, 0, fmt.Errorf("invalid %v atom", typ)
+	}
+	return binary.BigEndian.Uint32(b[8:12]), uint64(binary.BigEndian.Uint32(b[12:16])), nil
+}
+
+func readMoov(b []byte) (*mp4Moov, error) {
+	m := &mp4Moov{}
+	err := readAtoms(b, func(typ string, body []byte) error {
+		switch typ {
+		case "mvhd":
+			timescale, duration, err := readTimes(body, typ)
+			if err != nil {
+				return err
+			}
+			if timescale > 0 {
+				m.duration = int(duration * 1000 / uint64(timescale))
+			}
+
+		case "udta":
+			return readAtoms(body, func(typ string, body []byte) error {
+				if typ != "chpl" {
+					return nil
+				}
+				var err error
+				m.nero, err = readChpl(body)
+				return err
+			})
+
+		case "trak":
+			t, err := readTrak(body)
+			if err != nil {
+				return err
+			}
+			m.tracks = append(m.tracks, t)
+		}
+		return nil
+	})
+	return m, err
+}
+
+// readChpl reads the chapters in a Nero chpl atom.  Chapter start times are in units of
+// 100ns, and each chapter ends at the start of the next.
+func readChpl(b []byte) ([]Chapter, error) {
+	version, b, err := fullAtom(b, "chpl")
+	if err != nil {
+		return nil, err
+	}
+	if version == 1 {
+		if len(b) < 4 {
+			return nil, errors.New("invalid chpl atom")
+		}
+		b = b[4:]
+	}
+	if len(b) < 1 {
+		return nil, errors.New("invalid chpl atom")
+	}
+	n := int(b[0])
+	b = b[1:]
+
+	chapters := make([]Chapter, 0, n)
+	for i := 0; i < n; i++ {
+		if len(b) < 9 {
+			return nil, errors.New("invalid chpl atom")
+		}
+		start := binary.BigEndian.Uint64(b[:8])
+		l := int(b[8])
+		b = b[9:]
+		if l > len(b) {
+			return nil, errors.New("invalid chpl atom")
+		}
+		chapters = append(chapters, Chapter{
+			ID:    fmt.Sprintf("ch%d", i),
+			Title: string(b[:l]),
+			Start: int(start / 10000),
+		})
+		b = b[l:]
+	}
+	return chapters, nil
+}
+
+func readTrak(b []byte) (*mp4Track, error) {
+	t := &mp4Track{}
+	var walk func(b []byte) error
+	walk = func(b []byte) error {
+		return readAtoms(b, func(typ string, body []byte) error {
+			switch typ {
+			case "mdia", "minf", "stbl":
+				return walk(body)
+
+			case "tkhd":
+				version, body, err := fullAtom(body, typ)
+				if err != nil {
+					return err
+				}
+				i := 8
+				if version == 1 {
+					i = 16
+				}
+				if len(body) < i+4 {
+					return errors.New("invalid tkhd atom")
+				}
+				t.id = binary.BigEndian.Uint32(body[i : i+4])
+
+			case "tref":
+				return readAtoms(body, func(typ string, body []byte) error {
+					if typ != "chap" {
+						return nil
+					}
+					for ; len(body) >= 4; body = body[4:] {
+						t.chapters = append(t.chapters, binary.BigEndian.Uint32(body[:4]))
+					}
+					return nil
+				})
+
+			case "mdhd":
+				var err error
+				t.timescale, _, err = readTimes(body, typ)
+				return err
+
+			case "stts":
+				entries, err := tableEntries(body, typ, 8)
+				if err != nil {
+					return err
+				}
+				for _, e := range entries {
+					count, delta := binary.BigEndian.Uint32(e[:4]), binary.BigEndian.Uint32(e[4:8])
+					for j := uint32(0); j < count && len(t.durations) < maxChapters; j++ {
+						t.durations = append(t.durations, delta)
+					}
+				}
+
+			case "stsz":
+				_, body, err := fullAtom(body, typ)
+				if err != nil {
+					return err
+				}
+				if len(body) < 8 {
+					return errors.New("invalid stsz atom")
+				}
+				size, count := binary.BigEndian.Uint32(body[:4]), binary.BigEndian.Uint32(body[4:8])
+				body = body[8:]
+				for j := uint32(0); j < count && len(t.sizes) < maxChapters; j++ {
+					if size != 0 {
+						t.sizes = append(t.sizes, size)
+						continue
+					}
+					if len(body) < 4 {
+						return errors.New("invalid stsz atom")
+					}
+					t.sizes = append(t.sizes, binary.BigEndian.Uint32(body[:4]))
+					body = body[4:]
+				}
+
+			case "stsc":
+				entries, err := tableEntries(body, typ, 12)
+				if err != nil {
+					return err
+				}
+				for _, e := range entries {
+					t.chunks = append(t.chunks, [2]uint32{binary.BigEndian.Uint32(e[:4]), binary.BigEndian.Uint32(e[4:8])})
+				}
+
+			case "stco", "co64":
+				n := 4
+				if typ == "co64" {
+					n = 8
+				}
+				entries, err := tableEntries(body, typ, n)
+				if err != nil {
+					return err
+				}
+				for _, e := range entries {
+					if n == 4 {
+						t.offsets = append(t.offsets, int64(binary.BigEndian.Uint32(e)))
+					} else {
+						t.offsets = append(t.offsets, int64(binary.BigEndian.Uint64(e)))
+					}
+				}
+			}
+			return nil
+		})
+	}
+	return t, walk(b)
+}
+
+// maxChapters is the maximum number of chapters read from a chapter track.
+const maxChapters = 10000
+
+// tableEntries returns the entries (each n bytes) of a sample table atom.
+func tableEntries(b []byte, typ string, n int) ([][]byte, error) {
+	_, b, err := fullAtom(b, typ)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("invalid %v atom", typ)
+	}
+	count := int(binary.BigEndian.Uint32(b[:4]))
+	b = b[4:]
+	if count > len(b)/n {
+		return nil, fmt.Errorf("invalid %v atom", typ)
+	}
+
+	entries := make([][]byte, count)
+	for i := range entries {
+		entries[i] = b[i*n : (i+1)*n]
+	}
+	return entries, nil
+}
+
+// chapters returns the chapters of the file, reading chapter titles from r (if non-nil).
+func (m *mp4Moov) chapters(r io.ReadSeeker) ([]Chapter, error) {
+	chapters := m.nero
+	if chapters == nil {
+		t := m.chapterTrack()
+		if t == nil {
+			return []Chapter{}, nil
+		}
+		var err error
+		chapters, err = t.read(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		} else {
+			chapters[i].End = m.duration
+		}
+	}
+	return chapters, nil
+}
+
+// chapterTrack returns the first track which is referenced as a chapter track, or nil if there
+// is none.
+func (m *mp4Moov) chapterTrack() *mp4Track {
+	for _, t := range m.tracks {
+		for _, id := range t.chapters {
+			for _, c := range m.tracks {
+				if c.id == id {
+					return c
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sampleOffsets returns the offset of each sample in the track.
+func (t *mp4Track) sampleOffsets() []int64 {
+	var offsets []int64
+	for i, c := range t.chunks {
+		last := uint32(len(t.offsets))
+		if i+1 < len(t.chunks) {
+			last = t.chunks[i+1][0] - 1
+		}
+		for chunk := c[0]; chunk <= last && chunk >= 1 && int(chunk) <= len(t.offsets); chunk++ {
+			offset := t.offsets[chunk-1]
+			for j := uint32(0); j < c[1] && len(offsets) < len(t.sizes); j++ {
+				offsets = append(offsets, offset)
+				offset += int64(t.sizes[len(offsets)-1])
+			}
+		}
+	}
+	return offsets
+}
+
+// read returns the chapters in the text track, one for each sample.  Chapter titles are read
+// from r if it is non-nil.
+func (t *mp4Track) read(r io.ReadSeeker) ([]Chapter, error) {
+	if t.timescale == 0 {
+		return nil, errors.New("invalid chapter track timescale: 0")
+	}
+	offsets := t.sampleOffsets()
+
+	chapters := make([]Chapter, len(t.durations))
+	var start uint64
+	for i, d := range t.durations {
+		chapters[i] = Chapter{
+			ID:    fmt.Sprintf("ch%d", i),
+			Start: int(start * 1000 / uint64(t.timescale)),
+		}
+		start += uint64(d)
+
+		if r == nil || i >= len(offsets) {
+			continue
+		}
+		title, err := readTitle(r, offsets[i], t.sizes[i])
+		if err != nil {
+			return nil, err
+		}
+		chapters[i].Title = title
+	}
+	return chapters, nil
+}
+
+// readTitle reads a text sample of the given size at offset in r.  Text samples are a 16-bit
+// length followed by UTF-8 or (with a BOM) UTF-16 text.
+func readTitle(r io.ReadSeeker, offset int64, size uint32) (string, error) {
+	if size < 2 {
+		return "", nil
+	}
+	if size > maxTitleSize {
+		size = maxTitleSize
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+
+	n := int(binary.BigEndian.Uint16(b[:2]))
+	b = b[2:]
+	if n < len(b) {
+		b = b[:n]
+	}
+
+	if len(b) >= 2 && (b[0] == 0xfe && b[1] == 0xff || b[0] == 0xff && b[1] == 0xfe) {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			if b[0] == 0xfe {
+				u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+			} else {
+				u = append(u, uint16(b[i+1])<<8|uint16(b[i]))
+			}
+		}
+		return string(utf16.Decode(u)), nil
+	}
+	return string(b), nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chapter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func atom(typ string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b[:4], uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func uint32s(xs ...uint32) []byte {
+	b := make([]byte, 4*len(xs))
+	for i, x := range xs {
+		binary.BigEndian.PutUint32(b[4*i:], x)
+	}
+	return b
+}
+
+// full returns a version 0 full atom with the given fields.
+func full(typ string, fields ...uint32) []byte {
+	return atom(typ, uint32s(append([]uint32{0}, fields...)...))
+}
+
+var ftyp = atom("ftyp", []byte("M4B "), uint32s(0), []byte("M4B mp42isom"))
+
+// mvhd with a timescale of 1000 and the given duration.
+func mvhd(duration uint32) []byte {
+	return full("mvhd", 0, 0, 1000, duration)
+}
+
+func chpl(starts []uint64, titles []string) []byte {
+	b := []byte{1, 0, 0, 0, 0, 0, 0, 0, byte(len(starts))}
+	for i, s := range starts {
+		t := make([]byte, 8)
+		binary.BigEndian.PutUint64(t, s)
+		b = append(b, t...)
+		b = append(b, byte(len(titles[i])))
+		b = append(b, titles[i]...)
+	}
+	return atom("chpl", b)
+}
+
+// textSamples returns the text samples for the titles.
+func textSamples(titles ...string) ([]byte, []uint32) {
+	var b []byte
+	var sizes []uint32
+	for _, t := range titles {
+		s := make([]byte, 2, 2+len(t))
+		binary.BigEndian.PutUint16(s, uint16(len(t)))
+		s = append(s, t...)
+		b = append(b, s...)
+		sizes = append(sizes, uint32(len(s)))
+	}
+	return b, sizes
+}
+
+// chapterTrackFile returns an MP4 file with an audio track (id 1) which references a chapter
+// track (id 2) with the titles, each lasting the given number of milliseconds.  The media data
+// precedes the moov atom.
+func chapterTrackFile(durations []uint32, titles ...string) []byte {
+	samples, sizes := textSamples(titles...)
+	mdat := atom("mdat", samples)
+	offset := uint32(len(ftyp) + 8)
+
+	stts := []uint32{uint32(len(durations))}
+	for _, d := range durations {
+		stts = append(stts, 1, d)
+	}
+
+	// All samples are in one chunk.
+	moov := atom("moov",
+		mvhd(200000),
+		atom("trak",
+			full("tkhd", 0, 0, 1),
+			atom("tref", atom("chap", uint32s(2))),
+		),
+		atom("trak",
+			full("tkhd", 0, 0, 2),
+			atom("mdia",
+				full("mdhd", 0, 0, 1000, 0),
+				atom("minf", atom("stbl",
+					full("stts", stts...),
+					full("stsc", 1, 1, uint32(len(sizes)), 1),
+					full("stsz", append([]uint32{0, uint32(len(sizes))}, sizes...)...),
+					full("stco", 1, offset),
+				)),
+			),
+		),
+	)
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+// reader hides any other methods (i.e. Seek) of an io.Reader.
+type reader struct {
+	io.Reader
+}
+
+func TestReadMP4(t *testing.T) {
+	nero := bytes.Join([][]byte{
+		ftyp,
+		atom("mdat", make([]byte, 100)),
+		atom("moov",
+			mvhd(200000),
+			atom("udta", chpl([]uint64{0, 600000000}, []string{"Introduction", "Chapter One"})),
+		),
+	}, nil)
+
+	neroChapters := []Chapter{
+		{ID: "ch0", Title: "Introduction", Start: 0, End: 60000},
+		{ID: "ch1", Title: "Chapter One", Start: 60000, End: 200000},
+	}
+
+	track := chapterTrackFile([]uint32{60000, 140000}, "Introduction", "Chapter One")
+
+	tests := []struct {
+		in  io.Reader
+		out []Chapter
+	}{
+		{bytes.NewReader(nero), neroChapters},
+		{reader{bytes.NewReader(nero)}, neroChapters},
+		{bytes.NewReader(track), neroChapters},
+		{
+			// Chapter track titles can't be read without seeking.
+			reader{bytes.NewReader(track)},
+			[]Chapter{
+				{ID: "ch0", Start: 0, End: 60000},
+				{ID: "ch1", Start: 60000, End: 200000},
+			},
+		},
+		{
+			bytes.NewReader(bytes.Join([][]byte{ftyp, atom("moov", mvhd(1000))}, nil)),
+			[]Chapter{},
+		},
+		{
+			bytes.NewReader(bytes.Join([][]byte{ftyp, atom("mdat", make([]byte, 10))}, nil)),
+			[]Chapter{},
+		},
+	}
+
+	for ii, tt := range tests {
+		got, err := Read(tt.in)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", ii, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("[%d] Read() = %#v, expected: %#v", ii, got, tt.out)
+		}
+	}
+}
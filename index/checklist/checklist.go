@@ -4,6 +4,7 @@ package checklist
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"tchaik.com/index"
 )
@@ -14,16 +15,23 @@ type Store interface {
 	// Set whether the path should be in the checklist.
 	Set(index.Path, bool) error
 
+	// SetAll sets whether each of the paths should be in the checklist.
+	SetAll([]index.Path, bool) error
+
 	// Get whether the path is in the checklist.
 	Get(index.Path) bool
 
 	// List retuns a list of paths in the checklist.
 	List() []index.Path
+
+	// Flush writes any pending changes to the underlying file.
+	Flush() error
 }
 
 // NewStore creates a basic implementation of a checklist store, using the given path as the
 // source of data. Note: we do not enforce any locking on the underlying file, which is read
-// once to initialise the store, and then overwritten after each call to Set.
+// once to initialise the store, and then overwritten shortly after calls to Set (rapid changes are
+// written together).
 func NewStore(path string) (Store, error) {
 	m := make(map[string]bool)
 	s, err := index.NewPersistStore(path, &m)
@@ -33,7 +41,7 @@ func NewStore(path string) (Store, error) {
 
 	return &store{
 		m:     m,
-		store: s,
+		store: index.Debounce(s, time.Second),
 	}, nil
 }
 
@@ -41,7 +49,7 @@ type store struct {
 	sync.RWMutex
 
 	m     map[string]bool
-	store index.PersistStore
+	store index.FlushPersister
 }
 
 // Set implements Store.
@@ -59,6 +67,21 @@ func (s *store) Set(p index.Path, v bool) error {
 }
 
 // Get implements Store.
+func (s *store) SetAll(ps []index.Path, v bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, p := range ps {
+		k := fmt.Sprintf("%v", p)
+		if v {
+			s.m[k] = true
+		} else {
+			delete(s.m, k)
+		}
+	}
+	return s.store.Persist(&s.m)
+}
+
 func (s *store) Get(p index.Path) bool {
 	s.RLock()
 	defer s.RUnlock()
@@ -77,3 +100,8 @@ func (s *store) List() []index.Path {
 	}
 	return result
 }
+
+// Flush implements Store.
+func (s *store) Flush() error {
+	return s.store.Flush()
+}
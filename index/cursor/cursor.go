@@ -7,6 +7,7 @@ package cursor
 
 import (
 	"fmt"
+	"math/rand"
 	"sync"
 
 	"tchaik.com/index"
@@ -24,14 +25,39 @@ func (p Position) Empty() bool {
 	return len(p.Path) == 0
 }
 
+// Shuffle is a shuffled ordering of the positions in a playlist.
+type Shuffle struct {
+	// Seed is the seed used to generate the Order.
+	Seed int64 `json:"seed"`
+	// Order is the order in which positions are played.
+	Order []Position `json:"order"`
+}
+
+// indexOf returns the index of the Position in the Order, or -1 if it isn't present.
+func (s *Shuffle) indexOf(p Position) int {
+	for i, x := range s.Order {
+		if x.Index == p.Index && x.Path.Equal(p.Path) {
+			return i
+		}
+	}
+	return -1
+}
+
 // Cursor is a moveable marker on a playlist.
 type Cursor struct {
-	sync.Mutex // protects Current, Next and Previous
+	sync.Mutex // protects Current, Next, Previous, StopAfterCurrent and Shuffle
 
 	Current  Position `json:"current"`
 	Next     Position `json:"next"`
 	Previous Position `json:"previous"`
 
+	// StopAfterCurrent is true if playback should stop (rather than move forward) when the
+	// current track ends.
+	StopAfterCurrent bool `json:"stopAfterCurrent"`
+
+	// Shuffle, if non-nil, is the order in which the cursor moves through the playlist.
+	Shuffle *Shuffle `json:"shuffle,omitempty"`
+
 	p *playlist.Playlist
 	c index.Collection
 }
@@ -54,6 +80,36 @@ func (c *Cursor) Set(i int, p index.Path) {
 	c.Unlock()
 }
 
+// Goto moves the cursor to the first track of the playlist item at index i.  Indexes outside
+// the playlist are clamped to the first or last item.
+func (c *Cursor) Goto(i int) error {
+	c.Lock()
+	defer c.Unlock()
+
+	n := len(c.p.Items())
+	if n == 0 {
+		return fmt.Errorf("playlist is empty")
+	}
+	if i < 0 {
+		i = 0
+	}
+	if i >= n {
+		i = n - 1
+	}
+
+	paths, err := c.paths(i)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no tracks in playlist item: %d", i)
+	}
+	c.Current = Position{Index: i, Path: paths[0]}
+	c.Next, _ = c.next(c.Current)
+	c.Previous, _ = c.prev(c.Current)
+	return nil
+}
+
 // Forward moves the cursor forwards.  Returns an error if the next track could not be found,
 // and sets the Next item to be empty.
 func (c *Cursor) Forward() (err error) {
@@ -69,6 +125,132 @@ func (c *Cursor) Forward() (err error) {
 	return
 }
 
+// ItemMoved updates the cursor after the playlist item at index `from` has been moved to index
+// `to`, so that it still points at the same tracks.
+func (c *Cursor) ItemMoved(from, to int) {
+	c.Lock()
+	defer c.Unlock()
+
+	move := func(p *Position) {
+		if !p.Empty() {
+			p.Index = playlist.MovedIndex(p.Index, from, to)
+		}
+	}
+	move(&c.Current)
+	move(&c.Next)
+	move(&c.Previous)
+	if c.Shuffle != nil {
+		for i := range c.Shuffle.Order {
+			move(&c.Shuffle.Order[i])
+		}
+	}
+
+	// The neighbours of the current track may have changed.
+	if c.p != nil && !c.Current.Empty() {
+		c.Next, _ = c.next(c.Current)
+		c.Previous, _ = c.prev(c.Current)
+	}
+}
+
+// Upcoming returns the position which will follow the current track.  Unlike Next, this is
+// re-evaluated against the current state of the playlist (consulting the shuffled order, if
+// set), and so reflects changes to the playlist which haven't updated the cursor.
+func (c *Cursor) Upcoming() (Position, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.p == nil || c.Current.Empty() {
+		return c.Next, nil
+	}
+	return c.next(c.Current)
+}
+
+// ToggleStopAfterCurrent toggles whether playback should stop when the current track ends.
+func (c *Cursor) ToggleStopAfterCurrent() {
+	c.Lock()
+	c.StopAfterCurrent = !c.StopAfterCurrent
+	c.Unlock()
+}
+
+// Ended is called when the current track has finished playing.  If StopAfterCurrent is set
+// then it is cleared and the cursor is not moved, otherwise the cursor is moved forwards.
+// Returns true if the cursor was moved.
+func (c *Cursor) Ended() (bool, error) {
+	c.Lock()
+	if c.StopAfterCurrent {
+		c.StopAfterCurrent = false
+		c.Unlock()
+		return false, nil
+	}
+	c.Unlock()
+	return true, c.Forward()
+}
+
+// SetShuffle shuffles the order in which the cursor moves through the playlist, using the
+// given seed.  The current position is moved to the start of the shuffled order, so that
+// playback continues from it.  The playlist itself is not changed: items added to it after
+// shuffling are not included until it is shuffled again.
+func (c *Cursor) SetShuffle(seed int64) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.p == nil {
+		return fmt.Errorf("cursor is not attached to a playlist")
+	}
+
+	var positions []Position
+	for i := range c.p.Items() {
+		paths, err := c.paths(i)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			positions = append(positions, Position{Path: p, Index: i})
+		}
+	}
+
+	s := &Shuffle{
+		Seed:  seed,
+		Order: make([]Position, 0, len(positions)),
+	}
+	r := rand.New(rand.NewSource(seed))
+	for _, i := range r.Perm(len(positions)) {
+		s.Order = append(s.Order, positions[i])
+	}
+
+	if i := s.indexOf(c.Current); i > 0 {
+		copy(s.Order[1:i+1], s.Order[:i])
+		s.Order[0] = c.Current
+	}
+
+	c.Shuffle = s
+	c.Next, _ = c.next(c.Current)
+	c.Previous, _ = c.prev(c.Current)
+	return nil
+}
+
+// ClearShuffle restores the playlist order.
+func (c *Cursor) ClearShuffle() {
+	c.Lock()
+	c.Shuffle = nil
+	c.Next, _ = c.next(c.Current)
+	c.Previous, _ = c.prev(c.Current)
+	c.Unlock()
+}
+
+// shuffleStep returns the position d steps from p in the shuffled order.
+func (c *Cursor) shuffleStep(p Position, d int) (Position, error) {
+	i := c.Shuffle.indexOf(p)
+	if i == -1 {
+		return Position{}, fmt.Errorf("didn't find path in shuffle: %v", p.Path)
+	}
+	i += d
+	if i < 0 || i >= len(c.Shuffle.Order) {
+		return Position{}, nil
+	}
+	return c.Shuffle.Order[i], nil
+}
+
 // Backward moves the cursor backwards.  Returns an error if the previous track could not be found,
 // and sets the Previous item to be empty.
 func (c *Cursor) Backward() (err error) {
@@ -99,6 +281,10 @@ func (c *Cursor) pathIndex(p Position) ([]index.Path, int, error) {
 }
 
 func (c *Cursor) next(p Position) (Position, error) {
+	if c.Shuffle != nil {
+		return c.shuffleStep(p, 1)
+	}
+
 	paths, i, err := c.pathIndex(p)
 	if err != nil {
 		return Position{}, err
@@ -130,6 +316,10 @@ func (c *Cursor) next(p Position) (Position, error) {
 }
 
 func (c *Cursor) prev(p Position) (Position, error) {
+	if c.Shuffle != nil {
+		return c.shuffleStep(p, -1)
+	}
+
 	paths, i, err := c.pathIndex(p)
 	if err != nil {
 		return Position{}, err
@@ -0,0 +1,219 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cursor
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"tchaik.com/index"
+	"tchaik.com/index/playlist"
+)
+
+// testGroup is a group containing the given number of tracks.
+type testGroup int
+
+func (g testGroup) Tracks() []index.Track    { return make([]index.Track, g) }
+func (g testGroup) Name() string             { return "" }
+func (g testGroup) Field(string) interface{} { return nil }
+
+// testCollection is a collection of groups, each with the given number of tracks.
+type testCollection map[index.Key]int
+
+func (c testCollection) Tracks() []index.Track    { return nil }
+func (c testCollection) Name() string             { return "" }
+func (c testCollection) Field(string) interface{} { return nil }
+
+func (c testCollection) Keys() []index.Key {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+	result := make([]index.Key, len(keys))
+	for i, k := range keys {
+		result[i] = index.Key(k)
+	}
+	return result
+}
+
+func (c testCollection) Get(k index.Key) index.Group {
+	n, ok := c[k]
+	if !ok {
+		return nil
+	}
+	return testGroup(n)
+}
+
+// newTestCursor returns a cursor on a playlist with items Root:a (two tracks) and Root:b (one
+// track), positioned at the first track.
+func newTestCursor(t *testing.T) *Cursor {
+	p := &playlist.Playlist{}
+	p.Add(index.NewPath("Root:a"))
+	p.Add(index.NewPath("Root:b"))
+
+	c := NewCursor(p, testCollection{"a": 2, "b": 1})
+	if err := c.Goto(0); err != nil {
+		t.Fatalf("Goto(0) error = %v, expected: nil", err)
+	}
+	return c
+}
+
+func TestCursorToggleStopAfterCurrent(t *testing.T) {
+	c := newTestCursor(t)
+
+	for _, expected := range []bool{true, false, true} {
+		c.ToggleStopAfterCurrent()
+		if c.StopAfterCurrent != expected {
+			t.Errorf("ToggleStopAfterCurrent(): StopAfterCurrent = %v, expected: %v", c.StopAfterCurrent, expected)
+		}
+	}
+}
+
+func TestCursorEnded(t *testing.T) {
+	c := newTestCursor(t)
+	first := c.Current
+
+	c.ToggleStopAfterCurrent()
+	moved, err := c.Ended()
+	if err != nil {
+		t.Fatalf("Ended() error = %v, expected: nil", err)
+	}
+	if moved {
+		t.Errorf("Ended() with StopAfterCurrent = %v, expected: %v", moved, false)
+	}
+	if !reflect.DeepEqual(c.Current, first) {
+		t.Errorf("Ended() with StopAfterCurrent: Current = %v, expected: %v", c.Current, first)
+	}
+	if c.StopAfterCurrent {
+		t.Errorf("Ended(): StopAfterCurrent = %v, expected: %v", c.StopAfterCurrent, false)
+	}
+
+	expected := []Position{
+		{Path: index.NewPath("Root:a:1"), Index: 0},
+		{Path: index.NewPath("Root:b:0"), Index: 1},
+		{Path: index.NewPath("Root:b:0"), Index: 1}, // end of playlist
+	}
+	for i, pos := range expected {
+		moved, err := c.Ended()
+		if err != nil {
+			t.Fatalf("[%d] Ended() error = %v, expected: nil", i, err)
+		}
+		if !moved {
+			t.Errorf("[%d] Ended() = %v, expected: %v", i, moved, true)
+		}
+		if !reflect.DeepEqual(c.Current, pos) {
+			t.Errorf("[%d] Ended(): Current = %v, expected: %v", i, c.Current, pos)
+		}
+	}
+}
+
+func TestCursorShuffle(t *testing.T) {
+	c := newTestCursor(t)
+	if err := c.Goto(1); err != nil {
+		t.Fatalf("Goto(1) error = %v, expected: nil", err)
+	}
+	if err := c.SetShuffle(42); err != nil {
+		t.Fatalf("SetShuffle(42) error = %v, expected: nil", err)
+	}
+	order := append([]Position(nil), c.Shuffle.Order...)
+	if len(order) != 3 {
+		t.Fatalf("len(Shuffle.Order) = %d, expected: %d", len(order), 3)
+	}
+	if !reflect.DeepEqual(order[0], c.Current) {
+		t.Errorf("Shuffle.Order[0] = %v, expected current position: %v", order[0], c.Current)
+	}
+
+	// The same seed gives the same order.
+	d := newTestCursor(t)
+	d.Goto(1)
+	if err := d.SetShuffle(42); err != nil {
+		t.Fatalf("SetShuffle(42) error = %v, expected: nil", err)
+	}
+	if !reflect.DeepEqual(d.Shuffle.Order, order) {
+		t.Errorf("SetShuffle(42) order = %v, expected: %v", d.Shuffle.Order, order)
+	}
+
+	// Forward and backward follow the shuffled order.
+	for i := 1; i < len(order); i++ {
+		if err := c.Forward(); err != nil {
+			t.Fatalf("[%d] Forward() error = %v, expected: nil", i, err)
+		}
+		if !reflect.DeepEqual(c.Current, order[i]) {
+			t.Errorf("[%d] Forward(): Current = %v, expected: %v", i, c.Current, order[i])
+		}
+	}
+	if !c.Next.Empty() {
+		t.Errorf("Next at end of shuffled order = %v, expected empty", c.Next)
+	}
+	for i := len(order) - 2; i >= 0; i-- {
+		if err := c.Backward(); err != nil {
+			t.Fatalf("[%d] Backward() error = %v, expected: nil", i, err)
+		}
+		if !reflect.DeepEqual(c.Current, order[i]) {
+			t.Errorf("[%d] Backward(): Current = %v, expected: %v", i, c.Current, order[i])
+		}
+	}
+	if !c.Previous.Empty() {
+		t.Errorf("Previous at start of shuffled order = %v, expected empty", c.Previous)
+	}
+
+	// Clearing the shuffle restores the playlist order from the current position.
+	if err := c.Forward(); err != nil {
+		t.Fatalf("Forward() error = %v, expected: nil", err)
+	}
+	current := c.Current
+	c.ClearShuffle()
+	if c.Shuffle != nil {
+		t.Errorf("ClearShuffle(): Shuffle = %v, expected: nil", c.Shuffle)
+	}
+	if !reflect.DeepEqual(c.Current, current) {
+		t.Errorf("ClearShuffle(): Current = %v, expected: %v", c.Current, current)
+	}
+	next, err := c.next(current)
+	if err != nil {
+		t.Fatalf("next(%v) error = %v, expected: nil", current, err)
+	}
+	prev, err := c.prev(current)
+	if err != nil {
+		t.Fatalf("prev(%v) error = %v, expected: nil", current, err)
+	}
+	if !reflect.DeepEqual(c.Next, next) || !reflect.DeepEqual(c.Previous, prev) {
+		t.Errorf("ClearShuffle(): (Previous, Next) = (%v, %v), expected: (%v, %v)", c.Previous, c.Next, prev, next)
+	}
+}
+
+func TestCursorGoto(t *testing.T) {
+	c := newTestCursor(t)
+
+	tests := []struct {
+		in       int
+		expected Position
+	}{
+		{0, Position{Path: index.NewPath("Root:a:0"), Index: 0}},
+		{1, Position{Path: index.NewPath("Root:b:0"), Index: 1}},
+		{-1, Position{Path: index.NewPath("Root:a:0"), Index: 0}},
+		{2, Position{Path: index.NewPath("Root:b:0"), Index: 1}},
+		{100, Position{Path: index.NewPath("Root:b:0"), Index: 1}},
+	}
+	for _, tt := range tests {
+		if err := c.Goto(tt.in); err != nil {
+			t.Errorf("Goto(%d) error = %v, expected: nil", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.Current, tt.expected) {
+			t.Errorf("Goto(%d): Current = %v, expected: %v", tt.in, c.Current, tt.expected)
+		}
+	}
+
+	empty := NewCursor(&playlist.Playlist{}, testCollection{})
+	if err := empty.Goto(0); err == nil {
+		t.Errorf("Goto(0) on empty playlist error = nil, expected error")
+	}
+	if !empty.Current.Empty() {
+		t.Errorf("Goto(0) on empty playlist: Current = %v, expected empty", empty.Current)
+	}
+}
@@ -14,9 +14,16 @@ import (
 type Action string
 
 const (
-	ActionSet      Action = "set"
-	ActionNext            = "next"
-	ActionPrevious        = "previous"
+	ActionSet              Action = "set"
+	ActionGoto                    = "goto"
+	ActionNext                    = "next"
+	ActionPrevious                = "previous"
+	ActionEnded                   = "ended"
+	ActionStopAfterCurrent        = "stopAfterCurrent"
+	ActionShuffle                 = "shuffle"
+	ActionUnshuffle               = "unshuffle"
+	ActionSetAndPlay              = "setAndPlay"
+	ActionDelete                  = "delete"
 )
 
 type RepAction struct {
@@ -24,12 +31,27 @@ type RepAction struct {
 	Action Action     `json:"action"`
 	Path   index.Path `json:"path"`
 	Index  int        `json:"index"`
+	Seed   int64      `json:"seed"`
+
+	// Paths are the items of the playlist, used by ActionSetAndPlay.
+	Paths []index.Path `json:"paths,omitempty"`
 }
 
 var actionToAction = map[string]Action{
 	"SET":  ActionSet,
+	"GOTO": ActionGoto,
 	"NEXT": ActionNext,
 	"PREV": ActionPrevious,
+
+	"ENDED":              ActionEnded,
+	"STOP_AFTER_CURRENT": ActionStopAfterCurrent,
+
+	"SHUFFLE":   ActionShuffle,
+	"UNSHUFFLE": ActionUnshuffle,
+
+	"SET_AND_PLAY": ActionSetAndPlay,
+
+	"DELETE": ActionDelete,
 }
 
 func (a RepAction) Apply(s Store, ps playlist.Store, collection index.Collection) error {
@@ -38,14 +60,36 @@ func (a RepAction) Apply(s Store, ps playlist.Store, collection index.Collection
 		return fmt.Errorf("unknown action: %v", a.Action)
 	}
 
-	if action == ActionSet {
+	if action == ActionSetAndPlay {
+		return a.setAndPlay(s, ps, collection)
+	}
+
+	if action == ActionDelete {
+		// Deleting a cursor which doesn't exist is a no-op.
+		if s.Get(a.Name) == nil {
+			return nil
+		}
+		return s.Delete(a.Name)
+	}
+
+	if action == ActionSet || action == ActionGoto {
 		p := ps.Get(a.Name)
 		if p == nil {
 			return fmt.Errorf("cannot set cursor for invalid playlist name: %v", a.Name)
 		}
 
 		c := NewCursor(p, collection)
-		c.Set(a.Index, a.Path)
+		if old := s.Get(a.Name); old != nil {
+			// Keep the shuffled order when moving to another position.
+			c.Shuffle = old.Shuffle
+		}
+		if action == ActionGoto {
+			if err := c.Goto(a.Index); err != nil {
+				return err
+			}
+		} else {
+			c.Set(a.Index, a.Path)
+		}
 		return s.Set(a.Name, c)
 	}
 
@@ -60,6 +104,14 @@ func (a RepAction) Apply(s Store, ps playlist.Store, collection index.Collection
 		err = c.Backward()
 	case ActionNext:
 		err = c.Forward()
+	case ActionEnded:
+		_, err = c.Ended()
+	case ActionStopAfterCurrent:
+		c.ToggleStopAfterCurrent()
+	case ActionShuffle:
+		err = c.SetShuffle(a.Seed)
+	case ActionUnshuffle:
+		c.ClearShuffle()
 	}
 	err1 := s.Set(a.Name, c)
 	if err == nil {
@@ -67,3 +119,38 @@ func (a RepAction) Apply(s Store, ps playlist.Store, collection index.Collection
 	}
 	return err
 }
+
+// setAndPlay replaces the items of the playlist with Paths, and moves the cursor to the item
+// at Index (or to Path within it, if set).  The playlist is created if it doesn't exist, and
+// any shuffle is re-applied (with the same seed) to the new items.
+func (a RepAction) setAndPlay(s Store, ps playlist.Store, collection index.Collection) error {
+	if len(a.Paths) == 0 {
+		return fmt.Errorf("cannot set cursor to an empty list of paths")
+	}
+
+	p := &playlist.Playlist{}
+	if old := ps.Get(a.Name); old != nil {
+		p.SetMeta(old.Meta())
+	}
+	for _, path := range a.Paths {
+		p.Add(path)
+	}
+
+	c := NewCursor(p, collection)
+	if err := c.Goto(a.Index); err != nil {
+		return err
+	}
+	if len(a.Path) > 0 {
+		c.Set(c.Current.Index, a.Path)
+	}
+	if old := s.Get(a.Name); old != nil && old.Shuffle != nil {
+		if err := c.SetShuffle(old.Shuffle.Seed); err != nil {
+			return err
+		}
+	}
+
+	if err := ps.Set(a.Name, p); err != nil {
+		return err
+	}
+	return s.Set(a.Name, c)
+}
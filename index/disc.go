@@ -0,0 +1,50 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// noDiscName is the name of the group of tracks without a disc number in a collection
+// created by ByDisc.
+const noDiscName = "Other"
+
+// ByDisc is a type which creates a collection of tracks grouped by their disc number, which
+// is given by the int field.  Groups are named "Disc <n>" and keyed by the disc number, and
+// are ordered by the first appearance of each disc in the tracks.
+type ByDisc string
+
+// Collect implements Collector.
+func (d ByDisc) Collect(t Tracker) Collection {
+	name := "by " + string(d)
+	if tg, ok := t.(Group); ok {
+		name = tg.Name()
+	}
+
+	c := newCol(name)
+	for _, t := range t.Tracks() {
+		n := t.GetInt(string(d))
+		dn := noDiscName
+		if n > 0 {
+			dn = fmt.Sprintf("Disc %d", n)
+		}
+		c.addTrack(dn, Key(strconv.Itoa(n)), t)
+	}
+	return c
+}
+
+// Discs returns the number of distinct (non-zero) disc numbers of the tracks.  Collecting is
+// only useful if there is more than one.
+func (d ByDisc) Discs(t Tracker) int {
+	discs := make(map[int]bool)
+	for _, t := range t.Tracks() {
+		if n := t.GetInt(string(d)); n > 0 {
+			discs[n] = true
+		}
+	}
+	return len(discs)
+}
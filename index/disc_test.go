@@ -0,0 +1,83 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestByDisc(t *testing.T) {
+	tests := []struct {
+		in         testTracker
+		discs      int
+		keys       []Key
+		names      []string
+		trackNames [][]string
+	}{
+		{
+			in:    testTracker{},
+			discs: 0,
+		},
+		{
+			in: testTracker{
+				{Name: "A", DiscNumber: 1, TrackNumber: 1},
+				{Name: "B", DiscNumber: 1, TrackNumber: 2},
+			},
+			discs:      1,
+			keys:       []Key{"1"},
+			names:      []string{"Disc 1"},
+			trackNames: [][]string{{"A", "B"}},
+		},
+		{
+			in: testTracker{
+				{Name: "A", DiscNumber: 1, TrackNumber: 1},
+				{Name: "B", DiscNumber: 1, TrackNumber: 2},
+				{Name: "C", DiscNumber: 2, TrackNumber: 1},
+				{Name: "D", DiscNumber: 2, TrackNumber: 2},
+			},
+			discs:      2,
+			keys:       []Key{"1", "2"},
+			names:      []string{"Disc 1", "Disc 2"},
+			trackNames: [][]string{{"A", "B"}, {"C", "D"}},
+		},
+		{
+			in: testTracker{
+				{Name: "A"},
+				{Name: "B", DiscNumber: 2, TrackNumber: 1},
+			},
+			discs:      1,
+			keys:       []Key{"0", "2"},
+			names:      []string{"Other", "Disc 2"},
+			trackNames: [][]string{{"A"}, {"B"}},
+		},
+	}
+
+	for ii, tt := range tests {
+		d := ByDisc("DiscNumber")
+		if got := d.Discs(tt.in); got != tt.discs {
+			t.Errorf("[%d] Discs() = %d, expected: %d", ii, got, tt.discs)
+		}
+
+		c := d.Collect(tt.in)
+		if got := c.Keys(); !reflect.DeepEqual(got, tt.keys) {
+			t.Errorf("[%d] Collect().Keys() = %#v, expected: %#v", ii, got, tt.keys)
+			continue
+		}
+		for i, k := range c.Keys() {
+			g := c.Get(k)
+			if g.Name() != tt.names[i] {
+				t.Errorf("[%d] Collect().Get(%#v).Name() = %#v, expected: %#v", ii, k, g.Name(), tt.names[i])
+			}
+			var names []string
+			for _, t := range g.Tracks() {
+				names = append(names, t.GetString("Name"))
+			}
+			if !reflect.DeepEqual(names, tt.trackNames[i]) {
+				t.Errorf("[%d] Collect().Get(%#v) tracks = %v, expected: %v", ii, k, names, tt.trackNames[i])
+			}
+		}
+	}
+}
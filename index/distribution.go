@@ -0,0 +1,95 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"fmt"
+	"sort"
+
+	"tchaik.com/index/attr"
+)
+
+// ValueCount is a pairing of an attribute value and the number of tracks which have
+// that value.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// valueCountSlice is a convenience type for sorting a slice of ValueCounts by count
+// (descending), and then by value.
+type valueCountSlice []ValueCount
+
+func (v valueCountSlice) Len() int      { return len(v) }
+func (v valueCountSlice) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v valueCountSlice) Less(i, j int) bool {
+	if v[i].Count != v[j].Count {
+		return v[i].Count > v[j].Count
+	}
+	return v[i].Value < v[j].Value
+}
+
+// Distribution computes the number of tracks in the Tracker for each distinct value of
+// the attribute.  Tracks with an empty value are not counted, and tracks with multiple
+// values (i.e. attr.Strings) are counted once for each value.  The result is sorted by
+// count (largest first) and then by value.
+func Distribution(t Tracker, a attr.Interface) []ValueCount {
+	m := make(map[string]int)
+	for _, x := range t.Tracks() {
+		v := a.Value(x)
+		if a.IsEmpty(v) {
+			continue
+		}
+		switch v := v.(type) {
+		case []string:
+			for _, s := range v {
+				m[s]++
+			}
+		default:
+			m[fmt.Sprintf("%v", v)]++
+		}
+	}
+
+	result := make([]ValueCount, 0, len(m))
+	for k, v := range m {
+		result = append(result, ValueCount{Value: k, Count: v})
+	}
+	sort.Sort(valueCountSlice(result))
+	return result
+}
+
+// decade is an implementation of attr.Interface which buckets an int attribute
+// into decades.
+type decade struct {
+	attr.Interface
+}
+
+// Decade returns an attr.Interface whose value is the decade (i.e. "1970s") of the int
+// attribute with field name f.  Zero values of the field are treated as empty.
+func Decade(f string) attr.Interface {
+	return decade{attr.Int(f)}
+}
+
+// IsEmpty implements attr.Interface.
+func (d decade) IsEmpty(x interface{}) bool {
+	return x == ""
+}
+
+// Value implements attr.Interface.
+func (d decade) Value(g attr.Getter) interface{} {
+	v := d.Interface.Value(g).(int)
+	if v == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", v-v%10)
+}
+
+// Intersect implements attr.Interface.
+func (d decade) Intersect(x, y interface{}) interface{} {
+	if x == y {
+		return x
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"reflect"
+	"testing"
+
+	"tchaik.com/index/attr"
+)
+
+func TestDistribution(t *testing.T) {
+	tracker := testTracker([]testTrack{
+		{Artist: "A", Year: 1971},
+		{Artist: "B", Year: 1979},
+		{Artist: "A", Year: 1985},
+		{Artist: "", Year: 0},
+		{Artist: "C", Year: 2001},
+	})
+
+	tests := []struct {
+		attr     attr.Interface
+		expected []ValueCount
+	}{
+		{
+			attr.String("Artist"),
+			[]ValueCount{{"A", 2}, {"B", 1}, {"C", 1}},
+		},
+		{
+			Decade("Year"),
+			[]ValueCount{{"1970s", 2}, {"1980s", 1}, {"2000s", 1}},
+		},
+	}
+
+	for ii, tt := range tests {
+		got := Distribution(tracker, tt.attr)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("[%d] Distribution(...) = %#v, expected: %#v", ii, got, tt.expected)
+		}
+	}
+}
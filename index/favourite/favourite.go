@@ -5,6 +5,7 @@ package favourite
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"tchaik.com/index"
 )
@@ -20,11 +21,15 @@ type Store interface {
 
 	// List retuns a list of paths in the favourite Store.
 	List() []index.Path
+
+	// Flush writes any pending changes to the underlying file.
+	Flush() error
 }
 
 // NewStore creates a basic implementation of a favourites store, using the given path as the
 // source of data. Note: we do not enforce any locking on the underlying file, which is read
-// once to initialise the store, and then overwritten after each call to Set.
+// once to initialise the store, and then overwritten shortly after calls to Set (rapid changes are
+// written together).
 func NewStore(path string) (Store, error) {
 	m := make(map[string]bool)
 	s, err := index.NewPersistStore(path, &m)
@@ -34,7 +39,7 @@ func NewStore(path string) (Store, error) {
 
 	return &store{
 		m:     m,
-		store: s,
+		store: index.Debounce(s, time.Second),
 	}, nil
 }
 
@@ -42,7 +47,7 @@ type store struct {
 	sync.RWMutex
 
 	m     map[string]bool
-	store index.PersistStore
+	store index.FlushPersister
 }
 
 // Set implements Store.
@@ -78,3 +83,8 @@ func (s *store) List() []index.Path {
 	}
 	return result
 }
+
+// Flush implements Store.
+func (s *store) Flush() error {
+	return s.store.Flush()
+}
@@ -5,7 +5,12 @@
 package index
 
 import (
+	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"tchaik.com/index/attr"
 )
@@ -56,7 +61,7 @@ func (f filter) Items() []FilterItem {
 }
 
 // FilterCollection creates Filter of the Collection using fields to partition
-// Tracks in a collection.
+// Tracks in a collection.  Int fields are partitioned by their (non-zero) values.
 func FilterCollection(c Collection, field attr.Interface) Filter {
 	m := make(map[string][]Path)
 	walkfn := func(t Track, p Path) error {
@@ -68,6 +73,11 @@ func FilterCollection(c Collection, field attr.Interface) Filter {
 			for _, x := range f {
 				m[x] = append(m[x], p)
 			}
+		case int:
+			if f != 0 {
+				k := strconv.Itoa(f)
+				m[k] = append(m[k], p)
+			}
 		}
 		return nil
 	}
@@ -84,3 +94,87 @@ func FilterCollection(c Collection, field attr.Interface) Filter {
 	sort.Sort(FilterItemSlice(items))
 	return filter{items}
 }
+
+// BucketFunc returns the name of the bucket of the filter item with the given name, or "" if the
+// item should be omitted.
+type BucketFunc func(name string) string
+
+// Bucket creates a Filter whose items are buckets of the items of f, computed by applying fn to
+// the name of each item (i.e. grouping years into decades).  The paths of each bucket are the
+// union of the paths of its items.
+func Bucket(f Filter, fn BucketFunc) Filter {
+	var names []string
+	m := make(map[string][][]Path)
+	for _, x := range f.Items() {
+		b := fn(x.Name())
+		if b == "" {
+			continue
+		}
+		if _, ok := m[b]; !ok {
+			names = append(names, b)
+		}
+		m[b] = append(m[b], x.Paths())
+	}
+
+	items := make([]FilterItem, 0, len(names))
+	for _, n := range names {
+		items = append(items, &filterItem{
+			name:   n,
+			fields: make(map[string]interface{}),
+			paths:  Union(m[n]...),
+		})
+	}
+	sort.Sort(FilterItemSlice(items))
+	return filter{items}
+}
+
+// DecadeBucket is a BucketFunc which groups years (i.e. "1994") into decades ("1990s").
+func DecadeBucket(name string) string {
+	y, err := strconv.Atoi(name)
+	if err != nil || y == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", y-y%10)
+}
+
+// LetterBucket is a BucketFunc which groups names by their first letter (in upper case) for
+// an A-Z index.  Names which don't start with a letter are grouped into "#".
+func LetterBucket(name string) string {
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(name))
+	if r == utf8.RuneError {
+		return ""
+	}
+	if !unicode.IsLetter(r) {
+		return "#"
+	}
+	return string(unicode.ToUpper(r))
+}
+
+// FilterPaths returns the paths of the item with name names[0] in filters[0], intersected
+// with the paths of the item with name names[i] in filters[i] for each subsequent level.
+// Returns an error if len(names) is greater than len(filters), or an item cannot be found.
+func FilterPaths(filters []Filter, names []string) ([]Path, error) {
+	if len(names) == 0 || len(names) > len(filters) {
+		return nil, fmt.Errorf("invalid number of filter levels: %d (max %d)", len(names), len(filters))
+	}
+
+	var levels [][]Path
+	for i, name := range names {
+		var item FilterItem
+		for _, x := range filters[i].Items() {
+			if x.Name() == name {
+				item = x
+				break
+			}
+		}
+		if item == nil {
+			return nil, fmt.Errorf("invalid filter item: %#v", name)
+		}
+		levels = append(levels, item.Paths())
+	}
+
+	if len(levels) == 1 {
+		return levels[0], nil
+	}
+	return OrderedIntersection(levels...), nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterPaths(t *testing.T) {
+	genre := filter{[]FilterItem{
+		&filterItem{name: "Jazz", paths: []Path{NewPath("Root:a:0"), NewPath("Root:a:1"), NewPath("Root:b:0")}},
+		&filterItem{name: "Rock", paths: []Path{NewPath("Root:c:0")}},
+	}}
+	year := filter{[]FilterItem{
+		&filterItem{name: "1959", paths: []Path{NewPath("Root:a:1"), NewPath("Root:c:0")}},
+	}}
+	filters := []Filter{genre, year}
+
+	tests := []struct {
+		names    []string
+		expected []Path
+		ok       bool
+	}{
+		{[]string{"Jazz"}, []Path{NewPath("Root:a:0"), NewPath("Root:a:1"), NewPath("Root:b:0")}, true},
+		{[]string{"Jazz", "1959"}, []Path{NewPath("Root:a:1")}, true},
+		{[]string{"Rock", "1959"}, []Path{NewPath("Root:c:0")}, true},
+		{[]string{"Jazz", "1960"}, nil, false},
+		{[]string{"Jazz", "1959", "x"}, nil, false},
+		{nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := FilterPaths(filters, tt.names)
+		if (err == nil) != tt.ok {
+			t.Errorf("FilterPaths(%v) error = %v, expected ok: %v", tt.names, err, tt.ok)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("FilterPaths(%v) = %v, expected: %v", tt.names, got, tt.expected)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	year := filter{[]FilterItem{
+		&filterItem{name: "1959", paths: []Path{NewPath("Root:a:0"), NewPath("Root:a:1")}},
+		&filterItem{name: "1964", paths: []Path{NewPath("Root:b:0")}},
+		&filterItem{name: "1951", paths: []Path{NewPath("Root:c:0"), NewPath("Root:a:1")}},
+		&filterItem{name: "1972", paths: []Path{NewPath("Root:d:0")}},
+	}}
+
+	got := Bucket(year, DecadeBucket).Items()
+	expected := []struct {
+		name  string
+		paths []Path
+	}{
+		{"1950s", []Path{NewPath("Root:a:0"), NewPath("Root:a:1"), NewPath("Root:c:0")}},
+		{"1960s", []Path{NewPath("Root:b:0")}},
+		{"1970s", []Path{NewPath("Root:d:0")}},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("len(Bucket(...).Items()) = %d, expected: %d", len(got), len(expected))
+	}
+	for i, x := range expected {
+		if got[i].Name() != x.name || !reflect.DeepEqual(got[i].Paths(), x.paths) {
+			t.Errorf("Bucket(...).Items()[%d] = %v %v, expected: %v %v", i, got[i].Name(), got[i].Paths(), x.name, x.paths)
+		}
+	}
+
+	// Buckets can be used by FilterPaths like any other filter.
+	paths, err := FilterPaths([]Filter{Bucket(year, DecadeBucket)}, []string{"1950s"})
+	if err != nil || !reflect.DeepEqual(paths, expected[0].paths) {
+		t.Errorf("FilterPaths(..., %v) = %v, %v, expected: %v, nil", []string{"1950s"}, paths, err, expected[0].paths)
+	}
+}
+
+func TestLetterBucket(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"Miles Davis", "M"},
+		{"miles davis", "M"},
+		{" Öl", "Ö"},
+		{"2Pac", "#"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := LetterBucket(tt.in); got != tt.out {
+			t.Errorf("LetterBucket(%#v) = %#v, expected: %#v", tt.in, got, tt.out)
+		}
+	}
+}
@@ -50,7 +50,7 @@ func Collect(t Tracker, c Collector) Collection {
 // in the Collection.
 func CollectionPaths(c Collection, root Path) []Path {
 	keys := c.Keys()
-	paths := make([]Path, len(keys))
+	paths := make([]Path, 0, len(keys))
 	for _, k := range keys {
 		p := make(Path, len(root)+1)
 		copy(p, root)
@@ -318,6 +318,28 @@ func Recent(c Collection, n int) []Path {
 	return result
 }
 
+// RecentlyAdded returns the paths of the n most recently added tracks, newest first.  If n
+// is not positive then the paths of all tracks are returned.
+func RecentlyAdded(c Collection, n int) []Path {
+	var trackPaths []trackPath
+	walkfn := func(t Track, p Path) error {
+		trackPaths = append(trackPaths, trackPath{t, p})
+		return nil
+	}
+	Walk(c, Path([]Key{"Root"}), walkfn)
+
+	sort.Stable(sort.Reverse(trackPathSorter{trackPaths, SortByTime("DateAdded")}))
+
+	if n > 0 && n < len(trackPaths) {
+		trackPaths = trackPaths[:n]
+	}
+	result := make([]Path, len(trackPaths))
+	for i, tp := range trackPaths {
+		result[i] = tp.p
+	}
+	return result
+}
+
 // By is a function which returns a Collector to group a collection using the given
 // attribute.
 func By(a attr.Interface) Collector {
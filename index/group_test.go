@@ -16,6 +16,7 @@ type testTrack struct {
 	Name, Album, Artist, Composer           string
 	TrackNumber, DiscNumber, Duration, Year int
 	stringsMap                              map[string][]string
+	DateAdded                               time.Time
 }
 
 func (f testTrack) GetString(k string) string {
@@ -63,7 +64,10 @@ func (f testTrack) GetBool(k string) bool {
 	return false
 }
 
-func (f testTrack) GetTime(string) time.Time {
+func (f testTrack) GetTime(k string) time.Time {
+	if k == "DateAdded" {
+		return f.DateAdded
+	}
 	return time.Time{}
 }
 
@@ -112,6 +116,54 @@ func TestByAttr(t *testing.T) {
 	}
 }
 
+func TestCollectionPaths(t *testing.T) {
+	trackListing := []testTrack{
+		{Name: "A", Album: "Album A"},
+		{Name: "B", Album: "Album B"},
+	}
+
+	c := By(attr.String("Album")).Collect(testTracker(trackListing[:]))
+	SortKeysByGroupName(c)
+
+	got := CollectionPaths(c, Path{"Root"})
+	expected := make([]Path, 0, len(c.Keys()))
+	for _, k := range c.Keys() {
+		expected = append(expected, Path{"Root", k})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("CollectionPaths() = %v, expected: %v", got, expected)
+	}
+}
+
+func TestRecentlyAdded(t *testing.T) {
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	trackListing := []testTrack{
+		{Name: "A", Album: "Album A", DateAdded: t0},
+		{Name: "B", Album: "Album A", DateAdded: t0.Add(2 * time.Hour)},
+		{Name: "C", Album: "Album B", DateAdded: t0.Add(time.Hour)},
+	}
+
+	c := By(attr.String("Album")).Collect(testTracker(trackListing[:]))
+	SortKeysByGroupName(c)
+	keys := c.Keys()
+
+	tests := []struct {
+		n        int
+		expected []Path
+	}{
+		{0, []Path{{"Root", keys[0], "1"}, {"Root", keys[1], "0"}, {"Root", keys[0], "0"}}},
+		{2, []Path{{"Root", keys[0], "1"}, {"Root", keys[1], "0"}}},
+		{5, []Path{{"Root", keys[0], "1"}, {"Root", keys[1], "0"}, {"Root", keys[0], "0"}}},
+	}
+
+	for _, tt := range tests {
+		got := RecentlyAdded(c, tt.n)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("RecentlyAdded(c, %d) = %v, expected: %v", tt.n, got, tt.expected)
+		}
+	}
+}
+
 func TestSubCollect(t *testing.T) {
 	album1 := "Mahler Symphonies"
 	album2 := "Shostakovich Symphonies"
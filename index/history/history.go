@@ -3,6 +3,7 @@ package history
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,8 +17,23 @@ type Store interface {
 	Add(index.Path) error
 	// Get the play events associated to a path.
 	Get(index.Path) []time.Time
+	// Recent returns the n most recent play events (most recent first).
+	Recent(n int) []Event
 }
 
+// Event is a play event.
+type Event struct {
+	Path index.Path `json:"path"`
+	Time time.Time  `json:"time"`
+}
+
+// eventSlice is a convenience type for sorting Events by time (most recent first).
+type eventSlice []Event
+
+func (e eventSlice) Len() int           { return len(e) }
+func (e eventSlice) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e eventSlice) Less(i, j int) bool { return e[i].Time.After(e[j].Time) }
+
 // NewStore creates a basic implementation of a play history store, using the given path as the
 // source of data. If the file does not exist it will be created.
 func NewStore(path string) (Store, error) {
@@ -57,3 +73,22 @@ func (s *store) Get(p index.Path) []time.Time {
 
 	return s.m[fmt.Sprintf("%v", p)]
 }
+
+// Recent implements Store.
+func (s *store) Recent(n int) []Event {
+	s.RLock()
+	defer s.RUnlock()
+
+	var events []Event
+	for k, times := range s.m {
+		p := index.NewPath(k)
+		for _, t := range times {
+			events = append(events, Event{Path: p, Time: t})
+		}
+	}
+	sort.Sort(eventSlice(events))
+	if n >= 0 && len(events) > n {
+		events = events[:n]
+	}
+	return events
+}
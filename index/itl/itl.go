@@ -102,6 +102,8 @@ func (t *itlTrack) GetString(name string) string {
 		return html.UnescapeString(t.Genre)
 	case "Kind":
 		return html.UnescapeString(t.Kind)
+	case "Format":
+		return kindFormat(t.Kind)
 	}
 
 	tt := reflect.TypeOf(t)
@@ -118,6 +120,24 @@ func (t *itlTrack) GetString(name string) string {
 	return html.UnescapeString(f.String())
 }
 
+// kindFormat returns the name of the audio format of files of the given kind, or "" if
+// unknown.
+func kindFormat(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "MPEG"):
+		return "MP3"
+	case strings.Contains(kind, "AAC"):
+		return "AAC"
+	case strings.HasPrefix(kind, "Apple Lossless"):
+		return "ALAC"
+	case strings.HasPrefix(kind, "AIFF"):
+		return "AIFF"
+	case strings.HasPrefix(kind, "WAV"):
+		return "WAV"
+	}
+	return ""
+}
+
 // GetStrings implements index.Track (will panic if the field doesn't exist as a list
 // of strings).
 func (t *itlTrack) GetStrings(name string) []string {
@@ -147,6 +167,14 @@ func (t *itlTrack) GetInt(name string) int {
 		return t.TotalTime
 	case "BitRate":
 		return t.BitRate
+	case "SampleRate":
+		return t.SampleRate
+	case "Size":
+		return t.Size
+	case "TrackGain", "AlbumGain", "BitDepth": // iTunes doesn't store these values
+		return 0
+	case "StartTime", "EndTime": // tracks are always whole files
+		return 0
 	}
 
 	tt := reflect.TypeOf(t)
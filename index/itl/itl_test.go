@@ -0,0 +1,51 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package itl
+
+import (
+	"bytes"
+	"testing"
+
+	rawitl "github.com/dhowden/itl"
+	"tchaik.com/index"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	l := &itlLibrary{&rawitl.Library{
+		Tracks: map[string]rawitl.Track{
+			"1": {
+				TrackID:   1,
+				Name:      "Name",
+				Album:     "Album",
+				Kind:      "MPEG audio file",
+				Location:  "file:///Music/Name.mp3",
+				TrackType: "File",
+				TotalTime: 1000,
+				Size:      123456,
+			},
+		},
+	}}
+
+	c := index.Convert(l, "ID")
+	buf := &bytes.Buffer{}
+	if err := index.WriteTo(c, buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	got, err := index.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+
+	tr, ok := got.Track("1")
+	if !ok {
+		t.Fatalf("Track(%#v) = _, false, expected true", "1")
+	}
+	if size := tr.GetInt("Size"); size != 123456 {
+		t.Errorf("GetInt(%#v) = %d, expected: %d", "Size", size, 123456)
+	}
+	if loc := tr.GetString("Location"); loc != "/Music/Name.mp3" {
+		t.Errorf("GetString(%#v) = %#v, expected: %#v", "Location", loc, "/Music/Name.mp3")
+	}
+}
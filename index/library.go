@@ -64,6 +64,7 @@ func Convert(l Library, id string) *library {
 			Genre:       t.GetString("Genre"),
 			Location:    t.GetString("Location"),
 			Kind:        t.GetString("Kind"),
+			Format:      t.GetString("Format"),
 
 			// integer fields
 			TotalTime:   t.GetInt("TotalTime"),
@@ -73,6 +74,13 @@ func Convert(l Library, id string) *library {
 			TrackCount:  t.GetInt("TrackCount"),
 			DiscCount:   t.GetInt("DiscCount"),
 			BitRate:     t.GetInt("BitRate"),
+			SampleRate:  t.GetInt("SampleRate"),
+			BitDepth:    t.GetInt("BitDepth"),
+			Size:        t.GetInt("Size"),
+			StartTime:   t.GetInt("StartTime"),
+			EndTime:     t.GetInt("EndTime"),
+			TrackGain:   t.GetInt("TrackGain"),
+			AlbumGain:   t.GetInt("AlbumGain"),
 
 			// date fields
 			DateAdded:    t.GetTime("DateAdded"),
@@ -149,6 +157,7 @@ type track struct {
 	Genre       string `json:"genre,omitempty"`
 	Location    string `json:"location,omitempty"`
 	Kind        string `json:"kind"`
+	Format      string `json:"format,omitempty"`
 
 	TotalTime   int `json:"totalTime,omitempty"`
 	Year        int `json:"year,omitempty"`
@@ -157,6 +166,19 @@ type track struct {
 	TrackCount  int `json:"trackCount,omitempty"`
 	DiscCount   int `json:"discCount,omitempty"`
 	BitRate     int `json:"bitRate,omitempty"`
+	SampleRate  int `json:"sampleRate,omitempty"`
+	BitDepth    int `json:"bitDepth,omitempty"`
+	Size        int `json:"size,omitempty"`
+
+	// StartTime and EndTime are the positions (in milliseconds) of tracks which are part of
+	// a file (i.e. split by a cue sheet), an EndTime of 0 is the end of the file.  Both
+	// are 0 for tracks which are the whole file.
+	StartTime int `json:"startTime,omitempty"`
+	EndTime   int `json:"endTime,omitempty"`
+
+	// ReplayGain values, in hundredths of a dB.
+	TrackGain int `json:"trackGain,omitempty"`
+	AlbumGain int `json:"albumGain,omitempty"`
 
 	DateAdded    time.Time `json:"dateAdded,omitempty"`
 	DateModified time.Time `json:"dateModified,omitempty"`
@@ -183,6 +205,8 @@ func (t *track) GetString(name string) string {
 		return t.Location
 	case "Kind":
 		return t.Kind
+	case "Format":
+		return t.Format
 	}
 	panic(fmt.Sprintf("unknown string field '%v'", name))
 }
@@ -224,6 +248,20 @@ func (t *track) GetInt(name string) int {
 		return t.DiscCount
 	case "BitRate":
 		return t.BitRate
+	case "SampleRate":
+		return t.SampleRate
+	case "BitDepth":
+		return t.BitDepth
+	case "Size":
+		return t.Size
+	case "StartTime":
+		return t.StartTime
+	case "EndTime":
+		return t.EndTime
+	case "TrackGain":
+		return t.TrackGain
+	case "AlbumGain":
+		return t.AlbumGain
 	}
 	panic(fmt.Sprintf("unknown int field '%v'", name))
 }
@@ -0,0 +1,214 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lyrics implements parsing of track lyrics, including synced lyrics in LRC format,
+// and fetching lyrics from HTTP providers.
+package lyrics
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line is a line of synced lyrics.
+type Line struct {
+	Time int    `json:"time"` // milliseconds
+	Text string `json:"text"`
+}
+
+// lineSlice is a convenience type for sorting Lines by time.
+type lineSlice []Line
+
+func (l lineSlice) Len() int           { return len(l) }
+func (l lineSlice) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l lineSlice) Less(i, j int) bool { return l[i].Time < l[j].Time }
+
+// Lyrics are the lyrics of a track.
+type Lyrics struct {
+	// Text is the plain text of the lyrics (without any timestamps).
+	Text string `json:"text"`
+	// Lines are the timed lines of synced lyrics, in order (empty if the lyrics aren't
+	// synced).
+	Lines []Line `json:"lines,omitempty"`
+}
+
+// Synced returns true if the lyrics have timed lines.
+func (l Lyrics) Synced() bool { return len(l.Lines) > 0 }
+
+// Parse parses lyrics, which can be plain text or synced lyrics in LRC format (lines prefixed
+// with one or more [mm:ss.xx] timestamps).  LRC metadata tags (i.e. [ar:Artist]) are dropped,
+// except for [offset:ms], which is applied to the timestamps.
+func Parse(s string) Lyrics {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+
+	var text []string
+	var lines []Line
+	var offset int
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		times, rest := parseTimes(line)
+		if len(times) > 0 {
+			text = append(text, rest)
+			for _, t := range times {
+				lines = append(lines, Line{Time: t, Text: rest})
+			}
+			continue
+		}
+
+		if k, v, ok := parseTag(line); ok {
+			if k == "offset" {
+				offset, _ = strconv.Atoi(v)
+			}
+			continue
+		}
+		text = append(text, line)
+	}
+
+	// A positive offset shifts the lyrics earlier.
+	for i := range lines {
+		lines[i].Time -= offset
+		if lines[i].Time < 0 {
+			lines[i].Time = 0
+		}
+	}
+	sort.Stable(lineSlice(lines))
+
+	return Lyrics{
+		Text:  strings.TrimSpace(strings.Join(text, "\n")),
+		Lines: lines,
+	}
+}
+
+// parseTimes returns the times (in milliseconds) of the LRC timestamps at the start of the
+// line, and the rest of the line.
+func parseTimes(line string) ([]int, string) {
+	var times []int
+	for strings.HasPrefix(line, "[") {
+		i := strings.Index(line, "]")
+		if i < 0 {
+			break
+		}
+		t, ok := parseTimestamp(line[1:i])
+		if !ok {
+			break
+		}
+		times = append(times, t)
+		line = line[i+1:]
+	}
+	return times, strings.TrimSpace(line)
+}
+
+// parseTag returns the key and value of the line if it is an LRC metadata tag, i.e.
+// [ar:Artist].
+func parseTag(line string) (string, string, bool) {
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", "", false
+	}
+	line = line[1 : len(line)-1]
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	for _, r := range line[:i] {
+		if r < 'a' || r > 'z' {
+			return "", "", false
+		}
+	}
+	return line[:i], strings.TrimSpace(line[i+1:]), true
+}
+
+// parseTimestamp parses an LRC timestamp of the form mm:ss, mm:ss.xx or mm:ss.xxx, returning
+// the time in milliseconds.
+func parseTimestamp(s string) (int, bool) {
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return 0, false
+	}
+	m, err := strconv.Atoi(s[:i])
+	if err != nil || m < 0 {
+		return 0, false
+	}
+
+	sec, frac := s[i+1:], ""
+	if j := strings.IndexAny(sec, ".:"); j >= 0 {
+		sec, frac = sec[:j], sec[j+1:]
+	}
+	n, err := strconv.Atoi(sec)
+	if err != nil || n < 0 || n >= 60 || len(sec) != 2 {
+		return 0, false
+	}
+
+	ms := (m*60 + n) * 1000
+	if frac != "" {
+		if len(frac) > 3 {
+			return 0, false
+		}
+		f, err := strconv.Atoi(frac)
+		if err != nil || f < 0 {
+			return 0, false
+		}
+		for k := len(frac); k < 3; k++ {
+			f *= 10
+		}
+		ms += f
+	}
+	return ms, true
+}
+
+// Provider is an interface which defines methods for fetching lyrics of tracks which have
+// none embedded.
+type Provider interface {
+	// Lyrics returns the (unparsed) lyrics of the track, or ErrNotFound if there are none.
+	Lyrics(artist, title string) (string, error)
+}
+
+// ErrNotFound is returned by Providers which don't have lyrics for a track.
+var ErrNotFound = errors.New("lyrics not found")
+
+// httpTimeout is the timeout for requests to HTTP providers.
+const httpTimeout = 10 * time.Second
+
+// HTTPProvider is a Provider which fetches lyrics (as plain text or LRC) from a URL.  The URL
+// is a template, where {artist} and {title} are replaced by the (query escaped) artist and
+// title of the track.  Responses with status 404 are treated as ErrNotFound.
+type HTTPProvider string
+
+// Lyrics implements Provider.
+func (p HTTPProvider) Lyrics(artist, title string) (string, error) {
+	u := strings.NewReplacer(
+		"{artist}", url.QueryEscape(artist),
+		"{title}", url.QueryEscape(title),
+	).Replace(string(p))
+
+	client := &http.Client{Timeout: httpTimeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("unexpected response from lyrics provider: %v", resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(b)) == "" {
+		return "", ErrNotFound
+	}
+	return string(b), nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lyrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in string
+		ms int
+		ok bool
+	}{
+		{"00:00", 0, true},
+		{"01:02.5", 62500, true},
+		{"01:02.50", 62500, true},
+		{"01:02.505", 62505, true},
+		{"10:02:05", 602050, true},
+		{"1:02", 62000, true},
+		{"01:60", 0, false},
+		{"01:2", 0, false},
+		{"ar:Artist", 0, false},
+		{"01:02.5000", 0, false},
+	}
+
+	for _, tt := range tests {
+		ms, ok := parseTimestamp(tt.in)
+		if ms != tt.ms || ok != tt.ok {
+			t.Errorf("parseTimestamp(%#v) = %v, %v, expected: %v, %v", tt.in, ms, ok, tt.ms, tt.ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Lyrics
+	}{
+		{
+			"Hello\r\n\r\nWorld\r\n",
+			Lyrics{Text: "Hello\n\nWorld"},
+		},
+		{
+			"[ar:Artist]\n[ti:Title]\n[00:01.00]Hello\n[00:03.00][00:05.00]World\n",
+			Lyrics{
+				Text: "Hello\nWorld",
+				Lines: []Line{
+					{Time: 1000, Text: "Hello"},
+					{Time: 3000, Text: "World"},
+					{Time: 5000, Text: "World"},
+				},
+			},
+		},
+		{
+			"[offset:500]\n[00:02.00]Second\n[00:00.20]First\n[Chorus]\n",
+			Lyrics{
+				Text: "Second\nFirst\n[Chorus]",
+				Lines: []Line{
+					{Time: 0, Text: "First"},
+					{Time: 1500, Text: "Second"},
+				},
+			},
+		},
+	}
+
+	for ii, tt := range tests {
+		got := Parse(tt.in)
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("[%d] Parse(%#v) = %#v, expected: %#v", ii, tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("title") {
+		case "Found Song":
+			fmt.Fprintf(w, "lyrics of %v by %v", r.URL.Query().Get("title"), r.URL.Query().Get("artist"))
+		case "Error":
+			http.Error(w, "error", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	p := HTTPProvider(s.URL + "/?artist={artist}&title={title}")
+	tests := []struct {
+		title string
+		out   string
+		err   error
+	}{
+		{"Found Song", "lyrics of Found Song by A & B", nil},
+		{"Missing", "", ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		got, err := p.Lyrics("A & B", tt.title)
+		if got != tt.out || err != tt.err {
+			t.Errorf("Lyrics(%#v) = %#v, %v, expected: %#v, %v", tt.title, got, err, tt.out, tt.err)
+		}
+	}
+
+	if _, err := p.Lyrics("A & B", "Error"); err == nil || err == ErrNotFound {
+		t.Errorf("Lyrics(%#v) error = %v, expected provider error", "Error", err)
+	}
+}
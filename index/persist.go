@@ -7,9 +7,26 @@ package index
 import (
 	"encoding/json"
 	"io"
+	"log"
 	"os"
+	"sync"
+	"time"
 )
 
+// Persister is an interface which defines the Persist method.
+type Persister interface {
+	// Persist writes the data to the underlying data store, overwriting any previous data.
+	Persist(data interface{}) error
+}
+
+// FlushPersister is a Persister which can delay writes, and so also defines the Flush method.
+type FlushPersister interface {
+	Persister
+
+	// Flush writes any delayed data immediately.
+	Flush() error
+}
+
 // PersistStore is a type which defines a simple persistence store.
 type PersistStore string
 
@@ -38,17 +55,81 @@ func NewPersistStore(path string, data interface{}) (PersistStore, error) {
 
 // Persist writes the data to the underlying data store, overwriting any previous data.
 func (p PersistStore) Persist(data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return p.write(b)
+}
+
+func (p PersistStore) write(b []byte) error {
 	f, err := os.Create(string(p))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
+	_, err = f.Write(b)
+	return err
+}
+
+// Debounce returns a Persister which delays writes to the PersistStore until no calls to
+// Persist have been made for the duration d, so that rapid changes result in a single write.
+// The data is encoded when Persist is called, and so can be modified after it returns.
+// Errors writing the data are logged.  Flush must be called before exiting, otherwise
+// changes made within d of exiting are lost.
+func Debounce(p PersistStore, d time.Duration) FlushPersister {
+	return &debounced{
+		p: p,
+		d: d,
+	}
+}
+
+type debounced struct {
+	sync.Mutex
+	p     PersistStore
+	d     time.Duration
+	b     []byte
+	timer *time.Timer
+}
+
+// Persist implements Persister.
+func (p *debounced) Persist(data interface{}) error {
 	b, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	_, err = f.Write(b)
-	return err
+	p.Lock()
+	defer p.Unlock()
+
+	p.b = b
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(p.d, p.flush)
+	return nil
+}
+
+func (p *debounced) flush() {
+	if err := p.Flush(); err != nil {
+		log.Printf("error persisting data to '%v': %v", string(p.p), err)
+	}
+}
+
+// Flush implements FlushPersister.
+func (p *debounced) Flush() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if p.b == nil {
+		return nil
+	}
+	b := p.b
+	p.b = nil
+	return p.p.write(b)
 }
@@ -0,0 +1,97 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "persist")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.json")
+	m := make(map[string]bool)
+	s, err := NewPersistStore(path, &m)
+	if err != nil {
+		t.Fatalf("unexpected error creating persist store: %v", err)
+	}
+
+	p := Debounce(s, 20*time.Millisecond)
+	for _, k := range []string{"a", "b", "c"} {
+		m[k] = true
+		if err := p.Persist(&m); err != nil {
+			t.Fatalf("unexpected error from Persist: %v", err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %v", err)
+	}
+	if len(b) != 0 {
+		t.Errorf("file written before debounce delay: %s", b)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	got := make(map[string]bool)
+	if _, err := NewPersistStore(path, &got); err != nil {
+		t.Fatalf("unexpected error reading persisted data: %v", err)
+	}
+	if len(got) != len(m) {
+		t.Errorf("persisted data = %v, expected: %v", got, m)
+	}
+}
+
+func TestDebounceFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "persist")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.json")
+	m := make(map[string]bool)
+	s, err := NewPersistStore(path, &m)
+	if err != nil {
+		t.Fatalf("unexpected error creating persist store: %v", err)
+	}
+
+	p := Debounce(s, time.Hour)
+	m["a"] = true
+	if err := p.Persist(&m); err != nil {
+		t.Fatalf("unexpected error from Persist: %v", err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatalf("unexpected error from Flush: %v", err)
+	}
+
+	got := make(map[string]bool)
+	if _, err := NewPersistStore(path, &got); err != nil {
+		t.Fatalf("unexpected error reading persisted data: %v", err)
+	}
+	if !got["a"] {
+		t.Errorf("persisted data after Flush = %v, expected: %v", got, m)
+	}
+
+	// Nothing is pending, so flushing again is a no-op.
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("unexpected error removing file: %v", err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Errorf("unexpected error from second Flush: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file written by second Flush, expected no write")
+	}
+}
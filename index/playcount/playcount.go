@@ -0,0 +1,113 @@
+// Package playcount defines methods for counting plays of index paths and persisting
+// this data.
+package playcount
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"tchaik.com/index"
+)
+
+// Store is an interface which defines methods necessary for counting plays of index paths.
+type Store interface {
+	// Increment the play count for the path.
+	Increment(index.Path) error
+
+	// Get the play count for the path.
+	Get(index.Path) int
+
+	// Top returns the n most played paths (most played first), ties are broken by the
+	// most recent play.
+	Top(n int) []index.Path
+}
+
+// entry is the play count of a path, and the time of the last play.
+type entry struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// NewStore creates a basic implementation of a play count store, using the given path as the
+// source of data. If the file does not exist it will be created.
+func NewStore(path string) (Store, error) {
+	m := make(map[string]entry)
+	s, err := index.NewPersistStore(path, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store{
+		m:     m,
+		store: s,
+	}, nil
+}
+
+type store struct {
+	sync.RWMutex
+
+	m     map[string]entry
+	store index.PersistStore
+}
+
+// Increment implements Store.
+func (s *store) Increment(p index.Path) error {
+	s.Lock()
+	defer s.Unlock()
+
+	k := fmt.Sprintf("%v", p)
+	e := s.m[k]
+	e.Count++
+	e.Last = time.Now().UTC()
+	s.m[k] = e
+	return s.store.Persist(&s.m)
+}
+
+// Get implements Store.
+func (s *store) Get(p index.Path) int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.m[fmt.Sprintf("%v", p)].Count
+}
+
+type keyEntry struct {
+	key string
+	entry
+}
+
+// keyEntrySlice is a convenience type for sorting keyEntries by count (largest first), then
+// by last play (most recent first).
+type keyEntrySlice []keyEntry
+
+func (k keyEntrySlice) Len() int      { return len(k) }
+func (k keyEntrySlice) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k keyEntrySlice) Less(i, j int) bool {
+	if k[i].Count != k[j].Count {
+		return k[i].Count > k[j].Count
+	}
+	return k[i].Last.After(k[j].Last)
+}
+
+// Top implements Store.
+func (s *store) Top(n int) []index.Path {
+	s.RLock()
+	entries := make([]keyEntry, 0, len(s.m))
+	for k, e := range s.m {
+		entries = append(entries, keyEntry{k, e})
+	}
+	s.RUnlock()
+
+	sort.Sort(keyEntrySlice(entries))
+	if n >= 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+
+	paths := make([]index.Path, len(entries))
+	for i, e := range entries {
+		paths[i] = index.NewPath(e.key)
+	}
+	return paths
+}
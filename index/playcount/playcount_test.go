@@ -0,0 +1,35 @@
+package playcount
+
+import (
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+)
+
+func TestTop(t *testing.T) {
+	now := time.Now()
+	s := &store{
+		m: map[string]entry{
+			"T:1": {Count: 2, Last: now.Add(-time.Hour)},
+			"T:2": {Count: 5, Last: now.Add(-2 * time.Hour)},
+			"T:3": {Count: 2, Last: now},
+			"T:4": {Count: 1, Last: now},
+		},
+	}
+
+	expected := []index.Path{{"T", "2"}, {"T", "3"}, {"T", "1"}}
+	got := s.Top(3)
+	if len(got) != len(expected) {
+		t.Fatalf("len(s.Top(3)) = %d, expected: %d", len(got), len(expected))
+	}
+	for i, p := range got {
+		if !p.Equal(expected[i]) {
+			t.Errorf("s.Top(3)[%d] = %v, expected: %v", i, p, expected[i])
+		}
+	}
+
+	if n := len(s.Top(-1)); n != len(s.m) {
+		t.Errorf("len(s.Top(-1)) = %d, expected: %d", n, len(s.m))
+	}
+}
@@ -96,17 +96,30 @@ func (i *Item) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// Meta is descriptive information attached to a playlist.
+type Meta struct {
+	// Description is a free-form description of the playlist.
+	Description string `json:"description,omitempty"`
+
+	// Cover is a reference to the artwork which represents the playlist: the ID
+	// of a track whose artwork is served through the artwork endpoint.
+	Cover string `json:"cover,omitempty"`
+}
+
 // Playlist is a basic implementation of a playlist
 type Playlist struct {
 	items []*Item
+	meta  Meta
 }
 
 // MarshalJSON implements json.Marshaler.
 func (p *Playlist) MarshalJSON() ([]byte, error) {
 	exp := struct {
 		Items []*Item `json:"items"`
+		Meta
 	}{
 		p.items,
+		p.meta,
 	}
 	return json.Marshal(exp)
 }
@@ -115,20 +128,80 @@ func (p *Playlist) MarshalJSON() ([]byte, error) {
 func (p *Playlist) UnmarshalJSON(b []byte) error {
 	exp := struct {
 		Items []*Item `json:"items"`
+		Meta
 	}{}
 	err := json.Unmarshal(b, &exp)
 	if err != nil {
 		return err
 	}
 	p.items = exp.Items
+	p.meta = exp.Meta
 	return nil
 }
 
+// Meta returns the descriptive information attached to the Playlist.
+func (p *Playlist) Meta() Meta {
+	return p.meta
+}
+
+// SetMeta sets the descriptive information attached to the Playlist.
+func (p *Playlist) SetMeta(m Meta) {
+	p.meta = m
+}
+
 // Add adds a new with the path to the Playlist.
 func (p *Playlist) Add(path index.Path) {
 	p.items = append(p.items, newItem(path))
 }
 
+// Insert inserts a new item with the path at index `n` of the Playlist.  If `n` is past the
+// end of the Playlist then the item is appended.
+func (p *Playlist) Insert(n int, path index.Path) {
+	if n < 0 {
+		n = 0
+	}
+	if n >= len(p.items) {
+		p.Add(path)
+		return
+	}
+	p.items = append(p.items, nil)
+	copy(p.items[n+1:], p.items[n:])
+	p.items[n] = newItem(path)
+}
+
+// Move moves the item with index `from` to index `to`, shifting the items in between.
+func (p *Playlist) Move(from, to int) error {
+	if from < 0 || from >= len(p.items) {
+		return fmt.Errorf("invalid item index (items: %d): %d", len(p.items), from)
+	}
+	if to < 0 || to >= len(p.items) {
+		return fmt.Errorf("invalid destination index (items: %d): %d", len(p.items), to)
+	}
+
+	item := p.items[from]
+	if from < to {
+		copy(p.items[from:to], p.items[from+1:to+1])
+	} else {
+		copy(p.items[to+1:from+1], p.items[to:from])
+	}
+	p.items[to] = item
+	return nil
+}
+
+// MovedIndex returns the index of the item at index `i` after the item at index `from` has
+// been moved to index `to` (see Move).
+func MovedIndex(i, from, to int) int {
+	switch {
+	case i == from:
+		return to
+	case from < to && from < i && i <= to:
+		return i - 1
+	case to < from && to <= i && i < from:
+		return i + 1
+	}
+	return i
+}
+
 // Remove removes the item with index `n` and path `path` from the Playlist.
 func (p *Playlist) Remove(n int, path index.Path) error {
 	if n >= len(p.items) {
@@ -148,6 +221,20 @@ func (p *Playlist) Remove(n int, path index.Path) error {
 	return nil
 }
 
+// Prune removes items whose paths are not reported as existing by exists.  Returns the number
+// of items removed.
+func (p *Playlist) Prune(exists func(index.Path) bool) int {
+	items := p.items[:0]
+	for _, item := range p.items {
+		if exists(item.path) {
+			items = append(items, item)
+		}
+	}
+	n := len(p.items) - len(items)
+	p.items = items
+	return n
+}
+
 // Items returns a slice of *Item instances which represent each item in the playlist.
 func (p *Playlist) Items() []*Item {
 	items := make([]*Item, len(p.items))
@@ -5,6 +5,7 @@
 package playlist
 
 import (
+	"encoding/json"
 	"testing"
 
 	"tchaik.com/index"
@@ -26,6 +27,71 @@ func TestPlaylistAdd(t *testing.T) {
 	}
 }
 
+func TestPlaylistInsert(t *testing.T) {
+	pathA := index.NewPath("Root:a")
+	pathB := index.NewPath("Root:b")
+	pathC := index.NewPath("Root:c")
+
+	p := &Playlist{}
+	p.Insert(5, pathA)
+	p.Insert(0, pathB)
+	p.Insert(1, pathC)
+
+	expected := []index.Path{pathB, pathC, pathA}
+	items := p.Items()
+	if len(items) != len(expected) {
+		t.Fatalf("len(p.Items()) = %d, expected: %d", len(items), len(expected))
+	}
+	for i, item := range items {
+		if !item.path.Equal(expected[i]) {
+			t.Errorf("p.Items()[%d].path = %v, expected: %v", i, item.path, expected[i])
+		}
+	}
+}
+
+func TestPlaylistMove(t *testing.T) {
+	pathA := index.NewPath("Root:a")
+	pathB := index.NewPath("Root:b")
+	pathC := index.NewPath("Root:c")
+	pathD := index.NewPath("Root:d")
+	original := []index.Path{pathA, pathB, pathC, pathD}
+
+	tests := []struct {
+		from, to int
+		expected []index.Path
+		err      bool
+	}{
+		{0, 2, []index.Path{pathB, pathC, pathA, pathD}, false},
+		{3, 1, []index.Path{pathA, pathD, pathB, pathC}, false},
+		{1, 1, []index.Path{pathA, pathB, pathC, pathD}, false},
+		{4, 0, []index.Path{pathA, pathB, pathC, pathD}, true},
+		{0, -1, []index.Path{pathA, pathB, pathC, pathD}, true},
+	}
+
+	for ii, tt := range tests {
+		p := &Playlist{}
+		for _, x := range original {
+			p.Add(x)
+		}
+
+		err := p.Move(tt.from, tt.to)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] p.Move(%d, %d) = %v, expected error: %v", ii, tt.from, tt.to, err, tt.err)
+		}
+		for i, item := range p.Items() {
+			if !item.path.Equal(tt.expected[i]) {
+				t.Errorf("[%d] p.Items()[%d].path = %v, expected: %v", ii, i, item.path, tt.expected[i])
+			}
+			// Check that MovedIndex agrees with Move.
+			if !tt.err {
+				if j := MovedIndex(i, tt.from, tt.to); !p.Items()[j].path.Equal(original[i]) {
+					t.Errorf("[%d] MovedIndex(%d, %d, %d) = %d, which has path %v", ii, i, tt.from, tt.to, j, p.Items()[j].path)
+				}
+			}
+		}
+	}
+}
+
 func TestPlaylistRemoveItem(t *testing.T) {
 	pathA := index.NewPath("Root:a")
 
@@ -138,3 +204,57 @@ func TestPlaylistItemRemove(t *testing.T) {
 		t.Errorf("expected error for removing invalid item (items: %v)", p.Items())
 	}
 }
+
+func TestPlaylistMetaJSON(t *testing.T) {
+	m := Meta{
+		Description: "Sunday morning",
+		Cover:       "123",
+	}
+
+	p := &Playlist{}
+	p.Add(index.NewPath("Root:a"))
+	p.SetMeta(m)
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("unexpected error marshalling playlist: %v", err)
+	}
+
+	got := &Playlist{}
+	err = json.Unmarshal(b, got)
+	if err != nil {
+		t.Fatalf("unexpected error unmarshalling playlist: %v", err)
+	}
+
+	if got.Meta() != m {
+		t.Errorf("got.Meta() = %#v, expected: %#v", got.Meta(), m)
+	}
+
+	if len(got.Items()) != 1 {
+		t.Errorf("len(got.Items()) = %d, expected: %d", len(got.Items()), 1)
+	}
+}
+
+func TestPlaylistPrune(t *testing.T) {
+	pathA := index.NewPath("Root:a")
+	pathB := index.NewPath("Root:b")
+	pathC := index.NewPath("Root:c")
+
+	p := &Playlist{}
+	p.Add(pathA)
+	p.Add(pathB)
+	p.Add(pathC)
+
+	n := p.Prune(func(path index.Path) bool { return !path.Equal(pathB) })
+	if n != 1 {
+		t.Errorf("p.Prune() = %d, expected: %d", n, 1)
+	}
+
+	items := p.Items()
+	if len(items) != 2 {
+		t.Fatalf("len(p.Items()) = %d, expected: %d", len(items), 2)
+	}
+	if !items[0].path.Equal(pathA) || !items[1].path.Equal(pathC) {
+		t.Errorf("p.Items() = [%v %v], expected: [%v %v]", items[0].path, items[1].path, pathA, pathC)
+	}
+}
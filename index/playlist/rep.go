@@ -16,14 +16,19 @@ type Action string
 const (
 	ActionCreate Action = "create"
 	ActionDelete        = "delete"
+	ActionRename        = "rename"
 
 	ActionAddItem    = "addItem"
 	ActionRemoveItem = "deleteItem"
+	ActionMoveItem   = "moveItem"
 )
 
 var actionToAction = map[string]Action{
+	"DELETE":   ActionDelete,
+	"RENAME":   ActionRename,
 	"ADD_ITEM": ActionAddItem,
 	"REMOVE":   ActionRemoveItem,
+	"MOVE":     ActionMoveItem,
 }
 
 type RepAction struct {
@@ -31,12 +36,17 @@ type RepAction struct {
 	Action Action     `json:"action"`
 	Path   index.Path `json:"path"`
 	Index  int        `json:"index"`
+
+	// To is the destination index of the item at Index, used by ActionMoveItem.
+	To int `json:"to"`
+
+	// NewName is the name the playlist is given by ActionRename.
+	NewName string `json:"newName"`
 }
 
 func (a RepAction) Apply(s Store) error {
 	if a.Action == ActionCreate {
-		s.Set(a.Name, &Playlist{})
-		return nil
+		return s.Set(a.Name, &Playlist{})
 	}
 
 	action, ok := actionToAction[string(a.Action)]
@@ -51,13 +61,28 @@ func (a RepAction) Apply(s Store) error {
 
 	switch action {
 	case ActionDelete:
-		s.Delete(a.Name)
+		return s.Delete(a.Name)
+	case ActionRename:
+		if a.NewName == "" {
+			return fmt.Errorf("invalid new playlist name: '%v'", a.NewName)
+		}
+		if s.Get(a.NewName) != nil {
+			return fmt.Errorf("playlist already exists: '%v'", a.NewName)
+		}
+		if err := s.Set(a.NewName, p); err != nil {
+			return err
+		}
+		return s.Delete(a.Name)
 	case ActionAddItem:
 		p.Add(a.Path)
 	case ActionRemoveItem:
-		p.Remove(a.Index, a.Path)
+		if err := p.Remove(a.Index, a.Path); err != nil {
+			return err
+		}
+	case ActionMoveItem:
+		if err := p.Move(a.Index, a.To); err != nil {
+			return err
+		}
 	}
-
-	s.Set(a.Name, p)
-	return nil
+	return s.Set(a.Name, p)
 }
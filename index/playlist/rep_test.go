@@ -0,0 +1,66 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playlist
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"tchaik.com/index"
+)
+
+type mapStore map[string]*Playlist
+
+func (m mapStore) Names() []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m mapStore) Get(name string) *Playlist { return m[name] }
+
+func (m mapStore) Set(name string, p *Playlist) error {
+	m[name] = p
+	return nil
+}
+
+func (m mapStore) Delete(name string) error {
+	delete(m, name)
+	return nil
+}
+
+func TestRepActionRename(t *testing.T) {
+	a, b := &Playlist{}, &Playlist{}
+	a.Add(index.NewPath("Root:a"))
+
+	tests := []struct {
+		name, newName string
+		err           bool
+		expected      []string
+	}{
+		{"missing", "c", true, []string{"a", "b"}},
+		{"a", "", true, []string{"a", "b"}},
+		{"a", "b", true, []string{"a", "b"}},
+		{"a", "c", false, []string{"b", "c"}},
+	}
+
+	for ii, tt := range tests {
+		s := mapStore{"a": a, "b": b}
+		err := RepAction{Name: tt.name, Action: "RENAME", NewName: tt.newName}.Apply(s)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] Apply() error = %v, expected error: %v", ii, err, tt.err)
+		}
+		if got := s.Names(); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("[%d] Names() = %v, expected: %v", ii, got, tt.expected)
+		}
+		if s.Get("b") != b {
+			t.Errorf("[%d] playlist %#v was overwritten", ii, "b")
+		}
+	}
+}
@@ -49,6 +49,9 @@ type store struct {
 
 // Names implements Store.
 func (s *store) Names() []string {
+	s.RLock()
+	defer s.RUnlock()
+
 	n := make([]string, 0, len(s.m))
 	for k := range s.m {
 		n = append(n, k)
@@ -0,0 +1,222 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package remote defines items whose source is a remote HTTP URL (internet radio stations
+// and podcast episodes) which can be played like tracks, and methods for persisting them.
+package remote
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"tchaik.com/index"
+)
+
+// Type is a type which represents an enumeration of the kinds of remote item.
+type Type string
+
+// Types of remote item.
+const (
+	// TypeRadio is a live stream, which has no duration and can't be seeked.
+	TypeRadio Type = "radio"
+	// TypePodcast is a (podcast episode) file which can be seeked, if the server supports
+	// range requests.
+	TypePodcast = "podcast"
+)
+
+// IsValid returns true iff t is a valid Type.
+func (t Type) IsValid() bool {
+	switch t {
+	case TypeRadio, TypePodcast:
+		return true
+	}
+	return false
+}
+
+// SourceTypeField is the name of the string field which holds the Type of remote items.
+const SourceTypeField = "SourceType"
+
+// idPrefix is the prefix of the IDs of remote items, which distinguishes them from track IDs.
+const idPrefix = "remote-"
+
+// Item is a remote item.  Items implement index.Track, so that they can be played (and added
+// to playlists) like tracks.
+type Item struct {
+	ID   string `json:"id"`
+	Type Type   `json:"type"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// Album is the name of the podcast or station group, if any.
+	Album  string `json:"album,omitempty"`
+	Artist string `json:"artist,omitempty"`
+
+	// Duration is the duration (in seconds) of podcast episodes, if known.
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// NewItem creates a remote item of the given type.  The ID of the item is computed from the
+// URL, which must be an absolute http or https URL.
+func NewItem(typ Type, name, rawurl string) (Item, error) {
+	if !typ.IsValid() {
+		return Item{}, fmt.Errorf("invalid remote item type: %#v", typ)
+	}
+	if name == "" {
+		return Item{}, fmt.Errorf("remote item name required")
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Item{}, fmt.Errorf("invalid remote item URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return Item{}, fmt.Errorf("invalid remote item URL: %#v (must be http or https)", rawurl)
+	}
+
+	h := sha1.Sum([]byte(rawurl))
+	return Item{
+		ID:   idPrefix + hex.EncodeToString(h[:8]),
+		Type: typ,
+		Name: name,
+		URL:  rawurl,
+	}, nil
+}
+
+// GetString implements index.Track.  Unknown fields are empty.
+func (i Item) GetString(name string) string {
+	switch name {
+	case "ID":
+		return i.ID
+	case "Name":
+		return i.Name
+	case "Album":
+		return i.Album
+	case "Artist":
+		return i.Artist
+	case "Location":
+		return i.URL
+	case "Kind":
+		if i.Type == TypeRadio {
+			return "Internet radio"
+		}
+		return "Podcast episode"
+	case SourceTypeField:
+		return string(i.Type)
+	}
+	return ""
+}
+
+// GetStrings implements index.Track.  Unknown fields are nil.
+func (i Item) GetStrings(name string) []string {
+	return index.DefaultGetStrings(i, name)
+}
+
+// GetInt implements index.Track.  Unknown fields are 0.
+func (i Item) GetInt(name string) int {
+	if name == "TotalTime" {
+		return int(i.Duration * 1000)
+	}
+	return 0
+}
+
+// GetTime implements index.Track.  All fields are the zero time.
+func (i Item) GetTime(name string) time.Time {
+	return time.Time{}
+}
+
+// Store is an interface which defines methods for adding, removing and listing remote items.
+type Store interface {
+	// Add adds the item, replacing any item with the same ID.
+	Add(Item) error
+
+	// Remove removes the item with the given ID.
+	Remove(id string) error
+
+	// Get returns the item with the given ID, and true if it exists.
+	Get(id string) (Item, bool)
+
+	// List returns the items, ordered by name.
+	List() []Item
+}
+
+// NewStore creates a basic implementation of a remote item store, using the given path as the
+// source of data. Note: we do not enforce any locking on the underlying file, which is read
+// once to initialise the store, and then overwritten after each change.
+func NewStore(path string) (Store, error) {
+	m := make(map[string]Item)
+	s, err := index.NewPersistStore(path, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store{
+		m:     m,
+		store: s,
+	}, nil
+}
+
+type store struct {
+	sync.RWMutex
+
+	m     map[string]Item
+	store index.PersistStore
+}
+
+// Add implements Store.
+func (s *store) Add(i Item) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.m[i.ID] = i
+	return s.store.Persist(&s.m)
+}
+
+// Remove implements Store.
+func (s *store) Remove(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.m[id]; !ok {
+		return fmt.Errorf("invalid remote item: %#v", id)
+	}
+	delete(s.m, id)
+	return s.store.Persist(&s.m)
+}
+
+// Get implements Store.
+func (s *store) Get(id string) (Item, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	i, ok := s.m[id]
+	return i, ok
+}
+
+// List implements Store.
+func (s *store) List() []Item {
+	s.RLock()
+	defer s.RUnlock()
+
+	items := make([]Item, 0, len(s.m))
+	for _, i := range s.m {
+		items = append(items, i)
+	}
+	sort.Stable(byName(items))
+	return items
+}
+
+type byName []Item
+
+func (b byName) Len() int      { return len(b) }
+func (b byName) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool {
+	if b[i].Name != b[j].Name {
+		return b[i].Name < b[j].Name
+	}
+	return b[i].ID < b[j].ID
+}
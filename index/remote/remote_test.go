@@ -0,0 +1,114 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewItem(t *testing.T) {
+	tests := []struct {
+		typ       Type
+		name, url string
+		ok        bool
+	}{
+		{TypeRadio, "Radio", "http://example.com/stream", true},
+		{TypePodcast, "Episode 1", "https://example.com/ep1.mp3", true},
+		{"video", "Video", "http://example.com/v", false},
+		{TypeRadio, "", "http://example.com/stream", false},
+		{TypeRadio, "Radio", "ftp://example.com/stream", false},
+		{TypeRadio, "Radio", "/stream", false},
+	}
+
+	for _, tt := range tests {
+		i, err := NewItem(tt.typ, tt.name, tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewItem(%#v, %#v, %#v) error = %v, expected ok: %v", tt.typ, tt.name, tt.url, err, tt.ok)
+			continue
+		}
+		if tt.ok && !strings.HasPrefix(i.ID, idPrefix) {
+			t.Errorf("NewItem(%#v, %#v, %#v).ID = %#v, expected prefix: %#v", tt.typ, tt.name, tt.url, i.ID, idPrefix)
+		}
+	}
+
+	x, _ := NewItem(TypeRadio, "A", "http://example.com/stream")
+	y, _ := NewItem(TypePodcast, "B", "http://example.com/stream")
+	if x.ID != y.ID {
+		t.Errorf("IDs of items with the same URL = %#v, %#v, expected equal", x.ID, y.ID)
+	}
+}
+
+func TestItemTrack(t *testing.T) {
+	i, err := NewItem(TypePodcast, "Episode 1", "https://example.com/ep1.mp3")
+	if err != nil {
+		t.Fatalf("NewItem() error = %v", err)
+	}
+	i.Duration = 90.5
+
+	if got := i.GetString(SourceTypeField); got != string(TypePodcast) {
+		t.Errorf("GetString(%#v) = %#v, expected: %#v", SourceTypeField, got, TypePodcast)
+	}
+	if got := i.GetString("Location"); got != i.URL {
+		t.Errorf("GetString(%#v) = %#v, expected: %#v", "Location", got, i.URL)
+	}
+	if got := i.GetInt("TotalTime"); got != 90500 {
+		t.Errorf("GetInt(%#v) = %d, expected: %d", "TotalTime", got, 90500)
+	}
+	// Fields of local tracks are empty, rather than panicking.
+	if got := i.GetInt("BitRate"); got != 0 {
+		t.Errorf("GetInt(%#v) = %d, expected: %d", "BitRate", got, 0)
+	}
+	if got := i.GetStrings("Composer"); got != nil {
+		t.Errorf("GetStrings(%#v) = %#v, expected: nil", "Composer", got)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "remote.json")
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	b, _ := NewItem(TypeRadio, "B", "http://example.com/b")
+	a, _ := NewItem(TypePodcast, "A", "http://example.com/a.mp3")
+	for _, i := range []Item{b, a} {
+		if err := s.Add(i); err != nil {
+			t.Fatalf("Add(%#v) error = %v", i, err)
+		}
+	}
+
+	// Reload from the file.
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if got, expected := s.List(), []Item{a, b}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("List() = %#v, expected: %#v", got, expected)
+	}
+	if got, ok := s.Get(b.ID); !ok || got != b {
+		t.Errorf("Get(%#v) = %#v, %v, expected: %#v, true", b.ID, got, ok, b)
+	}
+
+	if err := s.Remove(b.ID); err != nil {
+		t.Errorf("Remove(%#v) error = %v", b.ID, err)
+	}
+	if _, ok := s.Get(b.ID); ok {
+		t.Errorf("Get(%#v) = _, true after Remove, expected false", b.ID)
+	}
+	if err := s.Remove(b.ID); err == nil {
+		t.Errorf("Remove(%#v) error = nil for missing item, expected error", b.ID)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rootorder defines methods for setting/getting the preferred display order of
+// top-level collections and persisting this data.
+package rootorder
+
+import (
+	"sync"
+
+	"tchaik.com/index"
+)
+
+// Store is an interface which defines methods necessary for setting and getting the preferred
+// order of top-level collection names.
+type Store interface {
+	// Set the preferred order.
+	Set([]string) error
+
+	// Get the preferred order.
+	Get() []string
+}
+
+// NewStore creates a basic implementation of a root order store, using the given path as the
+// source of data. Note: we do not enforce any locking on the underlying file, which is read
+// once to initialise the store, and then overwritten after each call to Set.
+func NewStore(path string) (Store, error) {
+	var order []string
+	s, err := index.NewPersistStore(path, &order)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store{
+		order: order,
+		store: s,
+	}, nil
+}
+
+type store struct {
+	sync.RWMutex
+
+	order []string
+	store index.PersistStore
+}
+
+// Set implements Store.
+func (s *store) Set(order []string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.order = order
+	return s.store.Persist(&s.order)
+}
+
+// Get implements Store.
+func (s *store) Get() []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.order
+}
+
+// Apply returns the names ordered using the preferred order.  Names which do not appear in
+// the preferred order are placed at the end, retaining their original order.
+func Apply(names []string, order []string) []string {
+	valid := make(map[string]bool, len(names))
+	for _, n := range names {
+		valid[n] = true
+	}
+
+	done := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, x := range order {
+		if valid[x] && !done[x] {
+			result = append(result, x)
+			done[x] = true
+		}
+	}
+	for _, n := range names {
+		if !done[n] {
+			result = append(result, n)
+			done[n] = true
+		}
+	}
+	return result
+}
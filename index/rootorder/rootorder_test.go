@@ -0,0 +1,37 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rootorder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		names, order []string
+		expected     []string
+	}{
+		{nil, nil, []string{}},
+		{[]string{"a", "b", "c"}, nil, []string{"a", "b", "c"}},
+		{[]string{"a", "b", "c"}, []string{"c", "a", "b"}, []string{"c", "a", "b"}},
+		// Unordered names are placed at the end, in their original order.
+		{[]string{"a", "b", "c", "d"}, []string{"c"}, []string{"c", "a", "b", "d"}},
+		{[]string{"a", "b", "c", "d"}, []string{"d", "b"}, []string{"d", "b", "a", "c"}},
+		// Unknown and repeated names in the order are ignored.
+		{[]string{"a", "b"}, []string{"x", "b", "y"}, []string{"b", "a"}},
+		{[]string{"a", "b"}, []string{"b", "b", "a", "b"}, []string{"b", "a"}},
+		{nil, []string{"a"}, []string{}},
+		// Repeated names are only included once.
+		{[]string{"a", "b", "a"}, nil, []string{"a", "b"}},
+	}
+
+	for ii, tt := range tests {
+		got := Apply(tt.names, tt.order)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("[%d] Apply(%v, %v) = %v, expected: %v", ii, tt.names, tt.order, got, tt.expected)
+		}
+	}
+}
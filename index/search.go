@@ -19,23 +19,35 @@ func isMn(r rune) bool {
 
 var transformer = transform.Chain(norm.NFD, transform.RemoveFunc(isMn), norm.NFC)
 
+// foldRune returns the case folded form of r: the lower case form of the smallest rune
+// in its case folding orbit (so that, for instance, 'S', 's' and 'ſ' all fold to 's').
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return unicode.ToLower(min)
+}
+
+// removeNonAlphaNumeric normalises s for indexing and searching: characters are decomposed
+// (NFD) and diacritics removed, then case folded.  Hyphens are replaced with spaces and other
+// non-alphanumeric characters are removed.  The same normalisation must be applied to both
+// the indexed strings and search input.
 func removeNonAlphaNumeric(s string) string {
-	in := []rune(s)
-	res := make([]rune, len(in))
-	i := 0
+	s, _, _ = transform.String(transformer, s)
+	res := make([]rune, 0, len(s))
 	for _, x := range s {
 		switch {
 		case x == '-':
-			res[i] = ' '
-			i++
+			res = append(res, ' ')
 
 		case unicode.IsLetter(x), unicode.IsDigit(x), unicode.IsSpace(x):
-			res[i] = unicode.ToLower(x)
-			i++
+			res = append(res, foldRune(x))
 		}
 	}
-	result, _, _ := transform.String(transformer, string(res[:i]))
-	return result
+	return string(res)
 }
 
 // Searcher is an interface which defines the Search method.
@@ -138,6 +150,100 @@ func (p PrefixMultiExpand) Expand(s string) []string {
 	return p.words[s]
 }
 
+// SubstringExpand is a type which implements Expander, expanding strings into the list of
+// words which contain them.
+type SubstringExpand []string
+
+// Expand returns the list of words which contain s.  Strings shorter than MinPrefix are
+// not expanded.
+func (w SubstringExpand) Expand(s string) []string {
+	if len(s) < MinPrefix {
+		return []string{s}
+	}
+	var result []string
+	for _, x := range w {
+		if strings.Contains(x, s) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// FuzzyMaxEdits returns the maximum number of edits allowed for a fuzzy match of a term of
+// length n (in runes): 2 for terms of at least 5 characters, 1 for 4 and none otherwise.
+func FuzzyMaxEdits(n int) int {
+	switch {
+	case n >= 5:
+		return 2
+	case n == 4:
+		return 1
+	}
+	return 0
+}
+
+// editDistance returns the Levenshtein distance between s and t if it is at most max,
+// otherwise it returns max+1.
+func editDistance(s, t []rune, max int) int {
+	if d := len(s) - len(t); d > max || -d > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if x := prev[j] + 1; x < cur[j] {
+				cur[j] = x
+			}
+			if x := cur[j-1] + 1; x < cur[j] {
+				cur[j] = x
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	if prev[len(t)] > max {
+		return max + 1
+	}
+	return prev[len(t)]
+}
+
+// FuzzyExpand is a type which implements Expander, expanding strings into the list of words
+// which are within a bounded edit distance (see FuzzyMaxEdits).
+type FuzzyExpand []string
+
+// Expand returns the list of words within FuzzyMaxEdits(len(s)) edits of s.  Strings which
+// are too short to be fuzzy matched are not expanded.
+func (w FuzzyExpand) Expand(s string) []string {
+	rs := []rune(s)
+	max := FuzzyMaxEdits(len(rs))
+	if max == 0 {
+		return []string{s}
+	}
+	var result []string
+	for _, x := range w {
+		if editDistance(rs, []rune(x), max) <= max {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
 // expandSearcher is an implementation of Searcher which applies the Expander to search
 // input and then performs a search on each of the expanded outputs, union the results
 // and returns as the Search result.
@@ -164,6 +270,19 @@ func BuildPrefixExpandSearcher(s Searcher, w WordIndex, n int) Searcher {
 	return &expandSearcher{BuildPrefixMultiExpander(w.Words(), n), s}
 }
 
+// BuildSubstringExpandSearcher constructs a substring expander which wraps the given Searcher
+// by expanding each word in the search input to all the words in the WordIndex which contain it.
+func BuildSubstringExpandSearcher(s Searcher, w WordIndex) Searcher {
+	return &expandSearcher{SubstringExpand(w.Words()), s}
+}
+
+// BuildFuzzyExpandSearcher constructs a fuzzy expander which wraps the given Searcher by
+// expanding each word in the search input to all the words in the WordIndex which are within
+// a bounded edit distance of it.
+func BuildFuzzyExpandSearcher(s Searcher, w WordIndex) Searcher {
+	return &expandSearcher{FuzzyExpand(w.Words()), s}
+}
+
 type trackWordIndex struct {
 	*wordIndex
 
@@ -240,6 +359,219 @@ func WordsIntersectSearcher(s Searcher) Searcher {
 	}
 }
 
+// ExactFirst returns a Searcher which orders the results of s so that paths which are also
+// returned by exact come first.  The order of results is otherwise preserved.  This is
+// used to rank exact matches above those found using an expanded search.
+func ExactFirst(s, exact Searcher) Searcher {
+	return exactFirst{s, exact}
+}
+
+type exactFirst struct {
+	Searcher
+	exact Searcher
+}
+
+// Search implements Searcher.
+func (e exactFirst) Search(x string) []Path {
+	paths := e.Searcher.Search(x)
+	if len(paths) == 0 {
+		return paths
+	}
+
+	exact := make(map[string]bool)
+	for _, p := range e.exact.Search(x) {
+		exact[p.Encode()] = true
+	}
+
+	result := make([]Path, 0, len(paths))
+	var rest []Path
+	for _, p := range paths {
+		if exact[p.Encode()] {
+			result = append(result, p)
+			continue
+		}
+		rest = append(rest, p)
+	}
+	return append(result, rest...)
+}
+
+// RankedUnion returns a Searcher which returns the union of the results of each of the
+// Searchers, ranked in the order the Searchers are given (duplicate paths are removed).
+// This is used to rank results from more permissive searches below the others.
+func RankedUnion(ss ...Searcher) Searcher {
+	return rankedUnion(ss)
+}
+
+type rankedUnion []Searcher
+
+// Search implements Searcher.
+func (r rankedUnion) Search(x string) []Path {
+	paths := make([][]Path, len(r))
+	for i, s := range r {
+		paths[i] = s.Search(x)
+	}
+	return Union(paths...)
+}
+
+// MatchScore returns the relevance of the tracks in the Group to the search input.  Each
+// word of the input scores the weight of the best field it matches in any of the tracks:
+// the full weight for an exact word match, and half of it for a prefix match.  Only fields
+// with a weight are compared.  Words qualified with a field name (see FieldSearcher) are
+// compared without the qualifier.
+func MatchScore(g Group, input string, weights map[string]float64) float64 {
+	fields := make([]string, 0, len(weights))
+	for f := range weights {
+		fields = append(fields, f)
+	}
+	return GroupMatchWords(g, fields).Score(input, weights)
+}
+
+// MatchWords is a mapping of field name -> distinct words of the field in the tracks of a
+// Group, used to score search input without walking the Group again (see MatchScore).
+type MatchWords map[string][]string
+
+// GroupMatchWords returns the MatchWords of the fields in the tracks of the Group.
+func GroupMatchWords(g Group, fields []string) MatchWords {
+	m := make(MatchWords, len(fields))
+	seen := make(map[string]map[string]bool, len(fields))
+	for _, f := range fields {
+		seen[f] = make(map[string]bool)
+	}
+	Walk(g, nil, func(t Track, _ Path) error {
+		for _, f := range fields {
+			for _, fw := range strings.Fields(removeNonAlphaNumeric(t.GetString(f))) {
+				if !seen[f][fw] {
+					seen[f][fw] = true
+					m[f] = append(m[f], fw)
+				}
+			}
+		}
+		return nil
+	})
+	return m
+}
+
+// Score returns the relevance of the words to the search input, as in MatchScore.
+func (m MatchWords) Score(input string, weights map[string]float64) float64 {
+	words := inputWords(input)
+	best := make([]float64, len(words))
+	for f, weight := range weights {
+		for _, fw := range m[f] {
+			for i, w := range words {
+				var s float64
+				switch {
+				case fw == w:
+					s = weight
+				case strings.HasPrefix(fw, w):
+					s = weight / 2
+				}
+				if s > best[i] {
+					best[i] = s
+				}
+			}
+		}
+	}
+
+	var score float64
+	for _, s := range best {
+		score += s
+	}
+	return score
+}
+
+// inputWords returns the words of the search input, without field qualifiers.
+func inputWords(input string) []string {
+	var words []string
+	for _, w := range strings.Fields(input) {
+		if i := strings.Index(w, ":"); i > 0 {
+			w = w[i+1:]
+		}
+		words = append(words, strings.Fields(removeNonAlphaNumeric(w))...)
+	}
+	return words
+}
+
+// MatchString returns true if every word of the search input is a prefix of a word in s
+// (compared as in MatchScore).  Returns false if the input has no words.
+func MatchString(s, input string) bool {
+	words := inputWords(input)
+	if len(words) == 0 {
+		return false
+	}
+	sw := strings.Fields(removeNonAlphaNumeric(s))
+	for _, w := range words {
+		found := false
+		for _, x := range sw {
+			if strings.HasPrefix(x, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FieldSearcher is a Searcher which dispatches terms qualified with a field name (i.e.
+// "field:term") to the Searcher for that field, and all unqualified terms to the
+// underlying Searcher.  The results of each are intersected.
+type FieldSearcher struct {
+	Searcher
+
+	// Fields is a mapping of (lower-case) field name -> Searcher for the field.
+	Fields map[string]Searcher
+}
+
+// Search implements Searcher.
+func (f FieldSearcher) Search(s string) []Path {
+	var rest []string
+	var paths [][]Path
+	for _, w := range strings.Fields(s) {
+		if i := strings.Index(w, ":"); i > 0 {
+			if fs, ok := f.Fields[strings.ToLower(w[:i])]; ok {
+				if w[i+1:] != "" {
+					paths = append(paths, fs.Search(w[i+1:]))
+				}
+				continue
+			}
+		}
+		rest = append(rest, w)
+	}
+
+	if len(paths) == 0 {
+		return f.Searcher.Search(strings.Join(rest, " "))
+	}
+	if len(rest) > 0 {
+		paths = append(paths, f.Searcher.Search(strings.Join(rest, " ")))
+	}
+	return OrderedIntersection(paths...)
+}
+
+// ScopedSearcher is a Searcher wrapper which restricts results to paths within Scope (i.e.
+// the group at Scope and its sub-groups).  An empty Scope does not restrict results.
+type ScopedSearcher struct {
+	Searcher
+	Scope Path
+}
+
+// Search implements Searcher.
+func (s ScopedSearcher) Search(input string) []Path {
+	paths := s.Searcher.Search(input)
+	if len(s.Scope) == 0 {
+		return paths
+	}
+
+	var result []Path
+	for _, p := range paths {
+		if s.Scope.Contains(p) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
 // FlatSearcher is a Searcher wrapper which flattens input strings (replaces any accented
 // characters with their un-accented equivalents).
 type FlatSearcher struct {
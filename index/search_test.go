@@ -106,6 +106,89 @@ func TestPrefixMultiExpander(t *testing.T) {
 	}
 }
 
+func TestSubstringExpand(t *testing.T) {
+	words := SubstringExpand([]string{"prokofiev", "shostakovich", "tchaikovsky", "rachmaninov", "rachmaninoff"})
+	tests := []struct {
+		in  string
+		out []string
+	}{
+		{"ko", []string{"ko"}},
+		{"kov", []string{"shostakovich", "tchaikovsky"}},
+		{"off", []string{"rachmaninoff"}},
+		{"xyz", nil},
+	}
+
+	for ii, tt := range tests {
+		got := words.Expand(tt.in)
+		if !reflect.DeepEqual(stringSet(tt.out), stringSet(got)) {
+			t.Errorf("[%d] Expand(%#v) = %#v expected: %#v (compared unordered)", ii, tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		s, t     string
+		max      int
+		expected int
+	}{
+		{"beethoven", "beethoven", 2, 0},
+		{"beethovn", "beethoven", 2, 1},
+		{"bethovn", "beethoven", 2, 2},
+		{"btovn", "beethoven", 2, 3},
+		{"mahler", "mahlre", 2, 2},
+		{"dvorak", "dvořak", 1, 1},
+		{"", "abc", 3, 3},
+	}
+
+	for ii, tt := range tests {
+		got := editDistance([]rune(tt.s), []rune(tt.t), tt.max)
+		if got != tt.expected {
+			t.Errorf("[%d] editDistance(%#v, %#v, %d) = %d, expected: %d", ii, tt.s, tt.t, tt.max, got, tt.expected)
+		}
+	}
+}
+
+func TestFuzzyExpand(t *testing.T) {
+	words := FuzzyExpand([]string{"beethoven", "bach", "back", "mahler", "mahlers", "brahms"})
+	tests := []struct {
+		in  string
+		out []string
+	}{
+		{"bch", []string{"bch"}},
+		{"bahc", nil},
+		{"bahh", []string{"bach"}},
+		{"beethovn", []string{"beethoven"}},
+		{"mahlr", []string{"mahler", "mahlers"}},
+		{"xyzzyx", nil},
+	}
+
+	for ii, tt := range tests {
+		got := words.Expand(tt.in)
+		if !reflect.DeepEqual(stringSet(tt.out), stringSet(got)) {
+			t.Errorf("[%d] Expand(%#v) = %#v expected: %#v (compared unordered)", ii, tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestRankedUnion(t *testing.T) {
+	beethoven := Path{"Root", "Beethoven"}
+	bach := Path{"Root", "Bach"}
+	brahms := Path{"Root", "Brahms"}
+
+	s := RankedUnion(
+		mapSearcher{"b": []Path{beethoven}},
+		mapSearcher{"b": []Path{bach, beethoven}},
+		mapSearcher{"b": []Path{brahms, bach}},
+	)
+
+	expected := []Path{beethoven, bach, brahms}
+	got := s.Search("b")
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("s.Search(%#v) = %v, expected: %v", "b", got, expected)
+	}
+}
+
 func TestRemoveNonAlphaNumeric(t *testing.T) {
 	tests := []struct {
 		in, out string
@@ -126,6 +209,22 @@ func TestRemoveNonAlphaNumeric(t *testing.T) {
 			"Saint-Saëns",
 			"saint saens",
 		},
+		{
+			"DEBUSSY",
+			"debussy",
+		},
+		{
+			"Bjo\u0308rk", // decomposed ö
+			"bjork",
+		},
+		{
+			"ΣΟΦΟΚΛΗΣ",
+			"σοφοκλησ",
+		},
+		{
+			"Σοφοκλής",
+			"σοφοκλησ",
+		},
 	}
 
 	for ii, tt := range tests {
@@ -136,6 +235,122 @@ func TestRemoveNonAlphaNumeric(t *testing.T) {
 	}
 }
 
+func TestFlatSearcher(t *testing.T) {
+	w := &wordIndex{words: make(map[string][]Path)}
+	bjork := Path{"Root", "Björk"}
+	w.AddString("Björk", bjork)
+
+	s := FlatSearcher{w}
+	for _, x := range []string{"bjork", "BJORK", "Björk", "BJÖRK", "Bjo\u0308rk"} {
+		got := s.Search(x)
+		expected := []Path{bjork}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Search(%#v) = %v, expected: %v", x, got, expected)
+		}
+	}
+}
+
+type mapSearcher map[string][]Path
+
+func (m mapSearcher) Search(s string) []Path {
+	return m[s]
+}
+
+func TestScopedSearcher(t *testing.T) {
+	abbeyRoad := Path{"Root", "Abbey Road"}
+	something := Path{"Root", "Abbey Road", "1"}
+	help := Path{"Root", "Help!"}
+	m := mapSearcher{"beatles": []Path{abbeyRoad, something, help}}
+
+	tests := []struct {
+		scope Path
+		out   []Path
+	}{
+		{nil, []Path{abbeyRoad, something, help}},
+		{Path{"Root"}, []Path{abbeyRoad, something, help}},
+		{abbeyRoad, []Path{abbeyRoad, something}},
+		{something, []Path{something}},
+		{Path{"Root", "Abbey"}, nil},
+	}
+
+	for _, tt := range tests {
+		s := ScopedSearcher{Searcher: m, Scope: tt.scope}
+		got := s.Search("beatles")
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("ScopedSearcher{Scope: %v}.Search(%#v) = %v, expected: %v", tt.scope, "beatles", got, tt.out)
+		}
+	}
+}
+
+func TestExactFirst(t *testing.T) {
+	beethoven := Path{"Root", "Beethoven"}
+	beet := Path{"Root", "Beet"}
+	other := Path{"Root", "Beetle"}
+
+	s := ExactFirst(
+		mapSearcher{"beet": []Path{beethoven, other, beet}},
+		mapSearcher{"beet": []Path{beet}},
+	)
+
+	expected := []Path{beet, beethoven, other}
+	got := s.Search("beet")
+	if len(got) != len(expected) {
+		t.Fatalf("s.Search(%#v) = %v, expected: %v", "beet", got, expected)
+	}
+	for i := range got {
+		if !got[i].Equal(expected[i]) {
+			t.Errorf("s.Search(%#v) = %v, expected: %v", "beet", got, expected)
+			break
+		}
+	}
+}
+
+func TestFieldSearcher(t *testing.T) {
+	bach := Path{"Root", "Goldberg Variations"}
+	vivaldi := Path{"Root", "Four Seasons"}
+	both := Path{"Root", "Concertos"}
+
+	s := FieldSearcher{
+		Searcher: mapSearcher{
+			"concertos":         []Path{vivaldi, both},
+			"goldberg":          []Path{bach},
+			"goldberg concerto": []Path{},
+		},
+		Fields: map[string]Searcher{
+			"artist":   mapSearcher{"Bach": []Path{bach, both}},
+			"composer": mapSearcher{"Vivaldi": []Path{vivaldi, both}},
+		},
+	}
+
+	tests := []struct {
+		in  string
+		out []Path
+	}{
+		{"concertos", []Path{vivaldi, both}},
+		{"artist:Bach", []Path{bach, both}},
+		{"artist:Bach composer:Vivaldi", []Path{both}},
+		{"ARTIST:Bach goldberg", []Path{bach}},
+		{"artist:", nil},
+		{"unknown:Bach", nil},
+	}
+
+	for ii, tt := range tests {
+		got := s.Search(tt.in)
+		sort.Sort(PathSlice(got))
+		sort.Sort(PathSlice(tt.out))
+		if len(got) != len(tt.out) {
+			t.Errorf("[%d] s.Search(%#v) = %v, expected: %v", ii, tt.in, got, tt.out)
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(tt.out[i]) {
+				t.Errorf("[%d] s.Search(%#v) = %v, expected: %v", ii, tt.in, got, tt.out)
+				break
+			}
+		}
+	}
+}
+
 func TestWordIndex(t *testing.T) {
 	tests := []struct {
 		in    map[string][]Path
@@ -214,3 +429,75 @@ func TestWordIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchScore(t *testing.T) {
+	g := group{
+		name: "Symphony No 1",
+		tracks: []Track{
+			testTrack{Name: "Allegro", Album: "Symphony No 1", Composer: "Gustav Mahler"},
+			testTrack{Name: "Mahlerian Scherzo", Album: "Symphony No 1", Composer: "Gustav Mahler"},
+		},
+	}
+	weights := map[string]float64{"Name": 1, "Album": 2, "Composer": 4}
+
+	tests := []struct {
+		in       string
+		expected float64
+	}{
+		{"", 0},
+		{"bach", 0},
+		{"allegro", 1},
+		{"alleg", 0.5},
+		{"mahler", 4},
+		{"mahl", 2},
+		{"MÄHLER symphony", 6},
+		{"composer:mahler", 4},
+		{"scherzo symph bach", 2},
+	}
+
+	for ii, tt := range tests {
+		if got := MatchScore(g, tt.in, weights); got != tt.expected {
+			t.Errorf("[%d] MatchScore(g, %#v) = %v, expected: %v", ii, tt.in, got, tt.expected)
+		}
+	}
+}
+
+func TestGroupMatchWords(t *testing.T) {
+	g := group{
+		name: "Symphony No 1",
+		tracks: []Track{
+			testTrack{Name: "Allegro", Album: "Symphony No 1", Composer: "Gustav Mahler"},
+			testTrack{Name: "Mahlerian Scherzo", Album: "Symphony No 1", Composer: "Gustav Mahler"},
+		},
+	}
+
+	got := GroupMatchWords(g, []string{"Name", "Composer"})
+	expected := MatchWords{
+		"Name":     {"allegro", "mahlerian", "scherzo"},
+		"Composer": {"gustav", "mahler"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GroupMatchWords() = %v, expected: %v", got, expected)
+	}
+}
+
+func TestMatchString(t *testing.T) {
+	tests := []struct {
+		s, in    string
+		expected bool
+	}{
+		{"Gustav Mahler", "", false},
+		{"Gustav Mahler", "mahler", true},
+		{"Gustav Mahler", "MAH gus", true},
+		{"Gustav Mahler", "artist:mahl", true},
+		{"Gustav Mahler", "mahler symphony", false},
+		{"Gustav Mahler", "ahler", false},
+		{"", "mahler", false},
+	}
+
+	for ii, tt := range tests {
+		if got := MatchString(tt.s, tt.in); got != tt.expected {
+			t.Errorf("[%d] MatchString(%#v, %#v) = %v, expected: %v", ii, tt.s, tt.in, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package smart defines types and methods for constructing smart playlists: playlists
+// whose tracks are determined by rules on track fields.
+package smart
+
+// Type is the type of a Field value.
+type Type string
+
+// Field types.
+const (
+	TypeString Type = "string"
+	TypeInt         = "int"
+	TypeTime        = "time"
+	TypeBool        = "bool"
+)
+
+// Operator is a comparison operator used in a rule.
+type Operator string
+
+// Operators.
+const (
+	OpIs          Operator = "is"
+	OpIsNot                = "isNot"
+	OpContains             = "contains"
+	OpNotContains          = "notContains"
+	OpStartsWith           = "startsWith"
+
+	OpEqual        = "eq"
+	OpNotEqual     = "ne"
+	OpLess         = "lt"
+	OpLessEqual    = "lte"
+	OpGreater      = "gt"
+	OpGreaterEqual = "gte"
+
+	OpBefore    = "before"
+	OpAfter     = "after"
+	OpInLast    = "inLast"    // value is a duration in seconds
+	OpNotInLast = "notInLast" // value is a duration in seconds, matches zero times
+)
+
+// Operators is a mapping of field types to the operators which can be applied to them.
+var Operators = map[Type][]Operator{
+	TypeString: {OpIs, OpIsNot, OpContains, OpNotContains, OpStartsWith},
+	TypeInt:    {OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual},
+	TypeTime:   {OpBefore, OpAfter, OpInLast, OpNotInLast},
+	TypeBool:   {OpIs},
+}
+
+// Field is a definition of a field which can be used in smart playlist rules.
+type Field struct {
+	// Name is the name used to identify the field in rules.
+	Name string `json:"name"`
+
+	// Type is the type of the field value.
+	Type Type `json:"type"`
+
+	// Attr is the name of the underlying track attribute (or meta data store).
+	Attr string `json:"-"`
+
+	// Meta is true if the field value comes from meta data (i.e. play history, ratings)
+	// rather than the track.
+	Meta bool `json:"meta,omitempty"`
+}
+
+// Fields is the list of fields which can be used in smart playlist rules.
+var Fields = []Field{
+	{Name: "name", Type: TypeString, Attr: "Name"},
+	{Name: "album", Type: TypeString, Attr: "Album"},
+	{Name: "artist", Type: TypeString, Attr: "Artist"},
+	{Name: "albumArtist", Type: TypeString, Attr: "AlbumArtist"},
+	{Name: "composer", Type: TypeString, Attr: "Composer"},
+	{Name: "genre", Type: TypeString, Attr: "Genre"},
+	{Name: "kind", Type: TypeString, Attr: "Kind"},
+
+	{Name: "year", Type: TypeInt, Attr: "Year"},
+	{Name: "duration", Type: TypeInt, Attr: "TotalTime"},
+	{Name: "bitRate", Type: TypeInt, Attr: "BitRate"},
+	{Name: "trackNumber", Type: TypeInt, Attr: "TrackNumber"},
+	{Name: "discNumber", Type: TypeInt, Attr: "DiscNumber"},
+
+	{Name: "added", Type: TypeTime, Attr: "DateAdded"},
+	{Name: "modified", Type: TypeTime, Attr: "DateModified"},
+
+	{Name: "rating", Type: TypeInt, Attr: "Rating", Meta: true},
+	{Name: "playCount", Type: TypeInt, Attr: "PlayCount", Meta: true},
+	{Name: "lastPlayed", Type: TypeTime, Attr: "LastPlayed", Meta: true},
+	{Name: "favourite", Type: TypeBool, Attr: "Favourite", Meta: true},
+	{Name: "checklist", Type: TypeBool, Attr: "Checklist", Meta: true},
+}
+
+// FieldByName returns the Field with the given name, and true if it exists (false otherwise).
+func FieldByName(name string) (Field, bool) {
+	for _, f := range Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// ValidOperator returns true if the operator can be applied to values of the type.
+func ValidOperator(t Type, op Operator) bool {
+	for _, x := range Operators[t] {
+		if x == op {
+			return true
+		}
+	}
+	return false
+}
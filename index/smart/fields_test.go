@@ -0,0 +1,42 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smart
+
+import "testing"
+
+func TestFieldsHaveOperators(t *testing.T) {
+	names := make(map[string]bool)
+	for _, f := range Fields {
+		if names[f.Name] {
+			t.Errorf("duplicate field name: %v", f.Name)
+		}
+		names[f.Name] = true
+
+		if len(Operators[f.Type]) == 0 {
+			t.Errorf("field %v has type %v which has no operators", f.Name, f.Type)
+		}
+	}
+}
+
+func TestValidOperator(t *testing.T) {
+	tests := []struct {
+		t        Type
+		op       Operator
+		expected bool
+	}{
+		{TypeString, OpContains, true},
+		{TypeString, OpLess, false},
+		{TypeInt, OpGreaterEqual, true},
+		{TypeTime, OpInLast, true},
+		{TypeBool, OpContains, false},
+	}
+
+	for ii, tt := range tests {
+		got := ValidOperator(tt.t, tt.op)
+		if got != tt.expected {
+			t.Errorf("[%d] ValidOperator(%v, %v) = %v, expected: %v", ii, tt.t, tt.op, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smart
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tchaik.com/index"
+)
+
+// Rule is a condition on a Field of a track.
+type Rule struct {
+	Field string   `json:"field"`
+	Op    Operator `json:"op"`
+
+	// Value is the value to compare against: a string for TypeString, a number for TypeInt,
+	// a boolean for TypeBool.  For TypeTime it is an RFC3339 string (or a number of seconds
+	// for OpInLast and OpNotInLast).
+	Value interface{} `json:"value"`
+}
+
+// Match is a type which represents the ways in which rules are combined.
+type Match string
+
+// Match modes.
+const (
+	// MatchAll requires all rules to match.
+	MatchAll Match = "all"
+	// MatchAny requires at least one rule to match.
+	MatchAny = "any"
+)
+
+// Playlist is a smart playlist: the tracks it contains are those which match its rules.
+type Playlist struct {
+	Match Match  `json:"match"`
+	Rules []Rule `json:"rules"`
+}
+
+// Meta is an interface which provides the values of meta fields (see Field.Meta).
+type Meta interface {
+	// Value returns the value of the meta field (identified by Field.Attr) for the track with
+	// the given path.  Values must be int for TypeInt, time.Time for TypeTime and bool for
+	// TypeBool fields.
+	Value(attr string, t index.Track, p index.Path) interface{}
+}
+
+// Validate returns an error if the rule is invalid.
+func (r Rule) Validate() error {
+	f, ok := FieldByName(r.Field)
+	if !ok {
+		return fmt.Errorf("unknown field: %#v", r.Field)
+	}
+	if !ValidOperator(f.Type, r.Op) {
+		return fmt.Errorf("invalid operator for %v field %#v: %#v", f.Type, f.Name, r.Op)
+	}
+
+	var valid bool
+	switch f.Type {
+	case TypeString:
+		_, valid = r.Value.(string)
+	case TypeInt:
+		_, valid = r.Value.(float64)
+	case TypeBool:
+		_, valid = r.Value.(bool)
+	case TypeTime:
+		if r.Op == OpInLast || r.Op == OpNotInLast {
+			_, valid = r.Value.(float64)
+			break
+		}
+		var s string
+		if s, valid = r.Value.(string); valid {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("invalid time value for field %#v: %v", f.Name, err)
+			}
+		}
+	}
+	if !valid {
+		return fmt.Errorf("invalid value for %v field %#v: %#v", f.Type, f.Name, r.Value)
+	}
+	return nil
+}
+
+// Validate returns an error if the playlist is invalid.
+func (p Playlist) Validate() error {
+	switch p.Match {
+	case MatchAll, MatchAny:
+	default:
+		return fmt.Errorf("invalid match: %#v", p.Match)
+	}
+	for i, r := range p.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the track (with path tp) matches the rules of the playlist.
+// Playlists with no rules match every track.  Assumes that the playlist is valid.
+func (p Playlist) Matches(t index.Track, tp index.Path, m Meta, now time.Time) bool {
+	for _, r := range p.Rules {
+		ok := r.Matches(t, tp, m, now)
+		if p.Match == MatchAny && ok {
+			return true
+		}
+		if p.Match == MatchAll && !ok {
+			return false
+		}
+	}
+	return p.Match == MatchAll || len(p.Rules) == 0
+}
+
+// Matches returns true if the track (with path tp) matches the rule.  Assumes that the rule
+// is valid.
+func (r Rule) Matches(t index.Track, tp index.Path, m Meta, now time.Time) bool {
+	f, _ := FieldByName(r.Field)
+
+	// Missing meta values are treated as zero values.
+	var v interface{}
+	if f.Meta {
+		v = m.Value(f.Attr, t, tp)
+	}
+
+	switch f.Type {
+	case TypeString:
+		return matchStrings(trackStrings(t, f.Attr), r.Op, r.Value.(string))
+
+	case TypeInt:
+		x, _ := v.(int)
+		if !f.Meta {
+			x = t.GetInt(f.Attr)
+		}
+		return matchInt(x, r.Op, int(r.Value.(float64)))
+
+	case TypeTime:
+		x, _ := v.(time.Time)
+		if !f.Meta {
+			x = t.GetTime(f.Attr)
+		}
+		return matchTime(x, r.Op, r.Value, now)
+
+	case TypeBool:
+		x, _ := v.(bool)
+		return x == r.Value.(bool)
+	}
+	return false
+}
+
+// trackStrings returns the string values of the attribute.
+func trackStrings(t index.Track, attr string) []string {
+	switch attr {
+	case "Artist", "AlbumArtist", "Composer":
+		return t.GetStrings(attr)
+	}
+	if s := t.GetString(attr); s != "" {
+		return []string{s}
+	}
+	return nil
+}
+
+// matchStrings compares the values case-insensitively with v.  Positive operators match
+// if any value matches, negative operators (OpIsNot, OpNotContains) match if no value
+// matches the positive form.
+func matchStrings(values []string, op Operator, v string) bool {
+	v = strings.ToLower(v)
+	var neg bool
+	switch op {
+	case OpIsNot:
+		op, neg = OpIs, true
+	case OpNotContains:
+		op, neg = OpContains, true
+	}
+
+	for _, x := range values {
+		x = strings.ToLower(x)
+		var ok bool
+		switch op {
+		case OpIs:
+			ok = x == v
+		case OpContains:
+			ok = strings.Contains(x, v)
+		case OpStartsWith:
+			ok = strings.HasPrefix(x, v)
+		}
+		if ok {
+			return !neg
+		}
+	}
+	return neg
+}
+
+func matchInt(x int, op Operator, v int) bool {
+	switch op {
+	case OpEqual:
+		return x == v
+	case OpNotEqual:
+		return x != v
+	case OpLess:
+		return x < v
+	case OpLessEqual:
+		return x <= v
+	case OpGreater:
+		return x > v
+	case OpGreaterEqual:
+		return x >= v
+	}
+	return false
+}
+
+// matchTime compares x with the rule value v.  Zero times (i.e. tracks which have never
+// been played) are never before, after or in the last duration.
+func matchTime(x time.Time, op Operator, v interface{}, now time.Time) bool {
+	switch op {
+	case OpInLast, OpNotInLast:
+		d := time.Duration(v.(float64) * float64(time.Second))
+		in := !x.IsZero() && x.After(now.Add(-d))
+		return in == (op == OpInLast)
+
+	case OpBefore, OpAfter:
+		if x.IsZero() {
+			return false
+		}
+		t, _ := time.Parse(time.RFC3339, v.(string))
+		if op == OpBefore {
+			return x.Before(t)
+		}
+		return x.After(t)
+	}
+	return false
+}
+
+// Evaluate returns the paths of the tracks in the Group (with path root) which match the
+// rules of the playlist.
+func Evaluate(p Playlist, g index.Group, root index.Path, m Meta, now time.Time) ([]index.Path, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	var paths []index.Path
+	err := index.Walk(g, root, func(t index.Track, tp index.Path) error {
+		if p.Matches(t, tp, m, now) {
+			paths = append(paths, tp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smart
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"tchaik.com/index"
+)
+
+type testTrack struct {
+	Name, Genre string
+	Artist      []string
+	Year        int
+}
+
+func (t testTrack) GetString(k string) string {
+	switch k {
+	case "Name":
+		return t.Name
+	case "Genre":
+		return t.Genre
+	}
+	return ""
+}
+
+func (t testTrack) GetStrings(k string) []string {
+	if k == "Artist" {
+		return t.Artist
+	}
+	return nil
+}
+
+func (t testTrack) GetInt(k string) int {
+	if k == "Year" {
+		return t.Year
+	}
+	return 0
+}
+
+func (t testTrack) GetTime(k string) time.Time { return time.Time{} }
+
+// testMeta is a smart.Meta which returns values keyed by track name.
+type testMeta map[string]map[string]interface{}
+
+func (m testMeta) Value(attr string, t index.Track, p index.Path) interface{} {
+	return m[t.GetString("Name")][attr]
+}
+
+var now = time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func TestRuleMatches(t *testing.T) {
+	track := testTrack{Name: "So What", Genre: "Jazz", Artist: []string{"Miles Davis", "John Coltrane"}, Year: 1959}
+	meta := testMeta{
+		"So What": {
+			"Rating":     4,
+			"LastPlayed": now.Add(-48 * time.Hour),
+			"Favourite":  true,
+		},
+	}
+
+	tests := []struct {
+		r        Rule
+		expected bool
+	}{
+		{Rule{"genre", OpIs, "jazz"}, true},
+		{Rule{"genre", OpIsNot, "jazz"}, false},
+		{Rule{"artist", OpContains, "coltrane"}, true},
+		{Rule{"artist", OpNotContains, "coltrane"}, false},
+		{Rule{"artist", OpStartsWith, "miles"}, true},
+		{Rule{"name", OpStartsWith, "what"}, false},
+		{Rule{"year", OpLess, 1960.0}, true},
+		{Rule{"year", OpGreaterEqual, 1960.0}, false},
+		{Rule{"rating", OpEqual, 4.0}, true},
+		{Rule{"rating", OpEqual, 5.0}, false},
+		{Rule{"lastPlayed", OpInLast, 7 * 24 * 3600.0}, true},
+		{Rule{"lastPlayed", OpNotInLast, 24 * 3600.0}, true},
+		{Rule{"lastPlayed", OpNotInLast, 7 * 24 * 3600.0}, false},
+		{Rule{"lastPlayed", OpAfter, "2015-05-01T00:00:00Z"}, true},
+		{Rule{"favourite", OpIs, true}, true},
+		{Rule{"checklist", OpIs, true}, false},
+		{Rule{"checklist", OpIs, false}, true},
+		{Rule{"added", OpBefore, "2015-05-01T00:00:00Z"}, false}, // zero time
+	}
+
+	for ii, tt := range tests {
+		if err := tt.r.Validate(); err != nil {
+			t.Errorf("[%d] unexpected error from Validate: %v", ii, err)
+			continue
+		}
+		got := tt.r.Matches(track, nil, meta, now)
+		if got != tt.expected {
+			t.Errorf("[%d] %v.Matches() = %v, expected: %v", ii, tt.r, got, tt.expected)
+		}
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []Rule{
+		{"unknown", OpIs, "x"},
+		{"genre", OpLess, "x"},
+		{"genre", OpIs, 1.0},
+		{"year", OpEqual, "1959"},
+		{"lastPlayed", OpInLast, "30 days"},
+		{"lastPlayed", OpBefore, "yesterday"},
+		{"favourite", OpIs, "true"},
+	}
+
+	for ii, r := range tests {
+		if err := r.Validate(); err == nil {
+			t.Errorf("[%d] expected error from %v.Validate()", ii, r)
+		}
+	}
+}
+
+type testGroup []index.Track
+
+func (g testGroup) Tracks() []index.Track    { return g }
+func (g testGroup) Name() string             { return "" }
+func (g testGroup) Field(string) interface{} { return nil }
+
+func TestEvaluate(t *testing.T) {
+	tracks := testGroup{
+		testTrack{Name: "So What", Genre: "Jazz"},
+		testTrack{Name: "Blue in Green", Genre: "Jazz"},
+		testTrack{Name: "Clair de Lune", Genre: "Classical"},
+	}
+	meta := testMeta{
+		"So What":       {"Rating": 5, "LastPlayed": now.Add(-time.Hour)},
+		"Blue in Green": {"Rating": 5},
+		"Clair de Lune": {"Rating": 5},
+	}
+
+	// All 5-star jazz tracks not played in 30 days.
+	p := Playlist{
+		Match: MatchAll,
+		Rules: []Rule{
+			{"rating", OpEqual, 5.0},
+			{"genre", OpIs, "Jazz"},
+			{"lastPlayed", OpNotInLast, 30 * 24 * 3600.0},
+		},
+	}
+
+	got, err := Evaluate(p, tracks, index.Path{"Root"}, meta, now)
+	if err != nil {
+		t.Fatalf("unexpected error from Evaluate: %v", err)
+	}
+	expected := []index.Path{{"Root", "1"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Evaluate() = %v, expected: %v", got, expected)
+	}
+
+	p.Match = MatchAny
+	got, err = Evaluate(p, tracks, index.Path{"Root"}, meta, now)
+	if err != nil {
+		t.Fatalf("unexpected error from Evaluate: %v", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("len(Evaluate()) = %d, expected: %d", len(got), 3)
+	}
+
+	if _, err := Evaluate(Playlist{Match: "some"}, tracks, nil, meta, now); err == nil {
+		t.Errorf("expected error from Evaluate with invalid match")
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tagwrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FLAC metadata block types.
+const (
+	flacStreamInfo    byte = 0
+	flacPadding            = 1
+	flacVorbisComment      = 4
+)
+
+// maxFLACBlockSize is the largest metadata block (the size is a 24-bit field).
+const maxFLACBlockSize = 1<<24 - 1
+
+// ratingComment is the name of the Vorbis comment which holds the rating, from 0 to 100.
+const ratingComment = "RATING"
+
+// flacBlock is a metadata block of a FLAC file.
+type flacBlock struct {
+	typ  byte
+	data []byte
+}
+
+// readFLAC reads the metadata blocks of the FLAC stream r, returning the blocks and the size
+// of the metadata (including the "fLaC" marker).
+func readFLAC(r io.ReaderAt) ([]flacBlock, int64, error) {
+	var blocks []flacBlock
+	off := int64(4)
+	for {
+		h := make([]byte, 4)
+		if _, err := r.ReadAt(h, off); err != nil {
+			return nil, 0, err
+		}
+		data := make([]byte, int(h[1])<<16|int(h[2])<<8|int(h[3]))
+		if _, err := r.ReadAt(data, off+4); err != nil {
+			return nil, 0, err
+		}
+		blocks = append(blocks, flacBlock{typ: h[0] & 0x7f, data: data})
+		off += int64(4 + len(data))
+
+		if h[0]&0x80 != 0 {
+			break
+		}
+	}
+	if blocks[0].typ != flacStreamInfo {
+		return nil, 0, errors.New("invalid FLAC stream: first metadata block is not STREAMINFO")
+	}
+	return blocks, off, nil
+}
+
+// vorbisComments are the comments of a VORBIS_COMMENT block.
+type vorbisComments struct {
+	vendor   string
+	comments []string // "NAME=value"
+}
+
+func parseVorbisComments(b []byte) (*vorbisComments, error) {
+	errInvalid := errors.New("invalid VORBIS_COMMENT block")
+	next := func() (string, error) {
+		if len(b) < 4 {
+			return "", errInvalid
+		}
+		n := binary.LittleEndian.Uint32(b)
+		b = b[4:]
+		if uint64(n) > uint64(len(b)) {
+			return "", errInvalid
+		}
+		s := string(b[:n])
+		b = b[n:]
+		return s, nil
+	}
+
+	vendor, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, errInvalid
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+
+	vc := &vorbisComments{vendor: vendor}
+	for i := uint32(0); i < count; i++ {
+		c, err := next()
+		if err != nil {
+			return nil, err
+		}
+		vc.comments = append(vc.comments, c)
+	}
+	return vc, nil
+}
+
+func (vc *vorbisComments) bytes() []byte {
+	var b bytes.Buffer
+	put := func(n int) {
+		x := make([]byte, 4)
+		binary.LittleEndian.PutUint32(x, uint32(n))
+		b.Write(x)
+	}
+	put(len(vc.vendor))
+	b.WriteString(vc.vendor)
+	put(len(vc.comments))
+	for _, c := range vc.comments {
+		put(len(c))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+// set replaces the comments with the name (ignoring case) with one with the value, or removes
+// them if value is empty.
+func (vc *vorbisComments) set(name, value string) {
+	comments := vc.comments[:0]
+	for _, c := range vc.comments {
+		if i := strings.Index(c, "="); i >= 0 && strings.EqualFold(c[:i], name) {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	if value != "" {
+		comments = append(comments, name+"="+value)
+	}
+	vc.comments = comments
+}
+
+// editVorbisComments applies the edit to the comments.
+func editVorbisComments(vc *vorbisComments, e edit) {
+	if e.rating != nil {
+		var v string
+		if r := *e.rating; r > 0 {
+			v = strconv.Itoa(r * 20)
+		}
+		vc.set(ratingComment, v)
+	}
+	if e.favourite != nil {
+		var v string
+		if *e.favourite {
+			v = "1"
+		}
+		vc.set(favouriteDescription, v)
+	}
+}
+
+// flacMetadata returns the encoded metadata (including the "fLaC" marker) for the blocks,
+// followed by a padding block of n bytes if n >= 0.
+func flacMetadata(blocks []flacBlock, n int) []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	if n >= 0 {
+		blocks = append(blocks, flacBlock{typ: flacPadding, data: make([]byte, n)})
+	}
+	for i, bl := range blocks {
+		typ := bl.typ
+		if i == len(blocks)-1 {
+			typ |= 0x80
+		}
+		b.Write([]byte{typ, byte(len(bl.data) >> 16), byte(len(bl.data) >> 8), byte(len(bl.data))})
+		b.Write(bl.data)
+	}
+	return b.Bytes()
+}
+
+// writeFLAC applies the edit to the VORBIS_COMMENT block of the FLAC file (adding one if there
+// is none).  The metadata is rewritten in place if it has enough padding.
+func writeFLAC(f *os.File, e edit) error {
+	blocks, size, err := readFLAC(f)
+	if err != nil {
+		return err
+	}
+
+	// Padding is dropped, and recreated to fill the space of the original metadata.
+	var vc *vorbisComments
+	var vcIndex int
+	kept := blocks[:0]
+	for _, bl := range blocks {
+		if bl.typ == flacPadding {
+			continue
+		}
+		if bl.typ == flacVorbisComment && vc == nil {
+			vc, err = parseVorbisComments(bl.data)
+			if err != nil {
+				return err
+			}
+			vcIndex = len(kept)
+		}
+		kept = append(kept, bl)
+	}
+	if vc == nil {
+		vc = &vorbisComments{vendor: "tchaik"}
+		vcIndex = len(kept)
+		kept = append(kept, flacBlock{typ: flacVorbisComment})
+	}
+	editVorbisComments(vc, e)
+	kept[vcIndex].data = vc.bytes()
+	if len(kept[vcIndex].data) > maxFLACBlockSize {
+		return errors.New("VORBIS_COMMENT block too large")
+	}
+
+	b := flacMetadata(kept, -1)
+	switch free := size - int64(len(b)); {
+	case free == 0:
+	case free >= 4 && free-4 <= maxFLACBlockSize:
+		b = flacMetadata(kept, int(free-4))
+	default:
+		b = flacMetadata(kept, padding)
+	}
+	return replace(f, b, size)
+}
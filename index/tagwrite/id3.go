@@ -0,0 +1,219 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tagwrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// popmEmail identifies the POPM (popularimeter) frame written by tchaik.
+const popmEmail = "tchaik"
+
+// favouriteDescription is the description of the TXXX frame (and the name of the Vorbis
+// comment) which holds the favourite flag.
+const favouriteDescription = "FAVOURITE"
+
+// popmRatings maps ratings to POPM rating bytes, using the same scale as other players
+// (i.e. Windows Media Player).
+var popmRatings = [...]byte{0, 1, 64, 128, 196, 255}
+
+// id3Frame is a frame of an ID3v2 tag.
+type id3Frame struct {
+	id    string
+	flags [2]byte
+	data  []byte
+}
+
+// id3Tag is an ID3v2.3 or ID3v2.4 tag.
+type id3Tag struct {
+	version byte // major version: 3 or 4
+	frames  []id3Frame
+	size    int64 // size of the tag in the file (including the header), 0 if there is none
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+func putSyncsafe(b []byte, n int) {
+	b[0] = byte(n >> 21 & 0x7f)
+	b[1] = byte(n >> 14 & 0x7f)
+	b[2] = byte(n >> 7 & 0x7f)
+	b[3] = byte(n & 0x7f)
+}
+
+// readID3 reads the ID3v2 tag at the start of r.  Tags which use unsynchronisation, or have an
+// extended header or footer, aren't supported.
+func readID3(r io.ReaderAt) (*id3Tag, error) {
+	h := make([]byte, 10)
+	n, err := r.ReadAt(h, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n < len(h) || string(h[:3]) != "ID3" {
+		return &id3Tag{version: 3}, nil
+	}
+	if h[3] != 3 && h[3] != 4 {
+		return nil, ErrUnsupported
+	}
+	if h[5]&0xd0 != 0 {
+		return nil, ErrUnsupported
+	}
+
+	body := make([]byte, syncsafe(h[6:]))
+	if _, err := r.ReadAt(body, 10); err != nil {
+		return nil, err
+	}
+
+	t := &id3Tag{version: h[3], size: int64(10 + len(body))}
+	for off := 0; off+10 <= len(body) && body[off] != 0; {
+		fh := body[off : off+10]
+		var n int
+		if t.version == 4 {
+			n = syncsafe(fh[4:8])
+		} else {
+			n = int(binary.BigEndian.Uint32(fh[4:8]))
+		}
+		off += 10
+		if n < 0 || off+n > len(body) {
+			return nil, errors.New("invalid ID3v2 frame size")
+		}
+		t.frames = append(t.frames, id3Frame{
+			id:    string(fh[:4]),
+			flags: [2]byte{fh[8], fh[9]},
+			data:  body[off : off+n],
+		})
+		off += n
+	}
+	return t, nil
+}
+
+// bytes returns the encoded tag, padded to at least size bytes.
+func (t *id3Tag) bytes(size int) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{'I', 'D', '3', t.version, 0, 0, 0, 0, 0, 0})
+	for _, f := range t.frames {
+		fh := make([]byte, 10)
+		copy(fh, f.id)
+		if t.version == 4 {
+			putSyncsafe(fh[4:8], len(f.data))
+		} else {
+			binary.BigEndian.PutUint32(fh[4:8], uint32(len(f.data)))
+		}
+		fh[8], fh[9] = f.flags[0], f.flags[1]
+		b.Write(fh)
+		b.Write(f.data)
+	}
+	if n := size - b.Len(); n > 0 {
+		b.Write(make([]byte, n))
+	}
+
+	tag := b.Bytes()
+	putSyncsafe(tag[6:10], len(tag)-10)
+	return tag
+}
+
+// remove removes the frames for which fn returns true.
+func (t *id3Tag) remove(fn func(id3Frame) bool) {
+	frames := t.frames[:0]
+	for _, f := range t.frames {
+		if !fn(f) {
+			frames = append(frames, f)
+		}
+	}
+	t.frames = frames
+}
+
+// framePOPMEmail returns the email (identifying the player which wrote it) of the POPM frame.
+func framePOPMEmail(f id3Frame) string {
+	if i := bytes.IndexByte(f.data, 0); i >= 0 {
+		return string(f.data[:i])
+	}
+	return string(f.data)
+}
+
+// frameTXXXDescription returns the description of the TXXX (user defined text) frame.
+func frameTXXXDescription(f id3Frame) string {
+	if len(f.data) == 0 {
+		return ""
+	}
+	enc, b := f.data[0], f.data[1:]
+	if enc == 0 || enc == 3 {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return string(b)
+	}
+
+	// UTF-16, with a BOM (1) or big-endian (2).
+	order := binary.ByteOrder(binary.BigEndian)
+	if enc == 1 && len(b) >= 2 {
+		if b[0] == 0xff && b[1] == 0xfe {
+			order = binary.LittleEndian
+		}
+		b = b[2:]
+	}
+	var u []uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		c := order.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// editID3 applies the edit to the frames of the tag.
+func editID3(t *id3Tag, e edit) {
+	if e.rating != nil {
+		t.remove(func(f id3Frame) bool {
+			return f.id == "POPM" && framePOPMEmail(f) == popmEmail
+		})
+		if r := *e.rating; r > 0 {
+			t.frames = append(t.frames, id3Frame{
+				id:   "POPM",
+				data: append([]byte(popmEmail+"\x00"), popmRatings[r]),
+			})
+		}
+	}
+
+	if e.favourite != nil {
+		t.remove(func(f id3Frame) bool {
+			return f.id == "TXXX" && strings.EqualFold(frameTXXXDescription(f), favouriteDescription)
+		})
+		if *e.favourite {
+			t.frames = append(t.frames, id3Frame{
+				id:   "TXXX",
+				data: []byte("\x00" + favouriteDescription + "\x001"),
+			})
+		}
+	}
+}
+
+// writeID3 applies the edit to the ID3v2 tag of the file (adding one if there is none).  The
+// tag is rewritten in place if it has enough padding.
+func writeID3(f *os.File, e edit) error {
+	t, err := readID3(f)
+	if err != nil {
+		return err
+	}
+	editID3(t, e)
+	if t.size == 0 && len(t.frames) == 0 {
+		return nil
+	}
+
+	b := t.bytes(int(t.size))
+	if int64(len(b)) > t.size {
+		b = t.bytes(len(b) + padding)
+	}
+	return replace(f, b, t.size)
+}
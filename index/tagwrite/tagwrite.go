@@ -0,0 +1,110 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tagwrite implements writing ratings and favourites into the metadata tags of audio
+// files, so that they can be read by other players: POPM (and TXXX) frames in ID3v2 tags
+// (MP3), and RATING (and FAVOURITE) Vorbis comments (FLAC).
+package tagwrite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupported is returned when writing tags to a file whose format (or tag version) isn't
+// supported.
+var ErrUnsupported = errors.New("unsupported file format for writing tags")
+
+// padding is the size of the padding added after rewritten tags, so that later changes can
+// be written without rewriting the whole file.
+const padding = 1024
+
+// edit is a change to the tags of a file.  Nil fields are left unchanged.
+type edit struct {
+	rating    *int // 0 (no rating) to 5
+	favourite *bool
+}
+
+// SetRating writes the rating (0 for no rating, otherwise 1 to 5) into the tags of the file.
+func SetRating(path string, rating int) error {
+	if rating < 0 || rating > 5 {
+		return fmt.Errorf("invalid rating: %d (must be between 0 and 5)", rating)
+	}
+	return write(path, edit{rating: &rating})
+}
+
+// SetFavourite writes the favourite flag into the tags of the file.
+func SetFavourite(path string, favourite bool) error {
+	return write(path, edit{favourite: &favourite})
+}
+
+func write(path string, e edit) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	switch {
+	case string(magic[:3]) == "ID3":
+		return writeID3(f, e)
+	case string(magic) == "fLaC":
+		return writeFLAC(f, e)
+	case strings.ToLower(filepath.Ext(path)) == ".mp3":
+		// MP3 without an ID3v2 tag.
+		return writeID3(f, e)
+	}
+	return ErrUnsupported
+}
+
+// replace writes the new header (tags) of the file, which replaces the first size bytes.  If
+// the header is the same size then it is written in place, otherwise the file is rewritten
+// (to a temporary file which then replaces the original).
+func replace(f *os.File, header []byte, size int64) error {
+	if int64(len(header)) == size {
+		_, err := f.WriteAt(header, 0)
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Name()), ".tagwrite-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails once renamed
+
+	if _, err := tmp.Write(header); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := f.Seek(size, os.SEEK_SET); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Name())
+}
@@ -0,0 +1,209 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tagwrite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// audio is the (fake) audio data written after the tags of test files.
+var audio = []byte("audio data which must be preserved")
+
+func tempFile(t *testing.T, name string, data []byte) (string, func()) {
+	dir, err := ioutil.TempDir("", "tagwrite")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("unexpected error writing temp file: %v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func readFile(t *testing.T, path string) *os.File {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening file: %v", err)
+	}
+	return f
+}
+
+func TestWriteID3(t *testing.T) {
+	existing := &id3Tag{
+		version: 3,
+		frames: []id3Frame{
+			{id: "TIT2", data: []byte("\x00Title")},
+			{id: "POPM", data: []byte("Windows Media Player 9 Series\x00\xc4")},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		padding bool // if true, then the tag should be rewritten in place
+	}{
+		{"untagged.mp3", audio, false},
+		{"tagged.mp3", append(existing.bytes(0), audio...), false},
+		{"padded.mp3", append(existing.bytes(256), audio...), true},
+	}
+
+	for _, tt := range tests {
+		path, cleanup := tempFile(t, tt.name, tt.data)
+		defer cleanup()
+
+		if err := SetRating(path, 3); err != nil {
+			t.Errorf("[%s] unexpected error from SetRating(): %v", tt.name, err)
+			continue
+		}
+		if err := SetFavourite(path, true); err != nil {
+			t.Errorf("[%s] unexpected error from SetFavourite(): %v", tt.name, err)
+			continue
+		}
+		if err := SetRating(path, 4); err != nil {
+			t.Errorf("[%s] unexpected error from SetRating(): %v", tt.name, err)
+			continue
+		}
+
+		f := readFile(t, path)
+		tag, err := readID3(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("[%s] unexpected error reading tag: %v", tt.name, err)
+			continue
+		}
+		if tt.padding && tag.size != int64(len(tt.data)-len(audio)) {
+			t.Errorf("[%s] tag size = %d, expected: %d (rewritten in place)", tt.name, tag.size, len(tt.data)-len(audio))
+		}
+
+		var popm, favourite []byte
+		for _, fr := range tag.frames {
+			switch {
+			case fr.id == "POPM" && framePOPMEmail(fr) == popmEmail:
+				if popm != nil {
+					t.Errorf("[%s] duplicate POPM frame", tt.name)
+				}
+				popm = fr.data
+			case fr.id == "TXXX" && frameTXXXDescription(fr) == favouriteDescription:
+				favourite = fr.data
+			}
+		}
+		if expected := []byte("tchaik\x00\xc4"); !bytes.Equal(popm, expected) {
+			t.Errorf("[%s] POPM = %q, expected: %q", tt.name, popm, expected)
+		}
+		if expected := []byte("\x00FAVOURITE\x001"); !bytes.Equal(favourite, expected) {
+			t.Errorf("[%s] TXXX = %q, expected: %q", tt.name, favourite, expected)
+		}
+
+		b, _ := ioutil.ReadFile(path)
+		if !bytes.HasSuffix(b, audio) {
+			t.Errorf("[%s] audio data was not preserved", tt.name)
+		}
+	}
+}
+
+func TestFrameTXXXDescription(t *testing.T) {
+	tests := []struct {
+		data []byte
+		out  string
+	}{
+		{[]byte("\x00FAVOURITE\x001"), "FAVOURITE"},
+		{[]byte("\x03FAVOURITE\x001"), "FAVOURITE"},
+		{[]byte("\x01\xff\xfeF\x00A\x00V\x00\x00\x00"), "FAV"},
+		{[]byte("\x02\x00F\x00A\x00V\x00\x00"), "FAV"},
+		{nil, ""},
+	}
+
+	for ii, tt := range tests {
+		got := frameTXXXDescription(id3Frame{id: "TXXX", data: tt.data})
+		if got != tt.out {
+			t.Errorf("[%d] frameTXXXDescription(%q) = %#v, expected: %#v", ii, tt.data, got, tt.out)
+		}
+	}
+}
+
+func TestWriteFLAC(t *testing.T) {
+	streamInfo := flacBlock{typ: flacStreamInfo, data: make([]byte, 34)}
+	comments := &vorbisComments{vendor: "test", comments: []string{"TITLE=Title", "rating=60"}}
+	withComments := []flacBlock{streamInfo, {typ: flacVorbisComment, data: comments.bytes()}}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		inPlace bool
+	}{
+		{"none.flac", append(flacMetadata([]flacBlock{streamInfo}, -1), audio...), false},
+		{"comments.flac", append(flacMetadata(withComments, -1), audio...), false},
+		{"padded.flac", append(flacMetadata(withComments, 512), audio...), true},
+	}
+
+	for _, tt := range tests {
+		path, cleanup := tempFile(t, tt.name, tt.data)
+		defer cleanup()
+
+		if err := SetRating(path, 5); err != nil {
+			t.Errorf("[%s] unexpected error from SetRating(): %v", tt.name, err)
+			continue
+		}
+		if err := SetFavourite(path, true); err != nil {
+			t.Errorf("[%s] unexpected error from SetFavourite(): %v", tt.name, err)
+			continue
+		}
+		if err := SetFavourite(path, false); err != nil {
+			t.Errorf("[%s] unexpected error from SetFavourite(): %v", tt.name, err)
+			continue
+		}
+
+		f := readFile(t, path)
+		blocks, size, err := readFLAC(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("[%s] unexpected error reading metadata: %v", tt.name, err)
+			continue
+		}
+		if tt.inPlace && size != int64(len(tt.data)-len(audio)) {
+			t.Errorf("[%s] metadata size = %d, expected: %d (rewritten in place)", tt.name, size, len(tt.data)-len(audio))
+		}
+
+		var got []string
+		for _, bl := range blocks {
+			if bl.typ == flacVorbisComment {
+				vc, err := parseVorbisComments(bl.data)
+				if err != nil {
+					t.Errorf("[%s] unexpected error parsing comments: %v", tt.name, err)
+					continue
+				}
+				got = vc.comments
+			}
+		}
+		var expected []string
+		if tt.name != "none.flac" {
+			expected = append(expected, "TITLE=Title")
+		}
+		expected = append(expected, "RATING=100")
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("[%s] comments = %v, expected: %v", tt.name, got, expected)
+		}
+
+		b, _ := ioutil.ReadFile(path)
+		if !bytes.HasSuffix(b, audio) {
+			t.Errorf("[%s] audio data was not preserved", tt.name)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	path, cleanup := tempFile(t, "track.m4a", append([]byte("\x00\x00\x00\x20ftypM4A "), audio...))
+	defer cleanup()
+
+	if err := SetRating(path, 3); err != ErrUnsupported {
+		t.Errorf("SetRating() = %v, expected: %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,192 @@
+package walk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// audioInfo describes the audio stream of a file.  Zero values are unknown.
+type audioInfo struct {
+	BitRate    int // kbps
+	SampleRate int // Hz
+	BitDepth   int // bits per sample (lossless formats only)
+	Duration   time.Duration
+}
+
+// mp3ScanLimit is the maximum number of bytes read (after any ID3v2 tag) when looking for
+// the first MPEG audio frame.
+const mp3ScanLimit = 64 * 1024
+
+// readAudioInfo reads the audio stream properties from r, which contains an audio file of
+// the given type and size.  Returns the zero audioInfo if the properties can't be read.
+func readAudioInfo(r io.ReadSeeker, ft tag.FileType, size int64) audioInfo {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return audioInfo{}
+	}
+	offset, err := skipID3v2(r)
+	if err != nil {
+		return audioInfo{}
+	}
+
+	switch ft {
+	case tag.FLAC:
+		return readFLACInfo(r, size-offset)
+	case tag.MP3:
+		b := make([]byte, mp3ScanLimit)
+		n, _ := io.ReadFull(r, b)
+		return readMP3Info(b[:n], size-offset)
+	}
+	return audioInfo{}
+}
+
+// skipID3v2 advances r past an ID3v2 tag (if there is one at the current position), and
+// returns the number of bytes skipped.
+func skipID3v2(r io.ReadSeeker) (int64, error) {
+	b := make([]byte, 10)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	if string(b[:3]) != "ID3" {
+		_, err := r.Seek(0, io.SeekStart)
+		return 0, err
+	}
+
+	// The size is a 28-bit "synchsafe" integer which excludes the header and footer.
+	n := int64(b[6]&0x7f)<<21 | int64(b[7]&0x7f)<<14 | int64(b[8]&0x7f)<<7 | int64(b[9]&0x7f)
+	n += 10
+	if b[5]&0x10 != 0 {
+		n += 10
+	}
+	_, err := r.Seek(n, io.SeekStart)
+	return n, err
+}
+
+// readFLACInfo reads the STREAMINFO block of a FLAC stream of the given size.
+func readFLACInfo(r io.Reader, size int64) audioInfo {
+	b := make([]byte, 4+4+34)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return audioInfo{}
+	}
+	// STREAMINFO must be the first metadata block.
+	if string(b[:4]) != "fLaC" || b[4]&0x7f != 0 {
+		return audioInfo{}
+	}
+
+	si := b[8:]
+	rate := int(si[10])<<12 | int(si[11])<<4 | int(si[12])>>4
+	if rate == 0 {
+		return audioInfo{}
+	}
+	ai := audioInfo{
+		SampleRate: rate,
+		BitDepth:   (int(si[12]&0x01)<<4 | int(si[13])>>4) + 1,
+	}
+
+	samples := int64(si[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(si[14:18]))
+	ai.Duration = time.Duration(samples) * time.Second / time.Duration(rate)
+	if samples > 0 && size > 0 {
+		ai.BitRate = int(size * 8 * int64(rate) / samples / 1000)
+	}
+	return ai
+}
+
+// MPEG audio versions, as encoded in frame headers.
+const (
+	mpeg25 = 0
+	mpeg2  = 2
+	mpeg1  = 3
+)
+
+// mp3BitRates are the bit rates (kbps) for each bit rate index, by MPEG version (MPEG-1 and
+// MPEG-2/2.5) and layer (I, II, III).
+var mp3BitRates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// mp3SampleRates are the sample rates (Hz) for each sample rate index, by MPEG version.
+var mp3SampleRates = map[int][3]int{
+	mpeg1:  {44100, 48000, 32000},
+	mpeg2:  {22050, 24000, 16000},
+	mpeg25: {11025, 12000, 8000},
+}
+
+// readMP3Info reads the first MPEG audio frame in b, from a stream of the given size.  VBR
+// streams are identified by a Xing header in the first frame, in which case the bit rate
+// is the average over the stream.
+func readMP3Info(b []byte, size int64) audioInfo {
+	for i := 0; i+4 <= len(b); i++ {
+		if b[i] != 0xff || b[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		version := int(b[i+1]>>3) & 0x03
+		layer := 4 - int(b[i+1]>>1)&0x03
+		brIndex := int(b[i+2] >> 4)
+		srIndex := int(b[i+2]>>2) & 0x03
+		if version == 1 || layer == 4 || brIndex == 0 || brIndex == 15 || srIndex == 3 {
+			continue
+		}
+
+		v := 0
+		if version != mpeg1 {
+			v = 1
+		}
+		ai := audioInfo{
+			BitRate:    mp3BitRates[v][layer-1][brIndex],
+			SampleRate: mp3SampleRates[version][srIndex],
+		}
+
+		if size > 0 {
+			ai.Duration = time.Duration(size*8) * time.Second / time.Duration(ai.BitRate*1000)
+		}
+		if layer == 3 {
+			if frames := xingFrames(b[i:], version); frames > 0 && size > 0 {
+				spf := int64(1152)
+				if version != mpeg1 {
+					spf = 576
+				}
+				ai.BitRate = int(size * 8 * int64(ai.SampleRate) / (int64(frames) * spf) / 1000)
+				ai.Duration = time.Duration(int64(frames)*spf) * time.Second / time.Duration(ai.SampleRate)
+			}
+		}
+		return ai
+	}
+	return audioInfo{}
+}
+
+// xingFrames returns the number of frames given in the Xing header of the Layer III frame
+// f, or 0 if there isn't one (i.e. the stream is CBR).
+func xingFrames(f []byte, version int) int {
+	mono := f[3]>>6 == 0x03
+	// The header follows the side information.
+	offset := 4 + 32
+	switch {
+	case version == mpeg1 && mono:
+		offset = 4 + 17
+	case version != mpeg1 && !mono:
+		offset = 4 + 17
+	case version != mpeg1 && mono:
+		offset = 4 + 9
+	}
+
+	if len(f) < offset+12 || !bytes.Equal(f[offset:offset+4], []byte("Xing")) {
+		return 0
+	}
+	flags := binary.BigEndian.Uint32(f[offset+4:])
+	if flags&0x01 == 0 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(f[offset+8:]))
+}
@@ -0,0 +1,228 @@
+package walk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cueSheet is a parsed cue sheet, which describes the tracks within audio files.
+type cueSheet struct {
+	Title     string
+	Performer string
+	Files     []cueFile
+}
+
+// cueFile is an audio file referenced by a cue sheet.
+type cueFile struct {
+	Name   string
+	Tracks []cueSheetTrack
+}
+
+// cueSheetTrack is a track in a cue sheet.
+type cueSheetTrack struct {
+	Number    int
+	Title     string
+	Performer string
+	Start     time.Duration // position of INDEX 01 in the file
+}
+
+// cueFramesPerSecond is the number of frames (the unit of cue sheet times) in a second.
+const cueFramesPerSecond = 75
+
+// parseCueSheet reads a cue sheet from r.  Commands which don't describe audio tracks are
+// ignored.
+func parseCueSheet(r io.Reader) (*cueSheet, error) {
+	cs := &cueSheet{}
+	var f *cueFile
+	var t *cueSheetTrack
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(strings.TrimPrefix(s.Text(), "\ufeff"))
+		cmd, args := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			cmd, args = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(cmd) {
+		case "FILE":
+			cs.Files = append(cs.Files, cueFile{Name: cueString(args)})
+			f, t = &cs.Files[len(cs.Files)-1], nil
+
+		case "TRACK":
+			if f == nil {
+				return nil, fmt.Errorf("line %d: TRACK before FILE", n)
+			}
+			fields := strings.Fields(args)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: invalid TRACK: %q", n, args)
+			}
+			if !strings.EqualFold(fields[1], "AUDIO") {
+				t = nil
+				continue
+			}
+			num, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid track number: %q", n, fields[0])
+			}
+			f.Tracks = append(f.Tracks, cueSheetTrack{Number: num, Start: -1})
+			t = &f.Tracks[len(f.Tracks)-1]
+
+		case "INDEX":
+			fields := strings.Fields(args)
+			if t == nil || len(fields) != 2 || fields[0] != "01" {
+				continue
+			}
+			d, err := parseCueTime(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			t.Start = d
+
+		case "TITLE":
+			if t != nil {
+				t.Title = cueString(args)
+			} else {
+				cs.Title = cueString(args)
+			}
+
+		case "PERFORMER":
+			if t != nil {
+				t.Performer = cueString(args)
+			} else {
+				cs.Performer = cueString(args)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range cs.Files {
+		for _, t := range f.Tracks {
+			if t.Start < 0 {
+				return nil, fmt.Errorf("track %d has no INDEX 01", t.Number)
+			}
+		}
+	}
+	return cs, nil
+}
+
+// cueString returns the (possibly quoted) string at the start of s, i.e. the name in
+// `"Disc 1.flac" WAVE`.
+func cueString(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if i := strings.Index(s[1:], `"`); i >= 0 {
+			return s[1 : i+1]
+		}
+		return s[1:]
+	}
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// parseCueTime parses a cue sheet time of the form mm:ss:ff (minutes, seconds, frames).
+func parseCueTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time: %q", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time: %q", s)
+		}
+		v[i] = n
+	}
+	if v[1] >= 60 || v[2] >= cueFramesPerSecond {
+		return 0, fmt.Errorf("invalid time: %q", s)
+	}
+	frames := (v[0]*60+v[1])*cueFramesPerSecond + v[2]
+	return time.Duration(frames) * time.Second / cueFramesPerSecond, nil
+}
+
+// Tracks returns the tracks of the audio file with the given name.  Cue sheets which only
+// reference one file describe that file, whatever the name given (which is often the name
+// of the file the sheet was created from, i.e. "CDImage.wav").
+func (cs *cueSheet) Tracks(name string) []cueSheetTrack {
+	if len(cs.Files) == 1 {
+		return cs.Files[0].Tracks
+	}
+	for _, f := range cs.Files {
+		if filepath.Base(filepath.FromSlash(strings.Replace(f.Name, `\`, "/", -1))) == name {
+			return f.Tracks
+		}
+	}
+	return nil
+}
+
+// cueTrack is a track within an audio file, described by a cue sheet.
+type cueTrack struct {
+	cueSheetTrack
+	Count       int           // number of tracks in the file
+	Album       string        // TITLE of the cue sheet
+	AlbumArtist string        // PERFORMER of the cue sheet
+	End         time.Duration // start of the next track, 0 for the end of the file
+}
+
+// cueSheetPath returns the path of the cue sheet for the audio file at path (which has the
+// same name, with the extension replaced by, or followed by, ".cue"), or "" if there isn't
+// one.
+func cueSheetPath(path string) string {
+	for _, p := range []string{strings.TrimSuffix(path, filepath.Ext(path)) + ".cue", path + ".cue"} {
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// readCueTracks returns the tracks of the audio file at path given by its cue sheet (see
+// cueSheetPath).  Returns nil if there is no cue sheet, or if it describes fewer than two
+// tracks in the file (in which case the file is a single track).  Tracks which end at the
+// end of the file end at duration (if it is known, otherwise 0).
+func readCueTracks(path string, duration time.Duration) ([]cueTrack, error) {
+	p := cueSheetPath(path)
+	if p == "" {
+		return nil, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cs, err := parseCueSheet(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cue sheet %v: %v", p, err)
+	}
+
+	sheetTracks := cs.Tracks(filepath.Base(path))
+	if len(sheetTracks) < 2 {
+		return nil, nil
+	}
+
+	tracks := make([]cueTrack, len(sheetTracks))
+	for i, t := range sheetTracks {
+		tracks[i] = cueTrack{
+			cueSheetTrack: t,
+			Count:         len(sheetTracks),
+			Album:         cs.Title,
+			AlbumArtist:   cs.Performer,
+			End:           duration,
+		}
+		if i+1 < len(sheetTracks) {
+			tracks[i].End = sheetTracks[i+1].Start
+		}
+	}
+	return tracks, nil
+}
@@ -0,0 +1,120 @@
+package walk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCueTime(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Duration
+		err      bool
+	}{
+		{"00:00:00", 0, false},
+		{"01:02:00", 62 * time.Second, false},
+		{"00:01:15", 1200 * time.Millisecond, false},
+		{"90:00:00", 90 * time.Minute, false},
+		{"00:60:00", 0, true},
+		{"00:00:75", 0, true},
+		{"00:00", 0, true},
+		{"a:b:c", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCueTime(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parseCueTime(%#v) error = %v, expected error: %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("parseCueTime(%#v) = %v, expected: %v", tt.in, got, tt.expected)
+		}
+	}
+}
+
+const testCueSheet = "\ufeff" + `REM GENRE Classical
+PERFORMER "Orchestra"
+TITLE "Symphony No. 5"
+FILE "CDImage.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "Allegro con brio"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Andante con moto"
+    PERFORMER "Soloist"
+    INDEX 00 07:20:00
+    INDEX 01 07:22:30
+`
+
+func TestParseCueSheet(t *testing.T) {
+	cs, err := parseCueSheet(strings.NewReader(testCueSheet))
+	if err != nil {
+		t.Fatalf("parseCueSheet() error = %v", err)
+	}
+
+	expected := &cueSheet{
+		Title:     "Symphony No. 5",
+		Performer: "Orchestra",
+		Files: []cueFile{
+			{
+				Name: "CDImage.wav",
+				Tracks: []cueSheetTrack{
+					{Number: 1, Title: "Allegro con brio"},
+					{Number: 2, Title: "Andante con moto", Performer: "Soloist", Start: 442400 * time.Millisecond},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(cs, expected) {
+		t.Errorf("parseCueSheet() = %#v, expected: %#v", cs, expected)
+	}
+
+	// Any file name matches a single FILE.
+	if got := cs.Tracks("Symphony.flac"); len(got) != 2 {
+		t.Errorf("Tracks(%#v) returned %d tracks, expected: 2", "Symphony.flac", len(got))
+	}
+}
+
+func TestParseCueSheetErrors(t *testing.T) {
+	tests := []string{
+		"TRACK 01 AUDIO\n",
+		"FILE a.wav WAVE\nTRACK 01\n",
+		"FILE a.wav WAVE\nTRACK x AUDIO\nINDEX 01 00:00:00\n",
+		"FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 00 00:00:00\n",
+		"FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:99\n",
+	}
+
+	for _, tt := range tests {
+		if _, err := parseCueSheet(strings.NewReader(tt)); err == nil {
+			t.Errorf("parseCueSheet(%#v) expected error", tt)
+		}
+	}
+}
+
+func TestCueSheetTracks(t *testing.T) {
+	cs := &cueSheet{
+		Files: []cueFile{
+			{Name: `C:\Music\Disc 1.flac`, Tracks: []cueSheetTrack{{Number: 1}, {Number: 2}}},
+			{Name: "Disc 2.flac", Tracks: []cueSheetTrack{{Number: 3}}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		expected int
+	}{
+		{"Disc 1.flac", 2},
+		{"Disc 2.flac", 1},
+		{"Disc 3.flac", 0},
+	}
+
+	for _, tt := range tests {
+		got := cs.Tracks(tt.name)
+		if len(got) != tt.expected {
+			t.Errorf("Tracks(%#v) returned %d tracks, expected: %d", tt.name, len(got), tt.expected)
+		}
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -35,6 +37,15 @@ func validFiles(in <-chan string) <-chan string {
 	return out
 }
 
+// Files returns the list of paths of supported audio files under the given path.
+func Files(path string) []string {
+	var files []string
+	for p := range validFiles(walk(path)) {
+		files = append(files, p)
+	}
+	return files
+}
+
 var workers = 4
 
 type pathTrack struct {
@@ -45,10 +56,44 @@ type pathTrack struct {
 // NewLibrary constructs an index.Library by walking through the directory tree under
 // the given path.  Any errors are logged to stdout (TODO: fix this!)
 func NewLibrary(path string) index.Library {
+	l, _ := newLibrary(path, nil)
+	return l
+}
+
+// Update constructs an index.Library by walking through the directory tree under the given
+// path, re-using tracks from prev (which must have been created by NewLibrary or Update) for
+// files which have not been modified.  Returns the library and the number of files which
+// were (re-)processed.
+func Update(prev index.Library, path string) (index.Library, int) {
+	l, _ := prev.(*library)
+	return newLibrary(path, l)
+}
+
+// unchanged returns the track for the file at path p from the library if the file has not
+// been modified since the track was read.  Files with cue sheets are always re-read.
+func (l *library) unchanged(p string) (*track, bool) {
+	if l == nil || cueSheetPath(p) != "" {
+		return nil, false
+	}
+	t, ok := l.tracks[p]
+	if !ok {
+		return nil, false
+	}
+	fi, err := os.Stat(p)
+	if err != nil || !fi.ModTime().Equal(t.FileInfo.ModTime()) || fi.Size() != t.FileInfo.Size() {
+		return nil, false
+	}
+	return t, true
+}
+
+func newLibrary(path string, prev *library) (index.Library, int) {
 	trackCh := make(chan pathTrack)
 	errCh := make(chan error)
 	files := validFiles(walk(path))
 
+	var processed int
+	var processedMu sync.Mutex
+
 	go func() {
 		for err := range errCh {
 			// FIXME
@@ -58,12 +103,34 @@ func NewLibrary(path string) index.Library {
 
 	process := func(files <-chan string) {
 		for p := range files {
+			if t, ok := prev.unchanged(p); ok {
+				trackCh <- pathTrack{p, t}
+				continue
+			}
+
+			processedMu.Lock()
+			processed++
+			processedMu.Unlock()
+
 			t, err := processPath(p)
 			if err != nil {
 				errCh <- fmt.Errorf("error processing '%v': %v", p, err)
 				continue
 			}
-			trackCh <- pathTrack{p, t}
+
+			cts, err := readCueTracks(p, t.audio.Duration)
+			if err != nil {
+				errCh <- fmt.Errorf("error processing '%v': %v", p, err)
+			}
+			if len(cts) == 0 {
+				trackCh <- pathTrack{p, t}
+				continue
+			}
+			for i := range cts {
+				ct := *t
+				ct.cue = &cts[i]
+				trackCh <- pathTrack{fmt.Sprintf("%v#%d", p, cts[i].Number), &ct}
+			}
 		}
 	}
 
@@ -89,7 +156,7 @@ func NewLibrary(path string) index.Library {
 
 	return &library{
 		tracks: tracks,
-	}
+	}, processed
 }
 
 // library is an implementation of index.library.
@@ -118,12 +185,21 @@ type track struct {
 	Location    string
 	FileInfo    os.FileInfo
 	CreatedTime time.Time
+
+	audio audioInfo
+
+	// cue is set for tracks which are part of the file (as described by its cue sheet), nil
+	// if the file is a single track.
+	cue *cueTrack
 }
 
 // GetString implements index.Track.
 func (m *track) GetString(name string) string {
 	switch name {
 	case "Name":
+		if m.cue != nil && m.cue.Title != "" {
+			return m.cue.Title
+		}
 		title := m.Title()
 		if title == "" {
 			fileName := m.FileInfo.Name()
@@ -132,10 +208,24 @@ func (m *track) GetString(name string) string {
 		}
 		return title
 	case "Album":
+		if m.cue != nil && m.Album() == "" {
+			return m.cue.Album
+		}
 		return m.Album()
 	case "Artist":
+		if m.cue != nil {
+			if m.cue.Performer != "" {
+				return m.cue.Performer
+			}
+			if m.Artist() == "" {
+				return m.cue.AlbumArtist
+			}
+		}
 		return m.Artist()
 	case "AlbumArtist":
+		if m.cue != nil && m.AlbumArtist() == "" {
+			return m.cue.AlbumArtist
+		}
 		return m.AlbumArtist()
 	case "Composer":
 		return m.Composer()
@@ -145,8 +235,14 @@ func (m *track) GetString(name string) string {
 		return m.Location
 	case "Kind":
 		return kind(m.FileType()).String()
+	case "Format":
+		return kind(m.FileType()).Format()
 	case "ID":
-		sum := sha1.Sum([]byte(m.Location))
+		loc := m.Location
+		if m.cue != nil {
+			loc = fmt.Sprintf("%v#%d", loc, m.cue.Number)
+		}
+		sum := sha1.Sum([]byte(loc))
 		return string(fmt.Sprintf("%x", sum))
 	}
 	return ""
@@ -170,6 +266,23 @@ func (k kind) String() string {
 	return ""
 }
 
+// Format returns the name of the audio format, or "" if unknown.
+func (k kind) Format() string {
+	switch k {
+	case tag.MP3:
+		return "MP3"
+	case tag.M4A, tag.M4B, tag.M4P:
+		return "AAC"
+	case tag.ALAC:
+		return "ALAC"
+	case tag.FLAC:
+		return "FLAC"
+	case tag.OGG:
+		return "OGG"
+	}
+	return ""
+}
+
 // GetStrings implements index.Track.
 func (m *track) GetStrings(name string) []string {
 	switch name {
@@ -185,27 +298,102 @@ func (m *track) GetInt(name string) int {
 	case "Year":
 		return m.Year()
 	case "TrackNumber":
+		if m.cue != nil {
+			return m.cue.Number
+		}
 		x, _ := m.Track()
 		return x
 	case "TrackCount":
+		if m.cue != nil {
+			return m.cue.Count
+		}
 		_, n := m.Track()
 		return n
+	case "TotalTime":
+		if m.cue != nil && m.cue.End > 0 {
+			return int((m.cue.End - m.cue.Start) / time.Millisecond)
+		}
+	case "StartTime":
+		if m.cue != nil {
+			return int(m.cue.Start / time.Millisecond)
+		}
+	case "EndTime":
+		if m.cue != nil {
+			return int(m.cue.End / time.Millisecond)
+		}
 	case "DiscNumber":
 		x, _ := m.Disc()
 		return x
 	case "DiscCount":
 		_, n := m.Disc()
 		return n
+	case "Size":
+		return int(m.FileInfo.Size())
+	case "BitRate":
+		return m.audio.BitRate
+	case "SampleRate":
+		return m.audio.SampleRate
+	case "BitDepth":
+		return m.audio.BitDepth
+	case "TrackGain":
+		return m.replayGain("replaygain_track_gain")
+	case "AlbumGain":
+		return m.replayGain("replaygain_album_gain")
+	}
+	return 0
+}
+
+// replayGain returns the ReplayGain value (in hundredths of a dB) from the tag with the given
+// (lower-case) name, or 0 if the tag is missing or invalid.  Vorbis comments and MP4 atoms
+// are stored by name, ID3v2 values are stored in TXXX frames with the name as description.
+func (m *track) replayGain(name string) int {
+	for k, v := range m.Raw() {
+		var s string
+		switch v := v.(type) {
+		case string:
+			if !strings.HasSuffix(strings.ToLower(k), name) {
+				continue
+			}
+			s = v
+
+		case *tag.Comm:
+			if !strings.HasPrefix(k, "TXXX") || strings.ToLower(v.Description) != name {
+				continue
+			}
+			s = v.Text
+
+		default:
+			continue
+		}
+		return parseGain(s)
 	}
 	return 0
 }
 
+// parseGain parses ReplayGain values of the form "-6.54 dB" into hundredths of a dB.
+func parseGain(s string) int {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[len(s)-2:], "dB") {
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int(math.Floor(f*100 + 0.5))
+}
+
 // GetTime implements index.Track.
 func (m *track) GetTime(name string) time.Time {
 	switch name {
 	case "DateModified":
 		return m.FileInfo.ModTime()
 	case "DateAdded":
+		// Not all platforms support file creation times, so fall back to when the file
+		// was last modified.
+		if m.CreatedTime.IsZero() {
+			return m.FileInfo.ModTime()
+		}
 		return m.CreatedTime
 	}
 	return time.Time{}
@@ -261,5 +449,6 @@ func processPath(path string) (*track, error) {
 		Location:    path,
 		FileInfo:    fileInfo,
 		CreatedTime: createdTime,
+		audio:       readAudioInfo(f, m.FileType(), fileInfo.Size()),
 	}, nil
 }
@@ -0,0 +1,84 @@
+package walk
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseGain(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected int
+	}{
+		{"", 0},
+		{"invalid", 0},
+		{"-6.54 dB", -654},
+		{"+1.20 dB", 120},
+		{" 0.005 db ", 1},
+		{"-10.5", -1050},
+	}
+
+	for _, tt := range tests {
+		got := parseGain(tt.in)
+		if got != tt.expected {
+			t.Errorf("parseGain(%#v) = %v, expected: %v", tt.in, got, tt.expected)
+		}
+	}
+}
+
+func TestReadFLACInfo(t *testing.T) {
+	b := []byte("fLaC")
+	b = append(b, 0x80, 0, 0, 34)         // last block, STREAMINFO, length 34
+	b = append(b, make([]byte, 10)...)    // block and frame sizes
+	b = append(b, 0x0a, 0xc4, 0x42, 0xf0) // 44100Hz, 2 channels, 16 bits
+	b = append(b, 0x00, 0x06, 0xba, 0xa8) // 441000 samples (10s)
+	b = append(b, make([]byte, 16)...)    // MD5
+
+	tests := []struct {
+		in       []byte
+		size     int64
+		expected audioInfo
+	}{
+		{nil, 0, audioInfo{}},
+		{[]byte("OggS"), 0, audioInfo{}},
+		{b, 0, audioInfo{SampleRate: 44100, BitDepth: 16, Duration: 10 * time.Second}},
+		{b, 1000000, audioInfo{BitRate: 800, SampleRate: 44100, BitDepth: 16, Duration: 10 * time.Second}},
+	}
+
+	for ii, tt := range tests {
+		got := readFLACInfo(bytes.NewReader(tt.in), tt.size)
+		if got != tt.expected {
+			t.Errorf("[%d] readFLACInfo() = %#v, expected: %#v", ii, got, tt.expected)
+		}
+	}
+}
+
+func TestReadMP3Info(t *testing.T) {
+	cbr := []byte{0xff, 0xfb, 0x90, 0x44} // MPEG-1 Layer III, 128kbps, 44100Hz
+	vbr := append(append([]byte{}, cbr...), make([]byte, 32)...)
+	vbr = append(vbr, "Xing"...)
+	vbr = append(vbr, 0, 0, 0, 0x01, 0, 0, 0, 100) // 100 frames
+
+	tests := []struct {
+		in       []byte
+		size     int64
+		expected audioInfo
+	}{
+		{nil, 0, audioInfo{}},
+		{[]byte{0xff, 0xff, 0xff, 0xff}, 0, audioInfo{}},
+		{cbr, 0, audioInfo{BitRate: 128, SampleRate: 44100}},
+		{append([]byte{0, 0, 0}, cbr...), 0, audioInfo{BitRate: 128, SampleRate: 44100}},
+		{[]byte{0xff, 0xf3, 0x44, 0xc4}, 0, audioInfo{BitRate: 32, SampleRate: 24000}},
+		{cbr, 160000, audioInfo{BitRate: 128, SampleRate: 44100, Duration: 10 * time.Second}},
+		{vbr, 100 * 418, audioInfo{BitRate: 128, SampleRate: 44100, Duration: 2612244897}},
+		{vbr, 100 * 209, audioInfo{BitRate: 64, SampleRate: 44100, Duration: 2612244897}},
+	}
+
+	for ii, tt := range tests {
+		got := readMP3Info(tt.in, tt.size)
+		if got != tt.expected {
+			t.Errorf("[%d] readMP3Info() = %#v, expected: %#v", ii, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package airplay implements a player.Player which plays tracks on AirPlay receivers using
+// the AirPlay HTTP protocol, in which the receiver fetches tracks from a URL.
+package airplay
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tchaik.com/player"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+	pollInterval   = time.Second
+
+	// endMargin is the distance from the end of a track within which a receiver which
+	// stops playing is considered to have finished the track.
+	endMargin = 2 * pollInterval
+)
+
+// Track is a track which can be played on a device.
+type Track struct {
+	ID string
+	// URL is the location of the track, which must be reachable by the device.
+	URL string
+}
+
+// Queue is an interface which defines the source of tracks played by a Player.
+type Queue interface {
+	// Current returns the current track.
+	Current() (Track, error)
+	// Next moves the queue forward and returns the new current track.  Returns an error
+	// if there is no next track.
+	Next() (Track, error)
+	// Prev moves the queue backward and returns the new current track.  Returns an error
+	// if there is no previous track.
+	Prev() (Track, error)
+}
+
+// StatusFn is a function which is called with the Status of the Player each time it
+// changes.
+type StatusFn func(player.Status)
+
+// errNoMedia is returned by media commands when no media is loaded on the device.
+var errNoMedia = errors.New("no media loaded")
+
+// errNoVolume is returned by volume commands, as the AirPlay HTTP protocol has no volume
+// control.
+var errNoVolume = player.InvalidValueError("volume control not supported by airplay")
+
+// Player is a player.Player which controls an AirPlay receiver.
+type Player struct {
+	key     string
+	addr    string
+	q       Queue
+	fn      StatusFn
+	client  *http.Client
+	session string
+
+	mu     sync.Mutex    // protects the fields below
+	done   chan struct{} // closed to stop polling, nil when not connected
+	track  *Track
+	info   playbackInfo // last reported by the device
+	last   player.Status
+	repeat bool
+}
+
+// New creates a Player (identified by key) which plays tracks from the Queue on the device
+// at addr (host:port).  The status of the device is passed to fn (which can be nil).
+func New(key, addr string, q Queue, fn StatusFn) *Player {
+	return &Player{
+		key:     key,
+		addr:    addr,
+		q:       q,
+		fn:      fn,
+		client:  &http.Client{Timeout: requestTimeout},
+		session: newSessionID(),
+	}
+}
+
+// newSessionID returns a random UUID used to identify requests from this Player.
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(fmt.Sprintf("error reading random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Key implements player.Player.
+func (p *Player) Key() string { return p.key }
+
+// Type implements player.Typed.
+func (p *Player) Type() string { return "airplay" }
+
+// Connect checks that the device is reachable and (if not already connected) starts
+// polling it so that status changes are reported.
+func (p *Player) Connect() error {
+	if err := p.request("GET", "/server-info", nil, "", nil); err != nil {
+		return fmt.Errorf("error connecting to %v: %v", p.addr, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done == nil {
+		p.done = make(chan struct{})
+		go p.poll(p.done)
+	}
+	return nil
+}
+
+// Close stops polling the device.
+func (p *Player) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+	return nil
+}
+
+// request sends an HTTP request to the device, and reads the response body into w (which
+// can be nil).
+func (p *Player) request(method, path string, values url.Values, body string, w io.Writer) error {
+	u := "http://" + p.addr + path
+	if values != nil {
+		u += "?" + values.Encode()
+	}
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "MediaControl/1.0")
+	req.Header.Set("X-Apple-Session-ID", p.session)
+	if body != "" {
+		req.Header.Set("Content-Type", "text/parameters")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v %v: unexpected response: %v", method, path, resp.Status)
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// mediaCommand sends a request to control the loaded media.
+func (p *Player) mediaCommand(path string, values url.Values) error {
+	p.mu.Lock()
+	loaded := p.track != nil && p.info.loaded()
+	p.mu.Unlock()
+	if !loaded {
+		return errNoMedia
+	}
+	return p.request("POST", path, values, "", nil)
+}
+
+// setRate sets the playback rate of the loaded media (0 to pause, 1 to play).
+func (p *Player) setRate(r float64) error {
+	return p.mediaCommand("/rate", url.Values{"value": {strconv.FormatFloat(r, 'f', 6, 64)}})
+}
+
+// load loads the track and starts playing it.
+func (p *Player) load(t Track) error {
+	body := fmt.Sprintf("Content-Location: %v\nStart-Position: 0\n", t.URL)
+	if err := p.request("POST", "/play", nil, body, nil); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.track = &t
+	p.info = playbackInfo{}
+	p.mu.Unlock()
+	return nil
+}
+
+// status returns the Status of the Player.  Must be called with the lock held.
+func (p *Player) status() player.Status {
+	st := player.Status{
+		Playing: p.info.playing(),
+		Time:    p.info.Position,
+	}
+	if p.track != nil {
+		st.TrackID = p.track.ID
+	}
+	return st
+}
+
+// poll fetches the playback state of the device until done is closed.
+func (p *Player) poll(done chan struct{}) {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := p.request("GET", "/playback-info", nil, "", &buf); err != nil {
+			continue
+		}
+		info, err := readPlaybackInfo(&buf)
+		if err != nil {
+			continue
+		}
+		p.update(info)
+	}
+}
+
+// update sets the playback state reported by the device, reporting the new status if it has
+// changed and moving to the next track if the current track has finished.
+func (p *Player) update(info playbackInfo) {
+	p.mu.Lock()
+	prev := p.info
+	p.info = info
+	st := p.status()
+
+	expected := p.last.Time
+	if p.last.Playing {
+		expected += pollInterval.Seconds()
+	}
+	changed := st.Playing != p.last.Playing || st.TrackID != p.last.TrackID ||
+		math.Abs(st.Time-expected) > pollInterval.Seconds()
+	p.last = st
+
+	ended := p.track != nil && prev.playing() && !info.playing() &&
+		prev.Duration-prev.Position < endMargin.Seconds()
+	repeat, t := p.repeat, p.track
+	p.mu.Unlock()
+
+	if changed && p.fn != nil {
+		p.fn(st)
+	}
+	if ended {
+		go p.ended(repeat, t)
+	}
+}
+
+// ended moves to the next track when the current track finishes.
+func (p *Player) ended(repeat bool, t *Track) {
+	if !repeat || t == nil {
+		next, err := p.q.Next()
+		if err != nil {
+			return
+		}
+		t = &next
+	}
+	if err := p.load(*t); err != nil {
+		log.Printf("error loading next track on %v: %v", p.key, err)
+	}
+}
+
+// Do implements player.Player.
+func (p *Player) Do(a player.Action) error {
+	switch a {
+	case player.ActionPlay:
+		p.mu.Lock()
+		loaded := p.track != nil && p.info.loaded()
+		p.mu.Unlock()
+		if loaded {
+			return p.setRate(1)
+		}
+		t, err := p.q.Current()
+		if err != nil {
+			return err
+		}
+		return p.load(t)
+
+	case player.ActionPause:
+		return p.setRate(0)
+
+	case player.ActionStop:
+		if err := p.request("POST", "/stop", nil, "", nil); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.info = playbackInfo{}
+		p.mu.Unlock()
+		return nil
+
+	case player.ActionTogglePlayPause:
+		p.mu.Lock()
+		playing := p.info.playing()
+		p.mu.Unlock()
+		if playing {
+			return p.Do(player.ActionPause)
+		}
+		return p.Do(player.ActionPlay)
+
+	case player.ActionNext, player.ActionPrev:
+		next := p.q.Next
+		if a == player.ActionPrev {
+			next = p.q.Prev
+		}
+		t, err := next()
+		if err != nil {
+			return err
+		}
+		return p.load(t)
+
+	case player.ActionToggleRepeat:
+		p.mu.Lock()
+		p.repeat = !p.repeat
+		p.mu.Unlock()
+		return nil
+
+	case player.ActionToggleMute:
+		return errNoVolume
+	}
+	return player.InvalidActionError(a)
+}
+
+// SetMute implements player.Player.  Not supported (see errNoVolume).
+func (p *Player) SetMute(b bool) error {
+	return errNoVolume
+}
+
+// SetRepeat implements player.Player.
+func (p *Player) SetRepeat(b bool) error {
+	p.mu.Lock()
+	p.repeat = b
+	p.mu.Unlock()
+	return nil
+}
+
+// SetVolume implements player.Player.  Not supported (see errNoVolume).
+func (p *Player) SetVolume(f float64) error {
+	return errNoVolume
+}
+
+// SetTime implements player.Player.
+func (p *Player) SetTime(f float64) error {
+	return p.mediaCommand("/scrub", url.Values{"position": {strconv.FormatFloat(f, 'f', 6, 64)}})
+}
+
+// SetTransition implements player.Player.  Only TransitionNone is supported.
+func (p *Player) SetTransition(t player.Transition) error {
+	if t.Mode != player.TransitionNone {
+		return player.InvalidValueError(fmt.Sprintf("transition mode not supported by airplay: '%v'", t.Mode))
+	}
+	return nil
+}
+
+// SetReplayGain implements player.Player.  Only ReplayGainOff is supported.
+func (p *Player) SetReplayGain(m player.ReplayGainMode) error {
+	if m != player.ReplayGainOff {
+		return player.InvalidValueError(fmt.Sprintf("replay gain mode not supported by airplay: '%v'", m))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package airplay
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// service is the mDNS (Bonjour) service name advertised by receivers.
+const service = "_airplay._tcp.local."
+
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Device is an AirPlay receiver found on the local network.
+type Device struct {
+	// ID is the unique identifier of the device (its MAC address).
+	ID string
+	// Name is the friendly name of the device.
+	Name string
+	// Model is the model of the device (i.e. AppleTV3,2), if advertised.
+	Model string
+	// Addr is the address (host:port) of the device.
+	Addr string
+}
+
+// Discover sends an mDNS query for receivers on the local network and returns those which
+// respond within the timeout.
+func Discover(timeout time.Duration) ([]Device, error) {
+	name, err := dnsmessage.NewName(service)
+	if err != nil {
+		return nil, err
+	}
+
+	q := dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{
+				Name: name,
+				Type: dnsmessage.TypePTR,
+				// Request a unicast response (so that it is sent to our socket).
+				Class: dnsmessage.ClassINET | 1<<15,
+			},
+		},
+	}
+	b, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if _, err := c.WriteTo(b, mdnsAddr); err != nil {
+		return nil, err
+	}
+	c.SetReadDeadline(time.Now().Add(timeout))
+
+	devices := make(map[string]*Device)
+	var order []string
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := c.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+
+		var m dnsmessage.Message
+		if err := m.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		for _, d := range parseResponse(m, from.IP) {
+			if _, ok := devices[d.ID]; !ok {
+				order = append(order, d.ID)
+			}
+			devices[d.ID] = d
+		}
+	}
+
+	result := make([]Device, len(order))
+	for i, id := range order {
+		result[i] = *devices[id]
+	}
+	return result, nil
+}
+
+// parseResponse returns the devices described in the mDNS response, which was sent from ip.
+func parseResponse(m dnsmessage.Message, ip net.IP) []*Device {
+	instances := make(map[string]*Device)
+	var order []string
+	get := func(name string) *Device {
+		d, ok := instances[name]
+		if !ok {
+			d = &Device{
+				ID:   strings.TrimSuffix(name, "."+service),
+				Name: strings.TrimSuffix(name, "."+service),
+				Addr: net.JoinHostPort(ip.String(), "7000"),
+			}
+			instances[name] = d
+			order = append(order, name)
+		}
+		return d
+	}
+
+	for _, r := range append(m.Answers, m.Additionals...) {
+		name := r.Header.Name.String()
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == service {
+				get(body.PTR.String())
+			}
+
+		case *dnsmessage.SRVResource:
+			if strings.HasSuffix(name, "."+service) {
+				get(name).Addr = net.JoinHostPort(ip.String(), strconv.Itoa(int(body.Port)))
+			}
+
+		case *dnsmessage.TXTResource:
+			if !strings.HasSuffix(name, "."+service) {
+				break
+			}
+			d := get(name)
+			for _, txt := range body.TXT {
+				switch {
+				case strings.HasPrefix(txt, "deviceid="):
+					d.ID = txt[len("deviceid="):]
+				case strings.HasPrefix(txt, "model="):
+					d.Model = txt[len("model="):]
+				}
+			}
+		}
+	}
+
+	devices := make([]*Device, len(order))
+	for i, name := range order {
+		devices[i] = instances[name]
+	}
+	return devices
+}
@@ -0,0 +1,43 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package airplay
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseResponse(t *testing.T) {
+	instance := dnsmessage.MustNewName("Living Room._airplay._tcp.local.")
+	m := dnsmessage.Message{
+		Answers: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(service), Type: dnsmessage.TypePTR},
+				Body:   &dnsmessage.PTRResource{PTR: instance},
+			},
+		},
+		Additionals: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: instance, Type: dnsmessage.TypeSRV},
+				Body:   &dnsmessage.SRVResource{Port: 7100, Target: dnsmessage.MustNewName("Apple-TV.local.")},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: instance, Type: dnsmessage.TypeTXT},
+				Body:   &dnsmessage.TXTResource{TXT: []string{"deviceid=58:55:CA:1A:2B:3C", "features=0x5A7FFFF7", "model=AppleTV3,2"}},
+			},
+		},
+	}
+
+	got := parseResponse(m, net.IPv4(192, 168, 1, 30))
+	expected := []*Device{
+		{ID: "58:55:CA:1A:2B:3C", Name: "Living Room", Model: "AppleTV3,2", Addr: "192.168.1.30:7100"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseResponse() = %v, expected: %v", got, expected)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package airplay
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+// playbackInfo is the state of playback reported by a receiver.
+type playbackInfo struct {
+	Duration float64 // seconds, 0 if nothing is loaded
+	Position float64 // seconds
+	Rate     float64 // 0 if paused, 1 if playing
+}
+
+// loaded returns true if the receiver has media loaded.
+func (i playbackInfo) loaded() bool {
+	return i.Duration > 0
+}
+
+// playing returns true if the receiver is playing loaded media.
+func (i playbackInfo) playing() bool {
+	return i.loaded() && i.Rate > 0
+}
+
+// readPlaybackInfo reads the property list returned by GET /playback-info.  Only the
+// top-level values (which contain everything we need) are read.
+func readPlaybackInfo(r io.Reader) (playbackInfo, error) {
+	var info playbackInfo
+	dec := xml.NewDecoder(r)
+
+	var depth int
+	var key string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return info, nil
+		}
+		if err != nil {
+			return playbackInfo{}, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			// Values in the top-level dict are at depth 3 (plist > dict > value).
+			if depth != 3 {
+				continue
+			}
+			if t.Name.Local == "key" {
+				if err := dec.DecodeElement(&key, &t); err != nil {
+					return playbackInfo{}, err
+				}
+				depth--
+				continue
+			}
+			if t.Name.Local != "real" && t.Name.Local != "integer" {
+				key = ""
+				continue
+			}
+
+			var s string
+			if err := dec.DecodeElement(&s, &t); err != nil {
+				return playbackInfo{}, err
+			}
+			depth--
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return playbackInfo{}, err
+			}
+			switch key {
+			case "duration":
+				info.Duration = f
+			case "position":
+				info.Position = f
+			case "rate":
+				info.Rate = f
+			}
+			key = ""
+
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package airplay
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPlaybackInfo(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected playbackInfo
+	}{
+		{
+			`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>readyToPlay</key>
+	<false/>
+</dict>
+</plist>`,
+			playbackInfo{},
+		},
+		{
+			`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>duration</key>
+	<real>214.5</real>
+	<key>loadedTimeRanges</key>
+	<array>
+		<dict>
+			<key>duration</key>
+			<real>100.0</real>
+			<key>start</key>
+			<real>0.0</real>
+		</dict>
+	</array>
+	<key>playbackBufferEmpty</key>
+	<true/>
+	<key>position</key>
+	<real>12.25</real>
+	<key>rate</key>
+	<integer>1</integer>
+	<key>readyToPlay</key>
+	<true/>
+</dict>
+</plist>`,
+			playbackInfo{Duration: 214.5, Position: 12.25, Rate: 1},
+		},
+	}
+
+	for ii, tt := range tests {
+		got, err := readPlaybackInfo(strings.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", ii, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("[%d] readPlaybackInfo() = %#v, expected: %#v", ii, got, tt.expected)
+		}
+	}
+
+	if _, err := readPlaybackInfo(strings.NewReader("<plist><dict><key>rate</key><real>x</real></dict></plist>")); err == nil {
+		t.Errorf("expected error for invalid value")
+	}
+}
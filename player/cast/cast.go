@@ -0,0 +1,568 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cast implements a player.Player which plays tracks on Chromecast devices using
+// the Cast v2 protocol.
+package cast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"tchaik.com/player"
+)
+
+// launchTimeout is the maximum time to wait for the Default Media Receiver to launch.
+const launchTimeout = 20 * time.Second
+
+// Track is a track which can be played on a device.
+type Track struct {
+	ID string
+	// URL is the location of the track, which must be reachable by the device.
+	URL         string
+	ContentType string
+
+	Title, Album, Artist string
+}
+
+// Queue is an interface which defines the source of tracks played by a Player.
+type Queue interface {
+	// Current returns the current track.
+	Current() (Track, error)
+	// Next moves the queue forward and returns the new current track.  Returns an error
+	// if there is no next track.
+	Next() (Track, error)
+	// Prev moves the queue backward and returns the new current track.  Returns an error
+	// if there is no previous track.
+	Prev() (Track, error)
+}
+
+// StatusFn is a function which is called with the Status of the Player each time the
+// device reports a change.
+type StatusFn func(player.Status)
+
+// errNoMedia is returned by media commands when no media is loaded on the device.
+var errNoMedia = errors.New("no media loaded")
+
+// Player is a player.Player which controls a Chromecast.
+type Player struct {
+	key  string
+	addr string
+	q    Queue
+	fn   StatusFn
+
+	mu          sync.Mutex // protects the fields below
+	c           *conn
+	transportID string        // transport of the running Default Media Receiver
+	ready       chan struct{} // closed when transportID is set
+	sessionID   int           // media session of the loaded track
+	track       *Track
+	state       string // media player state (i.e. PLAYING, PAUSED)
+	time        float64
+	muted       bool
+	volume      float64       // volume level reported by the device
+	fading      chan struct{} // closed to cancel the fade in progress, nil if none
+	repeat      bool
+}
+
+// New creates a Player (identified by key) which plays tracks from the Queue on the device
+// at addr (host:port).  The status reported by the device is passed to fn (which can be
+// nil).
+func New(key, addr string, q Queue, fn StatusFn) *Player {
+	return &Player{
+		key:   key,
+		addr:  addr,
+		q:     q,
+		fn:    fn,
+		ready: make(chan struct{}),
+	}
+}
+
+// Key implements player.Player.
+func (p *Player) Key() string { return p.key }
+
+// Type implements player.Typed.
+func (p *Player) Type() string { return "chromecast" }
+
+// Connect connects to the device (if not already connected), so that status changes
+// are reported.
+func (p *Player) Connect() error {
+	_, err := p.conn()
+	return err
+}
+
+// Close closes the connection to the device.
+func (p *Player) Close() error {
+	p.mu.Lock()
+	c := p.c
+	p.c = nil
+	p.resetTransport()
+	p.mu.Unlock()
+
+	if c != nil {
+		return c.Close()
+	}
+	return nil
+}
+
+// conn returns the connection to the device, connecting if necessary.
+func (p *Player) conn() (*conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.c != nil {
+		return p.c, nil
+	}
+
+	c, err := dial(p.addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %v: %v", p.addr, err)
+	}
+	if err := c.connect(receiverID); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.send(receiverID, nsReceiver, map[string]interface{}{"type": "GET_STATUS"}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	p.c = c
+	go p.readLoop(c)
+	return c, nil
+}
+
+// media returns the connection and transport ID of the Default Media Receiver, launching
+// it if it isn't running.
+func (p *Player) media() (*conn, string, error) {
+	c, err := p.conn()
+	if err != nil {
+		return nil, "", err
+	}
+
+	p.mu.Lock()
+	id, ready := p.transportID, p.ready
+	p.mu.Unlock()
+	if id != "" {
+		return c, id, nil
+	}
+
+	err = c.send(receiverID, nsReceiver, map[string]interface{}{
+		"type":  "LAUNCH",
+		"appId": defaultMediaReceiver,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	select {
+	case <-ready:
+	case <-time.After(launchTimeout):
+		return nil, "", fmt.Errorf("timed out waiting for media receiver to launch")
+	}
+
+	p.mu.Lock()
+	id = p.transportID
+	p.mu.Unlock()
+	if id == "" {
+		return nil, "", fmt.Errorf("media receiver closed")
+	}
+	return c, id, nil
+}
+
+// mediaCommand sends a command of type typ (with any extra fields) to the loaded media.
+func (p *Player) mediaCommand(typ string, extra map[string]interface{}) error {
+	p.mu.Lock()
+	c, id, s := p.c, p.transportID, p.sessionID
+	p.mu.Unlock()
+	if c == nil || id == "" || s == 0 {
+		return errNoMedia
+	}
+
+	payload := map[string]interface{}{
+		"type":           typ,
+		"mediaSessionId": s,
+	}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	return c.send(id, nsMedia, payload)
+}
+
+// load loads the track and starts playing it.
+func (p *Player) load(t Track) error {
+	c, id, err := p.media()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.track = &t
+	p.mu.Unlock()
+
+	return c.send(id, nsMedia, map[string]interface{}{
+		"type":        "LOAD",
+		"autoplay":    true,
+		"currentTime": 0,
+		"media": map[string]interface{}{
+			"contentId":   t.URL,
+			"contentType": t.ContentType,
+			"streamType":  "BUFFERED",
+			"metadata": map[string]interface{}{
+				"metadataType": 3, // MusicTrackMediaMetadata
+				"title":        t.Title,
+				"albumName":    t.Album,
+				"artist":       t.Artist,
+			},
+		},
+	})
+}
+
+// setVolume sets the volume fields of the device.
+func (p *Player) setVolume(volume map[string]interface{}) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	return c.send(receiverID, nsReceiver, map[string]interface{}{
+		"type":   "SET_VOLUME",
+		"volume": volume,
+	})
+}
+
+// resetTransport forgets the running Default Media Receiver.  Must be called with the lock
+// held.
+func (p *Player) resetTransport() {
+	if p.transportID != "" {
+		p.transportID = ""
+		p.ready = make(chan struct{})
+	}
+	p.sessionID = 0
+}
+
+// playing returns true if the device is playing (or about to play).  Must be called with the
+// lock held.
+func (p *Player) playing() bool {
+	return p.state == "PLAYING" || p.state == "BUFFERING"
+}
+
+// status returns the Status of the Player.  Must be called with the lock held.
+func (p *Player) status() player.Status {
+	st := player.Status{
+		Playing: p.playing(),
+		Time:    p.time,
+	}
+	if p.track != nil {
+		st.TrackID = p.track.ID
+	}
+	return st
+}
+
+// readLoop handles messages from the device until the connection fails.
+func (p *Player) readLoop(c *conn) {
+	for {
+		m, err := c.read()
+		if err != nil {
+			p.mu.Lock()
+			if p.c == c {
+				p.c = nil
+				p.resetTransport()
+			}
+			p.mu.Unlock()
+			c.Close()
+			return
+		}
+		p.handle(c, m)
+	}
+}
+
+func (p *Player) handle(c *conn, m message) {
+	var h struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(m.Payload), &h); err != nil {
+		return
+	}
+
+	switch h.Type {
+	case "PING":
+		c.send(m.Source, nsHeartbeat, map[string]interface{}{"type": "PONG"})
+
+	case "CLOSE":
+		p.mu.Lock()
+		if m.Source == p.transportID {
+			p.resetTransport()
+		}
+		p.mu.Unlock()
+
+	case "RECEIVER_STATUS":
+		p.receiverStatus(c, m.Payload)
+
+	case "MEDIA_STATUS":
+		p.mediaStatus(m.Payload)
+	}
+}
+
+func (p *Player) receiverStatus(c *conn, payload string) {
+	var rs struct {
+		Status struct {
+			Applications []struct {
+				AppID       string `json:"appId"`
+				TransportID string `json:"transportId"`
+			} `json:"applications"`
+			Volume struct {
+				Level *float64 `json:"level"`
+				Muted bool     `json:"muted"`
+			} `json:"volume"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(payload), &rs); err != nil {
+		return
+	}
+
+	var id string
+	for _, app := range rs.Status.Applications {
+		if app.AppID == defaultMediaReceiver {
+			id = app.TransportID
+		}
+	}
+
+	p.mu.Lock()
+	p.muted = rs.Status.Volume.Muted
+	if l := rs.Status.Volume.Level; l != nil {
+		p.volume = *l
+	}
+	current := p.transportID
+	if id == "" {
+		p.resetTransport()
+	}
+	p.mu.Unlock()
+
+	if id == "" || id == current {
+		return
+	}
+
+	// Connect to the transport before making it available for commands.
+	if err := c.connect(id); err != nil {
+		return
+	}
+	c.send(id, nsMedia, map[string]interface{}{"type": "GET_STATUS"})
+
+	p.mu.Lock()
+	if p.c == c && p.transportID == "" {
+		p.transportID = id
+		close(p.ready)
+	}
+	p.mu.Unlock()
+}
+
+func (p *Player) mediaStatus(payload string) {
+	var ms struct {
+		Status []struct {
+			MediaSessionID int     `json:"mediaSessionId"`
+			PlayerState    string  `json:"playerState"`
+			CurrentTime    float64 `json:"currentTime"`
+			IdleReason     string  `json:"idleReason"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(payload), &ms); err != nil || len(ms.Status) == 0 {
+		return
+	}
+	s := ms.Status[0]
+
+	p.mu.Lock()
+	p.sessionID = s.MediaSessionID
+	p.state = s.PlayerState
+	p.time = s.CurrentTime
+	if s.PlayerState == "IDLE" {
+		// Idle media sessions can't be controlled.
+		p.sessionID = 0
+	}
+	st := p.status()
+	repeat, t := p.repeat, p.track
+	p.mu.Unlock()
+
+	if p.fn != nil {
+		p.fn(st)
+	}
+
+	if s.PlayerState == "IDLE" && s.IdleReason == "FINISHED" {
+		go p.ended(repeat, t)
+	}
+}
+
+// ended moves to the next track when the current track finishes.
+func (p *Player) ended(repeat bool, t *Track) {
+	if !repeat || t == nil {
+		next, err := p.q.Next()
+		if err != nil {
+			return
+		}
+		t = &next
+	}
+	if err := p.load(*t); err != nil {
+		log.Printf("error loading next track on %v: %v", p.key, err)
+	}
+}
+
+// Do implements player.Player.
+func (p *Player) Do(a player.Action) error {
+	switch a {
+	case player.ActionPlay:
+		p.mu.Lock()
+		loaded := p.sessionID != 0
+		p.mu.Unlock()
+		if loaded {
+			return p.mediaCommand("PLAY", nil)
+		}
+		t, err := p.q.Current()
+		if err != nil {
+			return err
+		}
+		return p.load(t)
+
+	case player.ActionPause:
+		return p.mediaCommand("PAUSE", nil)
+
+	case player.ActionStop:
+		return p.mediaCommand("STOP", nil)
+
+	case player.ActionTogglePlayPause:
+		p.mu.Lock()
+		playing := p.playing()
+		p.mu.Unlock()
+		if playing {
+			return p.Do(player.ActionPause)
+		}
+		return p.Do(player.ActionPlay)
+
+	case player.ActionNext, player.ActionPrev:
+		next := p.q.Next
+		if a == player.ActionPrev {
+			next = p.q.Prev
+		}
+		t, err := next()
+		if err != nil {
+			return err
+		}
+		return p.load(t)
+
+	case player.ActionToggleRepeat:
+		p.mu.Lock()
+		p.repeat = !p.repeat
+		p.mu.Unlock()
+		return nil
+
+	case player.ActionToggleMute:
+		p.mu.Lock()
+		muted := p.muted
+		p.mu.Unlock()
+		return p.SetMute(!muted)
+	}
+	return player.InvalidActionError(a)
+}
+
+// SetMute implements player.Player.
+func (p *Player) SetMute(b bool) error {
+	return p.setVolume(map[string]interface{}{"muted": b})
+}
+
+// SetRepeat implements player.Player.
+func (p *Player) SetRepeat(b bool) error {
+	p.mu.Lock()
+	p.repeat = b
+	p.mu.Unlock()
+	return nil
+}
+
+// SetVolume implements player.Player.  Cancels any fade in progress.
+func (p *Player) SetVolume(f float64) error {
+	if f < 0 || f > 1 {
+		return player.InvalidValueError(fmt.Sprintf("invalid volume: %v (must be between 0.0 and 1.0)", f))
+	}
+	p.mu.Lock()
+	p.cancelFade()
+	p.mu.Unlock()
+	return p.setLevel(f)
+}
+
+// setLevel sets the volume level of the device.
+func (p *Player) setLevel(f float64) error {
+	if err := p.setVolume(map[string]interface{}{"level": f}); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.volume = f
+	p.mu.Unlock()
+	return nil
+}
+
+// cancelFade cancels the fade in progress (if any).  Must be called with the lock held.
+func (p *Player) cancelFade() {
+	if p.fading != nil {
+		close(p.fading)
+		p.fading = nil
+	}
+}
+
+// FadeVolume implements player.Fader.  The volume is ramped from the level last reported
+// by the device.
+func (p *Player) FadeVolume(f player.Fade) error {
+	p.mu.Lock()
+	p.cancelFade()
+	cancel := make(chan struct{})
+	p.fading = cancel
+	from := p.volume
+	p.mu.Unlock()
+
+	go func() {
+		done, err := player.Ramp(p.setLevel, from, f.Volume, f.Duration, cancel)
+		if err != nil {
+			log.Printf("error fading volume on %v: %v", p.key, err)
+		}
+		if !done {
+			return
+		}
+
+		p.mu.Lock()
+		if p.fading == cancel {
+			p.fading = nil
+		}
+		p.mu.Unlock()
+
+		if f.Pause {
+			if err := p.Do(player.ActionPause); err != nil {
+				log.Printf("error pausing %v after fade: %v", p.key, err)
+			}
+			if err := p.setLevel(from); err != nil {
+				log.Printf("error restoring volume on %v: %v", p.key, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// SetTime implements player.Player.
+func (p *Player) SetTime(f float64) error {
+	return p.mediaCommand("SEEK", map[string]interface{}{"currentTime": f})
+}
+
+// SetTransition implements player.Player.  Only TransitionNone is supported.
+func (p *Player) SetTransition(t player.Transition) error {
+	if t.Mode != player.TransitionNone {
+		return player.InvalidValueError(fmt.Sprintf("transition mode not supported by chromecast: '%v'", t.Mode))
+	}
+	return nil
+}
+
+// SetReplayGain implements player.Player.  Only ReplayGainOff is supported.
+func (p *Player) SetReplayGain(m player.ReplayGainMode) error {
+	if m != player.ReplayGainOff {
+		return player.InvalidValueError(fmt.Sprintf("replay gain mode not supported by chromecast: '%v'", m))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cast
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+)
+
+// Namespaces used to communicate with devices.
+const (
+	nsConnection = "urn:x-cast:com.google.cast.tp.connection"
+	nsHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	nsReceiver   = "urn:x-cast:com.google.cast.receiver"
+	nsMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+const (
+	senderID   = "sender-0"
+	receiverID = "receiver-0"
+
+	// defaultMediaReceiver is the application ID of the Default Media Receiver, which
+	// plays media from a URL.
+	defaultMediaReceiver = "CC1AD845"
+)
+
+const (
+	dialTimeout       = 5 * time.Second
+	writeTimeout      = 5 * time.Second
+	heartbeatInterval = 5 * time.Second
+
+	// readTimeout is the maximum time to wait for a message.  Devices send heartbeat
+	// messages every few seconds, so a connection which is silent for longer is dead.
+	readTimeout = 30 * time.Second
+)
+
+// conn is a connection to a device.
+type conn struct {
+	c         net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex // protects writes to c and requestID
+	requestID int
+}
+
+// dial connects to the device at addr.
+func dial(addr string) (*conn, error) {
+	d := &net.Dialer{Timeout: dialTimeout}
+	// Devices use self-signed certificates.
+	c, err := tls.DialWithDialer(d, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{
+		c:    c,
+		done: make(chan struct{}),
+	}
+	go cn.heartbeat()
+	return cn, nil
+}
+
+// send sends the payload (encoded as JSON) to the destination in the namespace.  Receiver and
+// media requests are assigned a request ID.
+func (c *conn) send(dest, ns string, payload map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ns == nsReceiver || ns == nsMedia {
+		c.requestID++
+		payload["requestId"] = c.requestID
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	c.c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return writeMessage(c.c, message{
+		Source:      senderID,
+		Destination: dest,
+		Namespace:   ns,
+		Payload:     string(b),
+	})
+}
+
+// connect opens a virtual connection to the destination (either the receiver or the
+// transport of a running application).
+func (c *conn) connect(dest string) error {
+	return c.send(dest, nsConnection, map[string]interface{}{"type": "CONNECT"})
+}
+
+// read reads the next message from the connection.  Must only be called from one goroutine.
+func (c *conn) read() (message, error) {
+	c.c.SetReadDeadline(time.Now().Add(readTimeout))
+	return readMessage(c.c)
+}
+
+// heartbeat keeps the connection alive until it is closed.
+func (c *conn) heartbeat() {
+	t := time.NewTicker(heartbeatInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			c.send(receiverID, nsHeartbeat, map[string]interface{}{"type": "PING"})
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close closes the connection.  It is safe to call Close more than once.
+func (c *conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.c.Close()
+	})
+	return err
+}
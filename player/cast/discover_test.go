@@ -0,0 +1,43 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cast
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseResponse(t *testing.T) {
+	instance := dnsmessage.MustNewName("Chromecast-abc123._googlecast._tcp.local.")
+	m := dnsmessage.Message{
+		Answers: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(service), Type: dnsmessage.TypePTR},
+				Body:   &dnsmessage.PTRResource{PTR: instance},
+			},
+		},
+		Additionals: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: instance, Type: dnsmessage.TypeSRV},
+				Body:   &dnsmessage.SRVResource{Port: 8010, Target: dnsmessage.MustNewName("abc123.local.")},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: instance, Type: dnsmessage.TypeTXT},
+				Body:   &dnsmessage.TXTResource{TXT: []string{"id=abc123", "md=Chromecast", "fn=Living Room"}},
+			},
+		},
+	}
+
+	got := parseResponse(m, net.IPv4(192, 168, 1, 20))
+	expected := []*Device{
+		{ID: "abc123", Name: "Living Room", Addr: "192.168.1.20:8010"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseResponse() = %v, expected: %v", got, expected)
+	}
+}
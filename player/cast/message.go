@@ -0,0 +1,153 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxMessageSize is the largest message which will be read from a device.
+const maxMessageSize = 64 << 10
+
+// message is a Cast v2 CastMessage.  Only string payloads are supported.
+type message struct {
+	Source      string
+	Destination string
+	Namespace   string
+	Payload     string
+}
+
+// Field numbers of the CastMessage protocol buffer.
+const (
+	fieldProtocolVersion = 1
+	fieldSourceID        = 2
+	fieldDestinationID   = 3
+	fieldNamespace       = 4
+	fieldPayloadType     = 5
+	fieldPayloadUTF8     = 6
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendVarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(b, buf[:n]...)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	b = appendVarint(b, uint64(field<<3|wireBytes))
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// marshal encodes the message as a CastMessage protocol buffer.
+func (m message) marshal() []byte {
+	var b []byte
+	b = appendVarint(b, fieldProtocolVersion<<3|wireVarint)
+	b = appendVarint(b, 0) // CASTV2_1_0
+	b = appendString(b, fieldSourceID, m.Source)
+	b = appendString(b, fieldDestinationID, m.Destination)
+	b = appendString(b, fieldNamespace, m.Namespace)
+	b = appendVarint(b, fieldPayloadType<<3|wireVarint)
+	b = appendVarint(b, 0) // STRING
+	b = appendString(b, fieldPayloadUTF8, m.Payload)
+	return b
+}
+
+var errTruncated = errors.New("truncated message")
+
+// unmarshal decodes a CastMessage protocol buffer.  Unknown fields (including binary
+// payloads) are ignored.
+func (m *message) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+
+		switch key & 7 {
+		case wireVarint:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+
+		case wireFixed64, wireFixed32:
+			n = 8
+			if key&7 == wireFixed32 {
+				n = 4
+			}
+			if len(b) < n {
+				return errTruncated
+			}
+			b = b[n:]
+
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errTruncated
+			}
+			s := string(b[n : n+int(l)])
+			b = b[n+int(l):]
+
+			switch key >> 3 {
+			case fieldSourceID:
+				m.Source = s
+			case fieldDestinationID:
+				m.Destination = s
+			case fieldNamespace:
+				m.Namespace = s
+			case fieldPayloadUTF8:
+				m.Payload = s
+			}
+
+		default:
+			return fmt.Errorf("unsupported wire type: %d", key&7)
+		}
+	}
+	return nil
+}
+
+// writeMessage writes the message to w, prefixed by its length.
+func writeMessage(w io.Writer, m message) error {
+	b := m.marshal()
+	buf := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(buf, uint32(len(b)))
+	copy(buf[4:], b)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readMessage reads a length-prefixed message from r.
+func readMessage(r io.Reader) (message, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return message{}, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxMessageSize {
+		return message{}, fmt.Errorf("message too large: %d bytes", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return message{}, err
+	}
+
+	var m message
+	err := m.unmarshal(b)
+	return m, err
+}
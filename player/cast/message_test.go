@@ -0,0 +1,54 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cast
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMessageReadWrite(t *testing.T) {
+	tests := []message{
+		{},
+		{
+			Source:      senderID,
+			Destination: receiverID,
+			Namespace:   nsReceiver,
+			Payload:     `{"type":"GET_STATUS","requestId":1}`,
+		},
+		{
+			Source:      "web-5",
+			Destination: senderID,
+			Namespace:   nsMedia,
+			Payload:     string(bytes.Repeat([]byte("x"), 300)), // multi-byte length
+		},
+	}
+
+	for ii, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeMessage(&buf, tt); err != nil {
+			t.Errorf("[%d] unexpected error from writeMessage: %v", ii, err)
+			continue
+		}
+		got, err := readMessage(&buf)
+		if err != nil {
+			t.Errorf("[%d] unexpected error from readMessage: %v", ii, err)
+			continue
+		}
+		if got != tt {
+			t.Errorf("[%d] readMessage() = %#v, expected: %#v", ii, got, tt)
+		}
+	}
+}
+
+func TestMessageUnmarshalTruncated(t *testing.T) {
+	b := message{Source: senderID, Payload: "payload"}.marshal()
+	for i := 1; i < len(b); i++ {
+		var m message
+		if err := m.unmarshal(b[:i]); err == nil && m.Payload == "payload" {
+			t.Errorf("unmarshal(b[:%d]) decoded the complete payload", i)
+		}
+	}
+}
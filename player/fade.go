@@ -0,0 +1,95 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package player
+
+import (
+	"fmt"
+	"time"
+)
+
+// Fade describes a gradual change of volume.
+type Fade struct {
+	// Volume is the volume at the end of the fade (between 0.0 and 1.0).
+	Volume float64
+	// Duration is the length of the fade.
+	Duration time.Duration
+	// Pause is true if the player should pause at the end of the fade, which is only valid
+	// when fading out (i.e. Volume is 0.0).  The volume before the fade is then restored,
+	// so that playback resumes at the same volume.
+	Pause bool
+}
+
+// Fader is an interface implemented by Players which can fade the volume.  Starting a fade
+// cancels any fade in progress.
+type Fader interface {
+	FadeVolume(Fade) error
+}
+
+// validateFade returns an error if the Fade is invalid.
+func validateFade(f Fade) error {
+	if f.Volume < 0.0 || f.Volume > 1.0 {
+		return InvalidValueError(fmt.Sprintf("invalid volume value '%v': must be between 0.0 and 1.0", f.Volume))
+	}
+	if f.Duration < 0 {
+		return InvalidValueError(fmt.Sprintf("invalid fade duration '%v': must not be negative", f.Duration))
+	}
+	if f.Pause && f.Volume != 0.0 {
+		return InvalidValueError("invalid fade: can only pause when fading to volume 0.0")
+	}
+	return nil
+}
+
+// FadeVolume fades the volume of the Player.  Players which don't implement Fader have the
+// volume set immediately (and are then paused if required, without restoring the volume).
+func FadeVolume(p Player, f Fade) error {
+	if err := validateFade(f); err != nil {
+		return err
+	}
+	if fp, ok := p.(Fader); ok {
+		return fp.FadeVolume(f)
+	}
+	if err := p.SetVolume(f.Volume); err != nil {
+		return err
+	}
+	if f.Pause {
+		return p.Do(ActionPause)
+	}
+	return nil
+}
+
+// fadeStep is the interval between volume changes in a Ramp.
+const fadeStep = 50 * time.Millisecond
+
+// Ramp calls set with volumes changing linearly from 'from' to 'to' over the duration d,
+// ending with 'to'.  Returns false if cancel was closed before the end of the ramp (or an
+// error from set).
+func Ramp(set func(float64) error, from, to float64, d time.Duration, cancel <-chan struct{}) (bool, error) {
+	steps := int(d / fadeStep)
+	if steps > 0 {
+		t := time.NewTicker(d / time.Duration(steps))
+		defer t.Stop()
+
+		for i := 1; i < steps; i++ {
+			select {
+			case <-t.C:
+			case <-cancel:
+				return false, nil
+			}
+			if err := set(from + (to-from)*float64(i)/float64(steps)); err != nil {
+				return false, err
+			}
+		}
+
+		select {
+		case <-t.C:
+		case <-cancel:
+			return false, nil
+		}
+	}
+	if err := set(to); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -109,7 +109,10 @@ func (h *httpHandler) createPlayer(w http.ResponseWriter, r *http.Request) {
 		}
 		players = append(players, p)
 	}
-	h.players.Add(Multi(postData.Key, players...))
+	if err := h.players.Add(Multi(postData.Key, players...)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
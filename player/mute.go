@@ -0,0 +1,77 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package player
+
+import "fmt"
+
+// defaultVolume is the volume assumed for Players which haven't had their volume recorded.
+const defaultVolume = 1.0
+
+// SetVolumeState records the volume of the Player identified by key, i.e. after it has been
+// set, so that it can be restored by ToggleMute.  Setting a non-zero volume while the Player
+// is muted unmutes it.
+//
+// Unlike the status, the volume and mute state are kept when the Player is removed, so that
+// they apply again when a Player with the same key is added (i.e. after reconnecting).
+func (s *Players) SetVolumeState(key string, v float64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.muted[key]; ok {
+		if v == 0 {
+			return
+		}
+		delete(s.muted, key)
+	}
+	s.volume[key] = v
+}
+
+// Muted returns true if the Player identified by key has been muted by ToggleMute.
+func (s *Players) Muted(key string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.muted[key]
+	return ok
+}
+
+// ToggleMute mutes the Player identified by key by setting its volume to 0, remembering its
+// current volume, or unmutes it by restoring the remembered volume.  Returns true if the
+// Player is now muted.
+func (s *Players) ToggleMute(key string) (bool, error) {
+	s.Lock()
+	p := s.m[key]
+	if p == nil {
+		s.Unlock()
+		return false, fmt.Errorf("invalid player key: %v", key)
+	}
+	v, muted := s.muted[key]
+	if !muted {
+		v = defaultVolume
+		if x, ok := s.volume[key]; ok && x > 0 {
+			v = x
+		}
+	}
+	s.Unlock()
+
+	if muted {
+		if err := p.SetVolume(v); err != nil {
+			return true, err
+		}
+		s.Lock()
+		delete(s.muted, key)
+		s.volume[key] = v
+		s.Unlock()
+		return false, nil
+	}
+
+	if err := p.SetVolume(0); err != nil {
+		return false, err
+	}
+	s.Lock()
+	s.muted[key] = v
+	s.Unlock()
+	return true, nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package player
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Output describes the audio output device of a player.
+type Output struct {
+	// Device is the identifier of the output device, empty for the default device.
+	Device string `json:"device"`
+	// Exclusive is true if the player should take exclusive control of the device, so that
+	// audio is passed through without resampling or mixing (bit-perfect).
+	Exclusive bool `json:"exclusive"`
+}
+
+// OutputSetter is an interface implemented by Players which can select their output device.
+// Players must return an error (rather than falling back to shared output) when Exclusive
+// is set and exclusive control of the device can't be taken.
+type OutputSetter interface {
+	SetOutput(Output) error
+}
+
+// ErrExclusiveUnavailable is returned by OutputSetters when exclusive mode can't be used,
+// i.e. because the device is busy or the player can't bypass the system mixer.
+var ErrExclusiveUnavailable = errors.New("exclusive mode unavailable")
+
+// SetOutput selects the output device of the Player, returning an error if the Player
+// doesn't implement OutputSetter.
+func SetOutput(p Player, o Output) error {
+	if os, ok := p.(OutputSetter); ok {
+		return os.SetOutput(o)
+	}
+	return InvalidValueError(fmt.Sprintf("player '%v' does not support output selection", p.Key()))
+}
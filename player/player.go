@@ -8,7 +8,9 @@ package player
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Action is a type which represents an enumeration of available player actions.
@@ -18,6 +20,7 @@ type Action string
 const (
 	ActionPlay            Action = "play"
 	ActionPause                  = "pause"
+	ActionStop                   = "stop"
 	ActionNext                   = "next"
 	ActionPrev                   = "prev"
 	ActionTogglePlayPause        = "togglePlayPause"
@@ -27,12 +30,120 @@ const (
 
 // Player actions which require values.
 const (
-	ActionSetVolume Action = "setVolume"
-	ActionSetMute          = "setMute"
-	ActionSetRepeat        = "setRepeat"
-	ActionSetTime          = "setTime"
+	ActionSetVolume     Action = "setVolume"
+	ActionSetMute              = "setMute"
+	ActionSetRepeat            = "setRepeat"
+	ActionSetTime              = "setTime"
+	ActionSeek                 = "seek"
+	ActionSetTransition        = "setTransition"
+	ActionSetReplayGain        = "setReplayGain"
+	ActionSetOutput            = "setOutput"
 )
 
+// TransitionMode is a type which represents an enumeration of the ways a player can move
+// from one track to the next.
+type TransitionMode string
+
+// Transition modes.
+const (
+	// TransitionNone plays tracks one after the other.
+	TransitionNone TransitionMode = "none"
+	// TransitionGapless loads the next track before the current track ends, so that
+	// it starts as soon as possible.
+	TransitionGapless = "gapless"
+	// TransitionCrossfade fades out the current track while fading in the next.
+	TransitionCrossfade = "crossfade"
+)
+
+// Transition describes how a player moves from one track to the next.
+type Transition struct {
+	Mode TransitionMode `json:"mode"`
+	// Seconds is the length of the crossfade (only used for TransitionCrossfade).
+	Seconds float64 `json:"seconds"`
+}
+
+// ReplayGainMode is a type which represents an enumeration of the ways a player can use
+// ReplayGain values to normalise playback volume.
+type ReplayGainMode string
+
+// ReplayGain modes.
+const (
+	// ReplayGainOff plays tracks without any adjustment.
+	ReplayGainOff ReplayGainMode = "off"
+	// ReplayGainTrack applies the track gain, so that all tracks play at similar loudness.
+	ReplayGainTrack = "track"
+	// ReplayGainAlbum applies the album gain, preserving relative loudness within albums.
+	ReplayGainAlbum = "album"
+)
+
+// IsValid returns true iff m is a valid ReplayGainMode.
+func (m ReplayGainMode) IsValid() bool {
+	switch m {
+	case ReplayGainOff, ReplayGainTrack, ReplayGainAlbum:
+		return true
+	}
+	return false
+}
+
+// SeekMode is a type which represents an enumeration of the ways a seek value can be
+// interpreted.
+type SeekMode string
+
+// Seek modes.
+const (
+	// SeekSeconds seeks to an absolute time (in seconds).
+	SeekSeconds SeekMode = "seconds"
+	// SeekFraction seeks to a fraction (between 0.0 and 1.0) of the track duration.
+	SeekFraction = "fraction"
+	// SeekRelative seeks forwards (or backwards) a number of seconds from the current
+	// play position.
+	SeekRelative = "relative"
+)
+
+// Position is the play position of the loaded track in a player, used to resolve seeks
+// which depend on the current time or track duration.
+type Position struct {
+	// Time is the current play position (in seconds).
+	Time float64
+	// Duration is the duration of the loaded track (in seconds).
+	Duration float64
+}
+
+// SeekTime returns the absolute time (in seconds) for the seek value v interpreted using
+// mode.  Times before the start of the track are clamped to 0, and (when the duration is
+// known) times after the end are clamped to the duration.
+func SeekTime(mode SeekMode, v float64, pos *Position) (float64, error) {
+	var t float64
+	switch mode {
+	case SeekSeconds, "":
+		t = v
+
+	case SeekFraction, SeekRelative:
+		if pos == nil {
+			return 0, InvalidValueError(fmt.Sprintf("cannot seek using mode '%v': play position unknown", mode))
+		}
+		if mode == SeekRelative {
+			t = pos.Time + v
+			break
+		}
+		if pos.Duration <= 0 {
+			return 0, InvalidValueError("cannot seek using mode 'fraction': track duration unknown")
+		}
+		t = v * pos.Duration
+
+	default:
+		return 0, InvalidValueError(fmt.Sprintf("invalid seek mode: '%v'", mode))
+	}
+
+	if t < 0 {
+		t = 0
+	}
+	if pos != nil && pos.Duration > 0 && t > pos.Duration {
+		t = pos.Duration
+	}
+	return t, nil
+}
+
 // Player is an interface which defines methods for controlling a player.
 type Player interface {
 	// Key returns a unique identifier for this Player.
@@ -49,6 +160,10 @@ type Player interface {
 	SetVolume(float64) error
 	// SetTime sets the current play position
 	SetTime(float64) error
+	// SetTransition sets how the player moves from one track to the next.
+	SetTransition(Transition) error
+	// SetReplayGain sets which (if any) ReplayGain values are applied during playback.
+	SetReplayGain(ReplayGainMode) error
 }
 
 type multi struct {
@@ -106,6 +221,48 @@ func (m multi) SetTime(f float64) error   { return m.applySetFloatFn(Player.SetT
 func (m multi) SetMute(v bool) error      { return m.applySetBoolFn(Player.SetMute, v) }
 func (m multi) SetRepeat(v bool) error    { return m.applySetBoolFn(Player.SetRepeat, v) }
 
+func (m multi) SetTransition(t Transition) error {
+	for _, p := range m.players {
+		err := p.SetTransition(t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FadeVolume implements Fader.
+func (m multi) FadeVolume(f Fade) error {
+	for _, p := range m.players {
+		err := FadeVolume(p, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetOutput implements OutputSetter.
+func (m multi) SetOutput(o Output) error {
+	for _, p := range m.players {
+		err := SetOutput(p, o)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multi) SetReplayGain(g ReplayGainMode) error {
+	for _, p := range m.players {
+		err := p.SetReplayGain(g)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m multi) MarshalJSON() ([]byte, error) {
 	playerKeys := make([]string, len(m.players))
 	for i, p := range m.players {
@@ -147,6 +304,12 @@ func (v validated) SetVolume(f float64) error {
 	return v.Player.SetVolume(f)
 }
 
+// FadeVolume implements Fader.
+func (v validated) FadeVolume(f Fade) error { return FadeVolume(v.Player, f) }
+
+// SetOutput implements OutputSetter.
+func (v validated) SetOutput(o Output) error { return SetOutput(v.Player, o) }
+
 // SetTime implements Player.
 func (v validated) SetTime(f float64) error {
 	if f < 0.0 {
@@ -155,6 +318,19 @@ func (v validated) SetTime(f float64) error {
 	return v.Player.SetTime(f)
 }
 
+// SetTransition implements Player.
+func (v validated) SetTransition(t Transition) error {
+	switch t.Mode {
+	case TransitionNone, TransitionGapless, TransitionCrossfade:
+	default:
+		return InvalidValueError(fmt.Sprintf("invalid transition mode '%v'", t.Mode))
+	}
+	if t.Seconds < 0.0 {
+		return InvalidValueError(fmt.Sprintf("invalid transition seconds '%v': must be greater than 0.0", t.Seconds))
+	}
+	return v.Player.SetTransition(t)
+}
+
 func (v validated) MarshalJSON() ([]byte, error) {
 	if m, ok := v.Player.(json.Marshaler); ok {
 		return m.MarshalJSON()
@@ -162,23 +338,156 @@ func (v validated) MarshalJSON() ([]byte, error) {
 	return nil, nil
 }
 
+// Status is a representation of the now-playing state of a Player.
+type Status struct {
+	// TrackID is the identifier of the loaded track, empty if no track is loaded.
+	TrackID string `json:"trackID,omitempty"`
+	// Playing is true iff the loaded track is playing.
+	Playing bool `json:"playing"`
+	// Time is the current play position (in seconds).
+	Time float64 `json:"time"`
+}
+
 // Players is a collection of players which are identified by key.
 type Players struct {
 	sync.RWMutex
-	m map[string]Player
+	m        map[string]Player
+	status   map[string]Status
+	updated  map[string]time.Time
+	watchers map[string]map[chan Status]bool
+	rooms    map[string][]string
+	timers   map[string]*time.Timer
+
+	volume map[string]float64 // last recorded volume (see SetVolumeState)
+	muted  map[string]float64 // volume before muting (see ToggleMute)
+
+	idleTTL  time.Duration
+	onExpire func(key string)
+	idle     map[string]*time.Timer
 }
 
 // NewPlayers creates a Players.
 func NewPlayers() *Players {
-	return &Players{m: make(map[string]Player)}
+	return &Players{
+		m:        make(map[string]Player),
+		status:   make(map[string]Status),
+		updated:  make(map[string]time.Time),
+		watchers: make(map[string]map[chan Status]bool),
+		rooms:    make(map[string][]string),
+		timers:   make(map[string]*time.Timer),
+		volume:   make(map[string]float64),
+		muted:    make(map[string]float64),
+		idle:     make(map[string]*time.Timer),
+	}
+}
+
+// Add the Player to the Players.  Players added with Add never expire (see AddExpiring).
+// Returns an error if the key of the Player is used by a room (see Group).
+func (s *Players) Add(p Player) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.add(p); err != nil {
+		return err
+	}
+	s.stopIdle(p.Key())
+	return nil
+}
+
+// add adds the Player, replacing it in any rooms which contain a Player with the
+// same key.  Must be called with the lock held.
+func (s *Players) add(p Player) error {
+	key := p.Key()
+	if _, ok := s.rooms[key]; ok {
+		return fmt.Errorf("player key is used by a room: %v", key)
+	}
+	s.m[key] = p
+
+	for room, members := range s.rooms {
+		if contains(members, key) {
+			s.setRoom(room, members)
+		}
+	}
+	return nil
+}
+
+// SetIdleTTL enables the expiry of players added with AddExpiring which have been idle (i.e.
+// haven't been sent a command or had their status set) for the duration ttl.  Expired players
+// are removed, and then fn is called with their key.  A ttl of zero disables expiry for
+// players added (or re-added) afterwards.
+func (s *Players) SetIdleTTL(ttl time.Duration, fn func(key string)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.idleTTL = ttl
+	s.onExpire = fn
 }
 
-// Add the Player to the Players.
-func (s *Players) Add(p Player) {
+// AddExpiring adds the Player to the Players, removing it when it has been idle for the TTL
+// given to SetIdleTTL (if set).  Adding a Player with the same key again resets the TTL.
+// Returns an error if the key of the Player is used by a room (see Group).
+func (s *Players) AddExpiring(p Player) error {
 	s.Lock()
 	defer s.Unlock()
 
-	s.m[p.Key()] = p
+	if err := s.add(p); err != nil {
+		return err
+	}
+	key := p.Key()
+	s.stopIdle(key)
+	if s.idleTTL > 0 {
+		s.startIdle(key)
+	}
+	return nil
+}
+
+// Touch resets the idle TTL of the Player identified by the key, i.e. when it is sent a
+// command.  Players which don't expire are unaffected.
+func (s *Players) Touch(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.touch(key)
+}
+
+// touch resets the expiry timer of the player identified by key, if it is expiring.  Must be
+// called with the lock held.
+func (s *Players) touch(key string) {
+	if _, ok := s.idle[key]; ok {
+		s.stopIdle(key)
+		s.startIdle(key)
+	}
+}
+
+// startIdle starts the expiry timer of the player identified by key.  Must be called with the
+// lock held.
+func (s *Players) startIdle(key string) {
+	var t *time.Timer
+	t = time.AfterFunc(s.idleTTL, func() {
+		s.Lock()
+		if s.idle[key] != t {
+			// The timer was replaced (the player was used) or stopped after it fired.
+			s.Unlock()
+			return
+		}
+		s.remove(key)
+		fn := s.onExpire
+		s.Unlock()
+
+		if fn != nil {
+			fn(key)
+		}
+	})
+	s.idle[key] = t
+}
+
+// stopIdle stops the expiry of the player identified by key.  Must be called with the lock
+// held.
+func (s *Players) stopIdle(key string) {
+	if t, ok := s.idle[key]; ok {
+		t.Stop()
+		delete(s.idle, key)
+	}
 }
 
 // Remove the Player from Players (by key).
@@ -186,7 +495,29 @@ func (s *Players) Remove(key string) {
 	s.Lock()
 	defer s.Unlock()
 
+	s.remove(key)
+}
+
+// remove removes the Player identified by key.  Must be called with the lock held.
+func (s *Players) remove(key string) {
 	delete(s.m, key)
+	delete(s.status, key)
+	delete(s.updated, key)
+	delete(s.rooms, key)
+	if t, ok := s.timers[key]; ok {
+		t.Stop()
+		delete(s.timers, key)
+	}
+	s.stopIdle(key)
+
+	for room, members := range s.rooms {
+		for i, k := range members {
+			if k == key {
+				s.setRoom(room, append(members[:i:i], members[i+1:]...))
+				break
+			}
+		}
+	}
 }
 
 // Get the Player identified by the key.
@@ -197,6 +528,95 @@ func (s *Players) Get(key string) Player {
 	return s.m[key]
 }
 
+// SetStatus sets the Status of the Player identified by the key.
+func (s *Players) SetStatus(key string, st Status) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.status[key] = st
+	s.updated[key] = time.Now()
+	s.touch(key)
+	for ch := range s.watchers[key] {
+		// Watchers which haven't received the previous status will pick up this
+		// change through the next call to Status.
+		select {
+		case ch <- st:
+		default:
+		}
+	}
+}
+
+// Watch returns a channel which receives the Status of the Player identified by the key
+// each time it is set.  Call the returned function to stop watching.
+func (s *Players) Watch(key string) (<-chan Status, func()) {
+	s.Lock()
+	defer s.Unlock()
+
+	ch := make(chan Status, 1)
+	if s.watchers[key] == nil {
+		s.watchers[key] = make(map[chan Status]bool)
+	}
+	s.watchers[key][ch] = true
+
+	return ch, func() {
+		s.Lock()
+		defer s.Unlock()
+
+		delete(s.watchers[key], ch)
+		if len(s.watchers[key]) == 0 {
+			delete(s.watchers, key)
+		}
+	}
+}
+
+// SetSleepTimer schedules the Player identified by the key to pause after the duration d,
+// replacing any existing timer for the Player.  After the pause, fn is called with the error
+// (if any) from pausing.  If d is zero then the existing timer is cancelled.
+func (s *Players) SetSleepTimer(key string, d time.Duration, fn func(error)) error {
+	if d < 0 {
+		return InvalidValueError("invalid sleep timer duration: must be non-negative")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.m[key]; !ok {
+		return fmt.Errorf("invalid player key: %v", key)
+	}
+	if t, ok := s.timers[key]; ok {
+		t.Stop()
+		delete(s.timers, key)
+	}
+	if d == 0 {
+		return nil
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		s.Lock()
+		if s.timers[key] != t {
+			// The timer was replaced or cancelled after it fired.
+			s.Unlock()
+			return
+		}
+		delete(s.timers, key)
+		p := s.m[key]
+		s.Unlock()
+
+		fn(p.Do(ActionPause))
+	})
+	s.timers[key] = t
+	return nil
+}
+
+// Status returns the Status of the Player identified by the key.
+func (s *Players) Status(key string) Status {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.status[key]
+}
+
 // List all Player keys in Players.
 func (s *Players) List() []string {
 	s.RLock()
@@ -209,6 +629,70 @@ func (s *Players) List() []string {
 	return keys
 }
 
+// Typed is an interface implemented by Players which control a particular kind of device.
+type Typed interface {
+	// Type returns the kind of device controlled by the Player.
+	Type() string
+}
+
+// State is the state of a Player, as last reported using SetStatus.
+type State struct {
+	Key string `json:"key"`
+	// Type is the kind of device controlled by the Player (see Typed), if known.
+	Type string `json:"type,omitempty"`
+	// Muted is true if the Player has been muted (see ToggleMute).
+	Muted bool `json:"muted"`
+	Status
+}
+
+// States returns the State of each Player in Players, ordered by key.  The time of playing
+// players is advanced by the time since their status was last set.
+func (s *Players) States() []State {
+	s.RLock()
+	defer s.RUnlock()
+
+	keys := make([]string, 0, len(s.m))
+	for k := range s.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	states := make([]State, len(keys))
+	for i, k := range keys {
+		states[i] = s.state(k)
+	}
+	return states
+}
+
+// State returns the State of the Player identified by key (see States), and false if there
+// is no such Player.
+func (s *Players) State(key string) (State, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if _, ok := s.m[key]; !ok {
+		return State{}, false
+	}
+	return s.state(key), true
+}
+
+// state returns the State of the Player identified by key.  Must be called with the lock
+// held.
+func (s *Players) state(key string) State {
+	st := s.status[key]
+	st.Time = s.position(key)
+	_, muted := s.muted[key]
+	state := State{
+		Key:    key,
+		Muted:  muted,
+		Status: st,
+	}
+	if t, ok := s.m[key].(Typed); ok {
+		state.Type = t.Type()
+	}
+	return state
+}
+
 // MarshalJSON implements json.Marshaler
 func (s *Players) MarshalJSON() ([]byte, error) {
 	keys := s.List()
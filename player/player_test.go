@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type testPlayer string
@@ -15,6 +16,9 @@ func (testPlayer) SetRepeat(bool) error    { return nil }
 func (testPlayer) SetVolume(float64) error { return nil }
 func (testPlayer) SetTime(float64) error   { return nil }
 
+func (testPlayer) SetTransition(Transition) error     { return nil }
+func (testPlayer) SetReplayGain(ReplayGainMode) error { return nil }
+
 func TestPlayers(t *testing.T) {
 	oneKey := "one"
 	onePl := testPlayer(oneKey)
@@ -58,3 +62,557 @@ func TestPlayers(t *testing.T) {
 		t.Errorf("len(ps.List()) = %d, expected: %d", len(list), 0)
 	}
 }
+
+func TestPlayersStatus(t *testing.T) {
+	key := "one"
+	ps := NewPlayers()
+	ps.Add(testPlayer(key))
+
+	st := Status{TrackID: "track", Playing: true, Time: 1.5}
+	ps.SetStatus(key, st)
+	if got := ps.Status(key); got != st {
+		t.Errorf("Status(%#v) = %#v, expected: %#v", key, got, st)
+	}
+
+	ps.Remove(key)
+	if got := ps.Status(key); got != (Status{}) {
+		t.Errorf("Status(%#v) = %#v, expected: %#v", key, got, Status{})
+	}
+}
+
+func TestPlayersStates(t *testing.T) {
+	ps := NewPlayers()
+	ps.Add(testPlayer("two"))
+	ps.Add(testPlayer("one"))
+
+	paused := Status{TrackID: "track", Time: 1.5}
+	ps.SetStatus("one", paused)
+
+	got := ps.States()
+	expected := []State{
+		{Key: "one", Status: paused},
+		{Key: "two"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("States() = %#v, expected: %#v", got, expected)
+	}
+
+	ps.SetStatus("two", Status{TrackID: "track", Playing: true, Time: 1.5})
+	if st := ps.States()[1]; st.Time < 1.5 {
+		t.Errorf("States()[1].Time = %v, expected >= %v", st.Time, 1.5)
+	}
+
+	if got, ok := ps.State("one"); !ok || !reflect.DeepEqual(got, expected[0]) {
+		t.Errorf("State(%#v) = %#v, %v, expected: %#v, true", "one", got, ok, expected[0])
+	}
+	if _, ok := ps.State("three"); ok {
+		t.Errorf("State(%#v) = _, %v, expected: _, false", "three", ok)
+	}
+}
+
+func TestPlayersWatch(t *testing.T) {
+	key := "one"
+	ps := NewPlayers()
+
+	ch, stop := ps.Watch(key)
+	st := Status{TrackID: "track", Playing: true}
+	ps.SetStatus(key, st)
+
+	select {
+	case got := <-ch:
+		if got != st {
+			t.Errorf("<-Watch(%#v) = %#v, expected: %#v", key, got, st)
+		}
+	default:
+		t.Errorf("expected status change from Watch(%#v)", key)
+	}
+
+	stop()
+	ps.SetStatus(key, Status{})
+	select {
+	case got := <-ch:
+		t.Errorf("unexpected status change after stop: %#v", got)
+	default:
+	}
+}
+
+type actionPlayer struct {
+	testPlayer
+	actions chan Action
+}
+
+func (p actionPlayer) Do(a Action) error {
+	p.actions <- a
+	return nil
+}
+
+func TestPlayersSetSleepTimer(t *testing.T) {
+	key := "one"
+	ps := NewPlayers()
+	p := actionPlayer{testPlayer(key), make(chan Action, 1)}
+	ps.Add(p)
+
+	if err := ps.SetSleepTimer("two", time.Millisecond, func(error) {}); err == nil {
+		t.Errorf("SetSleepTimer(%#v, ...) = nil, expected error", "two")
+	}
+
+	fired := make(chan error, 1)
+	fn := func(err error) { fired <- err }
+	if err := ps.SetSleepTimer(key, time.Millisecond, fn); err != nil {
+		t.Fatalf("unexpected error from SetSleepTimer: %v", err)
+	}
+	select {
+	case err := <-fired:
+		if err != nil {
+			t.Errorf("unexpected error from sleep timer: %v", err)
+		}
+		if a := <-p.actions; a != ActionPause {
+			t.Errorf("sleep timer action = %#v, expected: %#v", a, ActionPause)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected sleep timer to fire")
+	}
+
+	ps.SetSleepTimer(key, 10*time.Millisecond, fn)
+	ps.SetSleepTimer(key, 0, fn)
+	select {
+	case <-fired:
+		t.Errorf("unexpected sleep timer after cancel")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPlayersIdleTTL(t *testing.T) {
+	ps := NewPlayers()
+	expired := make(chan string, 2)
+	ps.SetIdleTTL(50*time.Millisecond, func(key string) { expired <- key })
+
+	ps.Add(testPlayer("fixed"))
+	ps.AddExpiring(testPlayer("idle"))
+	ps.AddExpiring(testPlayer("active"))
+
+	// Keep "active" in use for longer than the TTL.
+	for i := 0; i < 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if i%2 == 0 {
+			ps.Touch("active")
+		} else {
+			ps.SetStatus("active", Status{Playing: true})
+		}
+	}
+
+	select {
+	case key := <-expired:
+		if key != "idle" {
+			t.Errorf("expired player = %#v, expected: %#v", key, "idle")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected idle player to expire")
+	}
+	if ps.Get("idle") != nil {
+		t.Errorf("expected expired player to be removed")
+	}
+	if ps.Get("active") == nil || ps.Get("fixed") == nil {
+		t.Errorf("expected active and fixed players to remain")
+	}
+
+	// Players which are removed (or re-added without expiry) don't expire.
+	ps.Remove("active")
+	ps.AddExpiring(testPlayer("fixed"))
+	ps.Add(testPlayer("fixed"))
+	select {
+	case key := <-expired:
+		t.Errorf("unexpected expiry of %#v", key)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type timePlayer struct {
+	testPlayer
+	time float64
+}
+
+func (p *timePlayer) SetTime(f float64) error {
+	p.time = f
+	return nil
+}
+
+func TestRepActionSeek(t *testing.T) {
+	pos := &Position{Time: 30, Duration: 200}
+
+	tests := []struct {
+		mode SeekMode
+		in   float64
+		pos  *Position
+		out  float64
+		err  bool
+	}{
+		{SeekSeconds, 12, nil, 12, false},
+		{"", 12, pos, 12, false},
+		{SeekSeconds, 500, pos, 200, false},
+		{SeekFraction, 0.5, pos, 100, false},
+		{SeekFraction, 0.5, &Position{Time: 30}, 0, true},
+		{SeekFraction, 0.5, nil, 0, true},
+		{SeekRelative, 10, pos, 40, false},
+		{SeekRelative, -60, pos, 0, false},
+		{SeekRelative, 10, nil, 0, true},
+		{SeekMode("unknown"), 10, pos, 0, true},
+	}
+
+	for ii, tt := range tests {
+		p := &timePlayer{}
+		r := RepAction{
+			Action:   ActionSeek,
+			Value:    tt.in,
+			Mode:     tt.mode,
+			Position: tt.pos,
+		}
+
+		err := r.Apply(p)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] r.Apply() error = %v, expected error: %v", ii, err, tt.err)
+			continue
+		}
+		if p.time != tt.out {
+			t.Errorf("[%d] p.time = %v, expected: %v", ii, p.time, tt.out)
+		}
+	}
+}
+
+type replayGainPlayer struct {
+	testPlayer
+	mode ReplayGainMode
+}
+
+func (p *replayGainPlayer) SetReplayGain(g ReplayGainMode) error {
+	p.mode = g
+	return nil
+}
+
+func TestRepActionSetReplayGain(t *testing.T) {
+	tests := []struct {
+		action string
+		in     interface{}
+		out    ReplayGainMode
+		err    bool
+	}{
+		{ActionSetReplayGain, "album", ReplayGainAlbum, false},
+		{ActionSetReplayGain, "track", ReplayGainTrack, false},
+		{"SET_REPLAYGAIN", "off", ReplayGainOff, false},
+		{"SET_REPLAYGAIN", "album", ReplayGainAlbum, false},
+		{ActionSetReplayGain, "loud", "", true},
+		{ActionSetReplayGain, 1.0, "", true},
+		{ActionSetReplayGain, nil, "", true},
+	}
+
+	for ii, tt := range tests {
+		p := &replayGainPlayer{}
+		r := RepAction{
+			Action: tt.action,
+			Value:  tt.in,
+		}
+
+		err := r.Apply(p)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] r.Apply() error = %v, expected error: %v", ii, err, tt.err)
+			continue
+		}
+		if p.mode != tt.out {
+			t.Errorf("[%d] p.mode = %v, expected: %v", ii, p.mode, tt.out)
+		}
+	}
+}
+
+func TestRepActionSetOutput(t *testing.T) {
+	tests := []struct {
+		action string
+		in     interface{}
+		out    []interface{} // RepActions sent to the rep player
+		err    bool
+	}{
+		{"SET_OUTPUT", map[string]interface{}{"device": "usb-dac"}, []interface{}{RepAction{Action: "output", Value: Output{Device: "usb-dac"}}}, false},
+		{ActionSetOutput, map[string]interface{}{}, []interface{}{RepAction{Action: "output", Value: Output{}}}, false},
+		{ActionSetOutput, map[string]interface{}{"device": "usb-dac", "exclusive": true}, nil, true},
+		{ActionSetOutput, map[string]interface{}{"device": 1.0}, nil, true},
+		{ActionSetOutput, map[string]interface{}{"exclusive": "yes"}, nil, true},
+		{ActionSetOutput, "usb-dac", nil, true},
+		{ActionSetOutput, nil, nil, true},
+	}
+
+	for ii, tt := range tests {
+		var sent []interface{}
+		p := Validated(NewRep("rep", func(x interface{}) { sent = append(sent, x) }))
+		r := RepAction{
+			Action: tt.action,
+			Value:  tt.in,
+		}
+
+		err := r.Apply(p)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] r.Apply() error = %v, expected error: %v", ii, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(sent, tt.out) {
+			t.Errorf("[%d] sent = %#v, expected: %#v", ii, sent, tt.out)
+		}
+	}
+
+	// Players which can't select outputs return an error.
+	if err := SetOutput(testPlayer("test"), Output{}); err == nil {
+		t.Errorf("SetOutput(testPlayer, ...) = nil, expected error")
+	}
+}
+
+type syncPlayer struct {
+	testPlayer
+	time    float64
+	actions []Action
+}
+
+func (p *syncPlayer) SetTime(f float64) error {
+	p.time = f
+	return nil
+}
+
+func (p *syncPlayer) Do(a Action) error {
+	p.actions = append(p.actions, a)
+	return nil
+}
+
+func TestPlayersGroup(t *testing.T) {
+	one := &syncPlayer{testPlayer: "one"}
+	two := &syncPlayer{testPlayer: "two"}
+	three := &syncPlayer{testPlayer: "three"}
+
+	ps := NewPlayers()
+	ps.Add(one)
+	ps.Add(two)
+	ps.Add(three)
+
+	if _, err := ps.Group("one", []string{"two"}); err == nil {
+		t.Errorf("expected error grouping into existing player key")
+	}
+	if _, err := ps.Group("room", []string{"four"}); err == nil {
+		t.Errorf("expected error grouping unknown player key")
+	}
+
+	room, err := ps.Group("room", []string{"one", "two"})
+	if err != nil {
+		t.Fatalf("unexpected error from Group: %v", err)
+	}
+	if got := ps.Get("room"); got == nil || got.Key() != room.Key() {
+		t.Errorf("Get(%#v) = %#v, expected: %#v", "room", got, room)
+	}
+	if len(two.actions) != 0 {
+		t.Errorf("unexpected actions sent to member joining idle room: %v", two.actions)
+	}
+
+	ps.SetStatus("one", Status{TrackID: "track", Playing: true, Time: 10})
+	if _, err := ps.Group("room", []string{"three"}); err != nil {
+		t.Fatalf("unexpected error from Group: %v", err)
+	}
+	if three.time < 10 || three.time > 11 {
+		t.Errorf("joining member time = %v, expected: %v", three.time, 10)
+	}
+	if !reflect.DeepEqual(three.actions, []Action{ActionPlay}) {
+		t.Errorf("joining member actions = %v, expected: %v", three.actions, []Action{ActionPlay})
+	}
+
+	ps.Get("room").Do(ActionPause)
+	for _, p := range []*syncPlayer{one, two, three} {
+		if n := len(p.actions); n == 0 || p.actions[n-1] != ActionPause {
+			t.Errorf("member %v did not receive room action: %v", p.Key(), p.actions)
+		}
+	}
+
+	ps.Remove("two")
+	if got, expected := ps.Members("room"), []string{"one", "three"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Members(%#v) = %v, expected: %v", "room", got, expected)
+	}
+
+	if err := ps.Ungroup("room"); err != nil {
+		t.Errorf("unexpected error from Ungroup: %v", err)
+	}
+	if ps.Get("room") != nil {
+		t.Errorf("expected room to be removed")
+	}
+	if ps.Get("one") == nil {
+		t.Errorf("expected member to remain after Ungroup")
+	}
+}
+
+func TestPlayersAddRoomMember(t *testing.T) {
+	ps := NewPlayers()
+	ps.Add(&syncPlayer{testPlayer: "one"})
+	ps.Add(&syncPlayer{testPlayer: "two"})
+	if _, err := ps.Group("room", []string{"one", "two"}); err != nil {
+		t.Fatalf("unexpected error from Group: %v", err)
+	}
+
+	if err := ps.Add(testPlayer("room")); err == nil {
+		t.Errorf("expected error adding player with room key")
+	}
+	if err := ps.AddExpiring(testPlayer("room")); err == nil {
+		t.Errorf("expected error adding expiring player with room key")
+	}
+
+	// Replacing a member replaces it in the room.
+	one := &syncPlayer{testPlayer: "one"}
+	if err := ps.AddExpiring(one); err != nil {
+		t.Fatalf("unexpected error from AddExpiring: %v", err)
+	}
+	ps.Get("room").Do(ActionPlay)
+	if !reflect.DeepEqual(one.actions, []Action{ActionPlay}) {
+		t.Errorf("replaced member actions = %v, expected: %v", one.actions, []Action{ActionPlay})
+	}
+	if got, expected := ps.Members("room"), []string{"one", "two"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Members(%#v) = %v, expected: %v", "room", got, expected)
+	}
+}
+
+type fadePlayer struct {
+	testPlayer
+	volume float64
+	fade   *Fade
+	paused bool
+}
+
+func (p *fadePlayer) SetVolume(f float64) error {
+	p.volume = f
+	return nil
+}
+
+func (p *fadePlayer) Do(a Action) error {
+	p.paused = a == ActionPause
+	return nil
+}
+
+type faderPlayer struct {
+	fadePlayer
+}
+
+func (p *faderPlayer) FadeVolume(f Fade) error {
+	p.fade = &f
+	return nil
+}
+
+func TestRepActionSetVolumeFade(t *testing.T) {
+	tests := []struct {
+		r      RepAction
+		fade   *Fade // expected fade (for Faders)
+		volume float64
+		paused bool
+		err    bool
+	}{
+		{RepAction{Action: "SET_VOLUME", Value: 0.5}, nil, 0.5, false, false},
+		{RepAction{Action: "SET_VOLUME", Value: 0.3, FadeMs: 500}, &Fade{Volume: 0.3, Duration: 500 * time.Millisecond}, 0.3, false, false},
+		{RepAction{Action: "SET_VOLUME", Value: 0.0, FadeMs: 2000, Pause: true}, &Fade{Volume: 0.0, Duration: 2 * time.Second, Pause: true}, 0.0, true, false},
+		{RepAction{Action: "SET_VOLUME", Value: 0.3, FadeMs: 500, Pause: true}, nil, 0, false, true},
+		{RepAction{Action: "SET_VOLUME", Value: 0.3, FadeMs: -1}, nil, 0, false, true},
+		{RepAction{Action: "SET_VOLUME", Value: 1.5, FadeMs: 500}, nil, 0, false, true},
+	}
+
+	for ii, tt := range tests {
+		fp := &faderPlayer{}
+		err := tt.r.Apply(fp)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] r.Apply(fader) error = %v, expected error: %v", ii, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(fp.fade, tt.fade) {
+			t.Errorf("[%d] fade = %#v, expected: %#v", ii, fp.fade, tt.fade)
+		}
+
+		// Players which can't fade have the volume set immediately.
+		p := &fadePlayer{}
+		err = tt.r.Apply(p)
+		if (err != nil) != tt.err {
+			t.Errorf("[%d] r.Apply() error = %v, expected error: %v", ii, err, tt.err)
+			continue
+		}
+		if p.volume != tt.volume || p.paused != tt.paused {
+			t.Errorf("[%d] volume, paused = %v, %v, expected: %v, %v", ii, p.volume, p.paused, tt.volume, tt.paused)
+		}
+	}
+}
+
+func TestRamp(t *testing.T) {
+	var got []float64
+	set := func(f float64) error {
+		got = append(got, f)
+		return nil
+	}
+
+	done, err := Ramp(set, 1.0, 0.0, 4*fadeStep, nil)
+	if !done || err != nil {
+		t.Errorf("Ramp() = %v, %v, expected: true, <nil>", done, err)
+	}
+	expected := []float64{0.75, 0.5, 0.25, 0.0}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Ramp() set %v, expected: %v", got, expected)
+	}
+
+	got = nil
+	cancel := make(chan struct{})
+	close(cancel)
+	done, _ = Ramp(set, 1.0, 0.0, 4*fadeStep, cancel)
+	if done || len(got) != 0 {
+		t.Errorf("Ramp() after cancel = %v (set %v), expected: false", done, got)
+	}
+
+	got = nil
+	done, _ = Ramp(set, 0.2, 0.8, 0, nil)
+	if !done || !reflect.DeepEqual(got, []float64{0.8}) {
+		t.Errorf("Ramp() with no duration = %v (set %v), expected: true (set [0.8])", done, got)
+	}
+}
+
+func TestPlayersToggleMute(t *testing.T) {
+	ps := NewPlayers()
+	p := &fadePlayer{testPlayer: "one"}
+	ps.Add(p)
+	ps.SetVolumeState("one", 0.6)
+
+	tests := []struct {
+		muted  bool
+		volume float64
+	}{
+		{true, 0.0},
+		{false, 0.6},
+		{true, 0.0},
+	}
+	for ii, tt := range tests {
+		muted, err := ps.ToggleMute("one")
+		if err != nil {
+			t.Errorf("[%d] ToggleMute(%#v) error = %v, expected: nil", ii, "one", err)
+			continue
+		}
+		if muted != tt.muted || p.volume != tt.volume {
+			t.Errorf("[%d] ToggleMute(%#v) = %v (volume %v), expected: %v (volume %v)", ii, "one", muted, p.volume, tt.muted, tt.volume)
+		}
+		if st, _ := ps.State("one"); st.Muted != tt.muted {
+			t.Errorf("[%d] State(%#v).Muted = %v, expected: %v", ii, "one", st.Muted, tt.muted)
+		}
+	}
+
+	// The mute state is kept when the player reconnects.
+	ps.Remove("one")
+	ps.Add(p)
+	if !ps.Muted("one") {
+		t.Errorf("Muted(%#v) = false after reconnecting, expected: true", "one")
+	}
+
+	// Setting the volume unmutes.
+	ps.SetVolumeState("one", 0.0)
+	if !ps.Muted("one") {
+		t.Errorf("Muted(%#v) = false after setting volume 0, expected: true", "one")
+	}
+	ps.SetVolumeState("one", 0.4)
+	if ps.Muted("one") {
+		t.Errorf("Muted(%#v) = true after setting volume, expected: false", "one")
+	}
+
+	if _, err := ps.ToggleMute("two"); err == nil {
+		t.Errorf("ToggleMute(%#v) error = nil, expected error", "two")
+	}
+}
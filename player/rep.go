@@ -7,6 +7,7 @@ package player
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // RepFn is a type which represents a command function which will be called
@@ -17,16 +18,30 @@ type RepFn func(interface{})
 type RepAction struct {
 	Action string      `json:"action"`
 	Value  interface{} `json:",omitempty"`
+	Mode   SeekMode    `json:"mode,omitempty"`
+
+	// FadeMs is the duration (in milliseconds) over which SET_VOLUME fades the volume, and
+	// Pause is true if the player should pause at the end of the fade (see Fade).
+	FadeMs int  `json:"fadeMs,omitempty"`
+	Pause  bool `json:"pause,omitempty"`
+
+	// Position is the current play position of the player, required for seeks using
+	// the SeekFraction and SeekRelative modes.
+	Position *Position `json:"-"`
 }
 
-// Apply applies the action in RepAction to the Player.
+// Apply applies the action in RepAction to the Player.  The action can be given as an
+// Action or as its RepActions representation (i.e. "SET_REPLAYGAIN").
 func (r RepAction) Apply(p Player) (err error) {
 	a := Action(r.Action)
+	if x, ok := RepActionToAction(r.Action); ok {
+		a = x
+	}
 	switch a {
-	case ActionPlay, ActionPause, ActionNext, ActionPrev, ActionTogglePlayPause, ActionToggleMute, ActionToggleRepeat:
+	case ActionPlay, ActionPause, ActionStop, ActionNext, ActionPrev, ActionTogglePlayPause, ActionToggleMute, ActionToggleRepeat:
 		err = p.Do(a)
 
-	case ActionSetVolume, ActionSetMute, ActionSetTime, ActionSetRepeat:
+	case ActionSetVolume, ActionSetMute, ActionSetTime, ActionSetRepeat, ActionSeek, ActionSetTransition, ActionSetReplayGain, ActionSetOutput:
 		if r.Value == nil {
 			err = InvalidValueError("value required")
 			break
@@ -39,6 +54,14 @@ func (r RepAction) Apply(p Player) (err error) {
 				err = InvalidValueError("invalid volume value: expected float")
 				break
 			}
+			if r.FadeMs != 0 || r.Pause {
+				err = FadeVolume(p, Fade{
+					Volume:   f,
+					Duration: time.Duration(r.FadeMs) * time.Millisecond,
+					Pause:    r.Pause,
+				})
+				break
+			}
 			err = p.SetVolume(f)
 
 		case ActionSetMute:
@@ -64,6 +87,75 @@ func (r RepAction) Apply(p Player) (err error) {
 				break
 			}
 			err = p.SetTime(f)
+
+		case ActionSeek:
+			f, ok := r.Value.(float64)
+			if !ok {
+				err = InvalidValueError("invalid seek value: expected float")
+				break
+			}
+			f, err = SeekTime(r.Mode, f, r.Position)
+			if err != nil {
+				break
+			}
+			err = p.SetTime(f)
+
+		case ActionSetTransition:
+			m, ok := r.Value.(map[string]interface{})
+			if !ok {
+				err = InvalidValueError("invalid transition value: expected object")
+				break
+			}
+			mode, ok := m["mode"].(string)
+			if !ok {
+				err = InvalidValueError("invalid transition mode: expected string")
+				break
+			}
+			t := Transition{Mode: TransitionMode(mode)}
+			if s, ok := m["seconds"]; ok {
+				t.Seconds, ok = s.(float64)
+				if !ok {
+					err = InvalidValueError("invalid transition seconds: expected float")
+					break
+				}
+			}
+			err = p.SetTransition(t)
+
+		case ActionSetReplayGain:
+			s, ok := r.Value.(string)
+			if !ok {
+				err = InvalidValueError("invalid replay gain value: expected string")
+				break
+			}
+			g := ReplayGainMode(s)
+			if !g.IsValid() {
+				err = InvalidValueError(fmt.Sprintf("invalid replay gain mode: '%v'", s))
+				break
+			}
+			err = p.SetReplayGain(g)
+
+		case ActionSetOutput:
+			m, ok := r.Value.(map[string]interface{})
+			if !ok {
+				err = InvalidValueError("invalid output value: expected object")
+				break
+			}
+			var o Output
+			if d, ok := m["device"]; ok {
+				o.Device, ok = d.(string)
+				if !ok {
+					err = InvalidValueError("invalid output device: expected string")
+					break
+				}
+			}
+			if e, ok := m["exclusive"]; ok {
+				o.Exclusive, ok = e.(bool)
+				if !ok {
+					err = InvalidValueError("invalid output exclusive: expected boolean")
+					break
+				}
+			}
+			err = SetOutput(p, o)
 		}
 
 	default:
@@ -107,6 +199,7 @@ func (r rep) Key() string { return r.key }
 var RepActions = map[Action]string{
 	ActionPlay:            "PLAY",
 	ActionPause:           "PAUSE",
+	ActionStop:            "STOP",
 	ActionNext:            "NEXT",
 	ActionPrev:            "PREV",
 	ActionTogglePlayPause: "TOGGLE_PLAY_PAUSE",
@@ -117,6 +210,11 @@ var RepActions = map[Action]string{
 	ActionSetMute:   "SET_MUTE",
 	ActionSetRepeat: "SET_REPEAT",
 	ActionSetTime:   "SET_TIME",
+	ActionSeek:      "SEEK",
+
+	ActionSetTransition: "SET_TRANSITION",
+	ActionSetReplayGain: "SET_REPLAYGAIN",
+	ActionSetOutput:     "SET_OUTPUT",
 }
 
 // RepActionToAction takes a string and returns an Action and true if the
@@ -152,6 +250,30 @@ func (r rep) SetRepeat(b bool) error    { return r.sendActionValue("repeat", b)
 func (r rep) SetVolume(f float64) error { return r.sendActionValue("volume", f) }
 func (r rep) SetTime(f float64) error   { return r.sendActionValue("time", f) }
 
+// FadeVolume implements Fader.  The fade is carried out by the receiver of the action.
+func (r rep) FadeVolume(f Fade) error {
+	r.fn(RepAction{
+		Action: "volume",
+		Value:  f.Volume,
+		FadeMs: int(f.Duration / time.Millisecond),
+		Pause:  f.Pause,
+	})
+	return nil
+}
+
+func (r rep) SetTransition(t Transition) error     { return r.sendActionValue("transition", t) }
+func (r rep) SetReplayGain(g ReplayGainMode) error { return r.sendActionValue("replayGain", g) }
+
+// SetOutput implements OutputSetter.  The device is selected by the receiver of the action,
+// which (as a browser) always plays through the system mixer, so exclusive mode is never
+// available.
+func (r rep) SetOutput(o Output) error {
+	if o.Exclusive {
+		return ErrExclusiveUnavailable
+	}
+	return r.sendActionValue("output", o)
+}
+
 func (r rep) MarshalJSON() ([]byte, error) {
 	rep := struct {
 		Key string `json:"key"`
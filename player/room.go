@@ -0,0 +1,131 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package player
+
+import (
+	"fmt"
+	"time"
+)
+
+// Group binds the Players identified by the member keys into a room: a Player with the
+// given key which applies all calls to its members (see Multi).  If the room already
+// exists then the members are added to it.
+//
+// The first member of the room is used as its clock: members which join while it has a
+// track loaded are moved to its current play position (and started if it is playing).
+func (s *Players) Group(key string, members []string) (Player, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("no player keys specified")
+	}
+
+	s.Lock()
+	keys, ok := s.rooms[key]
+	if !ok && s.m[key] != nil {
+		s.Unlock()
+		return nil, fmt.Errorf("player key already exists: %v", key)
+	}
+	keys = append([]string(nil), keys...)
+
+	var joined []Player
+	for _, k := range members {
+		if contains(keys, k) {
+			continue
+		}
+		if _, ok := s.rooms[k]; ok || k == key {
+			s.Unlock()
+			return nil, fmt.Errorf("cannot add room to a room: %v", k)
+		}
+		p := s.m[k]
+		if p == nil {
+			s.Unlock()
+			return nil, fmt.Errorf("invalid player key: %v", k)
+		}
+		if len(keys) > 0 {
+			joined = append(joined, p)
+		}
+		keys = append(keys, k)
+	}
+
+	st, pos := s.status[keys[0]], s.position(keys[0])
+	room := s.setRoom(key, keys)
+	s.Unlock()
+
+	if st.TrackID == "" {
+		return room, nil
+	}
+	for _, p := range joined {
+		if err := p.SetTime(pos); err != nil {
+			return room, err
+		}
+		if st.Playing {
+			if err := p.Do(ActionPlay); err != nil {
+				return room, err
+			}
+		}
+	}
+	return room, nil
+}
+
+// Ungroup removes the room identified by key.  The members of the room are unaffected.
+func (s *Players) Ungroup(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.rooms[key]; !ok {
+		return fmt.Errorf("invalid room key: %v", key)
+	}
+	delete(s.rooms, key)
+	delete(s.m, key)
+	delete(s.status, key)
+	delete(s.updated, key)
+	return nil
+}
+
+// Members returns the keys of the Players in the room identified by key, or nil if there
+// is no such room.
+func (s *Players) Members(key string) []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return append([]string(nil), s.rooms[key]...)
+}
+
+// setRoom sets the members of the room identified by key, removing it if there are none.
+// Must be called with the lock held.
+func (s *Players) setRoom(key string, members []string) Player {
+	if len(members) == 0 {
+		delete(s.rooms, key)
+		delete(s.m, key)
+		return nil
+	}
+
+	players := make([]Player, len(members))
+	for i, k := range members {
+		players[i] = s.m[k]
+	}
+	room := Multi(key, players...)
+	s.rooms[key] = members
+	s.m[key] = room
+	return room
+}
+
+// position returns the current play position of the Player identified by key, accounting
+// for the time elapsed since its status was last set.  Must be called with the lock held.
+func (s *Players) position(key string) float64 {
+	st := s.status[key]
+	if !st.Playing {
+		return st.Time
+	}
+	return st.Time + time.Since(s.updated[key]).Seconds()
+}
+
+func contains(list []string, x string) bool {
+	for _, y := range list {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
@@ -75,6 +75,59 @@ func (afs artworkFileSystem) Open(ctx context.Context, path string) (http.File,
 	}, nil
 }
 
+// ThumbnailFileSystem wraps another FileSystem assumed to contain only images, which are then
+// resized to fit within size x size and returned in .jpg format.
+func ThumbnailFileSystem(fs FileSystem, size uint) FileSystem {
+	return thumbnailFileSystem{
+		FileSystem: fs,
+		size:       size,
+	}
+}
+
+type thumbnailFileSystem struct {
+	FileSystem
+	size uint
+}
+
+// Open the given path (assumed to contain an image) and then resize to fit within the
+// thumbnail size and return in .jpg format.
+func (tfs thumbnailFileSystem) Open(ctx context.Context, path string) (http.File, error) {
+	f, err := tfs.FileSystem.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	img = resize.Thumbnail(tfs.size, tfs.size, img, resize.Bilinear)
+	buf := &bytes.Buffer{}
+	err = jpeg.Encode(buf, img, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := stat.Name()
+	jpgFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".jpg"
+
+	return &file{
+		ReadSeeker: bytes.NewReader(buf.Bytes()),
+		stat: &fileInfo{
+			name:    jpgFilename,
+			size:    int64(buf.Len()),
+			modTime: stat.ModTime(),
+		},
+	}, nil
+}
+
 // FaviconFileSystem wraps another FileSystem assumed to contain only images, which are then
 // resized to 48px x 48px and returned in .ico format.
 func FaviconFileSystem(fs FileSystem) FileSystem {